@@ -6,8 +6,47 @@
 	"github.com/spf13/cobra"
 	"os"
 	"sin/internal/core"
+	"sin/internal/task"
 )
 
+// sourceTypeAnnotation the annotation key of backup commands, used for deriving the name from source.
+const sourceTypeAnnotation = "sin/sourceType"
+
+// loadConfigOnlyAnnotation the annotation key of commands that only need the config loaded,
+// without logging, directories or the name lock.
+const loadConfigOnlyAnnotation = "sin/loadConfigOnly"
+
+// exactArgsBeforeDash requires exactly n args before the "--" terminator,
+// the args after it are passed through to the dump tool.
+func exactArgsBeforeDash(n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		return cobra.ExactArgs(n)(cmd, argsBeforeDash(cmd, args))
+	}
+}
+
+// rangeArgsBeforeDash like cobra.RangeArgs, but only counts the args before the "--" terminator.
+func rangeArgsBeforeDash(minArgs int, maxArgs int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		return cobra.RangeArgs(minArgs, maxArgs)(cmd, argsBeforeDash(cmd, args))
+	}
+}
+
+// argsBeforeDash return the args before the "--" terminator.
+func argsBeforeDash(cmd *cobra.Command, args []string) []string {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		return args[:dash]
+	}
+	return args
+}
+
+// argsAfterDash return the args after the "--" terminator.
+func argsAfterDash(cmd *cobra.Command, args []string) []string {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		return args[dash:]
+	}
+	return nil
+}
+
 type CLI struct {
 	command *cobra.Command
 }
@@ -20,32 +59,66 @@ func NewCLI(app *core.App) *CLI {
 	command := cobra.Command{
 		Use:   "sin",
 		Short: "Backup tools",
-		PersistentPreRun: func(_ *cobra.Command, _ []string) {
-			err := app.Init(flags)
-			if err != nil {
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if sourceType, ok := cmd.Annotations[sourceTypeAnnotation]; ok && len(args) > 0 {
+				flags.SourceName = task.DeriveSourceName(sourceType, args[0])
+			}
+			initApp := app.Init
+			if printNameFormat(cmd) != "" || cmd.Annotations[loadConfigOnlyAnnotation] == "true" {
+				// Printing the name or validating the config must not have any side effects.
+				initApp = app.LoadConfig
+			}
+			if err := initApp(flags); err != nil {
 				pterm.Error.Printf("Error initializing: %s\n", err)
-				app.MustClose()
-				os.Exit(1)
+				exitWithError(app, err)
 			}
 		},
 	}
 
 	command.PersistentFlags().SortFlags = false
 	command.Flags().SortFlags = false
-	command.PersistentFlags().StringVarP(&flags.ConfigFile, "config", "c", flags.ConfigFile, "specify config file")
+	command.PersistentFlags().StringArrayVarP(&flags.ConfigFiles, "config", "c", flags.ConfigFiles, "specify config file or directory, can be specified multiple times to merge in order")
 	command.PersistentFlags().StringVar(&flags.Name, "name", flags.Name, "name of output backup and log file")
-	command.PersistentFlags().BoolVar(&flags.EnableFailFast, "ff", flags.EnableFailFast, "enable fail-fast mode")
+	command.PersistentFlags().BoolVar(&flags.FailFast, "ff", flags.FailFast, "enable fail-fast mode")
 	command.PersistentFlags().IntVar(&flags.Keep, "keep", flags.Keep, "number of local backups to keep")
-	command.PersistentFlags().BoolVar(&flags.EnableAutomaticEnv, "env", flags.EnableAutomaticEnv, "(experimental) enable automatic environment binding")
-	command.PersistentFlags().BoolVar(&flags.EnableLocalMode, "local", flags.EnableLocalMode, "(local mode) create backup in current directory without syncing")
+	command.PersistentFlags().IntVar(&flags.LocalKeep, "local-keep", flags.LocalKeep, "number of kept local backups (keepTempFile or local mode) to keep, independent of --keep")
+	command.PersistentFlags().BoolVar(&flags.AutomaticEnv, "env", flags.AutomaticEnv, "(experimental) enable automatic environment binding")
+	command.PersistentFlags().BoolVar(&flags.LocalMode, "local", flags.LocalMode, "(local mode) create backup in current directory without syncing")
+	command.PersistentFlags().BoolVar(&flags.StdoutMode, "stdout", flags.StdoutMode, "(stdout mode) write backup to stdout instead of targets, other output is written to stderr")
+	command.PersistentFlags().BoolVar(&flags.StdoutWithTargets, "stdout-with-targets", flags.StdoutWithTargets, "also sync backup to the enabled targets in stdout mode")
+	command.PersistentFlags().StringVar(&flags.StdoutChecksumFile, "stdout-checksum-file", flags.StdoutChecksumFile, "write the checksum of backup to the file in stdout mode, default printed to stderr")
+	command.PersistentFlags().BoolVar(&flags.RequireTargets, "require-targets", flags.RequireTargets, "fail if there are no enabled downloadable targets, ignored in local mode")
+	command.PersistentFlags().BoolVar(&flags.PingTargets, "ping-targets", flags.PingTargets, "check that every enabled target can be reached when starting")
+	command.PersistentFlags().BoolVar(&flags.DryRun, "dry-run", flags.DryRun, "only print what would be synced, deleted or moved on targets")
+	command.PersistentFlags().BoolVar(&flags.DeriveName, "derive-name", flags.DeriveName, "derive the name from backup source if name is not specified")
+	command.PersistentFlags().StringVar(&flags.InstanceLabel, "instance-label", flags.InstanceLabel, "suffix the name (<name>-<label>) to run multiple instances sharing a config")
+	command.PersistentFlags().StringVar(&flags.LogOutput, "log-output", flags.LogOutput, "where json logs are written: file, stdout, stderr or none, comma separated for multiple outputs (default file)")
+	command.PersistentFlags().StringVar(&flags.LockDir, "lock-dir", flags.LockDir, "directory of the name lock file, default to os temp directory")
+	command.PersistentFlags().BoolVar(&flags.SentryPing, "sentry-ping", flags.SentryPing, "send a test event to sentry at startup and fail if it cannot be sent")
+	command.PersistentFlags().IntVar(&flags.ChecksumWorkers, "checksum-workers", flags.ChecksumWorkers, "number of files to hash concurrently when verifying backups, default GOMAXPROCS capped at 8")
+	command.PersistentFlags().StringVar(&flags.Progress, "progress", flags.Progress, "display progress of syncing and pulling: auto, bar, log or none (default none)")
+	command.PersistentFlags().BoolVar(&flags.JSONOutput, "json", flags.JSONOutput, "print the result of each backup run to stdout as a json object, other output is written to stderr")
+	command.PersistentFlags().BoolVar(&flags.CleanTempOnExit, "clean-temp-on-exit", flags.CleanTempOnExit, "remove leftover temp files created by this run on exit, such as incomplete or errored backups")
 	command.PersistentFlags().BoolVar(&flags.NoMkdir, "no-mkdir", flags.NoMkdir, "does not create local backup directory if it not exist")
 
 	command.AddCommand(NewListCmd(app))
 	command.AddCommand(NewPullCmd(app))
+	command.AddCommand(NewCompactCmd(app))
+	command.AddCommand(NewPruneCmd(app))
+	command.AddCommand(NewMoveCmd(app))
+	command.AddCommand(NewRestoreCmd(app))
+	command.AddCommand(NewExtractCmd(app))
+	command.AddCommand(NewLsCmd(app))
+	command.AddCommand(NewVerifyCmd(app))
+	command.AddCommand(NewConfigCmd(app))
+	command.AddCommand(NewKeygenCmd(app))
+	command.AddCommand(NewHealthcheckCmd(app))
 
 	command.AddCommand(NewFileCmd(app))
 	command.AddCommand(NewMongoCmd(app))
 	command.AddCommand(NewPGCmd(app))
+	command.AddCommand(NewPGRestoreCmd(app))
+	command.AddCommand(NewMongoRestoreCmd(app))
 	return &CLI{
 		command: &command,
 	}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"github.com/spf13/pflag"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/task"
+	"strings"
+	"testing"
+)
+
+// initFlags runs the persistent pre-run of the root command with the flags, return the initialized app after closing it.
+// The app is only initialized using App.LoadConfig unless init is set, as App.Init also setups logging and the name lock.
+func initFlags(t *testing.T, init bool, args ...string) *core.App {
+	t.Helper()
+	app := &core.App{}
+	cli := NewCLI(app)
+	cli.command.Annotations = map[string]string{sourceTypeAnnotation: task.SourceTypeFile}
+	if !init {
+		cli.command.Annotations[loadConfigOnlyAnnotation] = "true"
+	}
+	if err := cli.command.ParseFlags(args); err != nil {
+		t.Fatalf("ParseFlags(%v) error = %s", args, err)
+	}
+	cli.command.PersistentPreRun(cli.command, []string{"/data/mydb.sql"})
+	if err := app.Close(); err != nil {
+		t.Errorf("Close() error = %s", err)
+	}
+	return app
+}
+
+func TestPersistentFlags(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{"backupTempDir": "`+backupDir+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	override := filepath.Join(dir, "override.json")
+	if err := os.WriteFile(override, []byte(`{"keep": 5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lockDir := t.TempDir()
+
+	tests := []struct {
+		flag string
+		args []string
+		// noConfig does not specify the config file with the flag.
+		noConfig bool
+		// init initializes the app using App.Init, with the lock and log output flags.
+		init bool
+		env  map[string]string
+		// changed whether the flag changed the app.
+		changed func(app *core.App) bool
+	}{
+		{flag: "config", args: []string{"--config", override}, changed: func(app *core.App) bool { return app.Keep == 5 }},
+		{flag: "name", args: []string{"--name", "flag"}, changed: func(app *core.App) bool { return app.Name == "flag" }},
+		{flag: "ff", args: []string{"--ff"}, changed: func(app *core.App) bool { return app.FailFast }},
+		{flag: "keep", args: []string{"--keep", "3"}, changed: func(app *core.App) bool { return app.Keep == 3 }},
+		{flag: "local-keep", args: []string{"--local-keep", "2"}, changed: func(app *core.App) bool { return app.LocalKeep == 2 }},
+		{flag: "local", args: []string{"--local"}, noConfig: true, changed: func(app *core.App) bool { return app.LocalMode() }},
+		{flag: "stdout", args: []string{"--stdout"}, changed: func(app *core.App) bool { return app.StdoutMode() }},
+		{flag: "stdout-with-targets", args: []string{"--stdout", "--stdout-with-targets"}, changed: func(app *core.App) bool { return app.StdoutWithTargets() }},
+		{flag: "stdout-checksum-file", args: []string{"--stdout", "--stdout-checksum-file", "sum.txt"}, changed: func(app *core.App) bool { return app.StdoutChecksumFile() == "sum.txt" }},
+		{flag: "require-targets", args: []string{"--require-targets"}, changed: func(app *core.App) bool { return app.RequireTargets }},
+		{flag: "ping-targets", args: []string{"--ping-targets"}, changed: func(app *core.App) bool { return app.PingTargets }},
+		{flag: "dry-run", args: []string{"--dry-run"}, changed: func(app *core.App) bool { return app.DryRun }},
+		{flag: "derive-name", args: []string{"--derive-name"}, changed: func(app *core.App) bool { return app.Name == "mydb" }},
+		{flag: "instance-label", args: []string{"--instance-label", "b"}, changed: func(app *core.App) bool { return strings.HasSuffix(app.Name, "-b") }},
+		{flag: "log-output", args: []string{"--log-output", "none"}, changed: func(app *core.App) bool { return app.LogOutput == "none" }},
+		{flag: "lock-dir", args: []string{"--lock-dir", lockDir}, changed: func(app *core.App) bool { return app.LockDir == lockDir }},
+		{flag: "sentry-ping", args: []string{"--sentry-ping"}, changed: func(app *core.App) bool { return app.SentryPing }},
+		{flag: "checksum-workers", args: []string{"--checksum-workers", "3"}, changed: func(app *core.App) bool { return app.ChecksumWorkers == 3 }},
+		{flag: "progress", args: []string{"--progress", "log"}, changed: func(app *core.App) bool { return app.Progress == "log" }},
+		{flag: "json", args: []string{"--json"}, changed: func(app *core.App) bool { return app.JSONOutput() }},
+		{flag: "clean-temp-on-exit", args: []string{"--clean-temp-on-exit"}, changed: func(app *core.App) bool { return app.CleanTempOnExit }},
+		{
+			flag: "no-mkdir", args: []string{"--no-mkdir"}, init: true,
+			changed: func(app *core.App) bool {
+				_, err := os.Stat(backupDir)
+				return os.IsNotExist(err)
+			},
+		},
+		// Automatic env binding is global, so it must be the last.
+		{
+			flag: "env", args: []string{"--env"}, env: map[string]string{"NAME": "env"},
+			changed: func(app *core.App) bool { return app.Name == "env" },
+		},
+	}
+
+	tested := make(map[string]bool, len(tests))
+	for _, tt := range tests {
+		tested[tt.flag] = true
+	}
+	NewCLI(&core.App{}).command.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if !tested[f.Name] {
+			t.Errorf("persistent flag --%s is not tested", f.Name)
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			var args []string
+			if tt.init {
+				args = append(args, "--lock-dir", lockDir, "--log-output", "none")
+			}
+			if changed := tt.changed(initFlags(t, tt.init, append(args, "--config", config)...)); changed {
+				t.Fatalf("app is changed without --%s", tt.flag)
+			}
+			if tt.init {
+				// Remove the directory created without the flag.
+				if err := os.Remove(backupDir); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tt.noConfig {
+				args = append(args, "--config", config)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if changed := tt.changed(initFlags(t, tt.init, append(args, tt.args...)...)); !changed {
+				t.Errorf("app is not changed by --%s", tt.flag)
+			}
+		})
+	}
+}
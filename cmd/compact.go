@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/store"
+)
+
+func NewCompactCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "compact",
+		Args:  cobra.NoArgs,
+		Short: "Delete old local backups according to keep/retention config",
+		Run: func(cmd *cobra.Command, args []string) {
+			if app.Keep < 1 && !app.Retention.Enabled() {
+				err := errors.New("keep or retention must be specified to compact local backups")
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+			syncher, err := store.NewSyncer(app)
+			if err != nil {
+				pterm.Error.Println("Error initialize syncer:", err)
+				exitWithError(app, err)
+				return
+			}
+
+			extension := lo.Must(cmd.Flags().GetString("ext"))
+			destFileName := app.Name
+			switch extension {
+			case "*":
+				destFileName += "(.\\w+)*"
+			case "+":
+				destFileName += "(.\\w+)+"
+			case "":
+				// no-op.
+			default:
+				destFileName += "." + extension
+			}
+			destFileName += core.BackupFileExt
+			tags := lo.Must(cmd.Flags().GetStringSlice("tag"))
+
+			if err := syncher.CompactLocal(destFileName, tags); err != nil {
+				pterm.Error.Println(err)
+				slog.Error("Error compacting local", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+			}
+		},
+	}
+	command.Flags().StringP("ext", "e", "*", "specify the extension of local backup file (without dot)")
+	command.Flags().StringSlice("tag", nil, "only include backups having all the specified tags")
+	return &command
+}
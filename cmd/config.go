@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"sin/internal/core"
+	"sin/internal/store"
+	"strings"
+)
+
+func NewConfigCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "config",
+		Short: "Config utilities",
+	}
+	command.AddCommand(NewConfigValidateCmd(app))
+	return &command
+}
+
+func NewConfigValidateCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:         "validate",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{loadConfigOnlyAnnotation: "true"},
+		Short:       "Validate the config and every target, reporting all problems found",
+		Run: func(_ *cobra.Command, _ []string) {
+			results := store.ValidateTargets(app)
+			if len(results) == 0 {
+				pterm.Warning.Println("No targets configured")
+			}
+
+			failed, warnings := 0, 0
+			for _, result := range results {
+				label := result.Name
+				if label == "" {
+					label = "<unnamed>"
+				}
+				if result.Type != "" {
+					label += " (" + result.Type + ")"
+				}
+				if result.Err != nil {
+					failed++
+					pterm.Error.Println(label, result.Err)
+				} else {
+					pterm.Success.Println(label)
+				}
+				if result.Disabled {
+					warnings++
+					pterm.Warning.Println(label, "is disabled, it will be skipped")
+				}
+				if len(result.UnknownKeys) > 0 {
+					warnings++
+					pterm.Warning.Println(label, "has unknown keys:", strings.Join(result.UnknownKeys, ", "))
+				}
+			}
+			pterm.Println(len(results), "targets,", failed, "invalid,", warnings, "warnings")
+			if failed > 0 {
+				exitWithError(app, errors.Newf("%d targets are invalid", failed))
+			}
+		},
+	}
+	return &command
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"github.com/aws/smithy-go"
+	"github.com/mawngo/go-errors"
+	"log/slog"
+	"net"
+	"os"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/task"
+	"sin/internal/utils"
+	"syscall"
+)
+
+// Category machine-readable category of a failure.
+type Category string
+
+const (
+	CategoryUnknown    Category = "unknown"
+	CategoryNetwork    Category = "network"
+	CategoryAuth       Category = "auth"
+	CategoryDiskFull   Category = "disk-full"
+	CategoryDumpFailed Category = "dump-failed"
+	CategoryChecksum   Category = "checksum"
+	CategoryLocked     Category = "locked"
+	CategoryNoTargets  Category = "no-targets"
+	CategoryTooLarge   Category = "too-large"
+)
+
+// exitCodes exit code of each category.
+// Exit code 2 is not used, as it is commonly used for invalid usage.
+var exitCodes = map[Category]int{
+	CategoryUnknown:    1,
+	CategoryNetwork:    3,
+	CategoryAuth:       4,
+	CategoryDiskFull:   5,
+	CategoryDumpFailed: 6,
+	CategoryChecksum:   7,
+	CategoryLocked:     8,
+	CategoryNoTargets:  9,
+	CategoryTooLarge:   10,
+}
+
+// authErrorCodes s3 error codes that indicate invalid credentials or permissions.
+var authErrorCodes = map[string]struct{}{
+	"AccessDenied":          {},
+	"InvalidAccessKeyId":    {},
+	"SignatureDoesNotMatch": {},
+	"ExpiredToken":          {},
+	"InvalidToken":          {},
+}
+
+// ErrorCategory derive the category of the error by inspecting the error chain.
+func ErrorCategory(err error) Category {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, core.ErrLocked):
+		return CategoryLocked
+	case errors.Is(err, store.ErrNoTargets):
+		return CategoryNoTargets
+	case errors.Is(err, store.ErrUploadTooLarge):
+		return CategoryTooLarge
+	case errors.Is(err, utils.ErrChecksumMismatch):
+		return CategoryChecksum
+	case errors.Is(err, task.ErrDumpFailed), errors.Is(err, task.ErrBackupTooSmall):
+		return CategoryDumpFailed
+	case errors.Is(err, syscall.ENOSPC):
+		return CategoryDiskFull
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if _, ok := authErrorCodes[apiErr.ErrorCode()]; ok {
+			return CategoryAuth
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return CategoryNetwork
+	}
+	return CategoryUnknown
+}
+
+// ExitCode return the exit code of the error, based on its category.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCodes[ErrorCategory(err)]
+}
+
+// exitWithError closes the app and exit with the exit code of the error.
+// Does nothing if the error is nil.
+func exitWithError(app *core.App, err error) {
+	if err == nil {
+		return
+	}
+	category := ErrorCategory(err)
+	code := exitCodes[category]
+	slog.Error("Exit with error",
+		slog.String("name", app.Name),
+		slog.String("category", string(category)),
+		slog.Int("code", code),
+		slog.Any("err", err))
+	app.MustClose()
+	os.Exit(code)
+}
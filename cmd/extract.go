@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/task"
+	"sin/internal/utils"
+)
+
+func NewExtractCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "extract <backup> <path in archive> <destination>",
+		Args:  cobra.ExactArgs(3),
+		Short: "Extract a file or directory from a zip/tar backup",
+		Run: func(cmd *cobra.Command, args []string) {
+			target := lo.Must(cmd.Flags().GetString("target"))
+			backup, cleanup, err := openBackup(app, target, args[0])
+			if err != nil {
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+			defer cleanup()
+
+			if err := task.ExtractArchive(app.Ctx, backup, args[1], args[2]); err != nil {
+				cleanup()
+				pterm.Error.Println(err)
+				slog.Error("Error extracting", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+				return
+			}
+			pterm.Success.Println("Extracted", args[1], "to", args[2])
+		},
+	}
+	command.Flags().String("target", "", "download the backup from the target instead of reading local file")
+	return &command
+}
+
+func NewLsCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "ls <backup>",
+		Args:  cobra.ExactArgs(1),
+		Short: "List files inside a zip/tar backup",
+		Run: func(cmd *cobra.Command, args []string) {
+			target := lo.Must(cmd.Flags().GetString("target"))
+			backup, cleanup, err := openBackup(app, target, args[0])
+			if err != nil {
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+			defer cleanup()
+
+			entries, err := task.ListArchive(backup)
+			if err != nil {
+				cleanup()
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+
+			if lo.Must(cmd.Flags().GetBool("json")) {
+				b, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					cleanup()
+					exitWithError(app, err)
+					return
+				}
+				// Print to stdout directly, so the output can be piped.
+				fmt.Println(string(b))
+				return
+			}
+
+			total := int64(0)
+			data := pterm.TableData{{"Size", "Name"}}
+			for _, entry := range entries {
+				size := ""
+				if !entry.IsDir {
+					size = utils.FormatBytes(entry.Size)
+					total += entry.Size
+				}
+				data = append(data, []string{size, entry.Name})
+			}
+			if err := pterm.DefaultTable.WithHasHeader().WithData(data).Render(); err != nil {
+				pterm.Error.Println(err)
+			}
+			pterm.Println(len(entries), "entries, total", utils.FormatBytes(total))
+		},
+	}
+	command.Flags().String("target", "", "download the backup from the target instead of reading local file")
+	command.Flags().Bool("json", false, "print the entries as json")
+	return &command
+}
+
+// openBackup return the local path of the backup after verifying its checksum.
+// If target is specified, the backup is downloaded from the target into a temporary directory,
+// which is removed by the cleanup function. An empty backup downloads the latest backup of the app name.
+func openBackup(app *core.App, target string, backup string) (string, func(), error) {
+	if target == "" {
+		if err := utils.VerifyFileChecksum(backup); err != nil {
+			return "", nil, errors.Wrapf(err, "error verifying backup %s", backup)
+		}
+		if _, encryption := utils.DecryptedFileName(backup); encryption != "" {
+			return "", nil, errors.Newf("backup %s is encrypted, use --target to download and decrypt it", backup)
+		}
+		return backup, func() {}, nil
+	}
+
+	syncer, err := store.NewSyncer(app)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error initialize syncer")
+	}
+	dir, err := os.MkdirTemp(app.BackupTempDir, ".sin-"+app.Name+"-")
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error creating temp directory")
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	if err := syncer.Restore(app.Ctx, target, backup, app.Name+"(.\\w+)*"+core.BackupFileExt, nil, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	restored, err := restoredBackup(dir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if _, encryption := utils.DecryptedFileName(restored); encryption != "" {
+		// Not decrypted as the key is not configured.
+		cleanup()
+		return "", nil, errors.Newf("cannot decrypt backup %s, encryption key is not configured", restored)
+	}
+	return filepath.Join(dir, restored), cleanup, nil
+}
+
+// restoredBackup return the name of the backup restored into the directory, ignoring its checksum file.
+func restoredBackup(dir string) (string, error) {
+	names, err := utils.ListFileNames(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "error listing %s", dir)
+	}
+	for _, name := range names {
+		if !utils.IsChecksumFile(name) {
+			return name, nil
+		}
+	}
+	return "", errors.Newf("no backup restored into %s", dir)
+}
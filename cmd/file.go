@@ -10,37 +10,63 @@
 )
 
 func NewFileCmd(app *core.App) *cobra.Command {
+	flags := task.SyncFileConfig{}
+
 	command := cobra.Command{
-		Use:   "file <path>",
-		Args:  cobra.ExactArgs(1),
-		Short: "Run backup for file/directory",
-		Run: func(_ *cobra.Command, args []string) {
+		Use:         "file <path/->",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{sourceTypeAnnotation: task.SourceTypeFile},
+		Short:       "Run backup for file/directory, or stdin if path is '-'",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.SourcePath = args[0]
+			if format := printNameFormat(cmd); format != "" {
+				printBackupName(app, format, func() (task.SyncTask, error) {
+					return task.NewSyncFile(app, nil, flags)
+				})
+				return
+			}
+
 			syncer, err := store.NewSyncer(app)
 			if err != nil {
 				pterm.Error.Println("Error initialize syncer:", err)
 				slog.Error("Fatal error initialize syncer",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
-			flags := task.SyncFileConfig{
-				SourcePath: args[0],
-			}
 			syncTask, err := task.NewSyncFile(app, syncer, flags)
 			if err != nil {
 				pterm.Error.Println("Error initialize file task:", err)
 				slog.Error("Fatal error initialize file task",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
-			if err := core.Run(app.Ctx, app.Config.Frequency, syncTask.ExecSync); err != nil {
+			if err := core.Run(app.Ctx, app.Config.Frequency, withLoadCheck(app, withNotify(app, syncer, task.SourceTypeFile, withSummary(app, syncer, task.SourceTypeFile, withHooks(app, syncer, withRedump(app, syncTask.ExecSync)))))); err != nil {
 				pterm.Error.Println(err)
 				slog.Error("Fatal error running", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
 			}
 		},
 	}
+	command.Flags().StringSliceVar(&flags.Tags, "tag", flags.Tags, "tag of the backup, can be specified multiple times")
+	command.Flags().StringVar(&flags.ArchiveRoot, "archive-root", flags.ArchiveRoot, "structure of directory backup: include-parent, contents-only, or a custom prefix path")
+	command.Flags().StringArrayVar(&flags.Exclude, "exclude", flags.Exclude, "glob pattern of paths to skip in directory backup, a trailing '/' matches directories, can be specified multiple times")
+	command.Flags().StringArrayVar(&flags.Include, "include", flags.Include, "glob pattern of paths to keep in directory backup, keep all if not specified, can be specified multiple times")
+	command.Flags().BoolVar(&flags.FollowSymlinks, "follow-symlinks", flags.FollowSymlinks, "archive the contents of symlink targets in directory backup, instead of storing symlinks")
+	command.Flags().StringVar(&flags.Ext, "ext", flags.Ext, "extension of the backup read from stdin (path '-'), e.g. sql")
+	command.Flags().StringVar(&flags.CompressCmd, "compress-cmd", flags.CompressCmd, "external compression command (pigz, lz4, zstd, ...) to compress the backup")
+	command.Flags().BoolVar(&flags.AutoCompress, "auto-compress", flags.AutoCompress, "only keep the backup compressed if it is large and compressible enough, used with --compress-cmd")
+	command.Flags().Int64Var(&flags.AutoCompressMinSize, "auto-compress-min-size", flags.AutoCompressMinSize, "minimum backup size in bytes to compress, used with --auto-compress")
+	command.Flags().Float64Var(&flags.AutoCompressMaxRatio, "auto-compress-max-ratio", flags.AutoCompressMaxRatio, "maximum compressed/original size ratio to keep the compressed backup, used with --auto-compress (default 0.9)")
+	command.Flags().StringVar(&flags.SourceChecksum, "source-checksum", flags.SourceChecksum, "precomputed checksum of the source file or stdin (in checksumAlgo), used instead of hashing the backup")
+	command.Flags().StringVar(&flags.SourceChecksumFile, "source-checksum-file", flags.SourceChecksumFile, "file containing the precomputed checksum of the source (e.g. sha256sum output), read on each backup")
+	command.Flags().BoolVar(&flags.VerifySourceChecksum, "verify-source-checksum", flags.VerifySourceChecksum, "verify the precomputed checksum once while creating the local backup, failing on mismatch")
+	command.Flags().Int64Var(&flags.MinBackupBytes, "min-backup-bytes", flags.MinBackupBytes, "fail if the created backup is smaller than the given bytes, overriding minBackupBytes in config")
+	addPrintNameFlag(&command)
 	return &command
 }
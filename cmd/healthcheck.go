@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/utils"
+	"strconv"
+	"time"
+)
+
+func NewHealthcheckCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:         "healthcheck",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{loadConfigOnlyAnnotation: "true"},
+		Short:       "Check that the instance running under the name is healthy, for liveness/readiness probes",
+		Long: "Check that the name lock file is held by a running process, the backup temp dir is writable, " +
+			"and every enabled target can be reached. Exit with code 0 only if all checks pass.",
+		Run: func(cmd *cobra.Command, _ []string) {
+			data := pterm.TableData{{"Check", "Status", "Detail"}}
+			failed := 0
+			addCheck := func(check string, detail string, err error) {
+				status := pterm.Green("ok")
+				if err != nil {
+					failed++
+					status = pterm.Red("failed")
+					detail = err.Error()
+				}
+				data = append(data, []string{check, status, detail})
+			}
+
+			if !lo.Must(cmd.Flags().GetBool("skip-lock")) {
+				pid, err := app.CheckNameLock()
+				detail := "held by pid " + strconv.Itoa(pid)
+				if pid == 0 {
+					detail = "held by unknown pid"
+				}
+				addCheck("lock", detail, err)
+			}
+			addCheck("temp dir", app.BackupTempDir+" is writable", utils.CheckDirWritable(app.BackupTempDir))
+
+			syncer, err := store.NewSyncer(app)
+			if err != nil {
+				addCheck("targets", "", err)
+			} else {
+				timeout := lo.Must(cmd.Flags().GetDuration("timeout"))
+				ctx, cancel := context.WithTimeout(app.Ctx, timeout)
+				defer cancel()
+				for _, result := range syncer.PingEach(ctx) {
+					check := "target " + result.Target + " (" + result.Type + ")"
+					if !result.Supported {
+						data = append(data, []string{check, pterm.Yellow("skipped"), "connectivity check not supported"})
+						continue
+					}
+					addCheck(check, "reachable, took "+result.Duration.Round(time.Millisecond).String(), result.Err)
+				}
+			}
+
+			if err := pterm.DefaultTable.WithHasHeader().WithData(data).Render(); err != nil {
+				pterm.Error.Println(err)
+			}
+			if failed > 0 {
+				exitWithError(app, errors.Newf("%d health checks failed", failed))
+			}
+		},
+	}
+	command.Flags().Bool("skip-lock", false, "skip checking the name lock, for checking the config of one-off runs")
+	command.Flags().Duration("timeout", 10*time.Second, "timeout of reaching the targets")
+	return &command
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/store"
+)
+
+// withHooks runs the pre hook before exec, aborting if it fails,
+// then runs the post hook with the result of exec, only warning if it fails.
+func withHooks(app *core.App, syncer *store.Syncer, exec func() error) func() error {
+	if app.PreHook == nil && app.PostHook == nil {
+		return exec
+	}
+	return func() error {
+		// Discard the report of the previous run, if not taken by notifications.
+		syncer.TakeReport()
+		if err := app.RunHook("pre", app.PreHook, nil); err != nil {
+			return errors.Wrapf(err, "backup aborted")
+		}
+		err := exec()
+		env := []string{"SIN_STATUS=success", "SIN_ERROR="}
+		if err != nil {
+			env = []string{"SIN_STATUS=failure", "SIN_ERROR=" + err.Error()}
+		}
+		if report := syncer.Report(); report != nil {
+			// Streamed backups have no local path.
+			source := report.Source
+			if source != "" {
+				source, _ = filepath.Abs(source)
+			}
+			env = append(env, "SIN_BACKUP="+report.Backup, "SIN_BACKUP_PATH="+source)
+		}
+		if herr := app.RunHook("post", app.PostHook, env); herr != nil {
+			pterm.Warning.Println(herr)
+			slog.Warn("Error running post hook", slog.String("name", app.Name), slog.Any("err", herr))
+		}
+		return err
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"sin/internal/core"
+)
+
+func NewKeygenCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "keygen [key file]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Generate an Ed25519 key pair for signing backups",
+		Long: "Generate an Ed25519 private key (PEM, PKCS #8) into the key file and its public key into <key file>.pub. " +
+			"Configure the private key as signing.keyFile on the machine creating backups, " +
+			"and the public key as signing.publicKeyFile where backups are restored or verified. Existing files are never overwritten.",
+		// Generating keys does not need any config, overriding the app initialization of the root command.
+		PersistentPreRun: func(*cobra.Command, []string) {},
+		Run: func(_ *cobra.Command, args []string) {
+			if err := core.GenerateSigningKey(args[0]); err != nil {
+				pterm.Error.Println("Error generating signing key:", err)
+				exitWithError(app, err)
+				return
+			}
+			pterm.Success.Println("Generated signing key", args[0], "and public key", args[0]+core.PublicKeyExt)
+		},
+	}
+	return &command
+}
@@ -17,6 +17,7 @@ func NewListCmd(app *core.App) *cobra.Command {
 			syncher, err := store.NewSyncer(app)
 			if err != nil {
 				pterm.Error.Println("Error initialize syncer:", err)
+				exitWithError(app, err)
 				return
 			}
 
@@ -24,22 +25,32 @@ func NewListCmd(app *core.App) *cobra.Command {
 			destFileName := app.Name
 			switch extension {
 			case "*":
-				destFileName += "(.\\w+)?"
+				destFileName += "(.\\w+)*"
 			case "+":
-				destFileName += ".\\w+"
+				destFileName += "(.\\w+)+"
 			case "":
 				// no-op.
 			default:
 				destFileName += "." + extension
 			}
 			destFileName += core.BackupFileExt
-
-			err = syncher.List(app.Ctx, destFileName, args...)
+			opts := store.ListOptions{
+				Tags:      lo.Must(cmd.Flags().GetStringSlice("tag")),
+				WarnEmpty: !lo.Must(cmd.Flags().GetBool("no-empty-warning")),
+				SizeTotal: lo.Must(cmd.Flags().GetBool("size-total")),
+				JSON:      lo.Must(cmd.Flags().GetBool("json")),
+			}
+			err = syncher.List(app.Ctx, destFileName, opts, args...)
 			if err != nil {
 				pterm.Error.Println(err)
+				exitWithError(app, err)
 			}
 		},
 	}
 	command.Flags().StringP("ext", "e", "*", "specify the extension of target file (without dot)")
+	command.Flags().StringSlice("tag", nil, "only include backups having all the specified tags")
+	command.Flags().Bool("no-empty-warning", false, "do not warn about targets having no backups")
+	command.Flags().Bool("size-total", false, "print the number and total size of backups of each target and all targets")
+	command.Flags().Bool("json", false, "print the backups of each target as json")
 	return &command
 }
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"sin/internal/core"
+)
+
+// withLoadCheck skips the backup run if the system is too busy, see core.App.WaitForIdle.
+// The skipped run is retried on the next schedule, if any.
+func withLoadCheck(app *core.App, exec func() error) func() error {
+	if app.MaxLoadAvg <= 0 && app.LoadCheck == nil {
+		return exec
+	}
+	return func() error {
+		idle, err := app.WaitForIdle()
+		if err != nil || !idle {
+			return err
+		}
+		return exec()
+	}
+}
@@ -16,36 +16,53 @@ func NewMongoCmd(app *core.App) *cobra.Command {
 	}
 
 	command := cobra.Command{
-		Use:   "mongo <uri/file>",
-		Args:  cobra.ExactArgs(1),
-		Short: "Run backup for mongo using mongodump",
-		Run: func(_ *cobra.Command, args []string) {
+		Use:         "mongo <uri/file> [-- mongodump args...]",
+		Args:        exactArgsBeforeDash(1),
+		Annotations: map[string]string{sourceTypeAnnotation: task.SourceTypeMongo},
+		Short:       "Run backup for mongo using mongodump",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.URI = args[0]
+			flags.DumpArgs = argsAfterDash(cmd, args)
+			if format := printNameFormat(cmd); format != "" {
+				printBackupName(app, format, func() (task.SyncTask, error) {
+					return task.NewSyncMongo(app, nil, flags)
+				})
+				return
+			}
+
 			syncer, err := store.NewSyncer(app)
 			if err != nil {
 				pterm.Error.Println("Error initialize syncer:", err)
 				slog.Error("Fatal error initialize syncer",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
-			flags.URI = args[0]
 			syncTask, err := task.NewSyncMongo(app, syncer, flags)
 			if err != nil {
 				pterm.Error.Println("Error initialize mongo task:", err)
 				slog.Error("Fatal error initialize mongo task",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
-			if err := core.Run(app.Ctx, app.Config.Frequency, syncTask.ExecSync); err != nil {
+			if err := core.Run(app.Ctx, app.Config.Frequency, withLoadCheck(app, withNotify(app, syncer, task.SourceTypeMongo, withSummary(app, syncer, task.SourceTypeMongo, withHooks(app, syncer, withRedump(app, syncTask.ExecSync)))))); err != nil {
 				pterm.Error.Println(err)
 				slog.Error("Fatal error running", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
 			}
 		},
 	}
 	command.Flags().StringVar(&flags.MongodumpPath, "mongodump", flags.MongodumpPath, "mongodump command/binary location")
 	command.Flags().BoolVar(&flags.EnableGzip, "gzip", flags.EnableGzip, "enable gzip compression")
+	command.Flags().StringSliceVar(&flags.Tags, "tag", flags.Tags, "tag of the backup, can be specified multiple times")
+	command.Flags().StringVar(&flags.CompressCmd, "compress-cmd", flags.CompressCmd, "external compression command (pigz, lz4, zstd, ...) to compress the backup")
+	command.Flags().BoolVar(&flags.Stream, "stream", flags.Stream, "stream the mongodump output to the targets without creating a local backup")
+	command.Flags().Int64Var(&flags.MinBackupBytes, "min-backup-bytes", flags.MinBackupBytes, "fail if the created backup is smaller than the given bytes, overriding minBackupBytes in config")
+	addPrintNameFlag(&command)
 	return &command
 }
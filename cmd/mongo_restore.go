@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/task"
+)
+
+func NewMongoRestoreCmd(app *core.App) *cobra.Command {
+	flags := task.RestoreMongoConfig{
+		MongorestorePath: "mongorestore",
+	}
+
+	command := cobra.Command{
+		Use:   "mongo-restore <backup?> <uri/file> [-- mongorestore args...]",
+		Args:  rangeArgsBeforeDash(1, 2),
+		Short: "Restore a mongo backup using mongorestore",
+		Run: func(cmd *cobra.Command, args []string) {
+			target := lo.Must(cmd.Flags().GetString("target"))
+			latest := lo.Must(cmd.Flags().GetBool("latest"))
+			positional := argsBeforeDash(cmd, args)
+			if latest && (target == "" || len(positional) != 1) {
+				pterm.Error.Println("Must specify --target and not specify backup when using --latest")
+				return
+			}
+			if !latest && len(positional) != 2 {
+				pterm.Error.Println("Must specify backup, or use --latest")
+				return
+			}
+
+			backup := ""
+			if !latest {
+				backup = positional[0]
+			}
+			backup, cleanup, err := openBackup(app, target, backup)
+			if err != nil {
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+			defer cleanup()
+
+			flags.URI = positional[len(positional)-1]
+			flags.RestoreArgs = argsAfterDash(cmd, args)
+			if err := task.RestoreMongo(app, backup, flags); err != nil {
+				cleanup()
+				pterm.Error.Println(err)
+				slog.Error("Error restoring", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+				return
+			}
+		},
+	}
+	command.Flags().String("target", "", "download the backup from the target instead of reading local file")
+	command.Flags().Bool("latest", false, "download the latest backup of --name from the target instead of the specified backup")
+	command.Flags().StringVar(&flags.MongorestorePath, "mongorestore", flags.MongorestorePath, "mongorestore command/binary location")
+	command.Flags().BoolVar(&flags.Drop, "drop", flags.Drop, "drop each collection before restoring it")
+	command.Flags().StringSliceVar(&flags.NSInclude, "nsInclude", flags.NSInclude, "namespace (db.collection) to restore, can be specified multiple times")
+	return &command
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/store"
+)
+
+func NewMoveCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "mv <target name> <source> <destination>",
+		Args:  cobra.ExactArgs(3),
+		Short: "Rename remote backup file",
+		Run: func(cmd *cobra.Command, args []string) {
+			syncher, err := store.NewSyncer(app)
+			if err != nil {
+				pterm.Error.Println("Error initialize syncer:", err)
+				exitWithError(app, err)
+				return
+			}
+
+			extension := lo.Must(cmd.Flags().GetString("ext"))
+			destFileName := app.Name
+			switch extension {
+			case "*":
+				destFileName += "(.\\w+)*"
+			case "+":
+				destFileName += "(.\\w+)+"
+			case "":
+				// no-op.
+			default:
+				destFileName += "." + extension
+			}
+			destFileName += core.BackupFileExt
+
+			err = syncher.Move(app.Ctx, destFileName, args[0], args[1], args[2])
+			if err != nil {
+				pterm.Error.Println(err)
+				slog.Error("Error moving", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+			}
+		},
+	}
+	command.Flags().StringP("ext", "e", "*", "specify the extension of destination file (without dot)")
+	return &command
+}
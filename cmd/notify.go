@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"sin/internal/core"
+	"sin/internal/notify"
+	"sin/internal/store"
+	"time"
+)
+
+// withNotify wraps the backup run to notify the configured webhooks and chats of its result.
+// Failures to deliver notifications are logged and never fail the run.
+func withNotify(app *core.App, syncer *store.Syncer, sourceType string, exec func() error) func() error {
+	notifiers := notify.NewNotifiers(app)
+	if len(notifiers) == 0 {
+		return exec
+	}
+	return func() error {
+		start := time.Now()
+		err := exec()
+		notify.NotifyAll(notifiers, newResult(app, syncer.TakeReport(), sourceType, start, err))
+		return err
+	}
+}
+
+// newResult return the result of the backup run started at start, with the report of its sync if any.
+func newResult(app *core.App, report *store.SyncReport, sourceType string, start time.Time, err error) notify.Result {
+	end := time.Now()
+	result := notify.Result{
+		Name:     app.Name,
+		Task:     sourceType,
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start),
+		Targets:  make([]store.SyncResult, 0),
+	}
+	if report != nil {
+		result.Backup = report.Backup
+		result.Bytes = report.Size
+		result.Targets = report.Targets
+		result.Failed = report.Failed()
+	}
+	if err != nil {
+		result.Failed = true
+		result.Error = err.Error()
+		result.Category = string(ErrorCategory(err))
+	}
+	return result
+}
@@ -17,41 +17,60 @@ func NewPGCmd(app *core.App) *cobra.Command {
 	}
 
 	command := cobra.Command{
-		Use:   "pg <uri/file>",
-		Args:  cobra.ExactArgs(1),
-		Short: "Run backup for postgres using pg_dump",
-		Run: func(_ *cobra.Command, args []string) {
+		Use:         "pg <uri/file/service=name> [-- pg_dump args...]",
+		Args:        exactArgsBeforeDash(1),
+		Annotations: map[string]string{sourceTypeAnnotation: task.SourceTypePostgres},
+		Short:       "Run backup for postgres using pg_dump",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.URI = args[0]
+			flags.DumpArgs = argsAfterDash(cmd, args)
+			if format := printNameFormat(cmd); format != "" {
+				printBackupName(app, format, func() (task.SyncTask, error) {
+					return task.NewSyncPostgres(app, nil, flags)
+				})
+				return
+			}
+
 			syncer, err := store.NewSyncer(app)
 			if err != nil {
 				pterm.Error.Println("Error initialize syncer:", err)
 				slog.Error("Fatal error initialize syncer",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
-			flags.URI = args[0]
 			syncTask, err := task.NewSyncPostgres(app, syncer, flags)
 			if err != nil {
 				pterm.Error.Println("Error initialize pg task:", err)
 				slog.Error("Fatal error initialize pg task",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
-			if err := core.Run(app.Ctx, app.Config.Frequency, syncTask.ExecSync); err != nil {
+			if err := core.Run(app.Ctx, app.Config.Frequency, withLoadCheck(app, withNotify(app, syncer, task.SourceTypePostgres, withSummary(app, syncer, task.SourceTypePostgres, withHooks(app, syncer, withRedump(app, syncTask.ExecSync)))))); err != nil {
 				pterm.Error.Println(err)
 				slog.Error("Fatal error running",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 			}
 		},
 	}
 	command.Flags().StringVar(&flags.PGDumpPath, "pg_dump", flags.PGDumpPath, "pg_dump command/binary location")
 	command.Flags().BoolVar(&flags.EnableGzip, "gzip", flags.EnableGzip, "enable gzip compression")
+	command.Flags().StringSliceVar(&flags.Tags, "tag", flags.Tags, "tag of the backup, can be specified multiple times")
+	command.Flags().StringVar(&flags.CompressCmd, "compress-cmd", flags.CompressCmd, "external compression command (pigz, lz4, zstd, ...) to compress the backup")
 	command.Flags().StringVar(&flags.Compress, "compress", flags.Compress, "specify compression algorithm or/and level")
 	command.Flags().StringVar(&flags.Format, "format", flags.Format, "specify output format")
+	command.Flags().StringVar(&flags.ServiceFile, "service-file", flags.ServiceFile, "postgres service file (PGSERVICEFILE) when using service=name")
+	command.Flags().StringVar(&flags.PassFile, "pgpass", flags.PassFile, "postgres password file (PGPASSFILE)")
 	command.Flags().IntVar(&flags.NumberOfJobs, "number-of-jobs", flags.NumberOfJobs, "specify number of concurrent jobs when output format is directory")
+	command.Flags().BoolVar(&flags.Stream, "stream", flags.Stream, "stream the pg_dump output to the targets without creating a local backup")
+	command.Flags().Int64Var(&flags.MinBackupBytes, "min-backup-bytes", flags.MinBackupBytes, "fail if the created backup is smaller than the given bytes, overriding minBackupBytes in config")
+	addPrintNameFlag(&command)
 	return &command
 }
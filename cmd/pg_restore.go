@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/task"
+)
+
+func NewPGRestoreCmd(app *core.App) *cobra.Command {
+	flags := task.RestorePostgresConfig{
+		PGRestorePath: "pg_restore",
+		PSQLPath:      "psql",
+	}
+
+	command := cobra.Command{
+		Use:   "pg-restore <backup> <uri/file/service=name> [-- pg_restore/psql args...]",
+		Args:  exactArgsBeforeDash(2),
+		Short: "Restore a pg backup using pg_restore or psql",
+		Run: func(cmd *cobra.Command, args []string) {
+			target := lo.Must(cmd.Flags().GetString("target"))
+			backup, cleanup, err := openBackup(app, target, args[0])
+			if err != nil {
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+			defer cleanup()
+
+			flags.URI = args[1]
+			flags.RestoreArgs = argsAfterDash(cmd, args)
+			if err := task.RestorePostgres(app, backup, flags); err != nil {
+				cleanup()
+				pterm.Error.Println(err)
+				slog.Error("Error restoring", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+				return
+			}
+		},
+	}
+	command.Flags().String("target", "", "download the backup from the target instead of reading local file")
+	command.Flags().StringVar(&flags.PGRestorePath, "pg_restore", flags.PGRestorePath, "pg_restore command/binary location")
+	command.Flags().StringVar(&flags.PSQLPath, "psql", flags.PSQLPath, "psql command/binary location, used for plain format")
+	command.Flags().BoolVar(&flags.Clean, "clean", flags.Clean, "drop database objects before recreating them")
+	command.Flags().BoolVar(&flags.Create, "create", flags.Create, "create the database before restoring into it")
+	command.Flags().IntVar(&flags.Jobs, "jobs", flags.Jobs, "number of concurrent pg_restore jobs")
+	command.Flags().StringVar(&flags.ServiceFile, "service-file", flags.ServiceFile, "postgres service file (PGSERVICEFILE) when using service=name")
+	command.Flags().StringVar(&flags.PassFile, "pgpass", flags.PassFile, "postgres password file (PGPASSFILE)")
+	return &command
+}
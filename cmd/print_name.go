@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"sin/internal/core"
+	"sin/internal/task"
+	"sin/internal/utils"
+	"strings"
+	"time"
+)
+
+// printNameFlag the flag of backup commands to print the backup name instead of running the backup.
+const printNameFlag = "print-name"
+
+type backupName struct {
+	Name     string `json:"name"`
+	FileName string `json:"fileName"`
+	// Example the name on targets if the backup is created now.
+	Example string `json:"example"`
+	// Pattern the regexp matching the backups of the file name on targets.
+	Pattern string `json:"pattern"`
+}
+
+func addPrintNameFlag(command *cobra.Command) {
+	command.Flags().String(printNameFlag, "", "print the backup file name and pattern without running the backup (plain, json)")
+	command.Flags().Lookup(printNameFlag).NoOptDefVal = "plain"
+}
+
+// printNameFormat return the output format of --print-name, or empty if not specified.
+func printNameFormat(cmd *cobra.Command) string {
+	flag := cmd.Flags().Lookup(printNameFlag)
+	if flag == nil {
+		return ""
+	}
+	return flag.Value.String()
+}
+
+// printBackupName prints the backup name of the task without running it.
+// The app is only configured, there is no lock or log file.
+func printBackupName(app *core.App, format string, newTask func() (task.SyncTask, error)) {
+	if format != "plain" && format != "json" {
+		err := errors.Newf("invalid print name format '%s'", format)
+		pterm.Error.Println(err)
+		exitWithError(app, err)
+		return
+	}
+	syncTask, err := newTask()
+	if err != nil {
+		pterm.Error.Println("Error initialize task:", err)
+		exitWithError(app, err)
+		return
+	}
+
+	fileName := syncTask.DestFileName()
+	name := backupName{
+		Name:     app.Name,
+		FileName: fileName,
+		Example:  utils.FormatBackupName(time.Now(), fileName),
+		Pattern:  utils.BackupFileNamePattern(strings.TrimSuffix(fileName, core.BackupFileExt)),
+	}
+	if format == "json" {
+		b, err := json.MarshalIndent(name, "", "  ")
+		if err != nil {
+			exitWithError(app, err)
+			return
+		}
+		// Print to stdout directly, so the output can be piped.
+		fmt.Println(string(b))
+		return
+	}
+	fmt.Println("Name:     ", name.Name)
+	fmt.Println("File name:", name.FileName)
+	fmt.Println("Example:  ", name.Example)
+	fmt.Println("Pattern:  ", name.Pattern)
+}
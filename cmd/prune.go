@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/utils"
+)
+
+func NewPruneCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "prune <target names...?>",
+		Args:  cobra.MinimumNArgs(0),
+		Short: "Delete old remote backups by count or age, without running a backup",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts := store.PruneOptions{
+				Tags:    lo.Must(cmd.Flags().GetStringSlice("tag")),
+				Keep:    lo.Must(cmd.Flags().GetInt("keep")),
+				Confirm: lo.Must(cmd.Flags().GetBool("yes")),
+			}
+			if opts.Keep < 0 {
+				err := errors.New("keep must not be negative")
+				pterm.Error.Println(err)
+				exitWithError(app, err)
+				return
+			}
+			if olderThan := lo.Must(cmd.Flags().GetString("older-than")); olderThan != "" {
+				age, err := utils.ParseAge(olderThan)
+				if err == nil && age <= 0 {
+					err = errors.New("older than must be positive")
+				}
+				if err != nil {
+					pterm.Error.Println(err)
+					exitWithError(app, err)
+					return
+				}
+				opts.OlderThan = age
+			}
+
+			syncher, err := store.NewSyncer(app)
+			if err != nil {
+				pterm.Error.Println("Error initialize syncer:", err)
+				exitWithError(app, err)
+				return
+			}
+
+			extension := lo.Must(cmd.Flags().GetString("ext"))
+			destFileName := app.Name
+			switch extension {
+			case "*":
+				destFileName += "(.\\w+)*"
+			case "+":
+				destFileName += "(.\\w+)+"
+			case "":
+				// no-op.
+			default:
+				destFileName += "." + extension
+			}
+			destFileName += core.BackupFileExt
+
+			if err := syncher.Prune(app.Ctx, destFileName, opts, args...); err != nil {
+				pterm.Error.Println(err)
+				slog.Error("Error pruning", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+			}
+		},
+	}
+	command.Flags().Int("keep", 0, "number of newest backups to keep on each target")
+	command.Flags().String("older-than", "", "only delete backups older than the age, e.g. 30d, 1d12h or 36h")
+	command.Flags().StringP("ext", "e", "*", "specify the extension of target file (without dot)")
+	command.Flags().StringSlice("tag", nil, "only include backups having all the specified tags")
+	command.Flags().Bool("yes", false, "delete the backups, otherwise only print what would be deleted")
+	return &command
+}
@@ -21,6 +21,7 @@ func NewPullCmd(app *core.App) *cobra.Command {
 				slog.Error("Fatal error initialize puller",
 					slog.String("name", app.Name),
 					slog.Any("err", err))
+				exitWithError(app, err)
 				return
 			}
 
@@ -28,26 +29,29 @@ func NewPullCmd(app *core.App) *cobra.Command {
 			destFileName := app.Name
 			switch extension {
 			case "*":
-				destFileName += "(.\\w+)?"
+				destFileName += "(.\\w+)*"
 			case "+":
-				destFileName += ".\\w+"
+				destFileName += "(.\\w+)+"
 			case "":
 				// no-op.
 			default:
 				destFileName += "." + extension
 			}
 			destFileName += core.BackupFileExt
+			tags := lo.Must(cmd.Flags().GetStringSlice("tag"))
 
 			err = core.Run(app.Ctx, app.Config.Frequency, func() error {
-				return syncher.Pull(app.Ctx, destFileName, args...)
+				return syncher.Pull(app.Ctx, destFileName, tags, args...)
 			})
 
 			if err != nil {
 				pterm.Error.Println(err)
 				slog.Error("Fatal error running", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
 			}
 		},
 	}
 	command.Flags().StringP("ext", "e", "*", "specify the extension of target file (without dot)")
+	command.Flags().StringSlice("tag", nil, "only include backups having all the specified tags")
 	return &command
 }
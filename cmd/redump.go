@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/store"
+)
+
+// withRedump runs exec again if the local backup changed while syncing it,
+// up to the upload retries of the verify config.
+func withRedump(app *core.App, exec func() error) func() error {
+	if !app.Verify.AfterUpload || app.Verify.UploadRetries <= 0 {
+		return exec
+	}
+	return func() error {
+		for redump := 0; ; redump++ {
+			err := exec()
+			if !errors.Is(err, store.ErrSourceChanged) || redump >= app.Verify.UploadRetries {
+				return err
+			}
+			pterm.Warning.Printf("Local backup changed while syncing, creating it again (%d/%d)\n", redump+1, app.Verify.UploadRetries)
+			slog.Warn("Local backup changed while syncing, creating it again",
+				slog.String("name", app.Name),
+				slog.Int("retry", redump+1),
+				slog.Int("retries", app.Verify.UploadRetries),
+				slog.Any("err", err))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/store"
+)
+
+func NewRestoreCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "restore <target name> <remote filename?> <destination>",
+		Args:  cobra.RangeArgs(2, 3),
+		Short: "Download a remote backup file to the destination",
+		Run: func(cmd *cobra.Command, args []string) {
+			latest := lo.Must(cmd.Flags().GetBool("latest"))
+			if latest && len(args) != 2 {
+				pterm.Error.Println("Must not specify remote filename when using --latest")
+				return
+			}
+			if !latest && len(args) != 3 {
+				pterm.Error.Println("Must specify remote filename, or use --latest")
+				return
+			}
+
+			syncher, err := store.NewSyncer(app)
+			if err != nil {
+				pterm.Error.Println("Error initialize syncer:", err)
+				exitWithError(app, err)
+				return
+			}
+
+			extension := lo.Must(cmd.Flags().GetString("ext"))
+			destFileName := app.Name
+			switch extension {
+			case "*":
+				destFileName += "(.\\w+)*"
+			case "+":
+				destFileName += "(.\\w+)+"
+			case "":
+				// no-op.
+			default:
+				destFileName += "." + extension
+			}
+			destFileName += core.BackupFileExt
+			tags := lo.Must(cmd.Flags().GetStringSlice("tag"))
+
+			file := ""
+			if !latest {
+				file = args[1]
+			}
+			err = syncher.Restore(app.Ctx, args[0], file, destFileName, tags, args[len(args)-1])
+			if err != nil {
+				pterm.Error.Println(err)
+				slog.Error("Error restoring", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+			}
+		},
+	}
+	command.Flags().Bool("latest", false, "restore the latest backup of --name instead of the specified remote filename")
+	command.Flags().StringP("ext", "e", "*", "specify the extension of target file (without dot), used with --latest")
+	command.Flags().StringSlice("tag", nil, "only include backups having all the specified tags, used with --latest")
+	return &command
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"os"
+	"sin/internal/core"
+	"sin/internal/store"
+	"time"
+)
+
+// withSummary wraps the backup run to print its result to stdout as a json object, if json output is enabled.
+// Each run prints a single line, so scheduled runs can be read as json lines.
+func withSummary(app *core.App, syncer *store.Syncer, sourceType string, exec func() error) func() error {
+	if !app.JSONOutput() {
+		return exec
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	return func() error {
+		// Discard the report of the previous run, if not taken by notifications.
+		syncer.TakeReport()
+		start := time.Now()
+		err := exec()
+		// Keep the report for notifications.
+		if eerr := encoder.Encode(newResult(app, syncer.Report(), sourceType, start, err)); eerr != nil {
+			pterm.Warning.Println("Error printing json result", eerr)
+			slog.Warn("Error printing json result", slog.String("name", app.Name), slog.Any("err", eerr))
+		}
+		return err
+	}
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/store"
+)
+
+func NewVerifyCmd(app *core.App) *cobra.Command {
+	command := cobra.Command{
+		Use:   "verify <target names...?>",
+		Args:  cobra.MinimumNArgs(0),
+		Short: "Verify remote backup files against their checksums",
+		Run: func(cmd *cobra.Command, args []string) {
+			syncher, err := store.NewSyncer(app)
+			if err != nil {
+				pterm.Error.Println("Error initialize syncer:", err)
+				exitWithError(app, err)
+				return
+			}
+
+			extension := lo.Must(cmd.Flags().GetString("ext"))
+			destFileName := app.Name
+			switch extension {
+			case "*":
+				destFileName += "(.\\w+)*"
+			case "+":
+				destFileName += "(.\\w+)+"
+			case "":
+				// no-op.
+			default:
+				destFileName += "." + extension
+			}
+			destFileName += core.BackupFileExt
+			tags := lo.Must(cmd.Flags().GetStringSlice("tag"))
+			samples := app.Verify.Sample
+			if cmd.Flags().Changed("sample") {
+				samples = lo.Must(cmd.Flags().GetStringSlice("sample"))
+			}
+
+			err = core.Run(app.Ctx, app.Verify.Schedule, func() error {
+				err := syncher.Verify(app.Ctx, destFileName, tags, samples, args...)
+				if err != nil && app.Verify.Schedule != "" && !app.FailFast {
+					// Keep verifying on schedule, the failures are already reported.
+					pterm.Error.Println(err)
+					return nil
+				}
+				return err
+			})
+			if err != nil {
+				pterm.Error.Println(err)
+				slog.Error("Fatal error verifying", slog.String("name", app.Name), slog.Any("err", err))
+				exitWithError(app, err)
+			}
+		},
+	}
+	command.Flags().StringP("ext", "e", "*", "specify the extension of target file (without dot)")
+	command.Flags().StringSlice("tag", nil, "only include backups having all the specified tags")
+	command.Flags().StringSlice("sample", nil, "strategies for choosing backups to verify: all, oldest, newest, random (default all)")
+	return &command
+}
@@ -3,7 +3,9 @@
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"filippo.io/age"
 	"fmt"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-viper/mapstructure/v2"
@@ -16,78 +18,334 @@
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// maxDefaultChecksumWorkers cap of the default number of checksum workers,
+// as hashing many files at once is usually bounded by disk io.
+const maxDefaultChecksumWorkers = 8
+
+// defaultSentryFlushTimeout the default maximum time waiting for sentry events to be sent on close.
+const defaultSentryFlushTimeout = 5 * time.Second
+
+// instanceLabelRegex the allowed instance label, which must not be confused with the backup extensions or tags.
+var instanceLabelRegex = regexp.MustCompile(`^[\w-]+$`)
+
+// ErrLocked another instance of sin is running under the same name.
+var ErrLocked = errors.New("name locked")
+
+// AppInitConfig the values of the global CLI flags, each field is bound to a persistent flag in cmd.NewCLI.
+// Non-zero values override the config file in App.Init.
 type AppInitConfig struct {
-	ConfigFile         string
-	Name               string
-	EnableAutomaticEnv bool
-	EnableFailFast     bool
-	Keep               int
-	NoMkdir            bool
-	EnableLocalMode    bool
+	// ConfigFiles the config files or directories, merged in order.
+	ConfigFiles    []string
+	Name           string
+	AutomaticEnv   bool
+	FailFast       bool
+	Keep           int
+	LocalKeep      int
+	NoMkdir        bool
+	LocalMode      bool
+	RequireTargets bool
+	PingTargets    bool
+	DryRun         bool
+	DeriveName     bool
+	// InstanceLabel suffixes the name, so instances sharing a config can run with distinct names.
+	InstanceLabel   string
+	LogOutput       string
+	CleanTempOnExit bool
+	SentryPing      bool
+	LockDir         string
+	ChecksumWorkers int
+	Progress        string
+	// StdoutMode writes the backup to stdout instead of the targets.
+	StdoutMode bool
+	// StdoutWithTargets also syncs the backup to the configured targets in stdout mode.
+	StdoutWithTargets bool
+	// StdoutChecksumFile the file the checksum is written to in stdout mode, default printed to stderr.
+	StdoutChecksumFile string
+	// JSONOutput prints the result of each backup run as a json object, overriding the output format.
+	JSONOutput bool
+	// SourceName the name derived from the backup source.
+	// Only used if DeriveName is enabled and no name is specified.
+	SourceName string
 }
 
 type App struct {
 	Ctx context.Context
 	Config
 	Revision string
+	// Version the module version of the build, empty if unknown.
+	Version string
+
+	// localMode creates the backup in the current directory without syncing.
+	localMode bool
+	// stdoutMode writes the backup to stdout, optionally also syncing it to the targets.
+	stdoutMode         bool
+	stdoutWithTargets  bool
+	stdoutChecksumFile string
 
 	cancel       context.CancelFunc
 	logFile      *os.File
 	nameLockPath string
+	closeOnce    sync.Once
+	closeErr     error
+	tempFiles    tempFiles
+
+	encryptionPassphrase []byte
+	ageRecipients        []age.Recipient
+	ageIdentities        []age.Identity
+	signingKey           ed25519.PrivateKey
+	signingPublicKey     ed25519.PublicKey
+	progressMode         string
 }
 
 type Config struct {
 	Name      string `json:"name"`
 	SentryDSN string `json:"sentryDSN"`
+	// SentryFlushTimeoutSeconds the maximum time waiting for sentry events to be sent on close.
+	// Default 5 seconds.
+	SentryFlushTimeoutSeconds int `json:"sentryFlushTimeoutSeconds"`
+	// SentryPing sends a test event to sentry at startup and fails if it cannot be sent,
+	// catching misconfigured alerting before relying on it.
+	SentryPing bool `json:"sentryPing"`
+	// UserAgent appended to the default User-Agent (sin/<revision>) of outbound requests.
+	UserAgent string `json:"userAgent"`
+	// PreHook command run before each backup, a shell command string or an array of command and args.
+	// The backup is aborted if the hook fails.
+	PreHook any `json:"preHook"`
+	// PostHook command run after each backup, same format as PreHook.
+	// The result is passed via SIN_STATUS, SIN_ERROR, SIN_BACKUP and SIN_BACKUP_PATH environment variables.
+	// Failures are only warned.
+	PostHook any `json:"postHook"`
+	// MaxLoadAvg skips the backup if the 1 minute system load average exceeds it, 0 disables.
+	// Only supported on linux and BSD (including macOS), the backup always runs on other platforms.
+	MaxLoadAvg float64 `json:"maxLoadAvg"`
+	// LoadCheck command deciding whether the system is idle enough to run the backup, same format as PreHook.
+	// The backup is skipped if the command exits with non-zero code.
+	LoadCheck any `json:"loadCheck"`
+	// LoadWaitSeconds waits up to the given seconds for the system to become idle before skipping the backup.
+	// Default 0, skipping immediately.
+	LoadWaitSeconds int `json:"loadWaitSeconds"`
+	// Niceness runs the dump and compression commands with the given CPU niceness (nice -n, -20 to 19).
+	// Default 0, keeping the priority. Not supported on windows.
+	Niceness int `json:"niceness"`
+	// IONiceClass runs the dump and compression commands with the given IO scheduling class (ionice -c):
+	// "realtime", "best-effort" or "idle". Default empty, keeping the priority. Linux only.
+	IONiceClass string `json:"ioNiceClass"`
+	// CheckUpdates logs a notice when a newer release of sin is available, checked daily against GitHub releases.
+	// Never updates automatically. Default disabled.
+	CheckUpdates bool `json:"checkUpdates"`
+	// Webhooks notified after each backup run.
+	Webhooks []WebhookConfig `json:"webhooks"`
+	// Notify chat notifications after each backup run.
+	Notify NotifyConfig `json:"notify"`
+	// DeriveName use the name derived from the backup source if no name is specified.
+	DeriveName bool `json:"deriveName"`
+
+	// LogOutput where the json logs are written: file (default, <name>.sinlog), stdout, stderr or none.
+	// Multiple outputs can be separated by comma. Sentry reporting applies regardless of the output.
+	LogOutput string `json:"logOutput"`
+	// LogOutputs the outputs with independent levels, replaces LogOutput if specified.
+	LogOutputs []LogOutputConfig `json:"logOutputs"`
+	// Progress displays the progress of syncing and pulling: auto, bar, log or none (default).
+	// auto displays progress bars on a terminal, otherwise periodic log lines.
+	Progress string `json:"progress"`
+	// OutputFormat the format of the result of each backup run: text (default) or json.
+	// json prints the result to stdout as a json object, writing the human-readable output to stderr.
+	OutputFormat string `json:"outputFormat"`
 
 	FailFast bool `json:"failFast"`
 	// BackupTempDir the directory for storing created backup.
 	BackupTempDir string `json:"backupTempDir"`
 	// KeepTempFile does not remove recently created backup after sync.
 	KeepTempFile bool `json:"keepTempFile"`
+	// LocalKeep number of kept local backups (KeepTempFile or local mode), independent of Keep.
+	// If specified, kept backups are named with the backup time so they are not replaced by the next backup,
+	// and the older ones are deleted after each backup. Default 0, which replaces the kept backup each backup.
+	LocalKeep int `json:"localKeep"`
+	// CleanTempOnExit removes the leftover temp files created by this run on exit,
+	// such as incomplete or errored backups of interrupted runs. Kept backups are not removed.
+	CleanTempOnExit bool `json:"cleanTempOnExit"`
+	// WriteMetadata writes a metadata file (.meta.json) describing the backup,
+	// and syncs it alongside the backup.
+	WriteMetadata bool `json:"writeMetadata"`
+	// ContentChecksum also stores the checksum of the decompressed content of compressed backups in the metadata,
+	// verified when decompressing on restore. Requires decompressing the backup once more when creating it.
+	// Only used with WriteMetadata.
+	ContentChecksum bool `json:"contentChecksum"`
+	// DryRun only prints what would be synced, deleted or moved on targets, without changing them.
+	DryRun bool `json:"dryRun"`
+	// RequireTargets fails if there are no enabled downloadable targets, catching accidentally disabled targets.
+	// Ignored in local mode.
+	RequireTargets bool `json:"requireTargets"`
+	// PingTargets checks that every enabled target can be reached when starting, failing fast on
+	// misconfigured endpoints or credentials instead of on the first upload.
+	PingTargets bool `json:"pingTargets"`
+	// SkipIdleBackup does not create the backup if no targets would sync it due to Each config.
+	// Always enabled if KeepTempFile is false, as the backup would be removed without syncing anyway.
+	SkipIdleBackup bool `json:"skipIdleBackup"`
+	// LockDir the directory for storing the name lock file.
+	// Default to the os temp directory.
+	LockDir string `json:"lockDir"`
+	// ErrorDir the directory for storing errored backup.
+	// Default to empty, which keeps errored backup in the BackupTempDir.
+	ErrorDir string `json:"errorDir"`
+	// MinBackupBytes fails the backup if the created local backup is smaller than it, such as an empty dump
+	// of a dump tool exiting successfully. Overridden by the backup commands. Default 0 (disabled).
+	MinBackupBytes int64 `json:"minBackupBytes"`
 
 	// Keep Number of backups to keep.
-	// Only apply for targets, local backup is always kept 0-1.
+	// Only apply for targets and pulled backups, kept local backups use LocalKeep.
 	Keep int `json:"keep"`
+	// Retention GFS retention policy, replaces Keep if specified.
+	Retention RetentionPolicy `json:"retention"`
 
 	// Frequency of the backup process.
 	// Support cron and duration string.
 	// If not specified, run once and stop.
 	Frequency string `json:"frequency"`
 
+	// CompactEvery only deletes old backups every N backup iterations, reducing list/delete requests.
+	// Default 1 (compact after every sync).
+	CompactEvery int `json:"compactEvery"`
+
+	// CrossTargetConcurrency number of targets to sync concurrently.
+	// Default 1 (sync to targets sequentially).
+	CrossTargetConcurrency int `json:"crossTargetConcurrency"`
+	// SyncConcurrency alias of CrossTargetConcurrency, used when CrossTargetConcurrency is not specified.
+	SyncConcurrency int `json:"syncConcurrency"`
+	// MaxConcurrency limits the total number of concurrent requests,
+	// which is CrossTargetConcurrency multiplied by the intraFileConcurrency of targets.
+	// Default 0 (unlimited).
+	MaxConcurrency int `json:"maxConcurrency"`
+
+	// ChecksumAlgo the algorithm of the checksum files (.<algo>.txt) of backups: sha256 (default), sha512 or blake3.
+	// Verification reads whichever checksum file exists, so changing it does not break existing backups.
+	ChecksumAlgo string `json:"checksumAlgo"`
+	// ChecksumWorkers number of files to hash concurrently when verifying many backups.
+	// Default GOMAXPROCS, capped at 8.
+	ChecksumWorkers int `json:"checksumWorkers"`
+	// ChecksumManifest an external manifest the checksum of each created backup is appended to,
+	// used instead of the checksum files on targets when restoring, pulling and verifying.
+	ChecksumManifest ChecksumManifestConfig `json:"checksumManifest"`
+
+	// Verify config of the verify command.
+	Verify VerifyConfig `json:"verify"`
+
+	// Encryption encrypts backups with AES-256-GCM before syncing to targets.
+	// Default disabled.
+	Encryption EncryptionConfig `json:"encryption"`
+	// AgeRecipients encrypts backups to the age recipients (public keys) before syncing to targets.
+	// Cannot be used with Encryption.
+	AgeRecipients []string `json:"ageRecipients"`
+	// AgeIdentityFile the age identity (private key) file for decrypting pulled backups.
+	AgeIdentityFile string `json:"ageIdentityFile"`
+	// Signing signs the checksum of each backup with an Ed25519 key, synced as a signature file (.sig) alongside it.
+	// If a public key is configured, restore and verify reject backups without a valid signature.
+	Signing SigningConfig `json:"signing"`
+
+	// RetryBudget limits the total retries of each run, regardless of targets config.
+	// Default unlimited.
+	RetryBudget RetryBudgetConfig `json:"retryBudget"`
+
 	Targets []map[string]any `json:"targets"`
 }
 
+// LogOutputConfig an output of the json logs.
+type LogOutputConfig struct {
+	// Output file, stdout, stderr or none.
+	Output string `json:"output"`
+	// Level the minimum level of logs written to the output: debug, info (default), warn or error.
+	Level string `json:"level"`
+}
+
+func (c LogOutputConfig) level() slog.Level {
+	level := slog.LevelInfo
+	_ = level.UnmarshalText([]byte(c.Level))
+	return level
+}
+
+// resolveLogOutputs resolves LogOutputs from LogOutput if not specified, defaulting to file, and validates them.
+func (app *App) resolveLogOutputs() error {
+	if len(app.LogOutputs) == 0 {
+		output := app.LogOutput
+		if output == "" {
+			output = LogOutputFile
+		}
+		for _, o := range strings.Split(output, ",") {
+			app.LogOutputs = append(app.LogOutputs, LogOutputConfig{Output: strings.TrimSpace(o)})
+		}
+	}
+	seen := make(map[string]struct{}, len(app.LogOutputs))
+	for _, o := range app.LogOutputs {
+		switch o.Output {
+		case LogOutputFile, LogOutputStdout, LogOutputStderr, LogOutputNone:
+		default:
+			return errors.Newf("invalid log output '%s': must be one of file, stdout, stderr, none", o.Output)
+		}
+		if _, ok := seen[o.Output]; ok {
+			return errors.Newf("duplicated log output '%s'", o.Output)
+		}
+		seen[o.Output] = struct{}{}
+		if o.Level != "" {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+				return errors.Newf("invalid level '%s' of log output %s", o.Level, o.Output)
+			}
+		}
+	}
+	return nil
+}
+
+// RetentionPolicy grandfather-father-son retention, keeping the newest backup of each recent period.
+// If enabled, it replaces the Keep config.
+type RetentionPolicy struct {
+	// Last number of the most recent backups to always keep.
+	Last    int `json:"last"`
+	Daily   int `json:"daily"`
+	Weekly  int `json:"weekly"`
+	Monthly int `json:"monthly"`
+	Yearly  int `json:"yearly"`
+}
+
+// Enabled whether any period of the policy is specified.
+func (p RetentionPolicy) Enabled() bool {
+	return p.Last > 0 || p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0 || p.Yearly > 0
+}
+
+type VerifyConfig struct {
+	// Schedule frequency of verifying remote backups, using the same format as Frequency.
+	// If not specified, verify once and stop.
+	Schedule string `json:"schedule"`
+	// Sample strategies for choosing backups to verify: all, oldest, newest, random.
+	// Default all.
+	Sample []string `json:"sample"`
+	// AfterUpload verifies each backup on targets against its checksum file right after uploading it.
+	AfterUpload bool `json:"afterUpload"`
+	// UploadRetries the number of re-uploads when verifying after upload finds a checksum mismatch,
+	// or re-dumps if the local backup changed during the sync. Default 0 (fail immediately).
+	UploadRetries int `json:"uploadRetries"`
+}
+
 // Init setup application core.
 func (app *App) Init(c AppInitConfig) error {
-	app.Config = Config{
-		Keep: -1,
+	if c.StdoutMode {
+		// Keep stdout only containing the backup.
+		redirectOutput(os.Stderr)
 	}
-	app.Revision = loadRevision()
-	app.Ctx, app.cancel = context.WithCancel(context.Background())
-	if err := loadJSONConfigInto(&app.Config, c.ConfigFile, c.EnableAutomaticEnv, c.EnableLocalMode); err != nil {
+	if err := app.LoadConfig(c); err != nil {
 		return err
 	}
-	if c.Name != "" {
-		app.Name = c.Name
-	}
-	if app.Name == "" {
-		app.Name = DefaultAppName
-	}
-	if c.EnableFailFast {
-		app.FailFast = c.EnableFailFast
-	}
-	if c.Keep > 0 {
-		app.Keep = c.Keep
-	}
-	if app.BackupTempDir == "" {
-		app.BackupTempDir = "."
-	}
+	// Printed after loading the config, as json output configured in the config file redirects the output.
+	app.Revision = loadRevision()
+	app.Version = loadVersion()
 
 	if err := setupLogging(app); err != nil {
 		return err
@@ -106,10 +364,26 @@ func (app *App) Init(c AppInitConfig) error {
 		if err := os.MkdirAll(app.BackupTempDir, os.ModePerm); err != nil {
 			return err
 		}
+		if app.ErrorDir != "" {
+			if err := os.MkdirAll(app.ErrorDir, os.ModePerm); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Handle the lock file.
-	nameLockPath := filepath.Join(os.TempDir(), app.Name+".sinnamelock")
+	if app.LockDir == "" {
+		app.LockDir = os.TempDir()
+	}
+	if info, err := os.Stat(app.LockDir); err != nil || !info.IsDir() {
+		if err == nil {
+			err = errors.New("lock dir is not a directory " + app.LockDir)
+		}
+		err = errors.Wrapf(err, "invalid lock dir")
+		slog.Error("Error initializing", slog.Any("err", err))
+		return err
+	}
+	nameLockPath := app.NameLockPath()
 	if _, err := os.Stat(nameLockPath); err == nil {
 		// Multi instance running with the same name can cause trouble if the user is not careful enough.
 		// So we forbid them from the start.
@@ -117,55 +391,281 @@ func (app *App) Init(c AppInitConfig) error {
 		pterm.Error.Println("Please use different --name")
 		pterm.Info.Println("If there are no other instance of sin running, this could be caused by improper shutdown of previous instance.")
 		pterm.Info.Println("In that case, please remove the lock file: ", nameLockPath)
-		err := errors.New("multiple instance running with same name")
+		err := errors.Wrapf(ErrLocked, "multiple instance running with same name")
 		slog.Error("Error initializing", slog.Any("err", err))
 		return err
 	}
 	f, err := os.Create(nameLockPath)
 	if err != nil {
-		err := errors.Wrapf(err, "cannot create lock file")
+		err := errors.Wrapf(err, "cannot create lock file, lock dir %s must be writable", app.LockDir)
 		slog.Error("Error initializing", slog.Any("err", err))
 		return err
 	}
 	defer f.Close()
 	app.nameLockPath = nameLockPath
+	// The pid of the owner, checked by healthcheck.
+	if _, err := f.WriteString(strconv.Itoa(os.Getpid())); err != nil {
+		err := errors.Wrapf(err, "cannot write lock file %s", nameLockPath)
+		slog.Error("Error initializing", slog.Any("err", err))
+		return err
+	}
 
 	if app.Config.SentryDSN != "" {
-		// Make sure we can connect to sentry.
-		slog.Warn("Ping sentry", slog.String("status", "initialized"))
+		if app.SentryPing {
+			if err := pingSentry(app); err != nil {
+				slog.Error("Error initializing", slog.Any("err", err))
+				return err
+			}
+		} else {
+			// Make sure we can connect to sentry.
+			slog.Warn("Ping sentry", slog.String("status", "initialized"))
+		}
 	}
 	// Make sure slog logger work.
 	slog.Info("Initialized",
 		slog.String("name", app.Name),
 		slog.String("revision", app.Revision),
-		slog.Bool("env", c.EnableAutomaticEnv))
+		slog.Bool("env", c.AutomaticEnv))
+	if app.CheckUpdates {
+		go app.checkUpdatesPeriodically()
+	}
+	return nil
+}
+
+// LoadConfig loads the config and applies the CLI flags, without setting up logging, directories or the name lock.
+func (app *App) LoadConfig(c AppInitConfig) error {
+	app.Config = Config{
+		Keep: -1,
+	}
+	app.Ctx, app.cancel = context.WithCancel(context.Background())
+	if err := loadJSONConfigInto(&app.Config, c.ConfigFiles, c.AutomaticEnv, c.LocalMode); err != nil {
+		return err
+	}
+	if c.Name != "" {
+		app.Name = c.Name
+	}
+	if _, err := hookArgs(app.PreHook); err != nil {
+		return errors.Wrapf(err, "invalid preHook")
+	}
+	if _, err := hookArgs(app.PostHook); err != nil {
+		return errors.Wrapf(err, "invalid postHook")
+	}
+	if _, err := hookArgs(app.LoadCheck); err != nil {
+		return errors.Wrapf(err, "invalid loadCheck")
+	}
+	if app.MaxLoadAvg < 0 {
+		return errors.New("maxLoadAvg must not be negative")
+	}
+	if app.MinBackupBytes < 0 {
+		return errors.New("minBackupBytes must not be negative")
+	}
+	if app.LocalKeep < 0 || c.LocalKeep < 0 {
+		return errors.New("localKeep must not be negative")
+	}
+	if err := app.validatePriority(); err != nil {
+		return err
+	}
+	if c.CleanTempOnExit {
+		app.CleanTempOnExit = c.CleanTempOnExit
+	}
+	if c.LogOutput != "" {
+		app.LogOutput = c.LogOutput
+		app.LogOutputs = nil
+	}
+	if err := app.resolveLogOutputs(); err != nil {
+		return err
+	}
+	if err := app.loadStdoutMode(c); err != nil {
+		return err
+	}
+	if err := app.loadOutputFormat(c); err != nil {
+		return err
+	}
+	if c.Progress != "" {
+		app.Progress = c.Progress
+	}
+	progressMode, err := resolveProgressMode(app.Progress, app.stdoutMode || app.JSONOutput())
+	if err != nil {
+		return err
+	}
+	app.progressMode = progressMode
+	if c.LockDir != "" {
+		app.LockDir = c.LockDir
+	}
+	if c.DeriveName {
+		app.DeriveName = c.DeriveName
+	}
+	if app.Name == "" && app.DeriveName {
+		app.Name = c.SourceName
+	}
+	if app.Name == "" {
+		app.Name = DefaultAppName
+	}
+	if c.SentryPing {
+		app.SentryPing = c.SentryPing
+	}
+	if c.InstanceLabel != "" {
+		if !instanceLabelRegex.MatchString(c.InstanceLabel) {
+			return errors.Newf("invalid instance label '%s': must only contain letters, digits, '_' and '-'", c.InstanceLabel)
+		}
+		app.Name += "-" + c.InstanceLabel
+	}
+	if c.FailFast {
+		app.FailFast = c.FailFast
+	}
+	if c.Keep > 0 {
+		app.Keep = c.Keep
+	}
+	if c.LocalKeep > 0 {
+		app.LocalKeep = c.LocalKeep
+	}
+	if c.RequireTargets {
+		app.RequireTargets = c.RequireTargets
+	}
+	if c.PingTargets {
+		app.PingTargets = c.PingTargets
+	}
+	if c.DryRun {
+		app.DryRun = c.DryRun
+	}
+	if c.LocalMode {
+		app.localMode = true
+		// Local mode never syncs, so targets are not required.
+		app.RequireTargets = false
+	}
+	if app.BackupTempDir == "" {
+		app.BackupTempDir = "."
+	}
+	switch app.ChecksumAlgo {
+	case "":
+		app.ChecksumAlgo = ChecksumSHA256
+	case ChecksumSHA256, ChecksumSHA512, ChecksumBLAKE3:
+	default:
+		return errors.Newf("invalid checksumAlgo '%s': must be one of sha256, sha512, blake3", app.ChecksumAlgo)
+	}
+	if c.ChecksumWorkers > 0 {
+		app.ChecksumWorkers = c.ChecksumWorkers
+	}
+	if app.ChecksumWorkers < 1 {
+		app.ChecksumWorkers = min(runtime.GOMAXPROCS(0), maxDefaultChecksumWorkers)
+	}
+	if err := app.ChecksumManifest.validate(); err != nil {
+		return err
+	}
+	if app.Encryption.Enabled() {
+		passphrase, err := app.Encryption.loadPassphrase()
+		if err != nil {
+			return err
+		}
+		app.encryptionPassphrase = passphrase
+	}
+	if len(app.AgeRecipients) > 0 {
+		if app.Encryption.Enabled() {
+			return errors.New("must not specify both encryption and age recipients")
+		}
+		recipients, err := loadAgeRecipients(app.AgeRecipients)
+		if err != nil {
+			return err
+		}
+		app.ageRecipients = recipients
+	}
+	if app.AgeIdentityFile != "" {
+		identities, err := loadAgeIdentities(app.AgeIdentityFile)
+		if err != nil {
+			return err
+		}
+		app.ageIdentities = identities
+	}
+	signingKey, signingPublicKey, err := app.Signing.load()
+	if err != nil {
+		return err
+	}
+	app.signingKey, app.signingPublicKey = signingKey, signingPublicKey
+	for _, webhook := range app.Webhooks {
+		if err := webhook.validate(); err != nil {
+			return err
+		}
+	}
+	if app.RetryBudget.MaxAttempts > 0 || app.RetryBudget.MaxDuration > 0 {
+		app.Ctx = WithRetryBudget(app.Ctx, NewRetryBudget(app.RetryBudget))
+	}
 	return nil
 }
 
 // Close handle cleanup when shutdown.
 func (app *App) Close() error {
-	if app.Ctx != nil {
-		defer app.cancel()
+	app.closeOnce.Do(func() {
+		app.closeErr = app.close()
+	})
+	return app.closeErr
+}
+
+// close releases the app resources in a deterministic order: cancel the context, clean temp files, flush sentry,
+// close the log, then remove the lock last, so the lock is held until everything else is done.
+// Every step runs even if an earlier step errors.
+func (app *App) close() error {
+	if app.cancel != nil {
+		app.cancel()
 	}
-	if app.nameLockPath != "" {
-		err := os.Remove(app.nameLockPath)
-		if err != nil {
-			pterm.Error.Println("Error removing lock file", app.nameLockPath, err)
-			slog.Error("Error shutdown",
-				slog.String("path", app.nameLockPath),
-				slog.Any("err", errors.Wrapf(err, "cannot remove lock file")),
-			)
+	var errs []error
+	if app.CleanTempOnExit {
+		if err := app.cleanTempFiles(); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	if app.SentryDSN != "" {
-		sentry.Flush(5 * time.Second)
+	// Sentry client is not initialized if the dsn is invalid or the app is closed before setting up logging.
+	if app.SentryDSN != "" && sentry.CurrentHub().Client() != nil {
+		timeout := app.sentryFlushTimeout()
+		if !sentry.Flush(timeout) {
+			pterm.Warning.Println("Timed out flushing sentry events after", timeout.String())
+		}
 	}
 	if app.logFile != nil {
-		return app.logFile.Close()
+		if err := app.logFile.Close(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "error closing log file"))
+		}
+	}
+	if app.nameLockPath != "" {
+		if err := os.Remove(app.nameLockPath); err != nil {
+			errs = append(errs, errors.Wrapf(err, "cannot remove lock file %s", app.nameLockPath))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sentryFlushTimeout return the maximum time waiting for sentry events to be sent.
+func (app *App) sentryFlushTimeout() time.Duration {
+	if app.SentryFlushTimeoutSeconds > 0 {
+		return time.Duration(app.SentryFlushTimeoutSeconds) * time.Second
+	}
+	return defaultSentryFlushTimeout
+}
+
+// pingSentry sends a test event to sentry and waits until it is sent,
+// failing if the event is dropped or cannot be sent within the flush timeout.
+func pingSentry(app *App) error {
+	pterm.Println("Pinging sentry")
+	id := sentry.CaptureMessage("Ping sentry from " + app.Name)
+	if id == nil {
+		return errors.New("error pinging sentry: test event was dropped")
 	}
+	if !sentry.Flush(app.sentryFlushTimeout()) {
+		return errors.Newf("error pinging sentry: test event not sent after %s, check the sentry dsn and network", app.sentryFlushTimeout())
+	}
+	pterm.Success.Println("Sentry ping sent, event id", string(*id))
 	return nil
 }
 
+// LocalMode whether the backup is created in the current directory without syncing to any targets.
+func (app *App) LocalMode() bool {
+	return app.localMode
+}
+
+// UserAgentHeader return the User-Agent of outbound requests.
+func (app *App) UserAgentHeader() string {
+	return strings.TrimSpace("sin/" + app.Revision + " " + app.UserAgent)
+}
+
 func (app *App) MustClose() {
 	if err := app.Close(); err != nil {
 		pterm.Error.Println(err)
@@ -173,33 +673,45 @@ func (app *App) MustClose() {
 }
 
 func setupLogging(app *App) error {
-	f, err := os.OpenFile(fmt.Sprintf("%s%s", app.Name, LogFileExt), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return errors.Wrapf(err, "error opening log file")
+	handlers := make([]slog.Handler, 0, len(app.LogOutputs)+1)
+	for _, output := range app.LogOutputs {
+		opts := &slog.HandlerOptions{Level: output.level()}
+		switch output.Output {
+		case LogOutputStdout:
+			handlers = append(handlers, slog.NewJSONHandler(os.Stdout, opts))
+		case LogOutputStderr:
+			handlers = append(handlers, slog.NewJSONHandler(os.Stderr, opts))
+		case LogOutputNone:
+		default:
+			f, err := os.OpenFile(fmt.Sprintf("%s%s", app.Name, LogFileExt), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+			if err != nil {
+				return errors.Wrapf(err, "error opening log file")
+			}
+			handlers = append(handlers, slog.NewJSONHandler(f, opts))
+			app.logFile = f
+		}
 	}
 
-	handler := slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelInfo})
-	app.logFile = f
-	if app.SentryDSN == "" {
-		slog.SetDefault(slog.New(handler))
-		return nil
+	if app.SentryDSN != "" {
+		err := sentry.Init(sentry.ClientOptions{
+			Dsn:           app.SentryDSN,
+			Release:       app.Name + "@" + app.Revision,
+			EnableTracing: false,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error initializing sentry")
+		}
+		handlers = append(handlers, slogsentry.Option{Level: slog.LevelWarn}.NewSentryHandler())
 	}
 
-	err = sentry.Init(sentry.ClientOptions{
-		Dsn:           app.SentryDSN,
-		Release:       app.Name + "@" + app.Revision,
-		EnableTracing: false,
-	})
-	if err != nil {
-		return errors.Wrapf(err, "error initializing sentry")
+	switch len(handlers) {
+	case 0:
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+	case 1:
+		slog.SetDefault(slog.New(handlers[0]))
+	default:
+		slog.SetDefault(slog.New(slogmulti.Fanout(handlers...)))
 	}
-
-	slog.SetDefault(slog.New(
-		slogmulti.Fanout(
-			handler,
-			slogsentry.Option{Level: slog.LevelWarn}.NewSentryHandler(),
-		),
-	))
 	return nil
 }
 
@@ -219,9 +731,11 @@ func loadRevision() string {
 	return revision
 }
 
-func loadJSONConfigInto(cfg *Config, path string, automaticEnv bool, localMode bool) error {
+// loadJSONConfigInto loads the config files on top of the struct defaults.
+// Later files override earlier ones, targets with the same name are replaced instead of appended.
+func loadJSONConfigInto(cfg *Config, paths []string, automaticEnv bool, localMode bool) error {
 	if localMode {
-		if path != "" || automaticEnv {
+		if len(paths) > 0 || automaticEnv {
 			return errors.New("must not specify config file or enable automatic env when using local mode")
 		}
 		cfg.BackupTempDir = "."
@@ -244,15 +758,35 @@ func loadJSONConfigInto(cfg *Config, path string, automaticEnv bool, localMode b
 		return err
 	}
 
-	if path != "" {
-		// Load core file.
-		viper.SetConfigFile(path)
-		if err := viper.MergeInConfig(); err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				return errors.New("config file not found")
-			}
+	if len(paths) > 0 {
+		files, err := configFiles(paths)
+		if err != nil {
 			return err
 		}
+		targets := make([]any, 0)
+		hasTargets := false
+		for _, file := range files {
+			// Load core file.
+			viper.SetConfigFile(file)
+			if err := viper.MergeInConfig(); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return errors.Newf("config file %s not found", file)
+				}
+				return errors.Wrapf(err, "error reading config file %s", file)
+			}
+			// Merging replaces the whole targets list, so merge them separately by name.
+			fileTargets, err := readConfigTargets(file)
+			if err != nil {
+				return errors.Wrapf(err, "error reading targets of config file %s", file)
+			}
+			if fileTargets != nil {
+				hasTargets = true
+				targets = mergeTargetsByName(targets, fileTargets)
+			}
+		}
+		if hasTargets {
+			viper.Set("targets", targets)
+		}
 		err = viper.Unmarshal(cfg, func(config *mapstructure.DecoderConfig) {
 			config.TagName = "json"
 			config.Squash = true
@@ -268,3 +802,88 @@ func loadJSONConfigInto(cfg *Config, path string, automaticEnv bool, localMode b
 	}
 	return nil
 }
+
+// configFiles expands the config paths into the list of config files in order.
+// Directories are expanded into the json/json5 files directly inside them, sorted by name.
+func configFiles(paths []string) ([]string, error) {
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, errors.Newf("config file %s not found", path)
+			}
+			return nil, errors.Wrapf(err, "error reading config file %s", path)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading config directory %s", path)
+		}
+		found := false
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".json" && ext != ".json5") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+			found = true
+		}
+		if !found {
+			return nil, errors.Newf("no config files found in directory %s", path)
+		}
+	}
+	return files, nil
+}
+
+// readConfigTargets return the targets defined in the config file, or nil if the file does not define targets.
+func readConfigTargets(file string) ([]any, error) {
+	v := viper.New()
+	v.SetConfigType("json")
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	if !v.IsSet("targets") {
+		return nil, nil
+	}
+	targets, ok := v.Get("targets").([]any)
+	if !ok {
+		return nil, errors.New("targets must be a list")
+	}
+	return targets, nil
+}
+
+// mergeTargetsByName replaces the targets having the same name with the overrides, and appends the others.
+func mergeTargetsByName(targets []any, overrides []any) []any {
+	for _, override := range overrides {
+		name := targetName(override)
+		i := -1
+		if name != "" {
+			for j, target := range targets {
+				if targetName(target) == name {
+					i = j
+					break
+				}
+			}
+		}
+		if i >= 0 {
+			targets[i] = override
+			continue
+		}
+		targets = append(targets, override)
+	}
+	return targets
+}
+
+func targetName(target any) string {
+	m, ok := target.(map[string]any)
+	if !ok {
+		return ""
+	}
+	name, _ := m["name"].(string)
+	return name
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/getsentry/sentry-go"
+	"github.com/mawngo/go-errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppInitLocked(t *testing.T) {
+	flags := AppInitConfig{LocalMode: true, LockDir: t.TempDir(), LogOutput: "none"}
+	t.Chdir(t.TempDir())
+	app := &App{}
+	if err := app.Init(flags); err != nil {
+		t.Fatalf("Init() error = %s", err)
+	}
+
+	other := &App{}
+	if err := other.Init(flags); !errors.Is(err, ErrLocked) {
+		t.Errorf("Init() of another instance error = %v, want %v", err, ErrLocked)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatalf("Close() error = %s", err)
+	}
+
+	// The lock is released on close.
+	if err := other.Init(flags); err != nil {
+		t.Errorf("Init() after close error = %s", err)
+	}
+	if err := other.Close(); err != nil {
+		t.Errorf("Close() error = %s", err)
+	}
+}
+
+func TestUserAgentHeader(t *testing.T) {
+	tests := []struct {
+		revision  string
+		userAgent string
+		want      string
+	}{
+		{revision: "abc", want: "sin/abc"},
+		{revision: "abc", userAgent: "team-x/1.0", want: "sin/abc team-x/1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			app := &App{Revision: tt.revision}
+			app.UserAgent = tt.userAgent
+			if got := app.UserAgentHeader(); got != tt.want {
+				t.Errorf("UserAgentHeader() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// slowSentryTransport a sentry transport timing out on flush, recording the app state while flushing.
+type slowSentryTransport struct {
+	app *App
+	// lockHeld whether the lock file still existed while flushing.
+	lockHeld bool
+	// canceled whether the app context was canceled before flushing.
+	canceled bool
+}
+
+func (s *slowSentryTransport) Flush(timeout time.Duration) bool {
+	_, err := os.Stat(s.app.nameLockPath)
+	s.lockHeld = err == nil
+	s.canceled = s.app.Ctx.Err() != nil
+	time.Sleep(timeout)
+	return false
+}
+
+func (s *slowSentryTransport) Configure(sentry.ClientOptions) {}
+func (s *slowSentryTransport) SendEvent(*sentry.Event)        {}
+func (s *slowSentryTransport) Close()                         {}
+
+func TestAppCloseSlowSentryFlush(t *testing.T) {
+	t.Chdir(t.TempDir())
+	app := &App{}
+	if err := app.Init(AppInitConfig{LocalMode: true, LockDir: t.TempDir(), LogOutput: "none"}); err != nil {
+		t.Fatalf("Init() error = %s", err)
+	}
+	logFile, err := os.Create(filepath.Join(t.TempDir(), "sin.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.logFile = logFile
+	app.SentryDSN = "https://key@sentry.example.com/1"
+	app.SentryFlushTimeoutSeconds = 1
+	transport := &slowSentryTransport{app: app}
+	if err := sentry.Init(sentry.ClientOptions{Dsn: app.SentryDSN, Transport: transport}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sentry.CurrentHub().BindClient(nil) })
+
+	start := time.Now()
+	if err := app.Close(); err != nil {
+		t.Fatalf("Close() error = %s", err)
+	}
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("Close() took %s, want bounded by the 1s sentry flush timeout", took)
+	}
+	if !transport.canceled {
+		t.Errorf("context is not canceled before flushing sentry")
+	}
+	if !transport.lockHeld {
+		t.Errorf("lock file is removed before flushing sentry")
+	}
+	if _, err := os.Stat(app.nameLockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file is not removed after close: %v", err)
+	}
+	if _, err := logFile.WriteString("after close"); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("log file is not closed after close: %v", err)
+	}
+}
+
+// recordingSentryTransport a sentry transport recording the sent events.
+type recordingSentryTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (s *recordingSentryTransport) Flush(time.Duration) bool       { return true }
+func (s *recordingSentryTransport) Configure(sentry.ClientOptions) {}
+func (s *recordingSentryTransport) Close()                         {}
+
+func (s *recordingSentryTransport) SendEvent(event *sentry.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func TestSetupLoggingOutputs(t *testing.T) {
+	t.Chdir(t.TempDir())
+	stdout, err := os.Create("stdout.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create("stderr.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultLogger, defaultStdout, defaultStderr := slog.Default(), os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	t.Cleanup(func() {
+		os.Stdout, os.Stderr = defaultStdout, defaultStderr
+		slog.SetDefault(defaultLogger)
+		sentry.CurrentHub().BindClient(nil)
+		_ = stdout.Close()
+		_ = stderr.Close()
+	})
+
+	app := &App{}
+	app.Name = "db"
+	app.SentryDSN = "https://key@sentry.example.com/1"
+	app.LogOutputs = []LogOutputConfig{
+		{Output: LogOutputFile, Level: "debug"},
+		{Output: LogOutputStdout},
+		{Output: LogOutputStderr, Level: "error"},
+	}
+	if err := setupLogging(app); err != nil {
+		t.Fatalf("setupLogging() error = %s", err)
+	}
+	t.Cleanup(func() { _ = app.logFile.Close() })
+	// Record the events sent by the sentry handler instead of sending them.
+	transport := &recordingSentryTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: app.SentryDSN, Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentry.CurrentHub().BindClient(client)
+
+	slog.Debug("debug record")
+	slog.Info("info record")
+	slog.Warn("warn record")
+	slog.Error("error record")
+
+	tests := []struct {
+		output string
+		path   string
+		want   []string
+	}{
+		{output: LogOutputFile, path: "db" + LogFileExt, want: []string{"debug record", "info record", "warn record", "error record"}},
+		{output: LogOutputStdout, path: "stdout.log", want: []string{"info record", "warn record", "error record"}},
+		{output: LogOutputStderr, path: "stderr.log", want: []string{"error record"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				var record struct {
+					Msg string `json:"msg"`
+				}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("invalid json log %q: %s", line, err)
+				}
+				got = append(got, record.Msg)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s records = %v, want %v", tt.output, got, tt.want)
+			}
+		})
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	var got []string
+	for _, event := range transport.events {
+		got = append(got, event.Message)
+	}
+	if want := []string{"warn record", "error record"}; !slices.Equal(got, want) {
+		t.Errorf("sentry events = %v, want %v", got, want)
+	}
+}
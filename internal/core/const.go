@@ -5,3 +5,18 @@
 	BackupFileExt  = ".sinbak"
 	DefaultAppName = "sin"
 )
+
+// Log outputs of the slog logger.
+const (
+	LogOutputFile   = "file"
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+	LogOutputNone   = "none"
+)
+
+// Algorithms of the backup checksum files.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA512 = "sha512"
+	ChecksumBLAKE3 = "blake3"
+)
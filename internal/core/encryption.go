@@ -0,0 +1,82 @@
+package core
+
+import (
+	"filippo.io/age"
+	"github.com/mawngo/go-errors"
+	"os"
+	"strings"
+)
+
+type EncryptionConfig struct {
+	// Passphrase the passphrase for encrypting backups.
+	Passphrase string `json:"passphrase"`
+	// KeyFile the file containing the passphrase, trailing whitespaces are ignored.
+	// Cannot be used with Passphrase.
+	KeyFile string `json:"keyFile"`
+}
+
+// Enabled whether backups should be encrypted.
+func (c EncryptionConfig) Enabled() bool {
+	return c.Passphrase != "" || c.KeyFile != ""
+}
+
+// loadPassphrase return the passphrase from config or the key file.
+func (c EncryptionConfig) loadPassphrase() ([]byte, error) {
+	if c.Passphrase != "" && c.KeyFile != "" {
+		return nil, errors.New("must not specify both encryption passphrase and key file")
+	}
+	if c.Passphrase != "" {
+		return []byte(c.Passphrase), nil
+	}
+	b, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading encryption key file")
+	}
+	passphrase := strings.TrimRight(string(b), " \t\r\n")
+	if passphrase == "" {
+		return nil, errors.New("empty encryption key file " + c.KeyFile)
+	}
+	return []byte(passphrase), nil
+}
+
+// EncryptionPassphrase return the passphrase for encrypting backups, nil if encryption is disabled.
+func (app *App) EncryptionPassphrase() []byte {
+	return app.encryptionPassphrase
+}
+
+// loadAgeRecipients parses the age recipients (public keys).
+func loadAgeRecipients(recipients []string) ([]age.Recipient, error) {
+	parsed := make([]age.Recipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid age recipient '%s'", recipient)
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// loadAgeIdentities parses the age identities (private keys) from the identity file.
+func loadAgeIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening age identity file")
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid age identity file %s", path)
+	}
+	return identities, nil
+}
+
+// AgeRecipientKeys return the age recipients for encrypting backups, nil if age encryption is disabled.
+func (app *App) AgeRecipientKeys() []age.Recipient {
+	return app.ageRecipients
+}
+
+// AgeIdentityKeys return the age identities for decrypting pulled backups, nil if not configured.
+func (app *App) AgeIdentityKeys() []age.Identity {
+	return app.ageIdentities
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// hookArgs return the command and args of the hook.
+// A string hook is run using the shell, an array hook is run directly.
+// Return nil if the hook is not specified.
+func hookArgs(hook any) ([]string, error) {
+	switch h := hook.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if h == "" {
+			return nil, nil
+		}
+		if runtime.GOOS == "windows" {
+			return []string{"cmd", "/C", h}, nil
+		}
+		return []string{"sh", "-c", h}, nil
+	case []string:
+		return h, nil
+	case []any:
+		args := make([]string, 0, len(h))
+		for _, arg := range h {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, errors.Newf("invalid hook arg %v: must be a string", arg)
+			}
+			args = append(args, s)
+		}
+		return args, nil
+	default:
+		return nil, errors.Newf("invalid hook %v: must be a command string or an array of command and args", hook)
+	}
+}
+
+// RunHook runs the hook command with the env appended to the current environment.
+// The kind (pre, post) is only used for reporting. Does nothing if the hook is not specified.
+func (app *App) RunHook(kind string, hook any, env []string) error {
+	args, err := hookArgs(hook)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	command := exec.CommandContext(app.Ctx, args[0], args[1:]...)
+	command.Env = append(append(os.Environ(), "SIN_NAME="+app.Name), env...)
+	command.Stdout = app.ConsoleOutput()
+	command.Stderr = os.Stderr
+
+	start := time.Now()
+	pterm.Printf("Running %s hook\n", kind)
+	if err := command.Run(); err != nil {
+		return errors.Wrapf(err, "error running %s hook", kind)
+	}
+	slog.Info("Run hook",
+		slog.String("name", app.Name),
+		slog.String("hook", kind),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
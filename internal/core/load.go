@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadCheckInterval the interval of checking again while waiting for the system to become idle.
+const loadCheckInterval = 30 * time.Second
+
+// ErrLoadAvgUnsupported reading the system load average is not supported on the platform.
+var ErrLoadAvgUnsupported = errors.New("load average not supported")
+
+// LoadAvg return the 1 minute system load average.
+// Return ErrLoadAvgUnsupported on platforms other than linux and BSD (including macOS).
+func LoadAvg(ctx context.Context) (float64, error) {
+	var fields []string
+	switch runtime.GOOS {
+	case "linux":
+		b, err := os.ReadFile("/proc/loadavg")
+		if err != nil {
+			return 0, errors.Wrapf(err, "error reading load average")
+		}
+		fields = strings.Fields(string(b))
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		// Output format: { 1.23 1.10 1.00 }
+		out, err := exec.CommandContext(ctx, "sysctl", "-n", "vm.loadavg").Output()
+		if err != nil {
+			return 0, errors.Wrapf(err, "error reading load average")
+		}
+		fields = strings.Fields(strings.Trim(strings.TrimSpace(string(out)), "{}"))
+	default:
+		return 0, errors.Wrapf(ErrLoadAvgUnsupported, "platform %s", runtime.GOOS)
+	}
+	if len(fields) == 0 {
+		return 0, errors.New("error reading load average: empty output")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error parsing load average")
+	}
+	return load, nil
+}
+
+// checkLoad check whether the system is idle enough to run the backup,
+// that is the load average does not exceed MaxLoadAvg and the LoadCheck command succeeds.
+// Return the reason if the system is busy, empty if the backup can run.
+func (app *App) checkLoad() (string, error) {
+	if app.MaxLoadAvg > 0 {
+		load, err := LoadAvg(app.Ctx)
+		if err != nil && !errors.Is(err, ErrLoadAvgUnsupported) {
+			return "", err
+		}
+		if err == nil && load > app.MaxLoadAvg {
+			return "load average " + strconv.FormatFloat(load, 'f', 2, 64) +
+				" exceeds " + strconv.FormatFloat(app.MaxLoadAvg, 'f', -1, 64), nil
+		}
+	}
+	args, err := hookArgs(app.LoadCheck)
+	if err != nil || len(args) == 0 {
+		return "", err
+	}
+	command := exec.CommandContext(app.Ctx, args[0], args[1:]...)
+	command.Env = append(os.Environ(), "SIN_NAME="+app.Name)
+	command.Stdout = app.ConsoleOutput()
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "load check exited with code " + strconv.Itoa(exitErr.ExitCode()), nil
+		}
+		return "", errors.Wrapf(err, "error running load check")
+	}
+	return "", nil
+}
+
+// WaitForIdle check whether the system is idle enough to run the backup,
+// waiting up to LoadWaitSeconds for it to become idle.
+// Return false if the backup should be skipped as the system is still busy.
+func (app *App) WaitForIdle() (bool, error) {
+	if app.MaxLoadAvg <= 0 && app.LoadCheck == nil {
+		return true, nil
+	}
+	deadline := time.Now().Add(time.Duration(app.LoadWaitSeconds) * time.Second)
+	for {
+		reason, err := app.checkLoad()
+		if err != nil || reason == "" {
+			return err == nil, err
+		}
+		wait := min(loadCheckInterval, time.Until(deadline))
+		if wait <= 0 {
+			pterm.Warning.Printf("Skipped backup as the system is busy: %s\n", reason)
+			slog.Warn("Skipped backup as the system is busy",
+				slog.String("name", app.Name),
+				slog.String("reason", reason))
+			return false, nil
+		}
+		pterm.Printf("System is busy (%s), checking again in %s\n", reason, wait.Round(time.Second))
+		select {
+		case <-app.Ctx.Done():
+			return false, app.Ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
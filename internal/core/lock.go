@@ -0,0 +1,58 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockFileExt the extension of the name lock file.
+const lockFileExt = ".sinnamelock"
+
+// NameLockPath return the path of the name lock file.
+func (app *App) NameLockPath() string {
+	dir := app.LockDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, app.Name+lockFileExt)
+}
+
+// CheckNameLock check that the name lock file exists and its owner process is running.
+// Return the pid of the owner, or 0 if the lock file does not contain the pid (created by older versions).
+func (app *App) CheckNameLock() (int, error) {
+	path := app.NameLockPath()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, errors.Newf("lock file %s not found, no instance is running under name %s", path, app.Name)
+		}
+		return 0, errors.Wrapf(err, "error reading lock file %s", path)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, nil
+	}
+	if !processRunning(pid) {
+		return pid, errors.Newf("owner process %d of lock file %s is not running", pid, path)
+	}
+	return pid, nil
+}
+
+// processRunning check whether the process is running.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens the process on windows, which fails if it is not running.
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
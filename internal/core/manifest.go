@@ -0,0 +1,44 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"net/url"
+	"strings"
+)
+
+// ChecksumManifestConfig an external append-only manifest of the checksums of created backups.
+// Restore, pull and verify compare backups against the manifest instead of the checksum files on targets,
+// so tampering with both a backup and its checksum file is detected.
+type ChecksumManifestConfig struct {
+	// Path the local file or http(s) url of the manifest. Default empty, disabled.
+	// A url manifest is read by GET and appended by POST, each line is an entry.
+	Path string `json:"path"`
+	// Headers sent with the requests to the url manifest, such as Authorization.
+	Headers map[string]string `json:"headers"`
+}
+
+// Enabled whether the checksums of backups should be written to and verified against the manifest.
+func (c ChecksumManifestConfig) Enabled() bool {
+	return c.Path != ""
+}
+
+// IsURL whether the manifest is an http(s) url instead of a local file.
+func (c ChecksumManifestConfig) IsURL() bool {
+	return strings.HasPrefix(c.Path, "http://") || strings.HasPrefix(c.Path, "https://")
+}
+
+func (c ChecksumManifestConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.IsURL() {
+		if _, err := url.Parse(c.Path); err != nil {
+			return errors.Wrapf(err, "invalid checksum manifest url")
+		}
+		return nil
+	}
+	if len(c.Headers) > 0 {
+		return errors.New("checksum manifest headers are only supported for url manifest")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"text/template"
+)
+
+const (
+	WebhookOnSuccess = "success"
+	WebhookOnFailure = "failure"
+	WebhookOnAlways  = "always"
+)
+
+type NotifyConfig struct {
+	Slack   ChatNotifyConfig `json:"slack"`
+	Discord ChatNotifyConfig `json:"discord"`
+}
+
+// ChatNotifyConfig config of the chat (Slack, Discord) notification.
+type ChatNotifyConfig struct {
+	// WebhookURL the incoming webhook url of the channel, empty to disable.
+	WebhookURL string `json:"webhookURL"`
+	// OnlyOnFailure only notify failed runs, avoid spamming the channel when the frequency is high.
+	OnlyOnFailure bool `json:"onlyOnFailure"`
+}
+
+type WebhookConfig struct {
+	// URL the url to POST the notification to.
+	URL string `json:"url"`
+	// On when to send the notification: success, failure or always (default).
+	On string `json:"on"`
+	// Template optional go template of the request body, executed with the notification payload.
+	// Default to the json encoded payload.
+	Template string `json:"template"`
+}
+
+// ShouldSend check whether the webhook should be sent for the run result.
+func (c WebhookConfig) ShouldSend(failed bool) bool {
+	switch c.On {
+	case WebhookOnSuccess:
+		return !failed
+	case WebhookOnFailure:
+		return failed
+	default:
+		return true
+	}
+}
+
+func (c WebhookConfig) validate() error {
+	if c.URL == "" {
+		return errors.New("missing url in webhooks config")
+	}
+	switch c.On {
+	case "", WebhookOnSuccess, WebhookOnFailure, WebhookOnAlways:
+	default:
+		return errors.Newf("invalid webhook on %s, must be one of: success, failure, always", c.On)
+	}
+	if c.Template != "" {
+		if _, err := template.New("webhook").Parse(c.Template); err != nil {
+			return errors.Wrapf(err, "invalid webhook template of %s", c.URL)
+		}
+	}
+	return nil
+}
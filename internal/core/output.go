@@ -0,0 +1,45 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"os"
+	"slices"
+)
+
+// Output formats of the result of backup runs.
+const (
+	// OutputFormatText prints the human-readable output.
+	OutputFormatText = "text"
+	// OutputFormatJSON prints the result of each backup run to stdout as a json object,
+	// writing the human-readable output to stderr.
+	OutputFormatJSON = "json"
+)
+
+// JSONOutput whether the result of each backup run is printed to stdout as a json object.
+func (app *App) JSONOutput() bool {
+	return app.OutputFormat == OutputFormatJSON
+}
+
+// loadOutputFormat applies the output format flag, validating that stdout can only contain the json results.
+func (app *App) loadOutputFormat(c AppInitConfig) error {
+	if c.JSONOutput {
+		app.OutputFormat = OutputFormatJSON
+	}
+	switch app.OutputFormat {
+	case "", OutputFormatText:
+		app.OutputFormat = OutputFormatText
+		return nil
+	case OutputFormatJSON:
+	default:
+		return errors.Newf("invalid output format '%s': must be one of text, json", app.OutputFormat)
+	}
+	if app.stdoutMode {
+		return errors.New("json output must not be used with stdout mode, as stdout only contains the backup")
+	}
+	if slices.ContainsFunc(app.LogOutputs, func(o LogOutputConfig) bool { return o.Output == LogOutputStdout }) {
+		return errors.New("json output must not be used with stdout log output, use stderr instead")
+	}
+	// Keep stdout only containing the json results.
+	redirectOutput(os.Stderr)
+	return nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// ioNiceClasses the ionice scheduling class number of each IONiceClass.
+var ioNiceClasses = map[string]string{
+	"realtime":    "1",
+	"best-effort": "2",
+	"idle":        "3",
+}
+
+// validatePriority check the Niceness and IONiceClass config, and that the nice and ionice commands exist.
+func (app *App) validatePriority() error {
+	if app.Niceness < -20 || app.Niceness > 19 {
+		return errors.Newf("invalid niceness %d: must be between -20 and 19", app.Niceness)
+	}
+	if app.IONiceClass != "" {
+		if _, ok := ioNiceClasses[app.IONiceClass]; !ok {
+			return errors.Newf("invalid ioNiceClass '%s': must be realtime, best-effort or idle", app.IONiceClass)
+		}
+	}
+	if app.Niceness != 0 && runtime.GOOS != "windows" {
+		if _, err := exec.LookPath("nice"); err != nil {
+			return errors.Wrapf(err, "niceness requires nice command")
+		}
+	}
+	if app.IONiceClass != "" && runtime.GOOS == "linux" {
+		if _, err := exec.LookPath("ionice"); err != nil {
+			return errors.Wrapf(err, "ioNiceClass requires ionice command")
+		}
+	}
+	return nil
+}
+
+// PriorityArgs return the command prefix running a subprocess with the configured CPU priority (nice)
+// and IO priority (ionice). The CPU priority is not supported on windows, the IO priority is linux only.
+// Return nil if not configured or not supported on the platform.
+func (app *App) PriorityArgs() []string {
+	var args []string
+	if app.Niceness != 0 && runtime.GOOS != "windows" {
+		args = append(args, "nice", "-n", strconv.Itoa(app.Niceness))
+	}
+	if app.IONiceClass != "" && runtime.GOOS == "linux" {
+		args = append(args, "ionice", "-c", ioNiceClasses[app.IONiceClass])
+	}
+	return args
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"os"
+	"sync/atomic"
+)
+
+// Modes of displaying the progress of transfers.
+const (
+	// ProgressNone does not display progress.
+	ProgressNone = "none"
+	// ProgressAuto displays progress bars on a terminal, otherwise periodic log lines.
+	ProgressAuto = "auto"
+	// ProgressBar displays a progress bar for each transfer and the overall progress.
+	ProgressBar = "bar"
+	// ProgressLog prints the progress of each transfer periodically.
+	ProgressLog = "log"
+)
+
+type progressCounterKey struct{}
+
+// ProgressCounter counts the bytes transferred by an operation, for displaying its progress.
+// ProgressCounter is safe for concurrent use, nil ProgressCounter counts nothing.
+type ProgressCounter struct {
+	n atomic.Int64
+}
+
+// Add counts n more transferred bytes.
+func (c *ProgressCounter) Add(n int) {
+	if c == nil || n <= 0 {
+		return
+	}
+	c.n.Add(int64(n))
+}
+
+// Reset restarts counting, as the transfer is retried from the beginning.
+func (c *ProgressCounter) Reset() {
+	if c == nil {
+		return
+	}
+	c.n.Store(0)
+}
+
+// Load return the number of transferred bytes.
+func (c *ProgressCounter) Load() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.n.Load()
+}
+
+// WithProgressCounter return a copy of ctx that carries the counter.
+func WithProgressCounter(ctx context.Context, counter *ProgressCounter) context.Context {
+	return context.WithValue(ctx, progressCounterKey{}, counter)
+}
+
+// ProgressCounterFrom return the counter carried by ctx, or nil if there is none.
+func ProgressCounterFrom(ctx context.Context) *ProgressCounter {
+	counter, _ := ctx.Value(progressCounterKey{}).(*ProgressCounter)
+	return counter
+}
+
+// resolveProgressMode resolves the auto mode based on whether stdout is a terminal, and validates the mode.
+// Progress bars are not displayed if stdout is reserved, as it only contains the backup in stdout mode,
+// or the results with json output.
+func resolveProgressMode(mode string, stdoutReserved bool) (string, error) {
+	switch mode {
+	case "", ProgressNone:
+		return ProgressNone, nil
+	case ProgressAuto:
+		if isTerminal(os.Stdout) && !stdoutReserved {
+			return ProgressBar, nil
+		}
+		return ProgressLog, nil
+	case ProgressBar:
+		if stdoutReserved {
+			return "", errors.New("progress bar must not be used with stdout mode or json output, use log instead")
+		}
+		return mode, nil
+	case ProgressLog:
+		return mode, nil
+	}
+	return "", errors.Newf("invalid progress '%s': must be one of auto, bar, log, none", mode)
+}
+
+// isTerminal check whether the file is a terminal, so it can display live output.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ProgressMode return the resolved mode of displaying the progress of transfers: bar, log or none.
+func (app *App) ProgressMode() string {
+	return app.progressMode
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"sync"
+	"time"
+)
+
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+type retryBudgetKey struct{}
+
+type RetryBudgetConfig struct {
+	// MaxAttempts maximum number of retries in a run, across all operations.
+	// Default 0 (unlimited).
+	MaxAttempts int `json:"maxAttempts"`
+	// MaxDuration maximum total time spent on retrying in a run, across all operations.
+	// Default 0 (unlimited).
+	MaxDuration time.Duration `json:"maxDuration"`
+}
+
+// RetryBudget limits the total retries of a run.
+// RetryBudget is safe for concurrent use, nil RetryBudget is unlimited.
+type RetryBudget struct {
+	RetryBudgetConfig
+
+	mu       sync.Mutex
+	attempts int
+	spent    time.Duration
+}
+
+func NewRetryBudget(config RetryBudgetConfig) *RetryBudget {
+	return &RetryBudget{RetryBudgetConfig: config}
+}
+
+// Take consumes one retry that has spent d, return ErrRetryBudgetExhausted if there is no budget left.
+func (b *RetryBudget) Take(d time.Duration) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts++
+	b.spent += d
+	if b.MaxAttempts > 0 && b.attempts > b.MaxAttempts {
+		return errors.Wrapf(ErrRetryBudgetExhausted, "exceed %d retries", b.MaxAttempts)
+	}
+	if b.MaxDuration > 0 && b.spent > b.MaxDuration {
+		return errors.Wrapf(ErrRetryBudgetExhausted, "exceed %s retrying", b.MaxDuration.String())
+	}
+	return nil
+}
+
+// Reset restores the budget for a new run.
+func (b *RetryBudget) Reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts = 0
+	b.spent = 0
+}
+
+// WithRetryBudget return a copy of ctx that carries the budget.
+func WithRetryBudget(ctx context.Context, budget *RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// RetryBudgetFrom return the budget carried by ctx, or nil if there is none.
+func RetryBudgetFrom(ctx context.Context) *RetryBudget {
+	budget, _ := ctx.Value(retryBudgetKey{}).(*RetryBudget)
+	return budget
+}
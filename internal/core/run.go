@@ -12,7 +12,16 @@
 
 // Run execute the function with given frequency without overlapping.
 // Run stop if the function returns an error.
+// The RetryBudget carried by ctx is reset before each execution.
 func Run(ctx context.Context, freq string, fn func() error) error {
+	if budget := RetryBudgetFrom(ctx); budget != nil {
+		run := fn
+		fn = func() error {
+			budget.Reset()
+			return run()
+		}
+	}
+
 	if freq == "" {
 		return fn()
 	}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/mawngo/go-errors"
+	"os"
+)
+
+// PublicKeyExt suffix of the public key file generated alongside the signing key.
+const PublicKeyExt = ".pub"
+
+type SigningConfig struct {
+	// KeyFile the Ed25519 private key file (PEM, PKCS #8) for signing the checksum of backups.
+	KeyFile string `json:"keyFile"`
+	// PublicKeyFile the Ed25519 public key file (PEM, PKIX) for verifying signatures.
+	// Default to the public key of KeyFile.
+	PublicKeyFile string `json:"publicKeyFile"`
+}
+
+// load return the signing key and the public key, nil if not configured.
+func (c SigningConfig) load() (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	var key ed25519.PrivateKey
+	var pub ed25519.PublicKey
+	if c.KeyFile != "" {
+		k, err := loadSigningKey(c.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		key = k
+		pub = k.Public().(ed25519.PublicKey)
+	}
+	if c.PublicKeyFile != "" {
+		p, err := loadPublicKey(c.PublicKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if key != nil && !pub.Equal(p) {
+			return nil, nil, errors.New("signing public key does not match the signing key")
+		}
+		pub = p
+	}
+	return key, pub, nil
+}
+
+// GenerateSigningKey generates an Ed25519 key pair, writing the private key to path
+// and the public key to path + PublicKeyExt. Existing files are never overwritten.
+func GenerateSigningKey(path string) error {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if err := writeNewFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
+		return errors.Wrapf(err, "error writing signing key")
+	}
+	if err := writeNewFile(path+PublicKeyExt, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}), 0644); err != nil {
+		return errors.Wrapf(errors.Join(err, os.Remove(path)), "error writing public key")
+	}
+	return nil
+}
+
+// writeNewFile writes the content into a new file, failing if the file already exists.
+func writeNewFile(path string, content []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadSigningKey parses the Ed25519 private key file, compatible with `openssl genpkey -algorithm ed25519`.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid signing key file %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid signing key file %s", path)
+	}
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Newf("invalid signing key file %s: not an ed25519 key", path)
+	}
+	return k, nil
+}
+
+// loadPublicKey parses the Ed25519 public key file, compatible with `openssl pkey -pubout`.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid signing public key file %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid signing public key file %s", path)
+	}
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.Newf("invalid signing public key file %s: not an ed25519 key", path)
+	}
+	return k, nil
+}
+
+func readPEM(path string, blockType string) (*pem.Block, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != blockType {
+		return nil, errors.Newf("missing %s pem block", blockType)
+	}
+	return block, nil
+}
+
+// SigningKey return the key for signing the checksum of backups, nil if signing is disabled.
+func (app *App) SigningKey() ed25519.PrivateKey {
+	return app.signingKey
+}
+
+// SigningPublicKey return the key for verifying the signature of backups, nil if not configured.
+func (app *App) SigningPublicKey() ed25519.PublicKey {
+	return app.signingPublicKey
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"io"
+	"os"
+	"slices"
+)
+
+// StdoutMode whether the backup is written to stdout, for piping it into other tools.
+// All other output is written to stderr, so stdout only contains the backup.
+func (app *App) StdoutMode() bool {
+	return app.stdoutMode
+}
+
+// StdoutWithTargets whether the backup is also synced to the configured targets in stdout mode.
+func (app *App) StdoutWithTargets() bool {
+	return app.stdoutWithTargets
+}
+
+// StdoutChecksumFile the file the checksum of the backup written to stdout is written to,
+// empty to print it to stderr.
+func (app *App) StdoutChecksumFile() string {
+	return app.stdoutChecksumFile
+}
+
+// ConsoleOutput return the output of the commands run by sin, such as hooks,
+// which is stderr in stdout mode or with json output, to keep stdout only containing the backup or the results.
+func (app *App) ConsoleOutput() io.Writer {
+	if app.stdoutMode || app.JSONOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// loadStdoutMode applies the stdout mode flags, validating that the config can be used with it.
+func (app *App) loadStdoutMode(c AppInitConfig) error {
+	if !c.StdoutMode {
+		if c.StdoutWithTargets || c.StdoutChecksumFile != "" {
+			return errors.New("stdout with targets and stdout checksum file must only be used with stdout mode")
+		}
+		return nil
+	}
+	if c.LocalMode {
+		return errors.New("must not use both local mode and stdout mode")
+	}
+	if app.Frequency != "" {
+		return errors.New("stdout mode must not be used with frequency, as only one backup can be written to stdout")
+	}
+	if slices.ContainsFunc(app.LogOutputs, func(o LogOutputConfig) bool { return o.Output == LogOutputStdout }) {
+		return errors.New("stdout mode must not be used with stdout log output, use stderr instead")
+	}
+	app.stdoutMode = true
+	app.stdoutWithTargets = c.StdoutWithTargets
+	app.stdoutChecksumFile = c.StdoutChecksumFile
+	if !app.stdoutWithTargets {
+		// Stdout is the only target, so targets are not required.
+		app.RequireTargets = false
+	}
+	return nil
+}
+
+// redirectOutput redirects the output of the default pterm printers to w.
+func redirectOutput(w io.Writer) {
+	printers := []*pterm.PrefixPrinter{&pterm.Info, &pterm.Success, &pterm.Warning, &pterm.Error, &pterm.Debug, &pterm.Description, &pterm.Fatal}
+	for _, printer := range printers {
+		printer.Writer = w
+	}
+	pterm.SetDefaultOutput(w)
+}
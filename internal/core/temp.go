@@ -0,0 +1,63 @@
+package core
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// tempFiles the temp files created during this run.
+type tempFiles struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+// TrackTempFile records the temp files (or directories) created during this run,
+// which are removed on close if CleanTempOnExit is enabled and they still exist.
+func (app *App) TrackTempFile(paths ...string) {
+	app.tempFiles.mu.Lock()
+	defer app.tempFiles.mu.Unlock()
+	if app.tempFiles.paths == nil {
+		app.tempFiles.paths = make(map[string]struct{})
+	}
+	for _, path := range paths {
+		app.tempFiles.paths[filepath.Clean(path)] = struct{}{}
+	}
+}
+
+// UntrackTempFile stops tracking the temp files, for example backups that are intentionally kept.
+func (app *App) UntrackTempFile(paths ...string) {
+	app.tempFiles.mu.Lock()
+	defer app.tempFiles.mu.Unlock()
+	for _, path := range paths {
+		delete(app.tempFiles.paths, filepath.Clean(path))
+	}
+}
+
+// cleanTempFiles removes the tracked temp files that still exist, leftover by failed or interrupted backups.
+// Files not created by this run are never touched.
+func (app *App) cleanTempFiles() error {
+	app.tempFiles.mu.Lock()
+	defer app.tempFiles.mu.Unlock()
+	var errs []error
+	removed := 0
+	for path := range app.tempFiles.paths {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, errors.Wrapf(err, "error removing temp file %s", path))
+			continue
+		}
+		removed++
+		slog.Info("Removed temp file", slog.String("name", app.Name), slog.String("path", path))
+	}
+	app.tempFiles.paths = nil
+	if removed > 0 {
+		pterm.Printf("Removed %d leftover temp files\n", removed)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppCleanTempFiles(t *testing.T) {
+	tests := []struct {
+		name            string
+		cleanTempOnExit bool
+		// wantRemoved the files expected to be removed on close, other files must be kept.
+		wantRemoved []string
+	}{
+		{name: "enabled", cleanTempOnExit: true, wantRemoved: []string{"db.sinbak.partial", "db.sinbak.error", "dump"}},
+		{name: "disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := []string{"db.sinbak.partial", "db.sinbak.error", "kept.sinbak", "other.sinbak.partial", "unrelated.txt"}
+			for _, name := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.MkdirAll(filepath.Join(dir, "dump", "nested"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, "dump")
+
+			app := &App{}
+			app.CleanTempOnExit = tt.cleanTempOnExit
+			app.TrackTempFile(
+				filepath.Join(dir, "db.sinbak.partial"),
+				filepath.Join(dir, "db.sinbak.error"),
+				filepath.Join(dir, "dump"),
+				filepath.Join(dir, "kept.sinbak"),
+				// Already removed by the run.
+				filepath.Join(dir, "missing.sinbak"),
+			)
+			app.UntrackTempFile(filepath.Join(dir, "kept.sinbak"))
+
+			if err := app.Close(); err != nil {
+				t.Fatalf("Close() error = %s", err)
+			}
+			removed := make(map[string]bool)
+			for _, name := range tt.wantRemoved {
+				removed[name] = true
+			}
+			for _, name := range files {
+				_, err := os.Lstat(filepath.Join(dir, name))
+				if exists := err == nil; exists == removed[name] {
+					t.Errorf("%s exists = %v, want %v", name, exists, !removed[name])
+				}
+			}
+		})
+	}
+}
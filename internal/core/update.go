@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// updateCheckURL the GitHub API returning the latest release of sin.
+	updateCheckURL = "https://api.github.com/repos/mawngo/sin/releases/latest"
+	// updateCheckInterval the interval between update checks, the result is cached in the state file in between.
+	updateCheckInterval = 24 * time.Hour
+	// updateCheckTimeout the timeout of the update check request.
+	updateCheckTimeout = 10 * time.Second
+	// updateStateFile the name of the state file caching the last update check.
+	updateStateFile = "update-check.json"
+)
+
+// updateState the cached result of the last update check.
+type updateState struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Latest    string    `json:"latest"`
+}
+
+// loadVersion return the module version of the build, or empty if unknown (devel build).
+func loadVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "(devel)" {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// checkUpdatesPeriodically checks for a newer release of sin now and then every updateCheckInterval
+// until the app is closed, logging a notice if one is available. Never updates automatically.
+func (app *App) checkUpdatesPeriodically() {
+	ticker := time.NewTicker(updateCheckInterval)
+	defer ticker.Stop()
+	for {
+		app.checkUpdates()
+		select {
+		case <-ticker.C:
+		case <-app.Ctx.Done():
+			return
+		}
+	}
+}
+
+// checkUpdates logs a notice if the latest release is newer than the running version.
+// The latest release is only fetched if the cached check is older than updateCheckInterval.
+// Errors are only logged at debug level, as the check must never affect backups.
+func (app *App) checkUpdates() {
+	if app.Version == "" {
+		slog.Debug("Skip checking updates of unknown version", slog.String("revision", app.Revision))
+		return
+	}
+	statePath := updateStatePath()
+	state, err := readUpdateState(statePath)
+	if err != nil || time.Since(state.CheckedAt) >= updateCheckInterval {
+		latest, err := app.fetchLatestVersion()
+		if err != nil {
+			slog.Debug("Error checking updates", slog.Any("err", err))
+			return
+		}
+		state = updateState{CheckedAt: time.Now(), Latest: latest}
+		if err := writeUpdateState(statePath, state); err != nil {
+			slog.Debug("Error caching update check", slog.Any("err", err))
+		}
+	}
+	if compareVersions(state.Latest, app.Version) > 0 {
+		pterm.Info.Printfln("A new version of sin is available: %s (current %s)", state.Latest, app.Version)
+		slog.Info("New version available",
+			slog.String("current", app.Version),
+			slog.String("latest", state.Latest))
+	}
+}
+
+// fetchLatestVersion return the tag of the latest release.
+func (app *App) fetchLatestVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(app.Ctx, updateCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, updateCheckURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", app.UserAgentHeader())
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Newf("unexpected status %s", res.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return "", errors.Wrapf(err, "error decoding release")
+	}
+	if release.TagName == "" {
+		return "", errors.New("missing release tag")
+	}
+	return release.TagName, nil
+}
+
+// updateStatePath return the path of the update check state file in the user cache directory,
+// or the os temp directory if the user cache directory is unknown.
+func updateStatePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "sin", updateStateFile)
+}
+
+func readUpdateState(path string) (updateState, error) {
+	var state updateState
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(b, &state)
+	return state, err
+}
+
+func writeUpdateState(path string, state updateState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// compareVersions compares two semantic versions (v1.2.3), return positive if a is newer than b.
+// A pre-release or pseudo-version (v1.2.4-0.20250101-abcdef) is older than the release with the same numbers.
+func compareVersions(a string, b string) int {
+	aNums, aPre := parseVersion(a)
+	bNums, bPre := parseVersion(b)
+	for i := range aNums {
+		if aNums[i] != bNums[i] {
+			return aNums[i] - bNums[i]
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+// parseVersion return the major, minor, patch numbers and the pre-release of the version.
+// Missing or invalid numbers are treated as 0, build metadata (+incompatible) is ignored.
+func parseVersion(v string) ([3]int, string) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ := strings.Cut(v, "-")
+	var nums [3]int
+	for i, s := range strings.SplitN(v, ".", 3) {
+		nums[i], _ = strconv.Atoi(s)
+	}
+	return nums, pre
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strings"
+	"time"
+)
+
+// maxDiscordContent the maximum length of discord message content.
+const maxDiscordContent = 2000
+
+var _ Notifier = (*slackNotifier)(nil)
+var _ Notifier = (*discordNotifier)(nil)
+
+type slackNotifier struct {
+	core.ChatNotifyConfig
+	userAgent string
+}
+
+func (n *slackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, result Result) error {
+	if n.OnlyOnFailure && !result.Failed {
+		return nil
+	}
+	body, err := json.Marshal(map[string]string{"text": formatMessage(result, "*")})
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.WebhookURL, n.userAgent, "application/json", body)
+}
+
+type discordNotifier struct {
+	core.ChatNotifyConfig
+	userAgent string
+}
+
+func (n *discordNotifier) Name() string {
+	return "discord"
+}
+
+func (n *discordNotifier) Notify(ctx context.Context, result Result) error {
+	if n.OnlyOnFailure && !result.Failed {
+		return nil
+	}
+	content := formatMessage(result, "**")
+	if runes := []rune(content); len(runes) > maxDiscordContent {
+		content = string(runes[:maxDiscordContent-3]) + "..."
+	}
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.WebhookURL, n.userAgent, "application/json", body)
+}
+
+// formatMessage format the result into a readable chat message, using bold as the bold markup.
+func formatMessage(result Result, bold string) string {
+	b := strings.Builder{}
+	if result.Failed {
+		b.WriteString(":x: ")
+	} else {
+		b.WriteString(":white_check_mark: ")
+	}
+	status := "succeeded"
+	if result.Failed {
+		status = "failed"
+	}
+	_, _ = fmt.Fprintf(&b, "%s%s%s %s backup %s, took %s", bold, result.Name, bold, result.Task, status, result.Duration.Round(time.Millisecond))
+	if result.Backup != "" {
+		_, _ = fmt.Fprintf(&b, "\n%s (%s)", result.Backup, utils.FormatBytes(result.Bytes))
+	}
+	for _, target := range result.Targets {
+		switch {
+		case target.Skipped:
+			_, _ = fmt.Fprintf(&b, "\n• %s: skipped", target.Target)
+		case target.Error != "":
+			_, _ = fmt.Fprintf(&b, "\n• %s: failed after %s: %s", target.Target, target.Duration.Round(time.Millisecond), target.Error)
+		default:
+			_, _ = fmt.Fprintf(&b, "\n• %s: synced in %s", target.Target, target.Duration.Round(time.Millisecond))
+			if target.Reclaimed > 0 {
+				_, _ = fmt.Fprintf(&b, ", reclaimed %s", utils.FormatBytes(target.Reclaimed))
+			}
+		}
+	}
+	if result.Error != "" {
+		_, _ = fmt.Fprintf(&b, "\nError (%s): %s", result.Category, result.Error)
+	}
+	return b.String()
+}
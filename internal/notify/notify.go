@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/mawngo/go-try/v2"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"net/http"
+	"sin/internal/core"
+	"sin/internal/store"
+	"time"
+)
+
+const (
+	requestTimeout  = 10 * time.Second
+	requestAttempts = 3
+)
+
+// Result the result of a backup run.
+type Result struct {
+	Name string `json:"name"`
+	// Task the source type of the backup.
+	Task   string    `json:"task"`
+	Failed bool      `json:"failed"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Duration of the run in nanoseconds.
+	Duration time.Duration      `json:"duration"`
+	Backup   string             `json:"backup,omitempty"`
+	Bytes    int64              `json:"bytes"`
+	Targets  []store.SyncResult `json:"targets"`
+	Error    string             `json:"error,omitempty"`
+	// Category the error category of the exit code.
+	Category string `json:"category,omitempty"`
+}
+
+// Notifier notifies the result of backup runs.
+type Notifier interface {
+	// Name of the notifier for logging, must not contain secrets.
+	Name() string
+	// Notify sends the result, return error if the notification cannot be delivered.
+	Notify(ctx context.Context, result Result) error
+}
+
+// NewNotifiers create the notifiers configured in the app.
+func NewNotifiers(app *core.App) []Notifier {
+	userAgent := app.UserAgentHeader()
+	notifiers := make([]Notifier, 0, len(app.Webhooks)+2)
+	for _, webhook := range app.Webhooks {
+		notifiers = append(notifiers, &webhookNotifier{WebhookConfig: webhook, userAgent: userAgent})
+	}
+	if app.Notify.Slack.WebhookURL != "" {
+		notifiers = append(notifiers, &slackNotifier{ChatNotifyConfig: app.Notify.Slack, userAgent: userAgent})
+	}
+	if app.Notify.Discord.WebhookURL != "" {
+		notifiers = append(notifiers, &discordNotifier{ChatNotifyConfig: app.Notify.Discord, userAgent: userAgent})
+	}
+	return notifiers
+}
+
+// NotifyAll sends the result to all notifiers.
+// Failures are logged and never returned, as they must not fail the backup.
+func NotifyAll(notifiers []Notifier, result Result) {
+	// Use a separate context, so the result is still delivered if the run is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), requestAttempts*2*requestTimeout)
+	defer cancel()
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, result); err != nil {
+			pterm.Warning.Println("Error sending notification to", notifier.Name(), err)
+			slog.Warn("Error sending notification",
+				slog.String("name", result.Name),
+				slog.String("notifier", notifier.Name()),
+				slog.Any("err", err))
+		}
+	}
+}
+
+// post sends the body to the url, retrying on error.
+func post(ctx context.Context, url string, userAgent string, contentType string, body []byte) error {
+	client := http.Client{Timeout: requestTimeout}
+	return try.DoCtx(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("User-Agent", userAgent)
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode >= 300 {
+			return errors.Newf("unexpected status %s", res.Status)
+		}
+		return nil
+	}, try.WithAttempts(requestAttempts), try.WithFixedBackoff(2*time.Second))
+}
@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	t.Cleanup(server.Close)
+
+	if err := post(context.Background(), server.URL, "sin/abc team-x", "application/json", []byte("{}")); err != nil {
+		t.Fatalf("post() error = %s", err)
+	}
+	if got != "sin/abc team-x" {
+		t.Errorf("User-Agent = %q, want %q", got, "sin/abc team-x")
+	}
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mawngo/go-errors"
+	"net/url"
+	"sin/internal/core"
+	"text/template"
+)
+
+var _ Notifier = (*webhookNotifier)(nil)
+
+// webhookNotifier posts the result as json, or rendered using the configured template.
+type webhookNotifier struct {
+	core.WebhookConfig
+	userAgent string
+}
+
+func (n *webhookNotifier) Name() string {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return "webhook"
+	}
+	return "webhook " + u.Redacted()
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, result Result) error {
+	if !n.ShouldSend(result.Failed) {
+		return nil
+	}
+	var body []byte
+	if n.Template == "" {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		body = b
+	} else {
+		tmpl, err := template.New("webhook").Parse(n.Template)
+		if err != nil {
+			return errors.Wrapf(err, "invalid webhook template")
+		}
+		buf := bytes.Buffer{}
+		if err := tmpl.Execute(&buf, result); err != nil {
+			return errors.Wrapf(err, "error executing webhook template")
+		}
+		body = buf.Bytes()
+	}
+	return post(ctx, n.URL, n.userAgent, "application/json", body)
+}
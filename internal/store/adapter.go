@@ -2,13 +2,26 @@
 
 import (
 	"context"
-	"errors"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"io"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	AdapterS3Type   = "s3"
 	AdapterFileType = "file"
 	AdapterMockType = "mock"
+	// AdapterStdoutType the pseudo target writing the backup to stdout in stdout mode, not configurable in targets.
+	AdapterStdoutType = "stdout"
+
+	defaultStatConcurrency = 8
 )
 
 // Adapter abstract storage adapter.
@@ -33,6 +46,16 @@ type Adapter interface {
 
 var (
 	ErrFileNotFound = errors.New("file not found")
+	// ErrPathNotFound the base path of the target does not exist.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrNoTargets there are no targets to perform the operation on.
+	ErrNoTargets = errors.New("no targets")
+	// ErrUploadTooLarge the backup exceeds the maximum object size of the target.
+	ErrUploadTooLarge = errors.New("upload too large")
+	// ErrNoChecksum the checksum file of the backup does not exist, so it cannot be verified.
+	ErrNoChecksum = errors.New("checksum file not found")
+	// ErrSourceChanged the local backup changed while syncing it, so it must be created again.
+	ErrSourceChanged = errors.New("local backup changed")
 )
 
 // Downloader Adapter that can download a file.
@@ -44,6 +67,114 @@ type Downloader interface {
 	Download(ctx context.Context, destination string, sourcePaths ...string) error
 }
 
+// Mover Adapter that can rename a file.
+type Mover interface {
+	Adapter
+	// Move renames a file and its checksum file, override if the destination already exists.
+	Move(ctx context.Context, source string, destination string) error
+}
+
+// PathChecker Adapter that can check whether its base path exists,
+// so a missing path (usually a misconfigured path) can be told apart from an empty one.
+type PathChecker interface {
+	Adapter
+	// PathExists check whether the base path of the adapter exists.
+	PathExists(ctx context.Context) (bool, error)
+}
+
+// Pinger Adapter that can check whether its storage can be reached, without reading or writing backups.
+type Pinger interface {
+	Adapter
+	// Ping check that the storage can be reached with the configured credentials.
+	Ping(ctx context.Context) error
+}
+
+// StreamSaver Adapter that can save a file from a reader, without a local copy of the file.
+type StreamSaver interface {
+	Adapter
+	// SaveStream saves the content of the reader to the storage, override if the file already exists.
+	// The size is -1 if unknown. The checksum file is created from the content while reading it.
+	// If extra pathElems are given, pathElems will be joined.
+	SaveStream(ctx context.Context, reader io.Reader, size int64, pathElem string, pathElems ...string) error
+}
+
+// backgroundWaiter Adapter that may continue working in the background after saving a file.
+type backgroundWaiter interface {
+	// waitBackground waits for the background work to finish.
+	waitBackground()
+}
+
+// Verifier Adapter that can verify a file against its checksum file in place,
+// without downloading it to the local disk.
+type Verifier interface {
+	Adapter
+	// Verify computes the checksum of the file and compares it to its checksum file.
+	// Return utils.ErrChecksumMismatch if mismatched, ErrNoChecksum if the checksum file does not exist.
+	// Verify must be safe for concurrent use.
+	Verify(ctx context.Context, pathElem string, pathElems ...string) error
+}
+
+// Hasher Adapter that can compute the checksum of a file in place, without downloading it to the local disk.
+type Hasher interface {
+	Adapter
+	// Checksum computes the checksum of the file using the algorithm.
+	// Return ErrFileNotFound if the file does not exist. Checksum must be safe for concurrent use.
+	Checksum(ctx context.Context, algo string, pathElem string, pathElems ...string) ([]byte, error)
+}
+
+// FileReader Adapter that can read a small file into memory, such as a signature file.
+type FileReader interface {
+	Adapter
+	// ReadFile return the content of the file, ErrFileNotFound if the file does not exist.
+	ReadFile(ctx context.Context, pathElem string, pathElems ...string) ([]byte, error)
+}
+
+// verifyChecksum compares the computed checksum to the content of the checksum file.
+func verifyChecksum(path string, expected string, checksum []byte) error {
+	expected = strings.TrimSpace(expected)
+	if expected == "" {
+		return errors.Wrapf(ErrNoChecksum, "empty checksum file of %s", path)
+	}
+	if actual := hex.EncodeToString(checksum); expected != actual {
+		return errors.Wrapf(utils.ErrChecksumMismatch, "%s: expected %s, got %s", path, expected, actual)
+	}
+	return nil
+}
+
+// FileInfo information of a file in the storage.
+type FileInfo struct {
+	Name string
+	Size int64
+	// ModTime the last modification time of the file, zero if unknown.
+	ModTime time.Time
+}
+
+// Lister Adapter that can list files with their sizes.
+type Lister interface {
+	Adapter
+	// ListFiles return list of files with their sizes in the given path.
+	// Return empty if not a directory, pathElems will be joined.
+	ListFiles(ctx context.Context, pathElems ...string) ([]FileInfo, error)
+}
+
+// Stater Adapter that can get the info of a single file.
+type Stater interface {
+	Adapter
+	// Stat return the info of the file, ErrFileNotFound if the file does not exist.
+	// If extra pathElems are given, pathElems will be joined. Stat must be safe for concurrent use.
+	Stat(ctx context.Context, pathElem string, pathElems ...string) (FileInfo, error)
+}
+
+// RecursiveLister Adapter that can list files in nested directories.
+type RecursiveLister interface {
+	Adapter
+	// ListFileNamesRecursive return list of file names in the given path and its subdirectories,
+	// relative to the given path using '/' as separator. Return empty if not a directory, pathElems will be joined.
+	ListFileNamesRecursive(ctx context.Context, pathElems ...string) ([]string, error)
+	// ListFilesRecursive is ListFileNamesRecursive with the file sizes.
+	ListFilesRecursive(ctx context.Context, pathElems ...string) ([]FileInfo, error)
+}
+
 type AdapterConfig struct {
 	Name string `json:"name"`
 
@@ -52,9 +183,141 @@ type AdapterConfig struct {
 
 	// Keep override the Syncer Keep. Default 0 (using the Syncer Keep).
 	Keep int `json:"keep"`
+	// Retention override the Syncer Retention and Keep.
+	Retention core.RetentionPolicy `json:"retention"`
 
 	// Each controls the number of actual syncs.
 	// Default it will sync every backup.
 	// If set to number n > 1, it will sync every nth backup.
 	Each int `json:"each"`
+
+	// IntraFileConcurrency the number of concurrent requests when transferring a single file.
+	// Only applies to adapters that support concurrent transfer (e.g. s3 multipart).
+	// Default 0 (adapter specific).
+	IntraFileConcurrency int `json:"intraFileConcurrency"`
+
+	// StatConcurrency limits the number of concurrent stat requests when listing files with sizes.
+	// Only applies to adapters that cannot get the file sizes from the listing itself.
+	// Default 0 (using defaultStatConcurrency).
+	StatConcurrency int `json:"statConcurrency"`
+
+	// StrictPath fails listing the target if its base path does not exist, instead of warning.
+	// Only applies to adapters that can tell a missing path apart from an empty one (e.g. file).
+	StrictPath bool `json:"strictPath"`
+
+	// Recursive compacts the backups in the subdirectories of the target path too,
+	// for backups organized into nested directories. Only applies to adapters supporting recursive listing.
+	Recursive bool `json:"recursive"`
+
+	// Retry the retry policy of requests to the target.
+	// Only applies to remote adapters (e.g. s3).
+	Retry RetryConfig `json:"retry"`
+}
+
+// statFiles stats the given file names using at most concurrency goroutines.
+// The result is in the same order as names.
+func statFiles(ctx context.Context, names []string, concurrency int, stat func(ctx context.Context, name string) (FileInfo, error)) ([]FileInfo, error) {
+	if concurrency < 1 {
+		concurrency = defaultStatConcurrency
+	}
+	files := make([]FileInfo, len(names))
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			files[i], errs[i] = stat(ctx, name)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// newAdapter creates the adapter of the target config, based on its type.
+// The checksum files of saved backups are created using checksumAlgo.
+func newAdapter(target map[string]any, userAgent string, checksumAlgo string) (Adapter, error) {
+	if raw, ok := target["type"]; !ok {
+		return nil, errors.New("missing type in config targets")
+	} else if _, ok := raw.(string); !ok {
+		return nil, errors.New("type in config targets must be string")
+	}
+
+	if raw, ok := target["name"]; !ok {
+		return nil, errors.New("missing name in config targets")
+	} else if _, ok := raw.(string); !ok {
+		return nil, errors.New("name in config targets must be string")
+	}
+
+	t := target["type"].(string)
+	name := target["name"].(string)
+	switch t {
+	case AdapterFileType:
+		adapter, err := newFileAdapter(target, checksumAlgo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating file adapter %s", name)
+		}
+		return adapter, nil
+	case AdapterS3Type:
+		adapter, err := newS3Adapter(target, userAgent, checksumAlgo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating s3 adapter %s", name)
+		}
+		return adapter, nil
+	case AdapterMockType:
+		adapter, err := newMockAdapter(target, checksumAlgo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating mock adapter %s", name)
+		}
+		return adapter, nil
+	default:
+		return nil, errors.New("unknown type in config targets: " + t)
+	}
+}
+
+// isTargetDisabled check whether the target config is disabled.
+func isTargetDisabled(target map[string]any) bool {
+	v, ok := target["disabled"].(bool)
+	return ok && v
+}
+
+// listFileNames lists the file names of the adapter base path.
+// If the adapter lists nothing as its base path does not exist, it warns or fails with ErrPathNotFound if StrictPath.
+func listFileNames(ctx context.Context, adapter Adapter) ([]string, error) {
+	names, err := adapter.ListFileNames(ctx)
+	if err != nil || len(names) > 0 {
+		return names, err
+	}
+	checker, ok := adapter.(PathChecker)
+	if !ok {
+		return names, nil
+	}
+	conf := adapter.Config()
+	exists, err := checker.PathExists(ctx)
+	if err != nil {
+		slog.Warn("Cannot check target path", slog.String("adapter", conf.Name), slog.Any("err", err))
+		return names, nil
+	}
+	if exists {
+		return names, nil
+	}
+	if conf.StrictPath {
+		return nil, errors.Wrapf(ErrPathNotFound, "path of target %s does not exist", conf.Name)
+	}
+	pterm.Warning.Println("Path of", conf.Name, "does not exist, check the target config if it is not a new target")
+	slog.Warn("Target path does not exist", slog.String("adapter", conf.Name))
+	return names, nil
 }
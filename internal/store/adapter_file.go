@@ -3,27 +3,46 @@
 import (
 	"context"
 	"github.com/mawngo/go-errors"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sin/internal/utils"
+	"strings"
 )
 
 var _ Adapter = (*fileAdapter)(nil)
 var _ Downloader = (*fileAdapter)(nil)
+var _ Lister = (*fileAdapter)(nil)
+var _ Stater = (*fileAdapter)(nil)
+var _ PathChecker = (*fileAdapter)(nil)
+var _ Pinger = (*fileAdapter)(nil)
+var _ Mover = (*fileAdapter)(nil)
+var _ Verifier = (*fileAdapter)(nil)
+var _ Hasher = (*fileAdapter)(nil)
+var _ FileReader = (*fileAdapter)(nil)
+var _ StreamSaver = (*fileAdapter)(nil)
+var _ RecursiveLister = (*fileAdapter)(nil)
 
 // fileAdapter is a local file adapter.
-// fileAdapter is not safe for concurrent use.
+// fileAdapter is not safe for concurrent use, except Verify.
 type fileAdapter struct {
 	AdapterConfig
 	Dir string `json:"dir"`
+	// DateDirs organizes backups into date subdirectories (YYYY/MM) based on the backup time in the file name.
+	// File names are still listed flat, so retention counts backups across subdirectories.
+	DateDirs bool `json:"dateDirs"`
+
+	// checksumAlgo the algorithm of the checksum files of saved backups.
+	checksumAlgo string
 }
 
 func (f *fileAdapter) Type() string {
 	return AdapterFileType
 }
 
-func newFileAdapter(conf map[string]any) (Adapter, error) {
-	adapter := fileAdapter{}
+func newFileAdapter(conf map[string]any, checksumAlgo string) (Adapter, error) {
+	adapter := fileAdapter{checksumAlgo: checksumAlgo}
 	if err := utils.MapToStruct(conf, &adapter); err != nil {
 		return nil, err
 	}
@@ -36,22 +55,71 @@ func newFileAdapter(conf map[string]any) (Adapter, error) {
 	return &adapter, nil
 }
 
+// path resolves the path of a file in the adapter directory.
+// If DateDirs is enabled, the file is placed in the date subdirectory of its backup time,
+// unless the file only exists in the flat layout.
+func (f *fileAdapter) path(pathElems ...string) string {
+	flat := filepath.Join(append([]string{f.Dir}, pathElems...)...)
+	if !f.DateDirs {
+		return flat
+	}
+	rel := filepath.Join(pathElems...)
+	dated := filepath.Join(f.Dir, filepath.Dir(rel), dateDir(filepath.Base(rel)), filepath.Base(rel))
+	if _, err := os.Stat(dated); err != nil {
+		if _, err := os.Stat(flat); err == nil {
+			return flat
+		}
+	}
+	return dated
+}
+
+// dateDir returns the date subdirectory (YYYY/MM) of the backup file name.
+// Returns empty if the name does not start with a backup time.
+func dateDir(name string) string {
+	t, ok := utils.ParseBackupTime(name)
+	if !ok {
+		return ""
+	}
+	return filepath.Join(t.Format("2006"), t.Format("01"))
+}
+
 func (f *fileAdapter) Save(ctx context.Context, source string, pathElem string, pathElems ...string) error {
-	dest := filepath.Join(append([]string{f.Dir, pathElem}, pathElems...)...)
+	dest := f.path(append([]string{pathElem}, pathElems...)...)
 	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
 		return errors.Wrapf(err, "error creating directory %s", filepath.Dir(dest))
 	}
 
-	destChecksum := dest + utils.ChecksumExt
-	if err := utils.CreateFileSHA256Checksum(source, destChecksum); err != nil {
+	// Copy and compute the checksum in one pass, as reading the source may be slow on network mounts.
+	destChecksum := dest + utils.ChecksumFileExt(f.checksumAlgo)
+	checksum, err := utils.CopyFileChecksum(ctx, source, dest, f.checksumAlgo)
+	if err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	if err := utils.WriteChecksum(destChecksum, checksum); err != nil {
+		_ = os.Remove(dest)
+		_ = os.Remove(destChecksum)
 		return errors.Wrapf(err, "error creating checksum file %s", destChecksum)
 	}
+	return nil
+}
 
-	err := utils.CopyFile(ctx, source, dest)
-	if err != nil {
+func (f *fileAdapter) SaveStream(ctx context.Context, reader io.Reader, _ int64, pathElem string, pathElems ...string) error {
+	dest := f.path(append([]string{pathElem}, pathElems...)...)
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "error creating directory %s", filepath.Dir(dest))
+	}
+
+	destChecksum := dest + utils.ChecksumFileExt(f.checksumAlgo)
+	h := utils.NewChecksumHash(f.checksumAlgo)
+	if err := utils.CopyToFile(ctx, io.TeeReader(reader, h), dest); err != nil {
+		_ = os.Remove(dest)
+		return errors.Wrapf(err, "error writing file %s", dest)
+	}
+	if err := utils.WriteChecksum(destChecksum, h.Sum(nil)); err != nil {
 		_ = os.Remove(dest)
 		_ = os.Remove(destChecksum)
-		return err
+		return errors.Wrapf(err, "error creating checksum file %s", destChecksum)
 	}
 	return nil
 }
@@ -60,33 +128,222 @@ func (f *fileAdapter) Download(ctx context.Context, destination string, sourcePa
 	if len(sourcePaths) == 0 {
 		sourcePaths = []string{filepath.Base(destination)}
 	}
-	source := filepath.Join(append([]string{f.Dir}, sourcePaths...)...)
+	source := f.path(sourcePaths...)
 
 	// Download checksum file if exists.
-	sourceChecksum := source + utils.ChecksumExt
-	destChecksum := destination + utils.ChecksumExt
-	if exists, err := utils.FileExists(sourceChecksum); err != nil {
-		return errors.Wrapf(err, "error checking checksum file %s", sourceChecksum)
-	} else if exists {
-		if err := utils.CopyFile(ctx, sourceChecksum, destChecksum); err != nil {
+	sourceChecksum, algo, err := utils.FindChecksumFile(source)
+	if err != nil {
+		return errors.Wrapf(err, "error checking checksum file of %s", source)
+	}
+	if sourceChecksum != "" {
+		if err := utils.CopyFile(ctx, sourceChecksum, destination+utils.ChecksumFileExt(algo)); err != nil {
 			return errors.Wrapf(err, "error copying checksum file %s", sourceChecksum)
 		}
 	}
 
-	if err := utils.CopyFile(ctx, source, destination); err != nil {
+	if algo == "" {
+		return errors.Wrapf(utils.CopyFile(ctx, source, destination), "error copying file %s", source)
+	}
+	// The checksum is computed while copying, so the copied file is not read again.
+	checksum, err := utils.CopyFileChecksum(ctx, source, destination, algo)
+	if err != nil {
 		return errors.Wrapf(err, "error copying file %s", source)
 	}
-	return utils.VerifyFileSHA256Checksum(destination)
+	return utils.VerifyChecksum(destination, algo, checksum)
+}
+
+func (f *fileAdapter) Verify(ctx context.Context, pathElem string, pathElems ...string) error {
+	path := f.path(append([]string{pathElem}, pathElems...)...)
+	checksumFile, algo, err := utils.FindChecksumFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "error checking checksum file of %s", path)
+	}
+	if checksumFile == "" {
+		return errors.Wrapf(ErrNoChecksum, "checksum file of %s not found", path)
+	}
+	expected, err := os.ReadFile(checksumFile)
+	if err != nil {
+		return errors.Wrapf(err, "error reading checksum file of %s", path)
+	}
+	checksum, err := f.Checksum(ctx, algo, pathElem, pathElems...)
+	if err != nil {
+		return err
+	}
+	return verifyChecksum(path, string(expected), checksum)
+}
+
+func (f *fileAdapter) Checksum(_ context.Context, algo string, pathElem string, pathElems ...string) ([]byte, error) {
+	path := f.path(append([]string{pathElem}, pathElems...)...)
+	checksum, err := utils.FileChecksum(path, algo)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrapf(ErrFileNotFound, "file %s not found", path)
+		}
+		return nil, errors.Wrapf(err, "error computing checksum of %s", path)
+	}
+	return checksum, nil
+}
+
+func (f *fileAdapter) ReadFile(_ context.Context, pathElem string, pathElems ...string) ([]byte, error) {
+	path := f.path(append([]string{pathElem}, pathElems...)...)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrapf(ErrFileNotFound, "file %s not found", path)
+	}
+	return b, err
+}
+
+func (f *fileAdapter) Move(_ context.Context, source string, destination string) error {
+	source = f.path(source)
+	destination = f.path(destination)
+	if exists, err := utils.FileExists(source); err != nil {
+		return errors.Wrapf(err, "error checking file %s", source)
+	} else if !exists {
+		return errors.Wrapf(ErrFileNotFound, "file %s not found", source)
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "error creating directory %s", filepath.Dir(destination))
+	}
+	if err := os.Rename(source, destination); err != nil {
+		return errors.Wrapf(err, "error renaming file %s", source)
+	}
+
+	for _, algo := range utils.ChecksumAlgos {
+		sourceChecksum := source + utils.ChecksumFileExt(algo)
+		if exists, err := utils.FileExists(sourceChecksum); err != nil {
+			return errors.Wrapf(err, "error checking checksum file %s", sourceChecksum)
+		} else if exists {
+			if err := os.Rename(sourceChecksum, destination+utils.ChecksumFileExt(algo)); err != nil {
+				return errors.Wrapf(err, "error renaming checksum file %s", sourceChecksum)
+			}
+		}
+	}
+	return nil
 }
 
 func (f *fileAdapter) Del(_ context.Context, pathElem string, pathElems ...string) error {
-	path := filepath.Join(append([]string{f.Dir, pathElem}, pathElems...)...)
-	return utils.DelFile(path)
+	path := f.path(append([]string{pathElem}, pathElems...)...)
+	if err := utils.DelFile(path); err != nil {
+		return err
+	}
+	if month := dateDir(filepath.Base(path)); f.DateDirs && month != "" && strings.HasSuffix(filepath.Dir(path), month) {
+		// Remove the month and year directories if they become empty, errors are ignored as they are not empty.
+		if err := os.Remove(filepath.Dir(path)); err == nil {
+			_ = os.Remove(filepath.Dir(filepath.Dir(path)))
+		}
+	}
+	return nil
 }
 
 func (f *fileAdapter) ListFileNames(_ context.Context, pathElems ...string) ([]string, error) {
 	path := filepath.Join(append([]string{f.Dir}, pathElems...)...)
-	return utils.ListFileNames(path)
+	if !f.DateDirs {
+		return utils.ListFileNames(path)
+	}
+	return listDateDirFileNames(path)
+}
+
+// listDateDirFileNames lists file names in the directory and its date subdirectories (YYYY/MM).
+// Files in the directory itself are included, so switching to date subdirectories keeps existing backups managed.
+func listDateDirFileNames(path string) ([]string, error) {
+	names, err := utils.ListFileNames(path)
+	if err != nil {
+		return nil, err
+	}
+	months, err := filepath.Glob(filepath.Join(path, "[0-9][0-9][0-9][0-9]", "[0-9][0-9]"))
+	if err != nil {
+		return nil, err
+	}
+	for _, month := range months {
+		monthNames, err := utils.ListFileNames(month)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing directory %s", month)
+		}
+		names = append(names, monthNames...)
+	}
+	return names, nil
+}
+
+func (f *fileAdapter) ListFiles(ctx context.Context, pathElems ...string) ([]FileInfo, error) {
+	names, err := f.ListFileNames(ctx, pathElems...)
+	if err != nil {
+		return nil, err
+	}
+	// Stat may be slow on network mounts, so we do it concurrently.
+	return statFiles(ctx, names, f.StatConcurrency, func(_ context.Context, name string) (FileInfo, error) {
+		info, err := os.Stat(f.path(append(pathElems, name)...))
+		if err != nil {
+			return FileInfo{}, errors.Wrapf(err, "error stat file %s", name)
+		}
+		return FileInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+	})
+}
+
+func (f *fileAdapter) Stat(_ context.Context, pathElem string, pathElems ...string) (FileInfo, error) {
+	info, err := os.Stat(f.path(append([]string{pathElem}, pathElems...)...))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return FileInfo{}, ErrFileNotFound
+		}
+		return FileInfo{}, errors.Wrapf(err, "error stat file %s", pathElem)
+	}
+	return FileInfo{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *fileAdapter) ListFileNamesRecursive(ctx context.Context, pathElems ...string) ([]string, error) {
+	files, err := f.ListFilesRecursive(ctx, pathElems...)
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	return names, err
+}
+
+// ListFilesRecursive walks the directory and its subdirectories, including the date subdirectories.
+func (f *fileAdapter) ListFilesRecursive(_ context.Context, pathElems ...string) ([]FileInfo, error) {
+	root := filepath.Join(append([]string{f.Dir}, pathElems...)...)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files := make([]FileInfo, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return errors.Wrapf(err, "error stat file %s", path)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (f *fileAdapter) PathExists(_ context.Context) (bool, error) {
+	info, err := os.Stat(f.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// Ping check that the directory exists and is writable.
+func (f *fileAdapter) Ping(_ context.Context) error {
+	return utils.CheckDirWritable(f.Dir)
 }
 
 func (f *fileAdapter) Config() AdapterConfig {
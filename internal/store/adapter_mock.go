@@ -5,6 +5,7 @@
 	"context"
 	"github.com/mawngo/go-errors"
 	"github.com/samber/lo"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -15,6 +16,8 @@
 
 var _ Adapter = (*mockAdapter)(nil)
 var _ Downloader = (*mockAdapter)(nil)
+var _ Mover = (*mockAdapter)(nil)
+var _ StreamSaver = (*mockAdapter)(nil)
 
 // mockAdapter only write results into a log file.
 // fileAdapter is not safe for concurrent use.
@@ -22,14 +25,17 @@ type mockAdapter struct {
 	AdapterConfig
 	Dir         string `json:"dir"`
 	LogFilename string `json:"logFilename"`
+
+	// checksumAlgo the algorithm of the checksum files of saved backups.
+	checksumAlgo string
 }
 
 func (m *mockAdapter) Type() string {
 	return AdapterMockType
 }
 
-func newMockAdapter(conf map[string]any) (Adapter, error) {
-	adapter := mockAdapter{}
+func newMockAdapter(conf map[string]any, checksumAlgo string) (Adapter, error) {
+	adapter := mockAdapter{checksumAlgo: checksumAlgo}
 	if err := utils.MapToStruct(conf, &adapter); err != nil {
 		return nil, err
 	}
@@ -54,27 +60,56 @@ func (m *mockAdapter) Save(_ context.Context, _ string, pathElem string, pathEle
 	if err != nil {
 		return err
 	}
-	checksumFile := filename + utils.ChecksumExt
 	files = lo.Filter(files, func(file string, _ int) bool {
-		return file != filename && file != checksumFile
+		return file != filename && !isChecksumFileOf(file, filename)
 	})
-	files = append(files, filename, checksumFile)
+	files = append(files, filename, filename+utils.ChecksumFileExt(m.checksumAlgo))
 	return m.writeLog(m.LogFilename, files)
 }
 
+// SaveStream discards the content of the reader, then logs the file like Save.
+func (m *mockAdapter) SaveStream(ctx context.Context, reader io.Reader, _ int64, pathElem string, pathElems ...string) error {
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return err
+	}
+	return m.Save(ctx, "", pathElem, pathElems...)
+}
+
 func (m *mockAdapter) Del(_ context.Context, pathElem string, pathElems ...string) error {
 	filename := m.joinPath(pathElem, pathElems...)
 	files, err := m.openLog(m.LogFilename)
 	if err != nil {
 		return err
 	}
-	checksumFile := filename + utils.ChecksumExt
 	files = lo.Filter(files, func(file string, _ int) bool {
-		return file != filename && file != checksumFile
+		return file != filename && !isChecksumFileOf(file, filename)
 	})
 	return m.writeLog(m.LogFilename, files)
 }
 
+func (m *mockAdapter) Move(_ context.Context, source string, destination string) error {
+	source = m.joinPath(source)
+	destination = m.joinPath(destination)
+	files, err := m.openLog(m.LogFilename)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(files, source) {
+		return errors.Wrapf(ErrFileNotFound, "file %s not found", source)
+	}
+	checksums := lo.Filter(files, func(file string, _ int) bool {
+		return isChecksumFileOf(file, source)
+	})
+	files = lo.Filter(files, func(file string, _ int) bool {
+		return file != source && file != destination && !isChecksumFileOf(file, source) && !isChecksumFileOf(file, destination)
+	})
+	files = append(files, destination)
+	for _, checksum := range checksums {
+		files = append(files, destination+strings.TrimPrefix(checksum, source))
+	}
+	return m.writeLog(m.LogFilename, files)
+}
+
 func (m *mockAdapter) ListFileNames(_ context.Context, pathElems ...string) ([]string, error) {
 	prefix := m.joinPath("", pathElems...)
 	files, err := m.openLog(m.LogFilename)
@@ -112,13 +147,21 @@ func (m *mockAdapter) Download(_ context.Context, destination string, sourcePath
 	f.Close()
 
 	// Optionally, handling checksum verification.
-	sourceChecksum := source + utils.ChecksumExt
-	if slices.Contains(files, sourceChecksum) {
-		return utils.CreateFileSHA256Checksum(destination, destination+utils.ChecksumExt)
+	for _, algo := range utils.ChecksumAlgos {
+		if slices.Contains(files, source+utils.ChecksumFileExt(algo)) {
+			return utils.CreateFileChecksum(destination, algo)
+		}
 	}
 	return nil
 }
 
+// isChecksumFileOf check whether the file is a checksum file of the backup, of any algorithm.
+func isChecksumFileOf(file string, backup string) bool {
+	return slices.ContainsFunc(utils.ChecksumAlgos, func(algo string) bool {
+		return file == backup+utils.ChecksumFileExt(algo)
+	})
+}
+
 func (m *mockAdapter) Config() AdapterConfig {
 	return m.AdapterConfig
 }
@@ -1,10 +1,13 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -12,12 +15,20 @@
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
 	"github.com/mawngo/go-errors"
-	"github.com/mawngo/go-try/v2"
+	"github.com/pterm/pterm"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sin/internal/core"
 	"sin/internal/utils"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,12 +37,43 @@
 
 	defaultPartSizeMB  = 50
 	defaultThresholdMB = 110
+
+	defaultConnectTimeout = 30 * time.Second
+	defaultReadTimeout    = 2 * time.Minute
+	// maxCopyObjectSize the maximum size of an object copied using a single CopyObject request.
+	maxCopyObjectSize = 5 * 1024 * MB
+	// objectWaitTimeout the maximum time waiting for a written object to exist.
+	objectWaitTimeout = 5 * time.Minute
+
+	// tagsMetadataKey the object metadata key of the backup tags.
+	tagsMetadataKey = "sin-tags"
+	// tagsObjectTagPrefix the prefix of the object tag key of each backup tag.
+	tagsObjectTagPrefix = "sin-tag:"
+
+	// s3AuthModeStatic authenticates using the AccessKeyID and AccessSecret of the config.
+	s3AuthModeStatic = "static"
+	// s3AuthModeDefault authenticates using the aws default credential chain:
+	// environment variables, shared config files, then the ECS/EC2 instance role.
+	s3AuthModeDefault = "default"
+	// s3AuthModeProfile authenticates using the named profile of the aws shared config files.
+	s3AuthModeProfile = "profile"
 )
 
 var _ Adapter = (*s3Adapter)(nil)
 var _ Downloader = (*s3Adapter)(nil)
+var _ Lister = (*s3Adapter)(nil)
+var _ Stater = (*s3Adapter)(nil)
+var _ Mover = (*s3Adapter)(nil)
+var _ Verifier = (*s3Adapter)(nil)
+var _ Hasher = (*s3Adapter)(nil)
+var _ FileReader = (*s3Adapter)(nil)
+var _ Pinger = (*s3Adapter)(nil)
+var _ StreamSaver = (*s3Adapter)(nil)
+var _ RecursiveLister = (*s3Adapter)(nil)
+var _ backgroundWaiter = (*s3Adapter)(nil)
+var _ intraFileConcurrent = (*s3Adapter)(nil)
 
-// s3Adapter is not safe for concurrent use.
+// s3Adapter is not safe for concurrent use, except Verify.
 type s3Adapter struct {
 	AdapterConfig
 	Multipart    s3MultipartConfig `json:"multipart"`
@@ -41,8 +83,51 @@ type s3Adapter struct {
 	AccessSecret string            `json:"accessSecret"`
 	Region       string            `json:"region"`
 	BasePath     string            `json:"basePath"`
+	// AuthMode how to obtain the credentials: static (default, AccessKeyID and AccessSecret),
+	// default (the aws default credential chain, including instance roles) or profile (the named shared config Profile).
+	AuthMode string `json:"authMode"`
+	// Profile the aws shared config profile, only used in profile auth mode.
+	Profile string `json:"profile"`
+	// ConnectTimeout timeout of establishing the connection to the endpoint.
+	ConnectTimeout time.Duration `json:"connectTimeout"`
+	// ReadTimeout timeout of waiting for the response headers after the request is sent.
+	ReadTimeout time.Duration `json:"readTimeout"`
+	// DisableObjectTagging do not attach the backup tags as object tags, for storages not supporting tagging.
+	// The tags are still attached as object metadata.
+	DisableObjectTagging bool `json:"disableObjectTagging"`
+	// ForcePathStyle addresses the bucket using the path (endpoint/bucket/key) instead of the virtual host
+	// (bucket.endpoint/key), required by most self-hosted storages such as MinIO.
+	ForcePathStyle bool `json:"forcePathStyle"`
+	// UsePathStyle alias of ForcePathStyle.
+	UsePathStyle bool `json:"usePathStyle"`
+	// DisableSSL uses http for endpoints without a scheme, instead of https.
+	DisableSSL bool `json:"disableSSL"`
+	// TolerateChecksumFailure counts the backup as synced if uploading its checksum file fails,
+	// only warning and retrying the checksum upload in the background, as the backup itself is stored.
+	TolerateChecksumFailure bool `json:"tolerateChecksumFailure"`
+	// ReuseUploaded copies an uploaded backup of the same name (ignoring the backup time), size and checksum file
+	// instead of uploading the backup again, such as the backup of an interrupted run or of unchanged files.
+	// Lists the target before uploading each backup, sidecar files are always uploaded. Default false.
+	ReuseUploaded bool `json:"reuseUploaded"`
+	// TolerateWaiterFailure only warns if waiting for a written object to exist fails,
+	// as long as a single HeadObject confirms it exists, for storages known to be flaky with waiters.
+	// Default false, failing the write.
+	TolerateWaiterFailure bool `json:"tolerateWaiterFailure"`
+	// StorageClass the storage class of the uploaded backups, use the bucket default if empty.
+	// The checksum files are always stored using the default storage class.
+	StorageClass string `json:"storageClass"`
 
-	client *s3.Client
+	// userAgent appended to the User-Agent of the aws sdk.
+	userAgent string
+	// checksumAlgo the algorithm of the checksum files of uploaded backups.
+	checksumAlgo string
+
+	client   *s3.Client
+	clientMu sync.Mutex
+	// orphansAborted whether the orphaned multipart uploads were aborted, as it is only done once.
+	orphansAborted bool
+	// background the checksum uploads retrying in the background.
+	background sync.WaitGroup
 }
 
 func (f *s3Adapter) Type() string {
@@ -50,14 +135,21 @@ func (f *s3Adapter) Type() string {
 }
 
 type s3MultipartConfig struct {
-	ThresholdMB     int  `json:"thresholdMB"`
-	PartSizeMB      int  `json:"partSizeMB"`
+	ThresholdMB int `json:"thresholdMB"`
+	PartSizeMB  int `json:"partSizeMB"`
+	// Concurrency deprecated, use AdapterConfig.IntraFileConcurrency instead.
 	Concurrency     int  `json:"concurrency"`
 	DisableChecksum bool `json:"disableChecksum"`
+	// LeavePartsOnError does not abort the multipart upload if it fails, leaving the uploaded parts for inspection.
+	// The parts are billed until the upload is aborted manually or by a bucket lifecycle rule.
+	LeavePartsOnError bool `json:"leavePartsOnError"`
+	// AbortOrphanedAfter aborts the multipart uploads under the BasePath initiated longer ago than it before the first
+	// upload, such as the uploads of interrupted runs, so their parts are not billed forever. Default 0 (disabled).
+	AbortOrphanedAfter time.Duration `json:"abortOrphanedAfter"`
 }
 
-func newS3Adapter(conf map[string]any) (Adapter, error) {
-	adapter := s3Adapter{}
+func newS3Adapter(conf map[string]any, userAgent string, checksumAlgo string) (Adapter, error) {
+	adapter := s3Adapter{userAgent: userAgent, checksumAlgo: checksumAlgo}
 	if err := utils.MapToStruct(conf, &adapter); err != nil {
 		return nil, err
 	}
@@ -70,14 +162,41 @@ func newS3Adapter(conf map[string]any) (Adapter, error) {
 	if adapter.Endpoint == "" {
 		return nil, errors.New("missing endpoint config for s3 adapter " + adapter.Name)
 	}
-	if adapter.AccessKeyID == "" {
-		return nil, errors.New("missing accessKeyID config for s3 adapter " + adapter.Name)
+	endpoint, err := s3Endpoint(adapter.Endpoint, adapter.DisableSSL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint config for s3 adapter %s", adapter.Name)
+	}
+	adapter.Endpoint = endpoint
+	adapter.ForcePathStyle = adapter.ForcePathStyle || adapter.UsePathStyle
+	if adapter.StorageClass != "" && !slices.Contains(types.StorageClass("").Values(), types.StorageClass(adapter.StorageClass)) {
+		return nil, errors.Newf("invalid storageClass config '%s' for s3 adapter %s", adapter.StorageClass, adapter.Name)
 	}
-	if adapter.AccessSecret == "" {
-		return nil, errors.New("missing accessSecret config for s3 adapter " + adapter.Name)
+	if adapter.AuthMode == "" {
+		adapter.AuthMode = s3AuthModeStatic
 	}
-	if adapter.Region == "" {
-		adapter.Region = "auto"
+	switch adapter.AuthMode {
+	case s3AuthModeStatic:
+		if adapter.AccessKeyID == "" {
+			return nil, errors.New("missing accessKeyID config for s3 adapter " + adapter.Name)
+		}
+		if adapter.AccessSecret == "" {
+			return nil, errors.New("missing accessSecret config for s3 adapter " + adapter.Name)
+		}
+		if adapter.Region == "" {
+			adapter.Region = "auto"
+		}
+	case s3AuthModeDefault, s3AuthModeProfile:
+		if adapter.AccessKeyID != "" || adapter.AccessSecret != "" {
+			return nil, errors.Newf("accessKeyID and accessSecret must not be used with authMode %s for s3 adapter %s", adapter.AuthMode, adapter.Name)
+		}
+	default:
+		return nil, errors.Newf("invalid authMode config '%s' for s3 adapter %s, must be one of: static, default, profile", adapter.AuthMode, adapter.Name)
+	}
+	if adapter.AuthMode == s3AuthModeProfile && adapter.Profile == "" {
+		return nil, errors.New("missing profile config for s3 adapter " + adapter.Name)
+	}
+	if adapter.AuthMode != s3AuthModeProfile && adapter.Profile != "" {
+		return nil, errors.New("profile config requires authMode profile for s3 adapter " + adapter.Name)
 	}
 	if adapter.Multipart.PartSizeMB < 5 || adapter.Multipart.PartSizeMB > 4*1024 {
 		adapter.Multipart.PartSizeMB = defaultPartSizeMB
@@ -85,14 +204,29 @@ func newS3Adapter(conf map[string]any) (Adapter, error) {
 	if adapter.Multipart.ThresholdMB < 20 || adapter.Multipart.ThresholdMB > 4*1024 {
 		adapter.Multipart.ThresholdMB = defaultThresholdMB
 	}
+	if adapter.IntraFileConcurrency < 1 {
+		adapter.IntraFileConcurrency = adapter.Multipart.Concurrency
+	}
+	if adapter.IntraFileConcurrency < 1 {
+		adapter.IntraFileConcurrency = manager.DefaultUploadConcurrency
+	}
+	if adapter.ConnectTimeout <= 0 {
+		adapter.ConnectTimeout = defaultConnectTimeout
+	}
+	if adapter.ReadTimeout <= 0 {
+		adapter.ReadTimeout = defaultReadTimeout
+	}
 	return &adapter, nil
 }
 
 func (f *s3Adapter) Save(ctx context.Context, source string, pathElem string, pathElems ...string) error {
 	p := f.joinPath(pathElem, pathElems...)
-	checksum, err := utils.FileSHA256Checksum(source)
-	if err != nil {
-		return errors.Wrapf(err, "error calculating checksum file %s", source)
+	checksum := sourceChecksumFrom(ctx)
+	if checksum == nil {
+		var err error
+		if checksum, err = utils.FileChecksum(source, f.checksumAlgo); err != nil {
+			return errors.Wrapf(err, "error calculating checksum file %s", source)
+		}
 	}
 	file, err := os.Open(source)
 	if err != nil {
@@ -103,12 +237,186 @@ func (f *s3Adapter) Save(ctx context.Context, source string, pathElem string, pa
 	if err != nil {
 		return errors.Wrapf(err, "error getting file info %s", source)
 	}
+	if f.ReuseUploaded && strings.HasSuffix(p, core.BackupFileExt) {
+		reused, err := f.reuseUploaded(ctx, path.Join(append([]string{pathElem}, pathElems...)...), fi.Size(), checksum)
+		if err != nil {
+			slog.Warn("Error checking uploaded backups to reuse, uploading",
+				slog.String("adapter", f.Name),
+				slog.String("target", p),
+				slog.Any("err", err))
+		} else if reused {
+			return nil
+		}
+	}
+	f.abortOrphanedUploads(ctx)
 	if fi.Size() < int64(f.Multipart.ThresholdMB*MB) {
 		return f.upload(ctx, p, file, checksum)
 	}
 	return f.uploadMultipart(ctx, p, file, checksum)
 }
 
+// reuseUploaded looks for an uploaded backup of the same name (ignoring the backup time), size and checksum file
+// as the backup to save at name, such as the backup of an interrupted run, and copies it to name instead of uploading.
+// Return false if there is no such backup, or it is too large to be copied in a single request.
+func (f *s3Adapter) reuseUploaded(ctx context.Context, name string, size int64, checksum []byte) (bool, error) {
+	base := path.Base(name)
+	if _, ok := utils.ParseBackupTime(base); !ok || size > maxCopyObjectSize {
+		return false, nil
+	}
+	filename := strings.TrimSuffix(base[len(utils.BackupTimeLayout)+1:], core.BackupFileExt)
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+	files, err := f.ListFiles(ctx, dir)
+	if err != nil {
+		return false, err
+	}
+	sizes := make(map[string]int64, len(files))
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		sizes[file.Name] = file.Size
+		names = append(names, file.Name)
+	}
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	candidates := utils.FilterBackupFileNames(names, filename)
+	// Prefer the newest backup, the most likely to be the same.
+	slices.Reverse(candidates)
+	for _, candidate := range candidates {
+		if sizes[candidate] != size {
+			continue
+		}
+		key := f.joinPath(dir, candidate)
+		expected := strings.Builder{}
+		err := f.stream(ctx, s3Client, key+utils.ChecksumFileExt(f.checksumAlgo), &expected)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if strings.TrimSpace(expected.String()) != hex.EncodeToString(checksum) {
+			continue
+		}
+
+		p := f.joinPath(name)
+		if candidate != base {
+			if err := f.copy(ctx, s3Client, key, p); err != nil {
+				return false, err
+			}
+			if err := f.saveChecksum(ctx, p, hex.EncodeToString(checksum)); err != nil {
+				return false, err
+			}
+		}
+		pterm.Info.Printf("%s already uploaded to %s as %s, skip uploading\n", base, f.Name, candidate)
+		slog.Info("Already uploaded, skip uploading",
+			slog.String("adapter", f.Name),
+			slog.String("target", p),
+			slog.String("source", key),
+			slog.Int64("size", size))
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *s3Adapter) Stat(ctx context.Context, pathElem string, pathElems ...string) (FileInfo, error) {
+	p := f.joinPath(pathElem, pathElems...)
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	head, err := f.headObject(ctx, s3Client, p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Name: path.Base(p), Size: aws.ToInt64(head.ContentLength), ModTime: aws.ToTime(head.LastModified)}, nil
+}
+
+// headObject return the metadata of the object, ErrFileNotFound if the object does not exist.
+func (f *s3Adapter) headObject(ctx context.Context, s3Client *s3.Client, key string) (*s3.HeadObjectOutput, error) {
+	return retryGet(ctx, func() (*s3.HeadObjectOutput, error) {
+		out, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(f.Bucket),
+			Key:    aws.String(key),
+		})
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			// Retrying won't help.
+			return nil, ErrFileNotFound
+		}
+		return out, err
+	}, f.Retry.options()...)
+}
+
+// abortOrphanedUploads aborts the multipart uploads under the BasePath initiated longer ago than AbortOrphanedAfter,
+// only once per adapter. Aborting is best effort, failures are only warned.
+func (f *s3Adapter) abortOrphanedUploads(ctx context.Context) {
+	if f.Multipart.AbortOrphanedAfter <= 0 || f.orphansAborted {
+		return
+	}
+	f.orphansAborted = true
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return
+	}
+	prefix := f.joinPath("")
+	if prefix != "" {
+		prefix += "/"
+	}
+	before := time.Now().Add(-f.Multipart.AbortOrphanedAfter)
+	paginator := s3.NewListMultipartUploadsPaginator(s3Client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(f.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	aborted := 0
+	for paginator.HasMorePages() {
+		page, err := retryGet(ctx, func() (*s3.ListMultipartUploadsOutput, error) {
+			return paginator.NextPage(ctx)
+		}, f.Retry.options()...)
+		if err != nil {
+			pterm.Warning.Printf("Error listing multipart uploads of %s: %s\n", f.Name, err)
+			slog.Warn("Error listing multipart uploads",
+				slog.String("adapter", f.Name),
+				slog.Any("err", err))
+			return
+		}
+		for _, upload := range page.Uploads {
+			if upload.Initiated == nil || !upload.Initiated.Before(before) {
+				continue
+			}
+			key, uploadID := aws.ToString(upload.Key), aws.ToString(upload.UploadId)
+			_, err := retryGet(ctx, func() (*s3.AbortMultipartUploadOutput, error) {
+				return s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+					Bucket:   aws.String(f.Bucket),
+					Key:      upload.Key,
+					UploadId: upload.UploadId,
+				})
+			}, f.Retry.options()...)
+			if err != nil {
+				pterm.Warning.Printf("Error aborting orphaned multipart upload %s of %s to %s: %s\n", uploadID, key, f.Name, err)
+				slog.Warn("Error aborting orphaned multipart upload",
+					slog.String("adapter", f.Name),
+					slog.String("target", key),
+					slog.String("uploadId", uploadID),
+					slog.Any("err", err))
+				continue
+			}
+			aborted++
+			slog.Info("Aborted orphaned multipart upload",
+				slog.String("adapter", f.Name),
+				slog.String("target", key),
+				slog.String("uploadId", uploadID),
+				slog.Time("initiated", aws.ToTime(upload.Initiated)))
+		}
+	}
+	if aborted > 0 {
+		pterm.Info.Printf("Aborted %d orphaned multipart uploads on %s\n", aborted, f.Name)
+	}
+}
+
 func (f *s3Adapter) uploadMultipart(ctx context.Context, p string, file *os.File, checksum []byte) error {
 	s3Client, err := f.getClient(ctx)
 	if err != nil {
@@ -116,37 +424,48 @@ func (f *s3Adapter) uploadMultipart(ctx context.Context, p string, file *os.File
 	}
 	uploader := manager.NewUploader(s3Client, func(u *manager.Uploader) {
 		u.PartSize = int64(min(f.Multipart.PartSizeMB, 10) * MB)
-		u.Concurrency = f.Multipart.Concurrency
+		u.Concurrency = f.IntraFileConcurrency
+		// Failed uploads are aborted by abortFailedUpload, which also logs the upload id.
+		u.LeavePartsOnError = true
 	})
 
+	metadata, tagging := f.objectTags(p)
+	body := progressBody(ctx, file)
 	input := &s3.PutObjectInput{
-		Bucket: aws.String(f.Bucket),
-		Key:    aws.String(p),
-		Body:   file,
+		Bucket:       aws.String(f.Bucket),
+		Key:          aws.String(p),
+		Body:         body,
+		Metadata:     metadata,
+		Tagging:      tagging,
+		StorageClass: types.StorageClass(f.StorageClass),
 	}
 	if !f.Multipart.DisableChecksum {
 		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
-		c := base64.StdEncoding.EncodeToString(checksum)
-		input.ChecksumSHA256 = &c
+		input.ChecksumSHA256 = f.objectChecksumSHA256(checksum)
 	}
 
-	// TODO: should we retry this?
-	_, err = uploader.Upload(ctx, input)
-	if err != nil {
-		var apiErr smithy.APIError
-		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "EntityTooLarge" {
-			return errors.New("object too large")
+	err = retryDo(ctx, func() error {
+		// Rewind the body, as the previous attempt may have consumed it.
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
 		}
+		_, err := uploader.Upload(ctx, input)
+		f.abortFailedUpload(ctx, s3Client, p, err)
+		if isEntityTooLarge(err) {
+			// Retrying won't help.
+			return errors.Wrapf(ErrUploadTooLarge, "object %s too large", p)
+		}
+		return err
+	}, f.Retry.options()...)
+	if err != nil {
 		return errors.Wrapf(err, "error uploading %s", p)
 	}
 
-	err = s3.NewObjectExistsWaiter(s3Client).Wait(ctx,
-		&s3.HeadObjectInput{Bucket: aws.String(f.Bucket), Key: aws.String(p)},
-		5*time.Minute)
+	err = f.waitObjectExists(ctx, s3Client, p)
 	if err != nil {
 		return errors.Wrapf(err, "error waiting for object %s", p)
 	}
-	return f.uploadChecksum(ctx, p, hex.EncodeToString(checksum))
+	return f.saveChecksum(ctx, p, hex.EncodeToString(checksum))
 }
 
 func (f *s3Adapter) upload(ctx context.Context, p string, file *os.File, checksum []byte) error {
@@ -155,26 +474,241 @@ func (f *s3Adapter) upload(ctx context.Context, p string, file *os.File, checksu
 		return err
 	}
 
-	c := base64.StdEncoding.EncodeToString(checksum)
-	_, err = try.GetCtx(ctx, func() (*s3.PutObjectOutput, error) {
-		return s3Client.PutObject(ctx, &s3.PutObjectInput{
+	metadata, tagging := f.objectTags(p)
+	body := progressBody(ctx, file)
+	_, err = retryGet(ctx, func() (*s3.PutObjectOutput, error) {
+		// Rewind the body, as the previous attempt may have consumed it.
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		out, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
 			Bucket:            aws.String(f.Bucket),
 			Key:               aws.String(p),
-			Body:              file,
+			Body:              body,
 			ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
-			ChecksumSHA256:    &c,
+			ChecksumSHA256:    f.objectChecksumSHA256(checksum),
+			Metadata:          metadata,
+			Tagging:           tagging,
+			StorageClass:      types.StorageClass(f.StorageClass),
 		})
-	}, try.WithFixedBackoff(10*time.Second))
+		if isEntityTooLarge(err) {
+			// Retrying won't help.
+			return nil, errors.Wrapf(ErrUploadTooLarge, "object %s too large", p)
+		}
+		return out, err
+	}, f.Retry.options()...)
+	if err != nil {
+		return errors.Wrapf(err, "error uploading %s", p)
+	}
+	err = f.waitObjectExists(ctx, s3Client, p)
+	if err != nil {
+		return errors.Wrapf(err, "error waiting for object %s", p)
+	}
+	return f.saveChecksum(ctx, p, hex.EncodeToString(checksum))
+}
+
+// s3Endpoint return the endpoint url, adding the scheme if missing: http if disableSSL, otherwise https.
+// Endpoints with https scheme cannot disable ssl.
+func s3Endpoint(endpoint string, disableSSL bool) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https://"
+		if disableSSL {
+			scheme = "http://"
+		}
+		endpoint = scheme + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.Newf("unsupported scheme '%s'", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", errors.New("missing host")
+	}
+	if disableSSL && u.Scheme == "https" {
+		return "", errors.New("disableSSL must not be used with https endpoint")
+	}
+	return endpoint, nil
+}
+
+// SaveStream uploads the reader using multipart upload, computing the checksum while uploading.
+// As the reader cannot be rewound, a failed upload is not retried, only its requests are.
+// The size of the object is limited by the part size, as multipart upload supports at most 10000 parts.
+func (f *s3Adapter) SaveStream(ctx context.Context, reader io.Reader, _ int64, pathElem string, pathElems ...string) error {
+	p := f.joinPath(pathElem, pathElems...)
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	uploader := manager.NewUploader(s3Client, func(u *manager.Uploader) {
+		u.PartSize = int64(f.Multipart.PartSizeMB * MB)
+		u.Concurrency = f.IntraFileConcurrency
+		u.LeavePartsOnError = true
+	})
+
+	h := utils.NewChecksumHash(f.checksumAlgo)
+	metadata, tagging := f.objectTags(p)
+	input := &s3.PutObjectInput{
+		Bucket:       aws.String(f.Bucket),
+		Key:          aws.String(p),
+		Body:         utils.ContextReader(ctx, io.TeeReader(reader, h)),
+		Metadata:     metadata,
+		Tagging:      tagging,
+		StorageClass: types.StorageClass(f.StorageClass),
+	}
+	if !f.Multipart.DisableChecksum {
+		// The checksum of the whole object is unknown before reading it, so only the parts are checked.
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	}
+	_, err = uploader.Upload(ctx, input)
+	f.abortFailedUpload(ctx, s3Client, p, err)
+	if isEntityTooLarge(err) {
+		return errors.Wrapf(ErrUploadTooLarge, "object %s too large", p)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "error uploading %s", p)
 	}
-	err = s3.NewObjectExistsWaiter(s3Client).Wait(ctx,
-		&s3.HeadObjectInput{Bucket: aws.String(f.Bucket), Key: aws.String(p)},
-		5*time.Minute)
+
+	err = f.waitObjectExists(ctx, s3Client, p)
 	if err != nil {
 		return errors.Wrapf(err, "error waiting for object %s", p)
 	}
-	return f.uploadChecksum(ctx, p, hex.EncodeToString(checksum))
+	return f.saveChecksum(ctx, p, hex.EncodeToString(h.Sum(nil)))
+}
+
+// objectTags return the object metadata (x-amz-meta-sin-tags: tag1,tag2) and object tagging (sin-tag:tag1=true&...)
+// of the backup tags parsed from the object name, so bucket tooling can filter by them.
+// Return nil if the backup has no tags.
+func (f *s3Adapter) objectTags(p string) (map[string]string, *string) {
+	tags := utils.ParseTags(path.Base(p))
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	metadata := map[string]string{tagsMetadataKey: strings.Join(tags, ",")}
+	if f.DisableObjectTagging {
+		return metadata, nil
+	}
+	tagging := url.Values{}
+	for _, tag := range tags {
+		tagging.Set(tagsObjectTagPrefix+tag, "true")
+	}
+	return metadata, aws.String(tagging.Encode())
+}
+
+// abortFailedUpload aborts the multipart upload if err is a failed multipart upload, unless LeavePartsOnError.
+// The upload id is logged either way, so operators can investigate leftover parts.
+// Aborting is best effort, failures are only warned.
+func (f *s3Adapter) abortFailedUpload(ctx context.Context, s3Client *s3.Client, p string, err error) {
+	var failure manager.MultiUploadFailure
+	if !errors.As(err, &failure) {
+		return
+	}
+	uploadID := failure.UploadID()
+	if f.Multipart.LeavePartsOnError {
+		pterm.Warning.Printf("Multipart upload %s of %s to %s failed, leaving uploaded parts\n", uploadID, p, f.Name)
+		slog.Warn("Multipart upload failed, leaving uploaded parts",
+			slog.String("adapter", f.Name),
+			slog.String("target", p),
+			slog.String("uploadId", uploadID))
+		return
+	}
+	// Abort even if the upload failed due to cancellation.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	_, abortErr := retryGet(ctx, func() (*s3.AbortMultipartUploadOutput, error) {
+		return s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(f.Bucket),
+			Key:      aws.String(p),
+			UploadId: aws.String(uploadID),
+		})
+	}, f.Retry.options()...)
+	if abortErr != nil {
+		pterm.Warning.Printf("Error aborting multipart upload %s of %s to %s: %s\n", uploadID, p, f.Name, abortErr)
+		slog.Warn("Error aborting multipart upload",
+			slog.String("adapter", f.Name),
+			slog.String("target", p),
+			slog.String("uploadId", uploadID),
+			slog.Any("err", abortErr))
+		return
+	}
+	slog.Info("Aborted failed multipart upload",
+		slog.String("adapter", f.Name),
+		slog.String("target", p),
+		slog.String("uploadId", uploadID))
+}
+
+// objectChecksumSHA256 return the base64 encoded object checksum verified by S3 when uploading,
+// or nil if the checksum file is not sha256, leaving the sdk to calculate the checksum of the object instead.
+func (f *s3Adapter) objectChecksumSHA256(checksum []byte) *string {
+	if f.checksumAlgo != core.ChecksumSHA256 {
+		return nil
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(checksum))
+}
+
+func isEntityTooLarge(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "EntityTooLarge"
+}
+
+// isForbidden check whether the request is denied (403), such as reading using write-only credentials.
+func isForbidden(err error) bool {
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// waitObjectExists waits for the written object to exist.
+// If TolerateWaiterFailure, a failed wait is only warned if a single HeadObject confirms the object exists.
+func (f *s3Adapter) waitObjectExists(ctx context.Context, s3Client *s3.Client, key string) error {
+	input := &s3.HeadObjectInput{Bucket: aws.String(f.Bucket), Key: aws.String(key)}
+	err := s3.NewObjectExistsWaiter(s3Client).Wait(ctx, input, objectWaitTimeout)
+	if err == nil || !f.TolerateWaiterFailure || ctx.Err() != nil {
+		return err
+	}
+	if _, herr := s3Client.HeadObject(ctx, input); herr != nil {
+		return errors.Join(err, herr)
+	}
+	pterm.Warning.Printf("Error waiting for object %s on %s, but it exists: %s\n", key, f.Name, err)
+	slog.Warn("Error waiting for object, but it exists",
+		slog.String("adapter", f.Name),
+		slog.String("key", key),
+		slog.Any("err", err))
+	return nil
+}
+
+// saveChecksum uploads the checksum file of the uploaded backup.
+// If TolerateChecksumFailure, the failure is only warned and the upload is retried in the background.
+func (f *s3Adapter) saveChecksum(ctx context.Context, p string, checksum string) error {
+	err := f.uploadChecksum(ctx, p, checksum)
+	if err == nil || !f.TolerateChecksumFailure || ctx.Err() != nil {
+		return err
+	}
+	pterm.Warning.Printf("Error uploading checksum of %s to %s, retrying in background: %s\n", p, f.Name, err)
+	slog.Warn("Error uploading checksum, retrying in background",
+		slog.String("adapter", f.Name),
+		slog.String("target", p),
+		slog.Any("err", err))
+	f.background.Add(1)
+	go func() {
+		defer f.background.Done()
+		if err := f.uploadChecksum(ctx, p, checksum); err != nil {
+			pterm.Error.Printf("Error uploading checksum of %s to %s: %s\n", p, f.Name, err)
+			slog.Error("Error uploading checksum in background",
+				slog.String("adapter", f.Name),
+				slog.String("target", p),
+				slog.Any("err", err))
+			return
+		}
+		slog.Info("Uploaded checksum in background", slog.String("adapter", f.Name), slog.String("target", p))
+	}()
+	return nil
+}
+
+// waitBackground waits for the checksum uploads retrying in the background.
+func (f *s3Adapter) waitBackground() {
+	f.background.Wait()
 }
 
 func (f *s3Adapter) uploadChecksum(ctx context.Context, p string, checksum string) error {
@@ -183,19 +717,17 @@ func (f *s3Adapter) uploadChecksum(ctx context.Context, p string, checksum strin
 		return err
 	}
 
-	_, err = try.GetCtx(ctx, func() (*s3.PutObjectOutput, error) {
+	_, err = retryGet(ctx, func() (*s3.PutObjectOutput, error) {
 		return s3Client.PutObject(ctx, &s3.PutObjectInput{
 			Bucket: aws.String(f.Bucket),
-			Key:    aws.String(p + utils.ChecksumExt),
+			Key:    aws.String(p + utils.ChecksumFileExt(f.checksumAlgo)),
 			Body:   strings.NewReader(checksum),
 		})
-	}, try.WithFixedBackoff(10*time.Second))
+	}, f.Retry.options()...)
 	if err != nil {
-		return errors.Wrapf(err, "error uploadingchecksum %s", p)
+		return errors.Wrapf(err, "error uploading checksum %s", p)
 	}
-	err = s3.NewObjectExistsWaiter(s3Client).Wait(ctx,
-		&s3.HeadObjectInput{Bucket: aws.String(f.Bucket), Key: aws.String(p)},
-		5*time.Minute)
+	err = f.waitObjectExists(ctx, s3Client, p+utils.ChecksumFileExt(f.checksumAlgo))
 	if err != nil {
 		return errors.Wrapf(err, "error waiting for checksum %s", p)
 	}
@@ -209,28 +741,117 @@ func (f *s3Adapter) Del(ctx context.Context, pathElem string, pathElems ...strin
 		return err
 	}
 
-	err = try.DoCtx(ctx, func() error {
+	err = retryDo(ctx, func() error {
 		_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 			Bucket: aws.String(f.Bucket),
 			Key:    aws.String(p),
 		})
 		return err
-	}, try.WithFixedBackoff(10*time.Second))
+	}, f.Retry.options()...)
 
 	if err != nil {
 		return err
 	}
 
-	return try.DoCtx(ctx, func() error {
-		_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
-			Bucket: aws.String(f.Bucket),
-			Key:    aws.String(p + utils.ChecksumExt),
-		})
+	// Delete the checksum files of every algorithm, deleting a missing object is not an error.
+	for _, algo := range utils.ChecksumAlgos {
+		err = retryDo(ctx, func() error {
+			_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(f.Bucket),
+				Key:    aws.String(p + utils.ChecksumFileExt(algo)),
+			})
+			return err
+		}, f.Retry.options()...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move copies the object (and its checksum) to the destination, then deletes the source.
+func (f *s3Adapter) Move(ctx context.Context, source string, destination string) error {
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
 		return err
-	}, try.WithFixedBackoff(10*time.Second))
+	}
+
+	if err := f.copy(ctx, s3Client, f.joinPath(source), f.joinPath(destination)); err != nil {
+		return err
+	}
+	for _, algo := range utils.ChecksumAlgos {
+		ext := utils.ChecksumFileExt(algo)
+		err = f.copy(ctx, s3Client, f.joinPath(source+ext), f.joinPath(destination+ext))
+		if err != nil && !errors.Is(err, ErrFileNotFound) {
+			return errors.Wrapf(err, "error copying checksum file %s", source)
+		}
+	}
+	return f.Del(ctx, source)
+}
+
+func (f *s3Adapter) copy(ctx context.Context, s3Client *s3.Client, source string, destination string) error {
+	// Copy source must be url-encoded, except the separator.
+	copySource := strings.Split(f.Bucket+"/"+source, "/")
+	for i := range copySource {
+		copySource[i] = url.PathEscape(copySource[i])
+	}
+	_, err := retryGet(ctx, func() (*s3.CopyObjectOutput, error) {
+		out, err := s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(f.Bucket),
+			Key:        aws.String(destination),
+			CopySource: aws.String(strings.Join(copySource, "/")),
+			// Copying resets the storage class to the default if not specified.
+			StorageClass: types.StorageClass(f.StorageClass),
+		})
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+			// Retrying won't help.
+			return nil, ErrFileNotFound
+		}
+		return out, err
+	}, f.Retry.options()...)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return errors.Wrapf(ErrFileNotFound, "file %s not found", source)
+		}
+		return errors.Wrapf(err, "error copying %s", source)
+	}
+	err = f.waitObjectExists(ctx, s3Client, destination)
+	if err != nil {
+		return errors.Wrapf(err, "error waiting for object %s", destination)
+	}
+	return nil
 }
 
 func (f *s3Adapter) ListFileNames(ctx context.Context, pathElems ...string) ([]string, error) {
+	files, err := f.ListFiles(ctx, pathElems...)
+	filenames := make([]string, 0, len(files))
+	for _, file := range files {
+		filenames = append(filenames, file.Name)
+	}
+	return filenames, err
+}
+
+// ListFiles use the size returned by ListObjectsV2, so no extra HeadObject is required.
+func (f *s3Adapter) ListFiles(ctx context.Context, pathElems ...string) ([]FileInfo, error) {
+	return f.listFiles(ctx, false, pathElems...)
+}
+
+func (f *s3Adapter) ListFileNamesRecursive(ctx context.Context, pathElems ...string) ([]string, error) {
+	files, err := f.ListFilesRecursive(ctx, pathElems...)
+	filenames := make([]string, 0, len(files))
+	for _, file := range files {
+		filenames = append(filenames, file.Name)
+	}
+	return filenames, err
+}
+
+func (f *s3Adapter) ListFilesRecursive(ctx context.Context, pathElems ...string) ([]FileInfo, error) {
+	return f.listFiles(ctx, true, pathElems...)
+}
+
+// listFiles lists the objects under the path, keys of nested directories are skipped unless recursive.
+func (f *s3Adapter) listFiles(ctx context.Context, recursive bool, pathElems ...string) ([]FileInfo, error) {
 	p := f.joinPath("", pathElems...)
 	s3Client, err := f.getClient(ctx)
 	if err != nil {
@@ -246,14 +867,14 @@ func (f *s3Adapter) ListFileNames(ctx context.Context, pathElems ...string) ([]s
 
 	// Create the Paginator for the ListObjectsV2 operation.
 	paginator := s3.NewListObjectsV2Paginator(s3Client, &params)
-	filenames := make([]string, 0)
+	files := make([]FileInfo, 0)
 	for paginator.HasMorePages() {
-		page, err := try.GetCtx(ctx, func() (*s3.ListObjectsV2Output, error) {
+		page, err := retryGet(ctx, func() (*s3.ListObjectsV2Output, error) {
 			return paginator.NextPage(ctx)
-		}, try.WithFixedBackoff(10*time.Second))
+		}, f.Retry.options()...)
 
 		if err != nil {
-			return filenames, err
+			return files, err
 		}
 		for _, obj := range page.Contents {
 			key := *obj.Key
@@ -262,13 +883,13 @@ func (f *s3Adapter) ListFileNames(ctx context.Context, pathElems ...string) ([]s
 				key = strings.TrimPrefix(key, p+"/")
 			}
 			// Skip nested directories.
-			if strings.Contains(key, "/") {
+			if !recursive && strings.Contains(key, "/") {
 				continue
 			}
-			filenames = append(filenames, key)
+			files = append(files, FileInfo{Name: key, Size: aws.ToInt64(obj.Size), ModTime: aws.ToTime(obj.LastModified)})
 		}
 	}
-	return filenames, nil
+	return files, nil
 }
 
 func (f *s3Adapter) Download(ctx context.Context, destination string, sourcePaths ...string) error {
@@ -281,62 +902,66 @@ func (f *s3Adapter) Download(ctx context.Context, destination string, sourcePath
 		sourcePaths = []string{filepath.Base(destination)}
 	}
 	source := f.joinPath("", sourcePaths...)
-	res, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(f.Bucket),
-		Key:    aws.String(source),
-	})
+	res, err := f.headObject(ctx, s3Client, source)
 	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return errors.Wrapf(ErrFileNotFound, "file %s not found", source)
+		}
 		return errors.Wrapf(err, "error head file %s", source)
 	}
 	if res.ContentLength == nil {
 		return errors.New("cannot determine file size")
 	}
 
-	if err := f.downloadChecksum(ctx, s3Client, destination, source); err != nil {
+	algo, err := f.downloadChecksum(ctx, s3Client, destination, source)
+	if err != nil {
 		return err
 	}
 
+	// The checksum is computed while downloading, so the downloaded file is not read again.
+	var checksum []byte
 	if *res.ContentLength < int64(f.Multipart.ThresholdMB*MB) {
-		err = f.download(ctx, s3Client, destination, source)
+		checksum, err = f.download(ctx, s3Client, destination, source, algo)
 	} else {
-		err = f.downloadMultipart(ctx, s3Client, destination, source)
+		checksum, err = f.downloadMultipart(ctx, s3Client, destination, source, algo)
 	}
 	if err != nil {
 		return err
 	}
-	return utils.VerifyFileSHA256Checksum(destination)
+	return utils.VerifyChecksum(destination, algo, checksum)
 }
 
-func (f *s3Adapter) download(ctx context.Context, s3Client *s3.Client, destination string, source string) error {
-	result, err := try.GetCtx(ctx, func() (*s3.GetObjectOutput, error) {
-		return s3Client.GetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(f.Bucket),
-			Key:    aws.String(source),
-		})
-	}, try.WithFixedBackoff(10*time.Second))
+// download downloads the object using a single request, return its checksum using the algorithm, nil if algo is empty.
+func (f *s3Adapter) download(ctx context.Context, s3Client *s3.Client, destination string, source string, algo string) ([]byte, error) {
+	result, err := f.getObject(ctx, s3Client, source)
 	if err != nil {
-		var noKey *types.NoSuchKey
-		if errors.As(err, &noKey) {
-			return ErrFileNotFound
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, ErrFileNotFound
 		}
-		return errors.Wrapf(err, "error downloading file %s", source)
+		return nil, errors.Wrapf(err, "error downloading file %s", source)
 	}
 	defer result.Body.Close()
-	if err := utils.CopyToFile(ctx, result.Body, destination); err != nil {
-		return errors.Wrapf(err, "error writing file %s", destination)
+	if algo == "" {
+		return nil, errors.Wrapf(utils.CopyToFile(ctx, result.Body, destination), "error writing file %s", destination)
 	}
-	return nil
+	h := utils.NewChecksumHash(algo)
+	if err := utils.CopyToFile(ctx, io.TeeReader(result.Body, h), destination); err != nil {
+		return nil, errors.Wrapf(err, "error writing file %s", destination)
+	}
+	return h.Sum(nil), nil
 }
 
-func (f *s3Adapter) downloadMultipart(ctx context.Context, s3Client *s3.Client, destination string, source string) (err error) {
+// downloadMultipart downloads the object in parts concurrently,
+// return its checksum using the algorithm, nil if algo is empty.
+func (f *s3Adapter) downloadMultipart(ctx context.Context, s3Client *s3.Client, destination string, source string, algo string) (checksum []byte, err error) {
 	downloader := manager.NewDownloader(s3Client, func(u *manager.Downloader) {
 		u.PartSize = int64(min(f.Multipart.PartSizeMB, 10) * MB)
-		u.Concurrency = f.Multipart.Concurrency
+		u.Concurrency = f.IntraFileConcurrency
 	})
 
 	out, err := os.Create(destination)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		cerr := out.Close()
@@ -344,57 +969,233 @@ func (f *s3Adapter) downloadMultipart(ctx context.Context, s3Client *s3.Client,
 			err = cerr
 		}
 	}()
+	var w io.WriterAt = out
+	var hw *utils.HashingFileWriter
+	if algo != "" {
+		hw = utils.NewHashingFileWriter(out, algo)
+		w = hw
+	}
+	counter := core.ProgressCounterFrom(ctx)
+	if counter != nil {
+		w = progressWriterAt{w: w, counter: counter}
+	}
 
-	// TODO: should we retry this?
-	_, err = downloader.Download(ctx, out, &s3.GetObjectInput{
-		Bucket: aws.String(f.Bucket),
-		Key:    aws.String(source),
-	})
-
-	if err != nil {
+	err = retryDo(ctx, func() error {
+		// Discard the content written by the previous attempt.
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		if hw != nil {
+			hw.Reset()
+		}
+		counter.Reset()
+		_, err := downloader.Download(ctx, w, &s3.GetObjectInput{
+			Bucket: aws.String(f.Bucket),
+			Key:    aws.String(source),
+		})
 		var noKey *types.NoSuchKey
 		if errors.As(err, &noKey) {
+			// Retrying won't help.
 			return ErrFileNotFound
 		}
-		return errors.Wrapf(err, "error downloading file %s", source)
+		return err
+	}, f.Retry.options()...)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, errors.Wrapf(err, "error downloading file %s", source)
 	}
+	if hw != nil {
+		checksum, err = hw.Checksum()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error computing checksum of %s", destination)
+		}
+	}
+	return checksum, out.Sync()
+}
+
+// Verify streams the object through the hasher, discarding the content, so no local disk space is required.
+func (f *s3Adapter) Verify(ctx context.Context, pathElem string, pathElems ...string) error {
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	source := f.joinPath(pathElem, pathElems...)
 
-	return out.Sync()
+	expected := strings.Builder{}
+	algo := ""
+	for _, a := range utils.PreferChecksumAlgo(f.checksumAlgo) {
+		err = f.stream(ctx, s3Client, source+utils.ChecksumFileExt(a), &expected)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error reading checksum file of %s", source)
+		}
+		algo = a
+		break
+	}
+	if algo == "" {
+		return errors.Wrapf(ErrNoChecksum, "checksum file of %s not found", source)
+	}
+
+	h := utils.NewChecksumHash(algo)
+	if err := f.stream(ctx, s3Client, source, h); err != nil {
+		return err
+	}
+	return verifyChecksum(source, expected.String(), h.Sum(nil))
 }
 
-func (f *s3Adapter) downloadChecksum(ctx context.Context, s3Client *s3.Client, destination string, source string) error {
-	destination += utils.ChecksumExt
-	source += utils.ChecksumExt
-	err := f.download(ctx, s3Client, destination, source)
-	if errors.Is(err, ErrFileNotFound) {
-		return nil
+// Checksum streams the object through the hasher, discarding the content.
+func (f *s3Adapter) Checksum(ctx context.Context, algo string, pathElem string, pathElems ...string) ([]byte, error) {
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h := utils.NewChecksumHash(algo)
+	if err := f.stream(ctx, s3Client, f.joinPath(pathElem, pathElems...), h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (f *s3Adapter) ReadFile(ctx context.Context, pathElem string, pathElems ...string) ([]byte, error) {
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	if err := f.stream(ctx, s3Client, f.joinPath(pathElem, pathElems...), &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stream writes the content of the object to the writer.
+func (f *s3Adapter) stream(ctx context.Context, s3Client *s3.Client, source string, w io.Writer) error {
+	result, err := f.getObject(ctx, s3Client, source)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return errors.Wrapf(ErrFileNotFound, "file %s not found", source)
+		}
+		return errors.Wrapf(err, "error getting file %s", source)
 	}
-	return errors.Wrapf(err, "error downloading checksum file %s", source)
+	defer result.Body.Close()
+	if _, err := io.Copy(w, utils.ContextReader(ctx, result.Body)); err != nil {
+		return errors.Wrapf(err, "error reading file %s", source)
+	}
+	return nil
+}
+
+// getObject return the object, ErrFileNotFound if the object does not exist.
+func (f *s3Adapter) getObject(ctx context.Context, s3Client *s3.Client, key string) (*s3.GetObjectOutput, error) {
+	return retryGet(ctx, func() (*s3.GetObjectOutput, error) {
+		out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(f.Bucket),
+			Key:    aws.String(key),
+		})
+		var noKey *types.NoSuchKey
+		if errors.As(err, &noKey) {
+			// Retrying won't help.
+			return nil, ErrFileNotFound
+		}
+		return out, err
+	}, f.Retry.options()...)
+}
+
+// downloadChecksum downloads the checksum file of the source, of whichever algorithm exists, if any.
+// Return the algorithm of the downloaded checksum file, empty if not found.
+func (f *s3Adapter) downloadChecksum(ctx context.Context, s3Client *s3.Client, destination string, source string) (string, error) {
+	for _, algo := range utils.PreferChecksumAlgo(f.checksumAlgo) {
+		ext := utils.ChecksumFileExt(algo)
+		_, err := f.download(ctx, s3Client, destination+ext, source+ext, "")
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "error downloading checksum file %s", source+ext)
+		}
+		return algo, nil
+	}
+	return "", nil
 }
 
 func (f *s3Adapter) Config() AdapterConfig {
 	return f.AdapterConfig
 }
 
+func (f *s3Adapter) intraFileConcurrency() int {
+	return f.IntraFileConcurrency
+}
+
+// Ping check that the bucket exists and is accessible using HeadBucket, without retrying.
+func (f *s3Adapter) Ping(ctx context.Context) error {
+	s3Client, err := f.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(f.Bucket)})
+	if err != nil {
+		return errors.Wrapf(err, "error head bucket %s", f.Bucket)
+	}
+	return nil
+}
+
+func (f *s3Adapter) limitIntraFileConcurrency(n int) {
+	f.IntraFileConcurrency = n
+}
+
 func (f *s3Adapter) getClient(ctx context.Context) (*s3.Client, error) {
+	// Verify can be called concurrently.
+	f.clientMu.Lock()
+	defer f.clientMu.Unlock()
 	if f.client != nil {
 		return f.client, nil
 	}
-	cfg, err := try.GetCtx(ctx, func() (aws.Config, error) {
-		return config.LoadDefaultConfig(ctx,
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(f.AccessKeyID, f.AccessSecret, "")),
-			config.WithRegion(f.Region),
-			config.WithRequestChecksumCalculation(0),
-			config.WithResponseChecksumValidation(0),
-			config.WithBaseEndpoint(f.Endpoint),
-		)
-	}, try.WithFixedBackoff(10*time.Second))
+	opts := []func(*config.LoadOptions) error{
+		config.WithRequestChecksumCalculation(0),
+		config.WithResponseChecksumValidation(0),
+		config.WithBaseEndpoint(f.Endpoint),
+		config.WithHTTPClient(awshttp.NewBuildableClient().
+			WithDialerOptions(func(d *net.Dialer) {
+				d.Timeout = f.ConnectTimeout
+			}).
+			WithTransportOptions(func(t *http.Transport) {
+				t.TLSHandshakeTimeout = f.ConnectTimeout
+				t.ResponseHeaderTimeout = f.ReadTimeout
+			})),
+	}
+	switch f.AuthMode {
+	case s3AuthModeStatic:
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(f.AccessKeyID, f.AccessSecret, "")))
+	case s3AuthModeProfile:
+		opts = append(opts, config.WithSharedConfigProfile(f.Profile))
+	}
+	// The region of default and profile auth modes can be resolved from the environment or the shared config.
+	if f.Region != "" {
+		opts = append(opts, config.WithRegion(f.Region))
+	}
+	cfg, err := retryGet(ctx, func() (aws.Config, error) {
+		return config.LoadDefaultConfig(ctx, opts...)
+	}, f.Retry.options()...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading aws config")
 	}
+	if cfg.Region == "" {
+		cfg.Region = "auto"
+	}
 
 	f.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
 		o.DisableLogOutputChecksumValidationSkipped = true
+		o.UsePathStyle = f.ForcePathStyle
+		for _, product := range strings.Fields(f.userAgent) {
+			if key, value, ok := strings.Cut(product, "/"); ok {
+				o.APIOptions = append(o.APIOptions, awsmiddleware.AddUserAgentKeyValue(key, value))
+				continue
+			}
+			o.APIOptions = append(o.APIOptions, awsmiddleware.AddUserAgentKey(product))
+		}
 	})
 	return f.client, nil
 }
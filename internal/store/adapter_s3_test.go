@@ -0,0 +1,479 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFile writes the content to a file in a temp dir, return its path.
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestS3AdapterSaveAndDownload(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{"basePath": "backups"})
+	content := []byte("backup content")
+	source := writeTestFile(t, "db.sinbak", content)
+
+	if err := adapter.Save(context.Background(), source, "260101_0000_db.sinbak"); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if got, _ := fake.object("backups/260101_0000_db.sinbak"); !bytes.Equal(got, content) {
+		t.Errorf("saved object = %q, want %q", got, content)
+	}
+	if got, _ := fake.object("backups/260101_0000_db.sinbak.sha256.txt"); string(got) != sha256Hex(content) {
+		t.Errorf("saved checksum = %q, want %q", got, sha256Hex(content))
+	}
+
+	destination := filepath.Join(t.TempDir(), "260101_0000_db.sinbak")
+	if err := adapter.Download(context.Background(), destination); err != nil {
+		t.Fatalf("Download() error = %s", err)
+	}
+	if got, _ := os.ReadFile(destination); !bytes.Equal(got, content) {
+		t.Errorf("downloaded content = %q, want %q", got, content)
+	}
+	if got, _ := os.ReadFile(destination + ".sha256.txt"); string(got) != sha256Hex(content) {
+		t.Errorf("downloaded checksum = %q, want %q", got, sha256Hex(content))
+	}
+}
+
+func TestS3AdapterSaveMultipart(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{"multipart": map[string]any{"thresholdMB": 20, "partSizeMB": 5}})
+	content := make([]byte, 21*MB)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	source := writeTestFile(t, "big.sinbak", content)
+
+	if err := adapter.Save(context.Background(), source, "260101_0000_big.sinbak"); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if n := fake.count("CreateMultipartUpload", "260101_0000_big.sinbak"); n != 1 {
+		t.Errorf("CreateMultipartUpload requests = %d, want 1", n)
+	}
+	if n := fake.count("UploadPart", "260101_0000_big.sinbak"); n < 2 {
+		t.Errorf("UploadPart requests = %d, want at least 2", n)
+	}
+	if got, _ := fake.object("260101_0000_big.sinbak"); !bytes.Equal(got, content) {
+		t.Errorf("saved object differs from the source")
+	}
+
+	destination := filepath.Join(t.TempDir(), "260101_0000_big.sinbak")
+	if err := adapter.Download(context.Background(), destination); err != nil {
+		t.Fatalf("Download() error = %s", err)
+	}
+	if got, _ := os.ReadFile(destination); !bytes.Equal(got, content) {
+		t.Errorf("downloaded content differs from the source")
+	}
+}
+
+func TestS3AdapterBelowMultipartThreshold(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{"multipart": map[string]any{"thresholdMB": 20}})
+	source := writeTestFile(t, "small.sinbak", make([]byte, MB))
+
+	if err := adapter.Save(context.Background(), source, "260101_0000_small.sinbak"); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if n := fake.count("CreateMultipartUpload", "260101_0000_small.sinbak"); n != 0 {
+		t.Errorf("CreateMultipartUpload requests = %d, want 0", n)
+	}
+	if n := fake.count("PutObject", "260101_0000_small.sinbak"); n != 1 {
+		t.Errorf("PutObject requests = %d, want 1", n)
+	}
+}
+
+func TestS3AdapterUploadChecksumWaitsForChecksumKey(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	source := writeTestFile(t, "db.sinbak", []byte("content"))
+
+	if err := adapter.Save(context.Background(), source, "260101_0000_db.sinbak"); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	requests := fake.received()
+	putChecksum := slices.IndexFunc(requests, func(r fakeS3Request) bool {
+		return r.operation() == "PutObject" && r.Key == "260101_0000_db.sinbak.sha256.txt"
+	})
+	if putChecksum < 0 {
+		t.Fatal("checksum file not uploaded")
+	}
+	waited := slices.ContainsFunc(requests[putChecksum+1:], func(r fakeS3Request) bool {
+		return r.operation() == "HeadObject" && r.Key == "260101_0000_db.sinbak.sha256.txt"
+	})
+	if !waited {
+		t.Error("did not wait for the checksum file after uploading it")
+	}
+}
+
+func TestS3AdapterListFileNames(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{"basePath": "backups"})
+	now := time.Now()
+	fake.put("backups/260101_0000_db.sinbak", []byte("1"), now)
+	fake.put("backups/260101_0000_db.sinbak.sha256.txt", []byte("2"), now)
+	fake.put("backups/nested/260101_0000_db.sinbak", []byte("3"), now)
+	fake.put("other/260101_0000_db.sinbak", []byte("4"), now)
+
+	names, err := adapter.ListFileNames(context.Background())
+	if err != nil {
+		t.Fatalf("ListFileNames() error = %s", err)
+	}
+	want := []string{"260101_0000_db.sinbak", "260101_0000_db.sinbak.sha256.txt"}
+	if !slices.Equal(names, want) {
+		t.Errorf("ListFileNames() = %v, want %v", names, want)
+	}
+
+	files, err := adapter.ListFiles(context.Background())
+	if err != nil {
+		t.Fatalf("ListFiles() error = %s", err)
+	}
+	if len(files) != 2 || files[0].Size != 1 {
+		t.Errorf("ListFiles() = %v, want sizes from the listing", files)
+	}
+	if n := fake.count("HeadObject", "backups/260101_0000_db.sinbak"); n != 0 {
+		t.Errorf("HeadObject requests = %d, want sizes without HeadObject", n)
+	}
+}
+
+func TestS3AdapterDel(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	now := time.Now()
+	fake.put("260101_0000_db.sinbak", []byte("1"), now)
+	fake.put("260101_0000_db.sinbak.sha256.txt", []byte("2"), now)
+	fake.put("260101_0000_db.sinbak.blake3.txt", []byte("3"), now)
+	fake.put("260102_0000_db.sinbak", []byte("4"), now)
+
+	if err := adapter.Del(context.Background(), "260101_0000_db.sinbak"); err != nil {
+		t.Fatalf("Del() error = %s", err)
+	}
+	if keys := fake.keys(); !slices.Equal(keys, []string{"260102_0000_db.sinbak"}) {
+		t.Errorf("remaining objects = %v, want only the other backup", keys)
+	}
+}
+
+func TestS3AdapterCompact(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	now := time.Now()
+	for _, name := range []string{"260101_0000_db.sinbak", "260102_0000_db.sinbak", "260103_0000_db.sinbak"} {
+		fake.put(name, []byte("backup"), now)
+		fake.put(name+".sha256.txt", []byte("checksum"), now)
+	}
+	fake.put("260101_0000_other.sinbak", []byte("backup"), now)
+
+	s := &Syncer{keep: 2}
+	reclaimed, err := s.compact(context.Background(), adapter, "db", "260103_0000_db.sinbak")
+	if err != nil {
+		t.Fatalf("compact() error = %s", err)
+	}
+	want := []string{
+		"260101_0000_other.sinbak",
+		"260102_0000_db.sinbak",
+		"260102_0000_db.sinbak.sha256.txt",
+		"260103_0000_db.sinbak",
+		"260103_0000_db.sinbak.sha256.txt",
+	}
+	if keys := fake.keys(); !slices.Equal(keys, want) {
+		t.Errorf("remaining objects = %v, want %v", keys, want)
+	}
+	if reclaimed != int64(len("backup")) {
+		t.Errorf("compact() reclaimed = %d, want the size of the deleted backup", reclaimed)
+	}
+}
+
+func TestS3AdapterNoSuchKey(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	ctx := context.Background()
+
+	if err := adapter.Download(ctx, filepath.Join(t.TempDir(), "missing.sinbak")); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Download() error = %v, want ErrFileNotFound", err)
+	}
+	if _, err := adapter.ReadFile(ctx, "missing.sinbak"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("ReadFile() error = %v, want ErrFileNotFound", err)
+	}
+	if _, err := adapter.Stat(ctx, "missing.sinbak"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat() error = %v, want ErrFileNotFound", err)
+	}
+	if err := adapter.Move(ctx, "missing.sinbak", "moved.sinbak"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Move() error = %v, want ErrFileNotFound", err)
+	}
+	if err := adapter.Verify(ctx, "missing.sinbak"); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("Verify() error = %v, want ErrNoChecksum", err)
+	}
+}
+
+func TestS3AdapterReuseUploaded(t *testing.T) {
+	content := []byte("backup content")
+	tests := []struct {
+		name string
+		conf map[string]any
+		// uploaded the checksum file content of the backup uploaded by a previous run.
+		uploaded string
+		dest     string
+		// wantUpload whether the backup is uploaded instead of copied.
+		wantUpload bool
+		wantList   bool
+	}{
+		{name: "reused", conf: map[string]any{"reuseUploaded": true}, uploaded: sha256Hex(content), dest: "260102_0000_db.sinbak", wantList: true},
+		{name: "checksum mismatch", conf: map[string]any{"reuseUploaded": true}, uploaded: sha256Hex([]byte("other content!")), dest: "260102_0000_db.sinbak", wantUpload: true, wantList: true},
+		{name: "disabled by default", uploaded: sha256Hex(content), dest: "260102_0000_db.sinbak", wantUpload: true},
+		{name: "sidecar always uploaded", conf: map[string]any{"reuseUploaded": true}, uploaded: sha256Hex(content), dest: "260102_0000_db.sinbak.meta.json", wantUpload: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapter := fake.adapter(t, tt.conf)
+			fake.put("260101_0000_db.sinbak", content, time.Now())
+			fake.put("260101_0000_db.sinbak.sha256.txt", []byte(tt.uploaded), time.Now())
+
+			if err := adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", content), tt.dest); err != nil {
+				t.Fatalf("Save() error = %s", err)
+			}
+			if got, _ := fake.object(tt.dest); !bytes.Equal(got, content) {
+				t.Errorf("saved object = %q, want %q", got, content)
+			}
+			if got, _ := fake.object(tt.dest + ".sha256.txt"); string(got) != sha256Hex(content) {
+				t.Errorf("saved checksum = %q, want %q", got, sha256Hex(content))
+			}
+			if uploaded := fake.count("PutObject", tt.dest) > 0; uploaded != tt.wantUpload {
+				t.Errorf("uploaded = %v, want %v", uploaded, tt.wantUpload)
+			}
+			if copied := fake.count("CopyObject", tt.dest) > 0; copied == tt.wantUpload {
+				t.Errorf("copied = %v, want %v", copied, !tt.wantUpload)
+			}
+			if listed := fake.count("ListObjectsV2", "") > 0; listed != tt.wantList {
+				t.Errorf("listed = %v, want %v", listed, tt.wantList)
+			}
+		})
+	}
+}
+
+func TestS3AdapterForbiddenNotRetried(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{
+		"reuseUploaded": true,
+		"retry":         map[string]any{"maxAttempts": 3, "backoffSeconds": 10},
+	})
+	fake.failFirst("ListObjectsV2", 1, http.StatusForbidden, "AccessDenied")
+
+	start := time.Now()
+	if err := adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", []byte("content")), "260101_0000_db.sinbak"); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if n := fake.count("ListObjectsV2", ""); n != 1 {
+		t.Errorf("ListObjectsV2 requests = %d, want 1", n)
+	}
+	if n := fake.count("PutObject", "260101_0000_db.sinbak"); n != 1 {
+		t.Errorf("PutObject requests = %d, want the backup uploaded after the denied listing", n)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Save() took %s, want no backoff on denied requests", took)
+	}
+}
+
+func TestS3AdapterReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	unresponsive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(unresponsive.Close)
+	// Registered after closing the server, so it runs first and unblocks the handlers.
+	t.Cleanup(func() { close(release) })
+
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{"endpoint": unresponsive.URL, "readTimeout": "200ms"})
+	if adapter.ConnectTimeout != defaultConnectTimeout {
+		t.Errorf("connect timeout = %s, want default %s", adapter.ConnectTimeout, defaultConnectTimeout)
+	}
+
+	start := time.Now()
+	_, err := adapter.Stat(context.Background(), "260101_0000_db.sinbak")
+	if err == nil {
+		t.Fatal("Stat() error = nil, want timeout")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Stat() took %s, want timing out after the read timeout", took)
+	}
+}
+
+func TestS3AdapterUserAgent(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	if err := adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", []byte("backup content")), "260101_0000_db.sinbak"); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+
+	requests := fake.received()
+	if len(requests) == 0 {
+		t.Fatal("no requests received")
+	}
+	for _, r := range requests {
+		if ua := r.Header.Get("User-Agent"); !strings.Contains(ua, "sin/test") {
+			t.Errorf("%s User-Agent = %q, want containing %q", r.operation(), ua, "sin/test")
+		}
+	}
+}
+
+func TestS3AdapterObjectTags(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		size int
+		// operation the request carrying the object metadata and tagging.
+		operation    string
+		disableTags  bool
+		wantMetadata string
+		wantTagging  url.Values
+	}{
+		{
+			name:         "single part",
+			key:          "260101_0000_[daily,prod] db.sinbak",
+			size:         MB,
+			operation:    "PutObject",
+			wantMetadata: "daily,prod",
+			wantTagging:  url.Values{"sin-tag:daily": {"true"}, "sin-tag:prod": {"true"}},
+		},
+		{
+			name:         "multipart",
+			key:          "260101_0000_[daily,prod] db.sinbak",
+			size:         6 * MB,
+			operation:    "CreateMultipartUpload",
+			wantMetadata: "daily,prod",
+			wantTagging:  url.Values{"sin-tag:daily": {"true"}, "sin-tag:prod": {"true"}},
+		},
+		{
+			name:         "object tagging disabled",
+			key:          "260101_0000_[daily] db.sinbak",
+			size:         MB,
+			operation:    "PutObject",
+			disableTags:  true,
+			wantMetadata: "daily",
+		},
+		{
+			name:      "no tags",
+			key:       "260101_0000_db.sinbak",
+			size:      MB,
+			operation: "PutObject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapter := fake.adapter(t, map[string]any{"disableObjectTagging": tt.disableTags})
+			adapter.Multipart.ThresholdMB = 5
+			adapter.Multipart.PartSizeMB = 5
+
+			if err := adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", make([]byte, tt.size)), tt.key); err != nil {
+				t.Fatalf("Save() error = %s", err)
+			}
+			var found bool
+			for _, req := range fake.received() {
+				if req.operation() != tt.operation || req.Key != tt.key {
+					continue
+				}
+				found = true
+				if got := req.Header.Get("X-Amz-Meta-Sin-Tags"); got != tt.wantMetadata {
+					t.Errorf("%s metadata sin-tags = %q, want %q", tt.operation, got, tt.wantMetadata)
+				}
+				tagging, err := url.ParseQuery(req.Header.Get("X-Amz-Tagging"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(tagging) > 0 || len(tt.wantTagging) > 0 {
+					if !reflect.DeepEqual(tagging, tt.wantTagging) {
+						t.Errorf("%s tagging = %v, want %v", tt.operation, tagging, tt.wantTagging)
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("no %s request of %s", tt.operation, tt.key)
+			}
+		})
+	}
+}
+
+func TestS3AdapterTolerateWaiterFailure(t *testing.T) {
+	const key = "260101_0000_db.sinbak"
+	content := []byte("backup content")
+	tests := []struct {
+		name     string
+		tolerate bool
+		// exists whether the object exists when confirming after the waiter failed.
+		exists  bool
+		wantErr bool
+	}{
+		{name: "strict", exists: true, wantErr: true},
+		{name: "tolerated", tolerate: true, exists: true},
+		{name: "tolerated but missing", tolerate: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapter := fake.adapter(t, map[string]any{"tolerateWaiterFailure": tt.tolerate})
+			// The waiter fails on its first HeadObject after the upload, as on storages flaky with waiters.
+			fake.mu.Lock()
+			uploaded, waited := false, false
+			fake.intercept = func(r fakeS3Request) *fakeS3Error {
+				if r.Key != key {
+					return nil
+				}
+				switch r.operation() {
+				case "PutObject":
+					uploaded = true
+				case "HeadObject":
+					if !uploaded {
+						return nil
+					}
+					if !waited {
+						waited = true
+						return &fakeS3Error{Status: http.StatusForbidden, Code: "AccessDenied"}
+					}
+					if !tt.exists {
+						return &fakeS3Error{Status: http.StatusNotFound, Code: "NotFound"}
+					}
+				}
+				return nil
+			}
+			fake.mu.Unlock()
+
+			err := adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", content), key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Save() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if !waited {
+				t.Errorf("waiter did not fail")
+			}
+		})
+	}
+}
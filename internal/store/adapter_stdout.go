@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"io"
+	"os"
+	"path"
+	"sin/internal/utils"
+)
+
+var _ Adapter = (*stdoutAdapter)(nil)
+var _ StreamSaver = (*stdoutAdapter)(nil)
+
+// stdoutAdapter writes the backup to stdout instead of a storage, for piping it into other tools.
+// Only the backup is written to stdout, its checksum is printed to stderr or written to the checksum file.
+// Nothing can be listed or deleted, so no backups are compacted.
+// stdoutAdapter is not safe for concurrent use.
+type stdoutAdapter struct {
+	AdapterConfig
+	out io.Writer
+	// checksumFile the file the checksum is written to, empty to print it to stderr.
+	checksumFile string
+	// checksumAlgo the algorithm of the checksum of the backup.
+	checksumAlgo string
+	// written whether a backup is written, as only one backup can be written to stdout.
+	written bool
+}
+
+func newStdoutAdapter(checksumFile string, checksumAlgo string) *stdoutAdapter {
+	return &stdoutAdapter{
+		AdapterConfig: AdapterConfig{Name: AdapterStdoutType},
+		out:           os.Stdout,
+		checksumFile:  checksumFile,
+		checksumAlgo:  checksumAlgo,
+	}
+}
+
+func (f *stdoutAdapter) Type() string {
+	return AdapterStdoutType
+}
+
+func (f *stdoutAdapter) Config() AdapterConfig {
+	return f.AdapterConfig
+}
+
+func (f *stdoutAdapter) Save(ctx context.Context, source string, pathElem string, pathElems ...string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return errors.Wrapf(err, "error opening file %s", source)
+	}
+	defer file.Close()
+	return f.write(ctx, file, path.Join(append([]string{pathElem}, pathElems...)...), sourceChecksumFrom(ctx))
+}
+
+func (f *stdoutAdapter) SaveStream(ctx context.Context, reader io.Reader, _ int64, pathElem string, pathElems ...string) error {
+	return f.write(ctx, reader, path.Join(append([]string{pathElem}, pathElems...)...), nil)
+}
+
+// write writes the backup to stdout, computing its checksum while writing unless it is precomputed.
+func (f *stdoutAdapter) write(ctx context.Context, reader io.Reader, name string, checksum []byte) error {
+	if f.written {
+		return errors.Newf("cannot write %s to stdout: only one backup can be written", name)
+	}
+	f.written = true
+	h := utils.NewChecksumHash(f.checksumAlgo)
+	if checksum == nil {
+		reader = io.TeeReader(reader, h)
+	}
+	// Stdout cannot be rewound, so writing is never retried.
+	if _, err := io.Copy(f.out, utils.ContextReader(ctx, reader)); err != nil {
+		return errors.Wrapf(err, "error writing %s to stdout", name)
+	}
+	if checksum == nil {
+		checksum = h.Sum(nil)
+	}
+	if f.checksumFile != "" {
+		return errors.Wrapf(utils.WriteChecksum(f.checksumFile, checksum), "error writing checksum file %s", f.checksumFile)
+	}
+	// pterm prints to stderr in stdout mode.
+	pterm.Printf("%s checksum of %s: %s\n", f.checksumAlgo, name, hex.EncodeToString(checksum))
+	return nil
+}
+
+// Del does nothing, as the backup written to stdout cannot be deleted.
+func (f *stdoutAdapter) Del(_ context.Context, _ string, _ ...string) error {
+	return nil
+}
+
+// ListFileNames return nothing, as the backups written to stdout cannot be listed.
+func (f *stdoutAdapter) ListFileNames(_ context.Context, _ ...string) ([]string, error) {
+	return nil, nil
+}
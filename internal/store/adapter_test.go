@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/mawngo/go-errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatFiles(t *testing.T) {
+	names := make([]string, 50)
+	for i := range names {
+		names[i] = fmt.Sprintf("260101_%04d_db.sinbak", i)
+	}
+
+	tests := []struct {
+		name        string
+		concurrency int
+		want        int
+	}{
+		{name: "configured", concurrency: 3, want: 3},
+		{name: "serial", concurrency: 1, want: 1},
+		{name: "default", concurrency: 0, want: defaultStatConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, peak atomic.Int32
+			files, err := statFiles(context.Background(), names, tt.concurrency, func(_ context.Context, name string) (FileInfo, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				time.Sleep(time.Millisecond)
+				return FileInfo{Name: name}, nil
+			})
+			if err != nil {
+				t.Fatalf("statFiles() error = %s", err)
+			}
+			for i, file := range files {
+				if file.Name != names[i] {
+					t.Fatalf("files[%d] = %s, want %s in the order of names", i, file.Name, names[i])
+				}
+			}
+			if p := int(peak.Load()); p > tt.want {
+				t.Errorf("concurrent stats = %d, want at most %d", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatFilesError(t *testing.T) {
+	errStat := errors.New("stat failed")
+	_, err := statFiles(context.Background(), []string{"a", "b", "c"}, 2, func(_ context.Context, name string) (FileInfo, error) {
+		if name == "b" {
+			return FileInfo{}, errStat
+		}
+		return FileInfo{Name: name}, nil
+	})
+	if !errors.Is(err, errStat) {
+		t.Errorf("statFiles() error = %v, want %v", err, errStat)
+	}
+}
+
+func TestS3AdapterListFilesWithoutHead(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	for i := range 20 {
+		fake.put(fmt.Sprintf("260101_%04d_db.sinbak", i), make([]byte, i), time.Now())
+	}
+
+	names, sizes, err := listFilesWithSize(context.Background(), adapter)
+	if err != nil {
+		t.Fatalf("listFilesWithSize() error = %s", err)
+	}
+	if len(names) != 20 {
+		t.Fatalf("listed %d files, want 20", len(names))
+	}
+	if size := sizes["260101_0007_db.sinbak"]; size != 7 {
+		t.Errorf("size = %d, want 7", size)
+	}
+	// The sizes are already in the listing, so no object is stat.
+	for _, r := range fake.received() {
+		if r.operation() == "HeadObject" {
+			t.Errorf("unexpected HeadObject request of %s", r.Key)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package store
+
+// intraFileConcurrent Adapter that transfers a single file using multiple concurrent requests.
+type intraFileConcurrent interface {
+	Adapter
+	// intraFileConcurrency return the number of concurrent requests when transferring a single file.
+	intraFileConcurrency() int
+	// limitIntraFileConcurrency limits the number of concurrent requests when transferring a single file.
+	limitIntraFileConcurrency(n int)
+}
+
+// limitConcurrency return the number of targets to sync concurrently (cross target concurrency),
+// limiting it and the intra file concurrency of adapters,
+// so that the total number of concurrent requests does not exceed the limit.
+// The limit < 1 means unlimited.
+func limitConcurrency(cross int, limit int, adapters []Adapter) int {
+	cross = max(min(cross, len(adapters)), 1)
+	if limit < 1 {
+		return cross
+	}
+
+	intra := 1
+	for _, adapter := range adapters {
+		if a, ok := adapter.(intraFileConcurrent); ok {
+			if a.intraFileConcurrency() > limit {
+				a.limitIntraFileConcurrency(limit)
+			}
+			intra = max(intra, a.intraFileConcurrency())
+		}
+	}
+	return max(min(cross, limit/intra), 1)
+}
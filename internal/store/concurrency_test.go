@@ -0,0 +1,57 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		cross int
+		limit int
+		// intra the intra file concurrency of each s3 target, 0 for a file target.
+		intra     []int
+		wantCross int
+		wantIntra []int
+	}{
+		{name: "unlimited", cross: 4, limit: 0, intra: []int{5, 5, 5, 5}, wantCross: 4, wantIntra: []int{5, 5, 5, 5}},
+		{name: "cross capped by targets", cross: 10, limit: 0, intra: []int{5, 5}, wantCross: 2, wantIntra: []int{5, 5}},
+		{name: "cross reduced to fit intra", cross: 4, limit: 10, intra: []int{5, 5, 5, 5}, wantCross: 2, wantIntra: []int{5, 5, 5, 5}},
+		{name: "intra reduced to the limit", cross: 3, limit: 4, intra: []int{10, 2, 0}, wantCross: 1, wantIntra: []int{4, 2, 0}},
+		{name: "file targets only", cross: 3, limit: 2, intra: []int{0, 0, 0}, wantCross: 2, wantIntra: []int{0, 0, 0}},
+		{name: "at least one", cross: 0, limit: 1, intra: []int{5}, wantCross: 1, wantIntra: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapters := make([]Adapter, len(tt.intra))
+			for i, intra := range tt.intra {
+				if intra == 0 {
+					adapters[i] = &fileAdapter{}
+					continue
+				}
+				adapters[i] = fake.adapter(t, map[string]any{"intraFileConcurrency": intra})
+			}
+
+			cross := limitConcurrency(tt.cross, tt.limit, adapters)
+			if cross != tt.wantCross {
+				t.Errorf("cross concurrency = %d, want %d", cross, tt.wantCross)
+			}
+			maxIntra := 1
+			for i, adapter := range adapters {
+				intra := 0
+				if a, ok := adapter.(intraFileConcurrent); ok {
+					intra = a.intraFileConcurrency()
+					maxIntra = max(maxIntra, intra)
+				}
+				if intra != tt.wantIntra[i] {
+					t.Errorf("intra concurrency of target %d = %d, want %d", i, intra, tt.wantIntra[i])
+				}
+			}
+			// The combined number of concurrent requests never exceeds the limit.
+			if tt.limit > 0 && cross*maxIntra > tt.limit {
+				t.Errorf("combined concurrency %d x %d exceeds the limit %d", cross, maxIntra, tt.limit)
+			}
+		})
+	}
+}
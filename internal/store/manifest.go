@@ -0,0 +1,179 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"github.com/mawngo/go-try/v2"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	manifestRequestTimeout  = 30 * time.Second
+	manifestRequestAttempts = 3
+)
+
+// ErrNotInManifest the backup has no entry in the checksum manifest, so it cannot be trusted.
+var ErrNotInManifest = errors.New("backup not found in checksum manifest")
+
+// manifestEntry an entry of the checksum manifest, a line of tab separated backup name, algorithm and hex checksum.
+type manifestEntry struct {
+	Backup       string
+	ChecksumAlgo string
+	Checksum     string
+}
+
+func (e manifestEntry) String() string {
+	return e.Backup + "\t" + e.ChecksumAlgo + "\t" + e.Checksum + "\n"
+}
+
+// checksumManifest the external append-only manifest of the checksums of created backups.
+type checksumManifest struct {
+	core.ChecksumManifestConfig
+	userAgent string
+}
+
+// newChecksumManifest return nil if the manifest is disabled.
+func newChecksumManifest(conf core.ChecksumManifestConfig, userAgent string) *checksumManifest {
+	if !conf.Enabled() {
+		return nil
+	}
+	return &checksumManifest{ChecksumManifestConfig: conf, userAgent: userAgent}
+}
+
+// Append appends the entry to the manifest, never modifying the existing entries.
+func (m *checksumManifest) Append(ctx context.Context, entry manifestEntry) error {
+	if m.IsURL() {
+		_, err := m.request(ctx, http.MethodPost, []byte(entry.String()))
+		return errors.Wrapf(err, "error appending to checksum manifest")
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "error creating checksum manifest directory")
+	}
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "error opening checksum manifest")
+	}
+	if _, err := file.WriteString(entry.String()); err != nil {
+		_ = file.Close()
+		return errors.Wrapf(err, "error appending to checksum manifest")
+	}
+	return errors.Wrapf(file.Close(), "error appending to checksum manifest")
+}
+
+// Load reads the entries of the manifest by backup name.
+// If a backup has multiple entries, the last one wins. Return empty if the manifest file does not exist.
+func (m *checksumManifest) Load(ctx context.Context) (map[string]manifestEntry, error) {
+	var content []byte
+	if m.IsURL() {
+		b, err := m.request(ctx, http.MethodGet, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading checksum manifest")
+		}
+		content = b
+	} else {
+		b, err := os.ReadFile(m.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrapf(err, "error reading checksum manifest")
+		}
+		content = b
+	}
+
+	entries := make(map[string]manifestEntry)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 || !slices.Contains(utils.ChecksumAlgos, parts[1]) {
+			return nil, errors.Newf("invalid checksum manifest entry '%s'", line)
+		}
+		entries[parts[0]] = manifestEntry{Backup: parts[0], ChecksumAlgo: parts[1], Checksum: parts[2]}
+	}
+	return entries, scanner.Err()
+}
+
+// request sends the request to the url manifest, retrying on error, and return the response body.
+func (m *checksumManifest) request(ctx context.Context, method string, body []byte) ([]byte, error) {
+	client := http.Client{Timeout: manifestRequestTimeout}
+	return try.GetCtx(ctx, func() ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, method, m.Path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", m.userAgent)
+		if body != nil {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+		for k, v := range m.Headers {
+			req.Header.Set(k, v)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode >= 300 {
+			return nil, errors.Newf("unexpected status %s", res.Status)
+		}
+		return io.ReadAll(res.Body)
+	}, try.WithAttempts(manifestRequestAttempts), try.WithFixedBackoff(2*time.Second))
+}
+
+// appendManifest appends the checksum of the backup to the checksum manifest, if enabled.
+func (s *Syncer) appendManifest(ctx context.Context, backup string, checksum []byte) error {
+	if s.manifest == nil || s.dryRun {
+		return nil
+	}
+	return s.manifest.Append(ctx, manifestEntry{
+		Backup:       backup,
+		ChecksumAlgo: s.checksumAlgo,
+		Checksum:     hex.EncodeToString(checksum),
+	})
+}
+
+// loadManifest return the entries of the checksum manifest, nil if disabled.
+func (s *Syncer) loadManifest(ctx context.Context) (map[string]manifestEntry, error) {
+	if s.manifest == nil {
+		return nil, nil
+	}
+	return s.manifest.Load(ctx)
+}
+
+// verifyManifest compares the local file to the manifest entry of the backup.
+// Do nothing if the manifest is disabled (nil entries).
+func verifyManifest(entries map[string]manifestEntry, path string, backup string) error {
+	if entries == nil {
+		return nil
+	}
+	entry, ok := entries[backup]
+	if !ok {
+		return errors.Wrapf(ErrNotInManifest, "%s", backup)
+	}
+	checksum, err := utils.FileChecksum(path, entry.ChecksumAlgo)
+	if err != nil {
+		return errors.Wrapf(err, "error computing checksum of %s", path)
+	}
+	return verifyManifestChecksum(entry, checksum)
+}
+
+// verifyManifestChecksum compares the computed checksum to the manifest entry.
+func verifyManifestChecksum(entry manifestEntry, checksum []byte) error {
+	if actual := hex.EncodeToString(checksum); actual != entry.Checksum {
+		return errors.Wrapf(utils.ErrChecksumMismatch, "%s does not match checksum manifest: expected %s, got %s",
+			entry.Backup, entry.Checksum, actual)
+	}
+	return nil
+}
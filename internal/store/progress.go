@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/pterm/pterm"
+	"io"
+	"os"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// progressRefreshInterval the interval of redrawing the progress bars.
+	progressRefreshInterval = 200 * time.Millisecond
+	// progressLogInterval the interval of printing the progress log lines, when not displaying bars.
+	progressLogInterval = 30 * time.Second
+	// progressBarWidth the number of characters of each progress bar.
+	progressBarWidth = 30
+)
+
+// progressDisplay displays the progress of the concurrent transfers of an operation,
+// as a progress bar of each transfer followed by the overall progress, or as periodic log lines.
+// nil progressDisplay displays nothing.
+type progressDisplay struct {
+	mode  string
+	title string
+	start time.Time
+
+	mu        sync.Mutex
+	transfers []*transferProgress
+	area      *pterm.AreaPrinter
+	// restoreOutput restores the output of pterm printers redirected while drawing the bars.
+	restoreOutput func()
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// transferProgress the progress of a transfer, such as uploading the backup to a target.
+// nil transferProgress tracks nothing.
+type transferProgress struct {
+	name string
+	// total the expected bytes to transfer, 0 if unknown.
+	total   int64
+	counter *core.ProgressCounter
+	start   time.Time
+
+	// Guarded by the progressDisplay mutex.
+	finished bool
+	err      error
+	took     time.Duration
+}
+
+// startProgress starts displaying the progress of the operation, return nil if progress is disabled.
+func (s *Syncer) startProgress(title string) *progressDisplay {
+	if s.progressMode == core.ProgressNone || s.progressMode == "" || s.dryRun {
+		return nil
+	}
+	p := &progressDisplay{
+		mode:  s.progressMode,
+		title: title,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	interval := progressLogInterval
+	if p.mode == core.ProgressBar {
+		interval = progressRefreshInterval
+		p.area, _ = pterm.DefaultArea.Start()
+		p.restoreOutput = redirectPtermOutput(progressOutput{p: p})
+	}
+	go p.run(interval)
+	return p
+}
+
+// track starts tracking a transfer of total bytes (0 if unknown),
+// return a copy of ctx counting the transferred bytes of the transfer.
+func (p *progressDisplay) track(ctx context.Context, name string, total int64) (context.Context, *transferProgress) {
+	if p == nil {
+		return ctx, nil
+	}
+	t := &transferProgress{name: name, total: max(total, 0), counter: &core.ProgressCounter{}, start: time.Now()}
+	p.mu.Lock()
+	p.transfers = append(p.transfers, t)
+	p.mu.Unlock()
+	return core.WithProgressCounter(ctx, t.counter), t
+}
+
+// finish marks the transfer as completed, or failed if err is not nil.
+func (p *progressDisplay) finish(t *transferProgress, err error) {
+	if p == nil || t == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.finished = true
+	t.err = err
+	t.took = time.Since(t.start)
+}
+
+// Stop stops displaying the progress, drawing the final progress bars if displayed.
+func (p *progressDisplay) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	if p.area == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.area.Update(p.render())
+	_ = p.area.Stop()
+	p.restoreOutput()
+}
+
+func (p *progressDisplay) run(interval time.Duration) {
+	defer close(p.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.area != nil {
+				p.area.Update(p.render())
+			} else {
+				p.log()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// render return the progress bars of the transfers and the overall progress.
+// Must be called with the mutex held.
+func (p *progressDisplay) render() string {
+	width := len("Total")
+	for _, t := range p.transfers {
+		width = max(width, len(t.name))
+	}
+	sb := strings.Builder{}
+	var transferred, total int64
+	finished, known := 0, true
+	for _, t := range p.transfers {
+		n := t.transferred()
+		transferred += n
+		total += t.total
+		known = known && t.total > 0
+		status := formatRate(n, time.Since(t.start))
+		if t.finished {
+			finished++
+			status = "done in " + t.took.Round(time.Second).String()
+			if t.err != nil {
+				status = "failed"
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%-*s %s %s\n", width, t.name, formatProgress(n, t.total), status))
+	}
+	if !known {
+		total = 0
+	}
+	sb.WriteString(fmt.Sprintf("%-*s %s %s, %d/%d completed, elapsed %s\n", width, "Total",
+		formatProgress(transferred, total),
+		formatRate(transferred, time.Since(p.start)),
+		finished, len(p.transfers),
+		time.Since(p.start).Round(time.Second).String()))
+	return sb.String()
+}
+
+// log prints the progress of the unfinished transfers.
+// Must be called with the mutex held.
+func (p *progressDisplay) log() {
+	for _, t := range p.transfers {
+		if t.finished {
+			continue
+		}
+		n := t.transferred()
+		if t.total > 0 {
+			pterm.Printf("%s %s: %d%% (%s/%s), %s\n", p.title, t.name, n*100/t.total,
+				utils.FormatBytes(n), utils.FormatBytes(t.total), formatRate(n, time.Since(t.start)))
+			continue
+		}
+		pterm.Printf("%s %s: %s, %s\n", p.title, t.name, utils.FormatBytes(n), formatRate(n, time.Since(t.start)))
+	}
+}
+
+// transferred return the transferred bytes, capped at the total if known,
+// as retried or re-read parts may be counted more than once.
+func (t *transferProgress) transferred() int64 {
+	n := t.counter.Load()
+	if t.total > 0 {
+		n = min(n, t.total)
+	}
+	if t.finished && t.err == nil && t.total > 0 {
+		n = t.total
+	}
+	return n
+}
+
+// formatProgress return the progress bar of n transferred bytes, or only the transferred size if the total is unknown.
+func formatProgress(n int64, total int64) string {
+	if total <= 0 {
+		return utils.FormatBytes(n)
+	}
+	filled := int(n * progressBarWidth / total)
+	bar := strings.Repeat("█", filled) + strings.Repeat("·", progressBarWidth-filled)
+	return fmt.Sprintf("[%s] %3d%% %s/%s", bar, n*100/total, utils.FormatBytes(n), utils.FormatBytes(total))
+}
+
+// formatRate return the transfer rate of n bytes in d.
+func formatRate(n int64, d time.Duration) string {
+	if d < time.Second {
+		return "-/s"
+	}
+	return utils.FormatBytes(int64(float64(n)/d.Seconds())) + "/s"
+}
+
+// progressOutput writes the output of pterm printers above the progress bars, so they are not overwritten.
+type progressOutput struct {
+	p *progressDisplay
+}
+
+func (o progressOutput) Write(b []byte) (int, error) {
+	o.p.mu.Lock()
+	defer o.p.mu.Unlock()
+	o.p.area.Update("")
+	n, err := os.Stdout.Write(b)
+	o.p.area.Update(o.p.render())
+	return n, err
+}
+
+// redirectPtermOutput redirects the output of the default pterm printers to w, return the func restoring it.
+func redirectPtermOutput(w io.Writer) func() {
+	printers := []*pterm.PrefixPrinter{&pterm.Info, &pterm.Success, &pterm.Warning, &pterm.Error, &pterm.Debug, &pterm.Description}
+	writers := make([]io.Writer, len(printers))
+	for i, printer := range printers {
+		writers[i] = printer.Writer
+		printer.Writer = w
+	}
+	pterm.SetDefaultOutput(w)
+	return func() {
+		for i, printer := range printers {
+			printer.Writer = writers[i]
+		}
+		pterm.SetDefaultOutput(os.Stdout)
+	}
+}
+
+// progressFile counts the bytes read from the file into the counter, keeping the file seekable for the s3 uploader.
+type progressFile struct {
+	*os.File
+	counter *core.ProgressCounter
+}
+
+// progressBody return the file counting the read bytes into the core.ProgressCounter carried by ctx,
+// or the file itself if there is none.
+func progressBody(ctx context.Context, file *os.File) io.ReadSeeker {
+	counter := core.ProgressCounterFrom(ctx)
+	if counter == nil {
+		return file
+	}
+	return progressFile{File: file, counter: counter}
+}
+
+func (f progressFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.counter.Add(n)
+	return n, err
+}
+
+func (f progressFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.counter.Add(n)
+	return n, err
+}
+
+// Seek restarts counting when rewinding to the start, as the body is read again from the beginning.
+func (f progressFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil && pos == 0 {
+		f.counter.Reset()
+	}
+	return pos, err
+}
+
+// progressWriterAt counts the bytes written into the counter.
+type progressWriterAt struct {
+	w       io.WriterAt
+	counter *core.ProgressCounter
+}
+
+func (w progressWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.w.WriteAt(p, off)
+	w.counter.Add(n)
+	return n, err
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PruneOptions selects the backups deleted by Syncer.Prune.
+// If neither Keep nor OlderThan is specified, the keep/retention config of each target is used.
+type PruneOptions struct {
+	Tags []string
+	// Keep the number of newest backups to keep, 0 to not limit the number.
+	Keep int
+	// OlderThan only deletes the backups older than it, 0 to not limit the age.
+	OlderThan time.Duration
+	// Confirm deletes the backups, otherwise only prints what would be deleted.
+	Confirm bool
+}
+
+// Prune deletes the old backups of filename on each target, without syncing a backup.
+// The adapterNames limits the targets to prune, all enabled targets if empty.
+func (s *Syncer) Prune(ctx context.Context, filename string, opts PruneOptions, adapterNames ...string) error {
+	if len(s.adapters) == 0 {
+		return errors.Wrapf(ErrNoTargets, "empty list of targets")
+	}
+	for _, name := range adapterNames {
+		if !slices.ContainsFunc(s.adapters, func(adapter Adapter) bool { return adapter.Config().Name == name }) {
+			return errors.Newf("unknown target '%s'", name)
+		}
+	}
+	filename = strings.TrimSuffix(filename, core.BackupFileExt)
+	dryRun := s.dryRun || !opts.Confirm
+	now := time.Now()
+
+	errs := make([]error, 0, len(s.adapters))
+	reclaimed, pruned := int64(0), 0
+	for _, adapter := range s.adapters {
+		conf := adapter.Config()
+		if len(adapterNames) > 0 && !slices.Contains(adapterNames, conf.Name) {
+			continue
+		}
+		keep, retention := opts.Keep, core.RetentionPolicy{}
+		if opts.Keep < 1 && opts.OlderThan <= 0 {
+			keep, retention = s.retentionOf(adapter)
+			if keep < 1 && !retention.Enabled() {
+				pterm.Warning.Println("Skip pruning", conf.Name, "as it has no keep or retention config")
+				continue
+			}
+		}
+
+		allNames, sizes, err := listFilesWithSize(ctx, adapter)
+		if err != nil {
+			pterm.Warning.Println("Error listing", conf.Name, err)
+			errs = append(errs, errors.Wrapf(err, "error listing %s", conf.Name))
+			if s.failFast {
+				break
+			}
+			continue
+		}
+		names := utils.FilterBackupFileNamesByTags(allNames, filename, opts.Tags)
+		deletions := names
+		if keep > 0 || retention.Enabled() {
+			deletions = selectOldBackups(names, keep, retention)
+		}
+		if opts.OlderThan > 0 {
+			deletions = selectOlderBackups(deletions, now.Add(-opts.OlderThan))
+		}
+		if len(deletions) == 0 {
+			pterm.Info.Println("Nothing to prune on", conf.Name, pterm.Sprintf("(%d backups)", len(names)))
+			continue
+		}
+		n, err := deleteBackups(ctx, adapter, filename, deletions, allNames, sizes, dryRun)
+		reclaimed += n
+		pruned += len(deletions)
+		if err != nil {
+			pterm.Warning.Println("Error pruning", conf.Name, err)
+			errs = append(errs, errors.Wrapf(err, "error pruning %s", conf.Name))
+			if s.failFast {
+				break
+			}
+		}
+	}
+	if dryRun && !s.dryRun && pruned > 0 {
+		pterm.Info.Println("Nothing deleted, use --yes to delete the backups")
+	}
+	slog.Info("Pruned old backups",
+		slog.String("filename", filename),
+		slog.Bool("dryRun", dryRun),
+		slog.Int("count", pruned),
+		slog.Int64("reclaimed", reclaimed))
+	return errors.Join(errs...)
+}
+
+// selectOlderBackups return the backups created before the time.
+// Backups whose time cannot be parsed from the name are always kept.
+func selectOlderBackups(names []string, before time.Time) []string {
+	older := make([]string, 0, len(names))
+	for _, name := range names {
+		if t, ok := utils.ParseBackupTime(name); ok && t.Before(before) {
+			older = append(older, name)
+		}
+	}
+	return older
+}
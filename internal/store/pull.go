@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"encoding/hex"
 	"github.com/mawngo/go-errors"
 	"github.com/pterm/pterm"
 	"github.com/samber/lo"
@@ -15,7 +16,9 @@
 	"time"
 )
 
-func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...string) error {
+// Pull downloads the latest backups from targets to local.
+// If tags are specified, only backups having all the tags are pulled.
+func (s *Syncer) Pull(ctx context.Context, filename string, tags []string, adapterNames ...string) error {
 	filename = strings.TrimSuffix(filename, core.BackupFileExt)
 
 	if _, err := os.Stat(s.pullTargetDir); err != nil {
@@ -29,6 +32,11 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 		return nil
 	}
 
+	manifest, err := s.loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+
 	pterm.Println("Pulling to", s.pullTargetDir)
 
 	downloaders := lo.FilterMap(s.adapters, func(adapter Adapter, _ int) (Downloader, bool) {
@@ -39,21 +47,24 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 		return d, ok
 	})
 	if len(downloaders) == 0 {
-		return errors.New("empty list of downloadable targets")
+		return errors.Wrapf(ErrNoTargets, "empty list of downloadable targets")
 	}
 
 	pullableByDownloader := make(map[Downloader][]string, len(downloaders))
+	// Set of backups that have metadata file.
+	metadataByDownloader := make(map[Downloader]map[string]struct{}, len(downloaders))
 	availableDownloaderLeft := len(downloaders)
 	start := time.Now()
 	pulledCnt := 0
 	errs := make([]error, 0, len(downloaders))
+	progress := s.startProgress("Pulling")
 	for availableDownloaderLeft > 0 {
 		names, err := utils.ListFileNames(s.pullTargetDir)
 		if err != nil {
 			pterm.Warning.Println("Cannot count number of pulled file:", err.Error())
 			slog.Error("Cannot count number of pulled file", slog.String("filename", filename), slog.Any("err", err))
 		}
-		names = utils.FilterBackupFileNames(names, filename)
+		names = utils.FilterBackupFileNamesByTags(names, filename, tags)
 		toPull := 1
 		if s.keep > 1 {
 			toPull = max(s.keep-len(names), 1)
@@ -61,6 +72,15 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 		pulled := lo.SliceToMap(names, func(name string) (string, struct{}) {
 			return name, struct{}{}
 		})
+		// Encrypted backups are decrypted after pulled, so the local decrypted backup counts as pulled.
+		for _, name := range names {
+			if s.passphrase != nil {
+				pulled[utils.EncryptedFileName(name, utils.EncryptedExt)] = struct{}{}
+			}
+			if s.ageIdentities != nil {
+				pulled[utils.EncryptedFileName(name, utils.AgeEncryptedExt)] = struct{}{}
+			}
+		}
 		pterm.Printf("Pulling in progress %d pulled, expected %d more...\n", pulledCnt, toPull)
 
 		// Start downloading.
@@ -73,13 +93,17 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 			pullable, ok := pullableByDownloader[downloader]
 			if !ok {
 				var err error
-				pullable, err = downloader.ListFileNames(ctx)
+				pullable, err = listFileNames(ctx, downloader)
 				if err != nil {
 					pterm.Warning.Println("Cannot list file names for", downloader.Config().Name, ": ", err.Error())
 					slog.Error("Cannot list file names", slog.String("adapter", downloader.Config().Name), slog.Any("err", err))
 				}
-				pullable = utils.FilterBackupFileNames(pullable, filename)
+				all := pullable
+				pullable = utils.FilterBackupFileNamesByTags(pullable, filename, tags)
 				pullableByDownloader[downloader] = pullable
+				metadataByDownloader[downloader] = lo.FilterSliceToMap(pullable, func(name string) (string, struct{}, bool) {
+					return name, struct{}{}, slices.Contains(all, name+utils.MetadataExt)
+				})
 			}
 
 			if len(pullable) == 0 {
@@ -107,7 +131,8 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 				if _, ok := pulled[file]; ok {
 					continue
 				}
-				if err := s.pull(ctx, downloader, file); err == nil {
+				_, hasMetadata := metadataByDownloader[downloader][file]
+				if err := s.pull(ctx, progress, downloader, file, hasMetadata, manifest); err == nil {
 					toPull--
 					pulledCnt++
 					if toPull == 0 {
@@ -121,6 +146,7 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 			break
 		}
 	}
+	progress.Stop()
 
 	if pulledCnt == 0 {
 		slog.Warn("All pull failed/skipped")
@@ -132,7 +158,7 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 	}
 
 	// Compacting.
-	if err := s.compactLocal(filename); err != nil {
+	if err := s.compactLocal(filename, tags, s.keep, s.retention); err != nil {
 		errs = append(errs, err)
 		// Currently we ignore compact error as it is not critical, and compact can be run again next sync.
 		// But if the error happens continuously, it could be a problem.
@@ -146,11 +172,22 @@ func (s *Syncer) Pull(ctx context.Context, filename string, adapterNames ...stri
 	return nil
 }
 
-func (s *Syncer) pull(ctx context.Context, downloader Downloader, file string) error {
+// pull downloads the backup to local, verifying it against the manifest entries if not nil,
+// and its signature if the signing public key is configured.
+func (s *Syncer) pull(ctx context.Context, progress *progressDisplay, downloader Downloader, file string, hasMetadata bool, manifest map[string]manifestEntry) error {
 	start := time.Now()
 	conf := downloader.Config()
 	destination := filepath.Join(s.pullTargetDir, file)
-	err := downloader.Download(ctx, destination, file)
+	downloadCtx, transfer := progress.track(ctx, conf.Name+" "+file, 0)
+	err := downloader.Download(downloadCtx, destination, file)
+	progress.finish(transfer, err)
+	if err == nil {
+		err = errors.Join(verifyManifest(manifest, destination, file), s.verifySignature(ctx, downloader, destination, file))
+		if err != nil {
+			// Never keep a backup that cannot be trusted.
+			err = errors.Join(err, utils.DelFile(destination))
+		}
+	}
 	if err != nil {
 		// Only report instead of stop completely.
 		pterm.Error.Println("Error pull to local from", downloader.Config().Name, err)
@@ -160,6 +197,26 @@ func (s *Syncer) pull(ctx context.Context, downloader Downloader, file string) e
 			slog.Any("err", err))
 		return err
 	}
+	if hasMetadata {
+		if err := downloader.Download(ctx, destination+utils.MetadataExt, file+utils.MetadataExt); err != nil {
+			// Metadata is optional, so only report.
+			pterm.Warning.Println("Error pull metadata to local from", conf.Name, err)
+			slog.Warn("Error pulling metadata",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", file),
+				slog.Any("err", err))
+		}
+	}
+	if s.canDecrypt(file) {
+		if err := s.decrypt(ctx, destination); err != nil {
+			pterm.Error.Println("Error decrypting", file, err)
+			slog.Error("Error decrypting",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", file),
+				slog.Any("err", err))
+			return err
+		}
+	}
 	pterm.Success.Println("Pulled from", conf.Name, ":", file, "took", time.Since(start).String())
 	slog.Info("Pulled",
 		slog.String("adapter", conf.Name),
@@ -168,35 +225,159 @@ func (s *Syncer) pull(ctx context.Context, downloader Downloader, file string) e
 	return nil
 }
 
-func (s *Syncer) compactLocal(filename string) error {
-	if s.keep < 1 {
-		slog.Info("Skip delete old pulled backup due to config",
+// canDecrypt check whether the backup is encrypted and can be decrypted using the configured key.
+func (s *Syncer) canDecrypt(file string) bool {
+	_, encryption := utils.DecryptedFileName(file)
+	switch encryption {
+	case utils.EncryptionAES256GCM:
+		return s.passphrase != nil
+	case utils.EncryptionAge:
+		return s.ageIdentities != nil
+	}
+	return false
+}
+
+// decrypt replaces the pulled encrypted backup with the decrypted one.
+// The checksum of the encrypted backup must be verified before decrypting.
+func (s *Syncer) decrypt(ctx context.Context, path string) error {
+	plain, encryption := utils.DecryptedFileName(path)
+	checksum, err := s.decryptFile(ctx, encryption, path, plain)
+	if err != nil {
+		return err
+	}
+
+	// Update the metadata to describe the decrypted backup.
+	if exists, err := utils.FileExists(path + utils.MetadataExt); err != nil {
+		return errors.Wrapf(err, "error checking metadata file")
+	} else if exists {
+		metadata, err := utils.ReadBackupMetadata(path + utils.MetadataExt)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(plain)
+		if err != nil {
+			return err
+		}
+		metadata.Encryption = ""
+		metadata.Size = info.Size()
+		metadata.Checksum = hex.EncodeToString(checksum)
+		metadata.ChecksumAlgo = s.checksumAlgo
+		if err := utils.WriteBackupMetadata(plain+utils.MetadataExt, metadata); err != nil {
+			return err
+		}
+		if err := utils.DelFile(path + utils.MetadataExt); err != nil {
+			return errors.Wrapf(err, "error removing metadata of encrypted backup")
+		}
+	}
+	return utils.DelFile(path)
+}
+
+// decryptFile decrypts the src file into dst and creates the checksum file of dst, returning the checksum.
+func (s *Syncer) decryptFile(ctx context.Context, encryption string, src string, dst string) ([]byte, error) {
+	var err error
+	if encryption == utils.EncryptionAge {
+		err = utils.AgeDecryptFile(ctx, src, dst, s.ageIdentities)
+	} else {
+		err = utils.DecryptFile(ctx, src, dst, s.passphrase)
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return nil, err
+	}
+	checksum, err := utils.FileChecksum(dst, s.checksumAlgo)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error computing checksum of decrypted backup")
+	}
+	if err := utils.WriteChecksum(dst+utils.ChecksumFileExt(s.checksumAlgo), checksum); err != nil {
+		return nil, errors.Wrapf(err, "error creating checksum of decrypted backup")
+	}
+	return checksum, nil
+}
+
+// CompactLocal deletes old local backups in the backup temp directory, applying the Keep config or the Retention policy.
+// If tags are specified, only backups having all the tags are considered.
+func (s *Syncer) CompactLocal(filename string, tags []string) error {
+	return s.compactLocal(strings.TrimSuffix(filename, core.BackupFileExt), tags, s.keep, s.retention)
+}
+
+// CompactKept deletes old kept local backups in the backup temp directory, applying the LocalKeep config,
+// independent of the Keep config of the targets and pulled backups.
+func (s *Syncer) CompactKept(filename string) error {
+	return s.compactLocal(strings.TrimSuffix(filename, core.BackupFileExt), nil, s.localKeep, core.RetentionPolicy{})
+}
+
+func (s *Syncer) compactLocal(filename string, tags []string, keep int, retention core.RetentionPolicy) error {
+	if keep < 1 && !retention.Enabled() {
+		slog.Info("Skip delete old local backup due to config",
 			slog.String("filename", filename),
-			slog.Int("keep", s.keep))
+			slog.Int("keep", keep))
 		return nil
 	}
-	names, err := utils.ListFileNames(s.pullTargetDir)
+	allNames, err := utils.ListFileNames(s.pullTargetDir)
 	if err != nil {
 		return errors.Wrapf(err, "error listing file names on local %s", s.pullTargetDir)
 	}
-	names = utils.FilterBackupFileNames(names, filename)
-	if len(names) <= s.keep {
+	names := utils.FilterBackupFileNamesByTags(allNames, filename, tags)
+	deletions := selectOldBackups(names, keep, retention)
+	if len(deletions) == 0 {
 		slog.Info("Skip delete old local backup",
 			slog.String("filename", filename),
 			slog.Int("count", len(names)))
 		return nil
 	}
 
+	reclaimed := int64(0)
+	if s.dryRun {
+		for _, name := range deletions {
+			path := filepath.Join(s.pullTargetDir, name)
+			size := localFileSize(path) + localFileSize(path+utils.MetadataExt)
+			reclaimed += size
+			pterm.Info.Println("(dry-run) Would delete", name, "on local", pterm.Sprintf("(%s)", utils.FormatBytes(size)))
+			slog.Info("Would delete old local backup (dry-run)",
+				slog.String("filename", filename),
+				slog.String("target", path),
+				slog.Int64("size", size))
+		}
+		pterm.Info.Println("(dry-run) Would reclaim", utils.FormatBytes(reclaimed), "on local")
+		return nil
+	}
+
 	// Delete old backup.
-	for _, name := range names[:len(names)-s.keep] {
-		name = filepath.Join(s.pullTargetDir, name)
+	for _, name := range deletions {
+		hasMetadata := slices.Contains(allNames, name+utils.MetadataExt)
+		path := filepath.Join(s.pullTargetDir, name)
+		size := localFileSize(path)
 		slog.Info("Deleting old backup",
 			slog.String("filename", filename),
-			slog.String("target", name),
+			slog.String("target", path),
+			slog.Int64("size", size),
 		)
-		if err := utils.DelFile(name); err != nil {
+		if err := utils.DelFile(path); err != nil {
 			return errors.Wrapf(err, "error deleting old backup")
 		}
+		reclaimed += size
+		if hasMetadata {
+			metadataSize := localFileSize(path + utils.MetadataExt)
+			if err := utils.DelFile(path + utils.MetadataExt); err != nil {
+				return errors.Wrapf(err, "error deleting old backup metadata")
+			}
+			reclaimed += metadataSize
+		}
+		pterm.Println("Deleted", name, pterm.Sprintf("(%s)", utils.FormatBytes(size)))
 	}
+	pterm.Println("Reclaimed", utils.FormatBytes(reclaimed), "from", len(deletions), "old backups on local")
+	slog.Info("Compacted old local backup",
+		slog.String("filename", filename),
+		slog.Int("deleted", len(deletions)),
+		slog.Int64("reclaimed", reclaimed))
 	return nil
 }
+
+// localFileSize return the size of the file, or zero if it cannot be stat.
+func localFileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
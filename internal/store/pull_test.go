@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSyncerPullVerifiesSignature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "260101_0000_db.sinbak"
+	content := []byte("backup content")
+	checksum := sha256.Sum256(content)
+
+	tests := []struct {
+		name string
+		// sig the signature stored for the backup, nil for no signature file.
+		sig      func() utils.BackupSignature
+		wantKept bool
+	}{
+		{
+			name:     "valid signature is kept",
+			sig:      func() utils.BackupSignature { return utils.SignChecksum(key, name, core.ChecksumSHA256, checksum[:]) },
+			wantKept: true,
+		},
+		{
+			name: "missing signature is rejected",
+		},
+		{
+			name: "tampered signature is rejected",
+			sig: func() utils.BackupSignature {
+				sig := utils.SignChecksum(key, name, core.ChecksumSHA256, checksum[:])
+				sig.Signature[0] ^= 0xff
+				return sig
+			},
+		},
+		{
+			name: "signature of another backup is rejected",
+			sig: func() utils.BackupSignature {
+				return utils.SignChecksum(key, "251231_0000_db.sinbak", core.ChecksumSHA256, checksum[:])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapter := fake.adapter(t, nil)
+			fake.put(name, content, time.Now())
+			fake.put(name+utils.ChecksumFileExt(core.ChecksumSHA256), []byte(sha256Hex(content)), time.Now())
+			if tt.sig != nil {
+				putSignature(t, fake, name, tt.sig())
+			}
+			dir := t.TempDir()
+			s := &Syncer{adapters: []Adapter{adapter}, pullTargetDir: dir, keep: 1, signingPublicKey: pub}
+
+			if err := s.Pull(context.Background(), "db", nil); err != nil {
+				t.Fatalf("Pull() error = %s", err)
+			}
+			_, err := os.Stat(filepath.Join(dir, name))
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("pulled backup kept = %v, want %v", kept, tt.wantKept)
+			}
+			names, err := utils.ListFileNames(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantKept && len(names) > 0 {
+				t.Errorf("files left after rejecting the backup: %v", names)
+			}
+		})
+	}
+}
+
+func TestSyncerCompactLocalKeepsTransientFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"260101_0000_db.sinbak",
+		"260102_0000_db.sinbak",
+		"260103_0000_db.sinbak",
+		"260104_0000_db.sinbak" + utils.ErrorExt,
+		"260104_0000_db.sinbak" + utils.PartialExt,
+		"260100_0000_db.sinbak" + utils.PartialExt,
+	}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Syncer{pullTargetDir: dir}
+
+	if err := s.compactLocal("db", nil, 1, core.RetentionPolicy{}); err != nil {
+		t.Fatalf("compactLocal() error = %s", err)
+	}
+	names, err := utils.ListFileNames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"260100_0000_db.sinbak" + utils.PartialExt,
+		"260103_0000_db.sinbak",
+		"260104_0000_db.sinbak" + utils.ErrorExt,
+		"260104_0000_db.sinbak" + utils.PartialExt,
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, want) {
+		t.Errorf("files left = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strings"
+	"time"
+)
+
+// Restore downloads a backup from the named target to the destination, verifying its checksum,
+// and against the checksum manifest and its signature if enabled.
+// If file is empty, the latest backup of filename having all the tags is restored.
+// If the destination is a directory, the backup is downloaded into it under its own name.
+// Encrypted backups are decrypted if the key is configured.
+func (s *Syncer) Restore(ctx context.Context, adapterName string, file string, filename string, tags []string, destination string) error {
+	adapter, ok := lo.Find(s.adapters, func(adapter Adapter) bool {
+		return adapter.Config().Name == adapterName
+	})
+	if !ok {
+		return errors.New("target not found: " + adapterName)
+	}
+	downloader, ok := adapter.(Downloader)
+	if !ok {
+		return errors.New("target does not support downloading: " + adapterName)
+	}
+
+	if file == "" {
+		names, err := listFileNames(ctx, downloader)
+		if err != nil {
+			return errors.Wrapf(err, "error listing %s", adapterName)
+		}
+		names = utils.FilterBackupFileNamesByTags(names, strings.TrimSuffix(filename, core.BackupFileExt), tags)
+		if len(names) == 0 {
+			return errors.Wrapf(ErrFileNotFound, "no backups of %s found on %s", filename, adapterName)
+		}
+		file = names[len(names)-1]
+	}
+
+	manifest, err := s.loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+
+	decrypt := s.canDecrypt(file)
+	if info, err := os.Stat(destination); err == nil && info.IsDir() {
+		name := file
+		if decrypt {
+			name, _ = utils.DecryptedFileName(file)
+		}
+		destination = filepath.Join(destination, name)
+	}
+
+	start := time.Now()
+	pterm.Println("Restoring", file, "from", adapterName, "to", destination)
+	downloadPath := destination
+	if decrypt {
+		downloadPath = destination + utils.PartialExt
+	}
+	if err := downloader.Download(ctx, downloadPath, file); err != nil {
+		return errors.Wrapf(err, "error downloading %s from %s", file, adapterName)
+	}
+	if err := verifyManifest(manifest, downloadPath, file); err != nil {
+		return errors.Join(err, utils.DelFile(downloadPath))
+	}
+	if err := s.verifySignature(ctx, downloader, downloadPath, file); err != nil {
+		return errors.Join(err, utils.DelFile(downloadPath))
+	}
+	if decrypt {
+		_, encryption := utils.DecryptedFileName(file)
+		_, err := s.decryptFile(ctx, encryption, downloadPath, destination)
+		if err := errors.Join(err, utils.DelFile(downloadPath)); err != nil {
+			return errors.Wrapf(err, "error decrypting %s", file)
+		}
+	}
+	pterm.Success.Println("Restored", file, "to", destination, "took", time.Since(start).String())
+	slog.Info("Restored",
+		slog.String("adapter", adapterName),
+		slog.String("filename", file),
+		slog.String("target", destination),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strconv"
+	"time"
+)
+
+// retentionPeriod maps the backup time to the period it belongs to.
+type retentionPeriod func(t time.Time) string
+
+var (
+	dailyPeriod = func(t time.Time) string {
+		return t.Format("2006-01-02")
+	}
+	weeklyPeriod = func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return strconv.Itoa(year) + "-W" + strconv.Itoa(week)
+	}
+	monthlyPeriod = func(t time.Time) string {
+		return t.Format("2006-01")
+	}
+	yearlyPeriod = func(t time.Time) string {
+		return t.Format("2006")
+	}
+)
+
+// SelectForDeletion return the backups that are not kept by the retention policy.
+// The names must be sorted from oldest to newest, as returned by utils.FilterBackupFileNames.
+// For each period (day, week, month, year) the newest backup is kept, for the configured number of recent periods.
+// Backups whose time cannot be parsed from the name are always kept.
+func SelectForDeletion(names []string, policy core.RetentionPolicy) []string {
+	buckets := []struct {
+		period retentionPeriod
+		count  int
+		last   string
+	}{
+		{period: dailyPeriod, count: policy.Daily},
+		{period: weeklyPeriod, count: policy.Weekly},
+		{period: monthlyPeriod, count: policy.Monthly},
+		{period: yearlyPeriod, count: policy.Yearly},
+	}
+
+	keep := make([]bool, len(names))
+	last := policy.Last
+	for i := len(names) - 1; i >= 0; i-- {
+		t, ok := utils.ParseBackupTime(names[i])
+		if !ok {
+			keep[i] = true
+			continue
+		}
+		if last > 0 {
+			keep[i] = true
+			last--
+		}
+		for j := range buckets {
+			bucket := &buckets[j]
+			if bucket.count < 1 {
+				continue
+			}
+			if period := bucket.period(t); period != bucket.last {
+				keep[i] = true
+				bucket.last = period
+				bucket.count--
+			}
+		}
+	}
+
+	deletions := make([]string, 0, len(names))
+	for i, name := range names {
+		if !keep[i] {
+			deletions = append(deletions, name)
+		}
+	}
+	return deletions
+}
+
+// selectOldBackups return the backups to delete, using the retention policy if enabled, otherwise keep the last backups.
+// The keep < 1 means keeping all backups.
+func selectOldBackups(names []string, keep int, policy core.RetentionPolicy) []string {
+	if policy.Enabled() {
+		return SelectForDeletion(names, policy)
+	}
+	if keep < 1 || len(names) <= keep {
+		return nil
+	}
+	return names[:len(names)-keep]
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/mawngo/go-try/v2"
+	"sin/internal/core"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 10 * time.Second
+	defaultRetryMaxBackoff = 5 * time.Minute
+)
+
+// RetryConfig the retry policy of requests to a target.
+// Default try.DefaultMaxAttempts attempts with 10 seconds fixed backoff.
+type RetryConfig struct {
+	// MaxAttempts the maximum number of attempts of each request, including the first one.
+	MaxAttempts int `json:"maxAttempts"`
+	// BackoffSeconds the backoff between attempts, or the initial backoff if Exponential.
+	BackoffSeconds int `json:"backoffSeconds"`
+	// Exponential doubles the backoff after each attempt, up to MaxBackoffSeconds.
+	Exponential bool `json:"exponential"`
+	// MaxBackoffSeconds the maximum backoff of exponential backoff, default 5 minutes.
+	MaxBackoffSeconds int `json:"maxBackoffSeconds"`
+}
+
+// options return the retry options of the policy.
+func (c RetryConfig) options() []try.RetryOption {
+	options := make([]try.RetryOption, 0, 2)
+	if c.MaxAttempts > 0 {
+		options = append(options, try.WithAttempts(c.MaxAttempts))
+	}
+	backoff := defaultRetryBackoff
+	if c.BackoffSeconds > 0 {
+		backoff = time.Duration(c.BackoffSeconds) * time.Second
+	}
+	if !c.Exponential {
+		return append(options, try.WithFixedBackoff(backoff))
+	}
+	maxBackoff := defaultRetryMaxBackoff
+	if c.MaxBackoffSeconds > 0 {
+		maxBackoff = time.Duration(c.MaxBackoffSeconds) * time.Second
+	}
+	return append(options, try.WithExponentialBackoff(backoff, max(backoff, maxBackoff)))
+}
+
+// isPermanentError check whether the error cannot be fixed by retrying.
+func isPermanentError(err error) bool {
+	return errors.Is(err, core.ErrRetryBudgetExhausted) || errors.Is(err, ErrUploadTooLarge) || errors.Is(err, ErrFileNotFound) ||
+		isForbidden(err)
+}
+
+// retryGet is try.GetCtx limited by the run retry budget carried by ctx.
+// Permanent errors (see isPermanentError) are never retried.
+func retryGet[T any](ctx context.Context, op func() (T, error), retryOptions ...try.RetryOption) (T, error) {
+	budget := core.RetryBudgetFrom(ctx)
+	if budget == nil {
+		return try.GetCtx(ctx, op, append(retryOptions, try.WithNoRetryIf(isPermanentError))...)
+	}
+
+	var last time.Time
+	var lastErr error
+	return try.GetCtx(ctx, func() (T, error) {
+		if !last.IsZero() {
+			if err := budget.Take(time.Since(last)); err != nil {
+				var empty T
+				return empty, errors.Join(err, lastErr)
+			}
+		}
+		last = time.Now()
+		v, err := op()
+		lastErr = err
+		return v, err
+	}, append(retryOptions, try.WithNoRetryIf(isPermanentError))...)
+}
+
+// retryDo is try.DoCtx limited by the run retry budget carried by ctx.
+func retryDo(ctx context.Context, op func() error, retryOptions ...try.RetryOption) error {
+	_, err := retryGet(ctx, func() (struct{}, error) {
+		return struct{}{}, op()
+	}, retryOptions...)
+	return err
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"github.com/mawngo/go-errors"
+	"net/http"
+	"path/filepath"
+	"sin/internal/core"
+	"testing"
+	"time"
+)
+
+func TestIsPermanentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "transient", err: errors.New("connection reset"), want: false},
+		{name: "upload too large", err: errors.Wrapf(ErrUploadTooLarge, "object too large"), want: true},
+		{name: "file not found", err: errors.Wrapf(ErrFileNotFound, "file not found"), want: true},
+		{name: "retry budget exhausted", err: errors.Wrapf(core.ErrRetryBudgetExhausted, "exceed 1 retries"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanentError(tt.err); got != tt.want {
+				t.Errorf("isPermanentError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3AdapterRetry(t *testing.T) {
+	content := []byte("backup content")
+	bigContent := make([]byte, 21*MB)
+	if _, err := rand.Read(bigContent); err != nil {
+		t.Fatal(err)
+	}
+	const key = "260101_0000_db.sinbak"
+
+	tests := []struct {
+		name string
+		// operation the request failing once with status and code.
+		operation string
+		status    int
+		code      string
+		// do runs the adapter operation on the fake.
+		do           func(t *testing.T, adapter *s3Adapter) error
+		wantErr      error
+		wantAttempts int
+		// wantObject the expected content of key after do, nil to not check.
+		wantObject []byte
+	}{
+		{
+			name:      "internal error is retried",
+			operation: "PutObject", status: http.StatusInternalServerError, code: "InternalError",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				return adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", content), key)
+			},
+			wantAttempts: 2,
+			wantObject:   content,
+		},
+		{
+			name:      "slow down is retried",
+			operation: "PutObject", status: http.StatusServiceUnavailable, code: "SlowDown",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				return adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", content), key)
+			},
+			wantAttempts: 2,
+			wantObject:   content,
+		},
+		{
+			name:      "multipart upload is retried from the start",
+			operation: "UploadPart", status: http.StatusServiceUnavailable, code: "SlowDown",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				adapter.Multipart.ThresholdMB = 20
+				return adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", bigContent), key)
+			},
+			wantObject: bigContent,
+		},
+		{
+			name:      "entity too large is not retried",
+			operation: "PutObject", status: http.StatusBadRequest, code: "EntityTooLarge",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				return adapter.Save(context.Background(), writeTestFile(t, "db.sinbak", content), key)
+			},
+			wantErr:      ErrUploadTooLarge,
+			wantAttempts: 1,
+		},
+		{
+			name:      "no such key maps to file not found",
+			operation: "GetObject", status: http.StatusNotFound, code: "NoSuchKey",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				_, err := adapter.ReadFile(context.Background(), key)
+				return err
+			},
+			wantErr:      ErrFileNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:      "no such key on copy maps to file not found",
+			operation: "CopyObject", status: http.StatusNotFound, code: "NoSuchKey",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				return adapter.Move(context.Background(), "moved.sinbak", key)
+			},
+			wantErr:      ErrFileNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:      "not found maps to file not found",
+			operation: "HeadObject", status: http.StatusNotFound, code: "NotFound",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				_, err := adapter.Stat(context.Background(), key)
+				return err
+			},
+			wantErr:      ErrFileNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:      "missing object on download maps to file not found",
+			operation: "HeadObject", status: http.StatusNotFound, code: "NotFound",
+			do: func(t *testing.T, adapter *s3Adapter) error {
+				return adapter.Download(context.Background(), filepath.Join(t.TempDir(), key))
+			},
+			wantErr:      ErrFileNotFound,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapter := fake.adapter(t, map[string]any{"retry": map[string]any{"maxAttempts": 3, "backoffSeconds": 1}})
+			fake.failFirst(tt.operation, 1, tt.status, tt.code)
+
+			err := tt.do(t, adapter)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("error = %s, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if n := fake.count(tt.operation, key); tt.wantAttempts > 0 && n != tt.wantAttempts {
+				t.Errorf("%s requests = %d, want %d", tt.operation, n, tt.wantAttempts)
+			}
+			if tt.wantObject != nil {
+				if got, _ := fake.object(key); !bytes.Equal(got, tt.wantObject) {
+					t.Errorf("stored object of %d bytes differs from the uploaded %d bytes, the body is not rewound", len(got), len(tt.wantObject))
+				}
+			}
+		})
+	}
+}
+
+func TestS3AdapterMissingChecksumNotRetried(t *testing.T) {
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, map[string]any{"retry": map[string]any{"maxAttempts": 3, "backoffSeconds": 10}})
+	content := []byte("backup content")
+	fake.put("260101_0000_db.sinbak", content, time.Now())
+	fake.put("260101_0000_db.sinbak.sha256.txt", []byte(sha256Hex(content)), time.Now())
+	adapter.checksumAlgo = core.ChecksumSHA512
+
+	start := time.Now()
+	if err := adapter.Verify(context.Background(), "260101_0000_db.sinbak"); err != nil {
+		t.Fatalf("Verify() error = %s", err)
+	}
+	if err := adapter.Download(context.Background(), filepath.Join(t.TempDir(), "260101_0000_db.sinbak")); err != nil {
+		t.Fatalf("Download() error = %s", err)
+	}
+	// Each missing checksum file is probed once, instead of being retried with backoff.
+	if n := fake.count("GetObject", "260101_0000_db.sinbak.sha512.txt"); n != 2 {
+		t.Errorf("GetObject requests of the missing checksum = %d, want 2", n)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("probing the checksum files took %s, want no backoff", took)
+	}
+}
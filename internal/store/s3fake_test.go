@@ -0,0 +1,461 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fakeS3Bucket = "bucket"
+
+// fakeS3 an in-memory S3 server supporting the requests used by s3Adapter, using path style addressing.
+type fakeS3 struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string]fakeS3Object
+	uploads  map[string]*fakeS3Upload
+	requests []fakeS3Request
+	nextID   int
+	// intercept is called before handling each request, a non-nil error is returned instead of handling it.
+	intercept func(r fakeS3Request) *fakeS3Error
+}
+
+type fakeS3Object struct {
+	data     []byte
+	metadata map[string]string
+	tagging  string
+	modTime  time.Time
+}
+
+type fakeS3Upload struct {
+	key       string
+	parts     map[int][]byte
+	initiated time.Time
+}
+
+// fakeS3Request a request received by the fake, with the decoded body.
+type fakeS3Request struct {
+	Method string
+	Key    string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// operation return a short name of the S3 operation of the request, for asserting the requests.
+func (r fakeS3Request) operation() string {
+	switch {
+	case r.Key == "" && r.Method == http.MethodGet && r.Query.Has("uploads"):
+		return "ListMultipartUploads"
+	case r.Key == "" && r.Method == http.MethodGet:
+		return "ListObjectsV2"
+	case r.Key == "" && r.Method == http.MethodHead:
+		return "HeadBucket"
+	case r.Method == http.MethodPost && r.Query.Has("uploads"):
+		return "CreateMultipartUpload"
+	case r.Method == http.MethodPost && r.Query.Has("uploadId"):
+		return "CompleteMultipartUpload"
+	case r.Method == http.MethodPut && r.Query.Has("uploadId"):
+		return "UploadPart"
+	case r.Method == http.MethodDelete && r.Query.Has("uploadId"):
+		return "AbortMultipartUpload"
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		return "CopyObject"
+	case r.Method == http.MethodPut:
+		return "PutObject"
+	case r.Method == http.MethodGet:
+		return "GetObject"
+	case r.Method == http.MethodHead:
+		return "HeadObject"
+	case r.Method == http.MethodDelete:
+		return "DeleteObject"
+	}
+	return r.Method
+}
+
+// fakeS3Error an S3 error response.
+type fakeS3Error struct {
+	Status int
+	Code   string
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+	s := &fakeS3{
+		objects: make(map[string]fakeS3Object),
+		uploads: make(map[string]*fakeS3Upload),
+	}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// adapter creates an s3Adapter of the fake, conf overrides the default config.
+// The requests are only retried by the adapter, not by the aws sdk, and only attempted once unless conf has retry.
+func (s *fakeS3) adapter(t *testing.T, conf map[string]any) *s3Adapter {
+	t.Helper()
+	c := map[string]any{
+		"name":           "fake",
+		"bucket":         fakeS3Bucket,
+		"endpoint":       s.URL,
+		"accessKeyID":    "key",
+		"accessSecret":   "secret",
+		"region":         "us-east-1",
+		"forcePathStyle": true,
+		"retry":          map[string]any{"maxAttempts": 1},
+	}
+	for k, v := range conf {
+		c[k] = v
+	}
+	adapter, err := newS3Adapter(c, "sin/test", "sha256")
+	if err != nil {
+		t.Fatalf("error creating s3 adapter: %s", err)
+	}
+	f := adapter.(*s3Adapter)
+	client, err := f.getClient(context.Background())
+	if err != nil {
+		t.Fatalf("error creating s3 client: %s", err)
+	}
+	f.client = s3.New(client.Options(), func(o *s3.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	return f
+}
+
+// put stores the object directly.
+func (s *fakeS3) put(key string, data []byte, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = fakeS3Object{data: data, modTime: modTime}
+}
+
+// object return the content of the object, false if it does not exist.
+func (s *fakeS3) object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj.data, ok
+}
+
+// keys return the sorted keys of the stored objects.
+func (s *fakeS3) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// received return the requests received so far.
+func (s *fakeS3) received() []fakeS3Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// count return the number of received requests of the operation on the key.
+func (s *fakeS3) count(operation string, key string) int {
+	n := 0
+	for _, r := range s.received() {
+		if r.operation() == operation && r.Key == key {
+			n++
+		}
+	}
+	return n
+}
+
+// failFirst makes the first n requests of the operation fail with the error, then handles them normally.
+func (s *fakeS3) failFirst(operation string, n int, status int, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := 0
+	s.intercept = func(r fakeS3Request) *fakeS3Error {
+		if r.operation() != operation || failed >= n {
+			return nil
+		}
+		failed++
+		return &fakeS3Error{Status: status, Code: code}
+	}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	body, err := readFakeS3Body(r)
+	if err != nil {
+		writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusBadRequest, Code: "IncompleteBody"})
+		return
+	}
+	req := fakeS3Request{Method: r.Method, Key: key, Query: r.URL.Query(), Header: r.Header.Clone(), Body: body}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if s.intercept != nil {
+		if e := s.intercept(req); e != nil {
+			writeFakeS3Error(w, r, *e)
+			return
+		}
+	}
+	if bucket != fakeS3Bucket {
+		writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusNotFound, Code: "NoSuchBucket"})
+		return
+	}
+
+	switch req.operation() {
+	case "HeadBucket":
+		w.WriteHeader(http.StatusOK)
+	case "ListObjectsV2":
+		s.listObjects(w, req)
+	case "ListMultipartUploads":
+		s.listUploads(w)
+	case "CreateMultipartUpload":
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &fakeS3Upload{key: key, parts: make(map[int][]byte), initiated: time.Now()}
+		writeFakeS3XML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case "UploadPart":
+		upload, ok := s.uploads[req.Query.Get("uploadId")]
+		if !ok {
+			writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusNotFound, Code: "NoSuchUpload"})
+			return
+		}
+		n, _ := strconv.Atoi(req.Query.Get("partNumber"))
+		upload.parts[n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+		w.WriteHeader(http.StatusOK)
+	case "CompleteMultipartUpload":
+		upload, ok := s.uploads[req.Query.Get("uploadId")]
+		if !ok {
+			writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusNotFound, Code: "NoSuchUpload"})
+			return
+		}
+		numbers := make([]int, 0, len(upload.parts))
+		for n := range upload.parts {
+			numbers = append(numbers, n)
+		}
+		slices.Sort(numbers)
+		data := make([]byte, 0)
+		for _, n := range numbers {
+			data = append(data, upload.parts[n]...)
+		}
+		delete(s.uploads, req.Query.Get("uploadId"))
+		s.objects[key] = fakeS3Object{data: data, metadata: fakeS3Metadata(r.Header), modTime: time.Now()}
+		writeFakeS3XML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: `"complete"`})
+	case "AbortMultipartUpload":
+		delete(s.uploads, req.Query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case "CopyObject":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		obj, ok := s.objects[sourceKey]
+		if !ok {
+			writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusNotFound, Code: "NoSuchKey"})
+			return
+		}
+		obj.modTime = time.Now()
+		s.objects[key] = obj
+		writeFakeS3XML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: `"copy"`, LastModified: obj.modTime.UTC().Format(time.RFC3339)})
+	case "PutObject":
+		s.objects[key] = fakeS3Object{
+			data:     body,
+			metadata: fakeS3Metadata(r.Header),
+			tagging:  r.Header.Get("X-Amz-Tagging"),
+			modTime:  time.Now(),
+		}
+		w.Header().Set("ETag", `"put"`)
+		w.WriteHeader(http.StatusOK)
+	case "HeadObject", "GetObject":
+		obj, ok := s.objects[key]
+		if !ok {
+			writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusNotFound, Code: "NoSuchKey"})
+			return
+		}
+		for k, v := range obj.metadata {
+			w.Header().Set("X-Amz-Meta-"+k, v)
+		}
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"object"`)
+		data, status := obj.data, http.StatusOK
+		if start, end, ok := parseFakeS3Range(r.Header.Get("Range"), len(obj.data)); ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.data)))
+			data, status = obj.data[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case "DeleteObject":
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeS3Error(w, r, fakeS3Error{Status: http.StatusNotImplemented, Code: "NotImplemented"})
+	}
+}
+
+func (s *fakeS3) listObjects(w http.ResponseWriter, req fakeS3Request) {
+	type content struct {
+		Key          string
+		LastModified string
+		Size         int
+		ETag         string
+	}
+	prefix := req.Query.Get("prefix")
+	contents := make([]content, 0)
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			contents = append(contents, content{Key: key, LastModified: obj.modTime.UTC().Format(time.RFC3339), Size: len(obj.data), ETag: `"object"`})
+		}
+	}
+	slices.SortFunc(contents, func(a, b content) int { return strings.Compare(a.Key, b.Key) })
+	writeFakeS3XML(w, struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: fakeS3Bucket, Prefix: prefix, KeyCount: len(contents), MaxKeys: 1000, Contents: contents})
+}
+
+func (s *fakeS3) listUploads(w http.ResponseWriter) {
+	type upload struct {
+		Key       string
+		UploadID  string `xml:"UploadId"`
+		Initiated string
+	}
+	uploads := make([]upload, 0, len(s.uploads))
+	for id, u := range s.uploads {
+		uploads = append(uploads, upload{Key: u.key, UploadID: id, Initiated: u.initiated.UTC().Format(time.RFC3339)})
+	}
+	writeFakeS3XML(w, struct {
+		XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+		Bucket      string
+		IsTruncated bool
+		Upload      []upload
+	}{Bucket: fakeS3Bucket, Upload: uploads})
+}
+
+// readFakeS3Body reads the request body, decoding the aws-chunked encoding used when the checksum is sent as trailer.
+func readFakeS3Body(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") &&
+		!strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING") {
+		return body, nil
+	}
+	decoded := bytes.Buffer{}
+	reader := bufio.NewReader(bytes.NewReader(body))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			// The rest are the trailers.
+			return decoded.Bytes(), nil
+		}
+		if _, err := io.CopyN(&decoded, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fakeS3Metadata return the user metadata (x-amz-meta-*) of the request.
+func fakeS3Metadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for k := range header {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok {
+			metadata[name] = header.Get(k)
+		}
+	}
+	return metadata
+}
+
+// parseFakeS3Range parses the "bytes=start-end" range header, return false if there is no range.
+func parseFakeS3Range(header string, size int) (int, int, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	startStr, endStr, _ := strings.Cut(spec, "-")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := strconv.Atoi(endStr)
+	if err != nil || end >= size {
+		end = size - 1
+	}
+	return start, end, true
+}
+
+func writeFakeS3XML(w http.ResponseWriter, v any) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(append([]byte(xml.Header), b...))
+}
+
+// writeFakeS3Error writes the error response, without body for HEAD requests as S3 does.
+func writeFakeS3Error(w http.ResponseWriter, r *http.Request, e fakeS3Error) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.Status)
+		return
+	}
+	b, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: e.Code, Message: e.Code})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.Status)
+	_, _ = w.Write(append([]byte(xml.Header), b...))
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"os"
+	"sin/internal/utils"
+)
+
+// ErrNoSignature the signature file of the backup does not exist, while a signing public key is configured.
+var ErrNoSignature = errors.New("signature file not found")
+
+// writeSignature signs the checksum of the backup named dest into a temp signature file for uploading to the targets.
+// Return the path of the signature file, empty if signing is disabled.
+func (s *Syncer) writeSignature(dest string, checksum []byte) (string, error) {
+	if s.signingKey == nil || s.dryRun {
+		return "", nil
+	}
+	return writeTempSignature(s.pullTargetDir, utils.SignChecksum(s.signingKey, dest, s.checksumAlgo, checksum))
+}
+
+// writeTempSignature writes the signature into a temp signature file in dir, return the path of the file.
+func writeTempSignature(dir string, sig utils.BackupSignature) (string, error) {
+	f, err := os.CreateTemp(dir, ".sin-*"+utils.SignatureExt)
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating signature file")
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := utils.WriteBackupSignature(f.Name(), sig); err != nil {
+		return "", errors.Join(err, os.Remove(f.Name()))
+	}
+	return f.Name(), nil
+}
+
+// saveSignature sends the signature file of the backup to the adapter, if signing is enabled.
+func (s *Syncer) saveSignature(ctx context.Context, adapter Adapter, signature string, dest string) error {
+	if signature == "" {
+		return nil
+	}
+	return errors.Wrapf(adapter.Save(ctx, signature, dest+utils.SignatureExt), "error syncing signature")
+}
+
+// readSignature reads the signature of the backup on the adapter.
+// Return ErrNoSignature if the backup has no signature file.
+func readSignature(ctx context.Context, adapter Adapter, name string) (utils.BackupSignature, error) {
+	reader, ok := adapter.(FileReader)
+	if !ok {
+		return utils.BackupSignature{}, errors.Newf("target %s does not support reading signatures", adapter.Config().Name)
+	}
+	b, err := reader.ReadFile(ctx, name+utils.SignatureExt)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return utils.BackupSignature{}, errors.Wrapf(ErrNoSignature, "signature file of %s not found", name)
+		}
+		return utils.BackupSignature{}, errors.Wrapf(err, "error reading signature file of %s", name)
+	}
+	return utils.ParseBackupSignature(b)
+}
+
+// verifySignature compares the local file at path to the signature of the backup on the adapter.
+// Do nothing if the signing public key is not configured.
+func (s *Syncer) verifySignature(ctx context.Context, adapter Adapter, path string, name string) error {
+	if s.signingPublicKey == nil {
+		return nil
+	}
+	sig, err := readSignature(ctx, adapter, name)
+	if err != nil {
+		return err
+	}
+	checksum, err := utils.FileChecksum(path, sig.ChecksumAlgo)
+	if err != nil {
+		return errors.Wrapf(err, "error computing checksum of %s", path)
+	}
+	return errors.Wrapf(sig.Verify(s.signingPublicKey, name, checksum), "error verifying signature of %s", name)
+}
+
+// renameSignature re-signs the signature of the backup at source for the backup name destination, before moving it,
+// as the signature is bound to the backup name. Return nil if the backup has no signature, or the adapter cannot read it.
+// Return an error if the signing key is not configured, so the backup is not moved away from its signature.
+func (s *Syncer) renameSignature(ctx context.Context, adapter Adapter, source string, destination string) (*utils.BackupSignature, error) {
+	if _, ok := adapter.(FileReader); !ok {
+		return nil, nil
+	}
+	sig, err := readSignature(ctx, adapter, source)
+	if err != nil {
+		if errors.Is(err, ErrNoSignature) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if s.signingKey == nil {
+		return nil, errors.Newf("signing key is required to move the signed backup %s, as its signature is bound to the backup name", source)
+	}
+	sig, err = sig.Rename(s.signingKey, destination)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error re-signing %s", source)
+	}
+	return &sig, nil
+}
+
+// saveRenamedSignature saves the signature re-signed by renameSignature for the moved backup at destination.
+// Do nothing if sig is nil.
+func (s *Syncer) saveRenamedSignature(ctx context.Context, adapter Adapter, sig *utils.BackupSignature, destination string) error {
+	if sig == nil {
+		return nil
+	}
+	signature, err := writeTempSignature(s.pullTargetDir, *sig)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(signature)
+	return s.saveSignature(ctx, adapter, signature, destination)
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/mawngo/go-errors"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"slices"
+	"testing"
+	"time"
+)
+
+// putSignature stores the signature of the backup named name on the fake.
+func putSignature(t *testing.T, fake *fakeS3, name string, sig utils.BackupSignature) {
+	t.Helper()
+	b, err := json.Marshal(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.put(name+utils.SignatureExt, b, time.Now())
+}
+
+func TestSyncerVerifySignature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "260101_0000_db.sinbak"
+	content := []byte("backup content")
+	checksum := sha256.Sum256(content)
+
+	tests := []struct {
+		name string
+		// sig the signature stored for the backup, nil for no signature file.
+		sig     func() utils.BackupSignature
+		wantErr error
+	}{
+		{
+			name: "valid",
+			sig:  func() utils.BackupSignature { return utils.SignChecksum(key, name, core.ChecksumSHA256, checksum[:]) },
+		},
+		{
+			name: "tampered",
+			sig: func() utils.BackupSignature {
+				sig := utils.SignChecksum(key, name, core.ChecksumSHA256, checksum[:])
+				sig.Signature[0] ^= 0xff
+				return sig
+			},
+			wantErr: utils.ErrInvalidSignature,
+		},
+		{
+			name: "wrong key",
+			sig: func() utils.BackupSignature {
+				return utils.SignChecksum(otherKey, name, core.ChecksumSHA256, checksum[:])
+			},
+			wantErr: utils.ErrInvalidSignature,
+		},
+		{
+			name: "signed for another backup",
+			sig: func() utils.BackupSignature {
+				return utils.SignChecksum(key, "251231_0000_db.sinbak", core.ChecksumSHA256, checksum[:])
+			},
+			wantErr: utils.ErrInvalidSignature,
+		},
+		{
+			name:    "missing",
+			wantErr: ErrNoSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			adapter := fake.adapter(t, nil)
+			if tt.sig != nil {
+				putSignature(t, fake, name, tt.sig())
+			}
+			s := &Syncer{signingPublicKey: pub}
+
+			err := s.verifySignature(context.Background(), adapter, writeTestFile(t, name, content), name)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("verifySignature() error = %s, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifySignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncerMoveResignsBackup(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const source = "260101_0000_db.sinbak"
+	const destination = "260101_0000_[keep] db.sinbak"
+	content := []byte("backup content")
+	checksum := sha256.Sum256(content)
+
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	fake.put(source, content, time.Now())
+	putSignature(t, fake, source, utils.SignChecksum(key, source, core.ChecksumSHA256, checksum[:]))
+	s := &Syncer{adapters: []Adapter{adapter}, signingKey: key, signingPublicKey: pub, pullTargetDir: t.TempDir()}
+
+	if err := s.Move(context.Background(), "db", adapter.Config().Name, source, destination); err != nil {
+		t.Fatalf("Move() error = %s", err)
+	}
+	if err := s.verifySignature(context.Background(), adapter, writeTestFile(t, "db.sinbak", content), destination); err != nil {
+		t.Errorf("verifySignature() of the moved backup error = %s", err)
+	}
+}
+
+func TestSyncerMoveSignedWithoutSigningKey(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const source = "260101_0000_db.sinbak"
+	const destination = "260101_0000_[keep] db.sinbak"
+	content := []byte("backup content")
+	checksum := sha256.Sum256(content)
+
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	fake.put(source, content, time.Now())
+	fake.put(source+".sha256.txt", []byte(sha256Hex(content)), time.Now())
+	putSignature(t, fake, source, utils.SignChecksum(key, source, core.ChecksumSHA256, checksum[:]))
+	s := &Syncer{adapters: []Adapter{adapter}, signingPublicKey: pub, pullTargetDir: t.TempDir()}
+
+	if err := s.Move(context.Background(), "db", adapter.Config().Name, source, destination); err == nil {
+		t.Fatalf("Move() without signing key error = nil, want error")
+	}
+	// The backup is not moved away from its signature.
+	want := []string{source, source + ".sha256.txt", source + utils.SignatureExt}
+	if got := fake.keys(); !slices.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+	if err := s.verifySignature(context.Background(), adapter, writeTestFile(t, "db.sinbak", content), source); err != nil {
+		t.Errorf("verifySignature() of the unmoved backup error = %s", err)
+	}
+}
+
+func TestSyncerMoveUnsignedWithoutSigningKey(t *testing.T) {
+	const source = "260101_0000_db.sinbak"
+	const destination = "260101_0000_[keep] db.sinbak"
+	fake := newFakeS3(t)
+	adapter := fake.adapter(t, nil)
+	fake.put(source, []byte("backup content"), time.Now())
+	s := &Syncer{adapters: []Adapter{adapter}, pullTargetDir: t.TempDir()}
+
+	if err := s.Move(context.Background(), "db", adapter.Config().Name, source, destination); err != nil {
+		t.Fatalf("Move() error = %s", err)
+	}
+	if got, want := fake.keys(), []string{destination}; !slices.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+}
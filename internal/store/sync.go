@@ -1,19 +1,31 @@
 package store
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"filippo.io/age"
+	"fmt"
 	"github.com/mawngo/go-errors"
 	"github.com/pterm/pterm"
 	"github.com/samber/lo"
+	"io"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"sin/internal/core"
 	"sin/internal/utils"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
+// backupSidecarExts the suffixes of the files synced alongside a backup, other than its checksum file.
+var backupSidecarExts = []string{utils.MetadataExt, utils.SignatureExt}
+
 // Syncer sync local backup to remote, or pull backup from remote to local.
 // Syncer instance is not thread safe.
 type Syncer struct {
@@ -21,86 +33,220 @@ type Syncer struct {
 
 	failFast bool
 
+	// dryRun only prints what would be saved, deleted or moved on targets.
+	dryRun bool
+
 	// iter backup iteration.
 	iter int64
 
 	// keep the last N backups.
 	keep int
+	// retention replaces keep if enabled.
+	retention core.RetentionPolicy
+	// localKeep the last N kept local backups, 0 to not compact them.
+	localKeep int
+
+	// compactEvery only compact every N backup iterations.
+	compactEvery int
+
+	// concurrency number of targets to sync concurrently.
+	concurrency int
+
+	// checksumWorkers number of backups to verify concurrently.
+	checksumWorkers int
+	// checksumAlgo the algorithm of the checksum files.
+	checksumAlgo string
+	// manifest the external checksum manifest, nil if disabled.
+	manifest *checksumManifest
+	// signingKey for signing the checksum of synced backups, nil if signing is disabled.
+	signingKey ed25519.PrivateKey
+	// signingPublicKey for verifying the signature of backups, nil if not configured.
+	signingPublicKey ed25519.PublicKey
+
+	// verifyAfterUpload verifies the backup on targets right after uploading it.
+	verifyAfterUpload bool
+	// uploadRetries number of re-uploads on checksum mismatch after upload.
+	uploadRetries int
+
+	// progressMode how the progress of syncing and pulling is displayed: bar, log or none.
+	progressMode string
 
 	// pullTargetDir the directory to pull backup to.
 	pullTargetDir string
+
+	// passphrase for decrypting pulled backups, nil if encryption is disabled.
+	passphrase []byte
+	// ageIdentities for decrypting pulled age encrypted backups, nil if not configured.
+	ageIdentities []age.Identity
+
+	// report of the last sync, nil if not synced since the last TakeReport.
+	report *SyncReport
+}
+
+// SyncReport the result of syncing a backup to the targets.
+type SyncReport struct {
+	// Backup the name of the synced backup.
+	Backup string `json:"backup"`
+	// Source the local path of the synced backup, which may be removed after syncing. Empty if streamed.
+	Source  string       `json:"-"`
+	Size    int64        `json:"size"`
+	Targets []SyncResult `json:"targets"`
+}
+
+// SyncResult the result of syncing a backup to a target.
+type SyncResult struct {
+	Target  string `json:"target"`
+	Skipped bool   `json:"skipped"`
+	// Error empty if the sync succeeded or skipped.
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Reclaimed the total size of old backups deleted by compaction after the sync.
+	Reclaimed int64 `json:"reclaimed,omitempty"`
+}
+
+// Failed check whether syncing to any target failed.
+func (r SyncReport) Failed() bool {
+	return lo.SomeBy(r.Targets, func(result SyncResult) bool {
+		return result.Error != ""
+	})
 }
 
 func NewSyncer(app *core.App) (*Syncer, error) {
 	s := Syncer{
-		keep:          app.Keep,
-		failFast:      app.FailFast,
-		adapters:      make([]Adapter, 0, len(app.Config.Targets)),
-		pullTargetDir: app.BackupTempDir,
-	}
-	for _, target := range app.Targets {
-		if raw, ok := target["disabled"]; ok {
-			if v, ok := raw.(bool); ok && v {
-				continue
-			}
+		keep:              app.Keep,
+		retention:         app.Retention,
+		localKeep:         app.LocalKeep,
+		compactEvery:      max(app.CompactEvery, 1),
+		failFast:          app.FailFast,
+		dryRun:            app.DryRun,
+		adapters:          make([]Adapter, 0, len(app.Config.Targets)),
+		pullTargetDir:     app.BackupTempDir,
+		checksumWorkers:   app.ChecksumWorkers,
+		checksumAlgo:      app.ChecksumAlgo,
+		manifest:          newChecksumManifest(app.ChecksumManifest, app.UserAgentHeader()),
+		signingKey:        app.SigningKey(),
+		signingPublicKey:  app.SigningPublicKey(),
+		verifyAfterUpload: app.Verify.AfterUpload,
+		uploadRetries:     max(app.Verify.UploadRetries, 0),
+		progressMode:      app.ProgressMode(),
+		passphrase:        app.EncryptionPassphrase(),
+		ageIdentities:     app.AgeIdentityKeys(),
+	}
+	targets := app.Targets
+	if app.LocalMode() {
+		// Local mode overrides the targets, the backup is only kept locally.
+		targets = nil
+	}
+	for _, target := range targets {
+		if isTargetDisabled(target) {
+			continue
 		}
-
-		if raw, ok := target["type"]; !ok {
-			return nil, errors.New("missing type in config targets")
-		} else if _, ok := raw.(string); !ok {
-			return nil, errors.New("type in config targets must be string")
+		adapter, err := newAdapter(target, app.UserAgentHeader(), app.ChecksumAlgo)
+		if err != nil {
+			return nil, err
 		}
-
-		if raw, ok := target["name"]; !ok {
-			return nil, errors.New("missing name in config targets")
-		} else if _, ok := raw.(string); !ok {
-			return nil, errors.New("name in config targets must be string")
+		s.adapters = append(s.adapters, adapter)
+	}
+	if app.StdoutMode() {
+		if err := s.addStdoutAdapter(app); err != nil {
+			return nil, err
 		}
-
-		t := target["type"].(string)
-		name := target["name"].(string)
-		switch t {
-		case AdapterFileType:
-			adapter, err := newFileAdapter(target)
-			if err != nil {
-				return nil, errors.Wrapf(err, "error creating file adapter %s", name)
-			}
-			s.adapters = append(s.adapters, adapter)
-		case AdapterS3Type:
-			adapter, err := newS3Adapter(target)
-			if err != nil {
-				return nil, errors.Wrapf(err, "error creating s3 adapter %s", name)
-			}
-			s.adapters = append(s.adapters, adapter)
-		case AdapterMockType:
-			adapter, err := newMockAdapter(target)
-			if err != nil {
-				return nil, errors.Wrapf(err, "error creating mock adapter %s", name)
-			}
-			s.adapters = append(s.adapters, adapter)
-		default:
-			return nil, errors.New("unknown type in config targets: " + t)
+	}
+	if app.RequireTargets && !lo.SomeBy(s.adapters, func(adapter Adapter) bool {
+		_, ok := adapter.(Downloader)
+		return ok
+	}) {
+		return nil, errors.Wrapf(ErrNoTargets, "no enabled downloadable targets while targets are required")
+	}
+	if app.PingTargets {
+		if err := s.Ping(app.Ctx); err != nil {
+			return nil, err
 		}
 	}
+	cross := app.CrossTargetConcurrency
+	if cross < 1 {
+		cross = app.SyncConcurrency
+	}
+	s.concurrency = limitConcurrency(cross, app.MaxConcurrency, s.adapters)
 	return &s, nil
 }
 
+// addStdoutAdapter adds the adapter writing the backup to stdout before the targets,
+// validating that the backup can be written to stdout.
+func (s *Syncer) addStdoutAdapter(app *core.App) error {
+	if len(s.adapters) > 0 && !app.StdoutWithTargets() {
+		return errors.Newf("stdout mode must not be used with %d enabled targets, disable them or specify --stdout-with-targets", len(s.adapters))
+	}
+	// Only the backup is written to stdout, its side files cannot be written after it.
+	if app.WriteMetadata {
+		return errors.New("stdout mode does not support writing metadata")
+	}
+	if s.signingKey != nil {
+		return errors.New("stdout mode does not support signing")
+	}
+	s.adapters = append([]Adapter{newStdoutAdapter(app.StdoutChecksumFile(), app.ChecksumAlgo)}, s.adapters...)
+	return nil
+}
+
 func (s *Syncer) AdaptersCount() int {
 	return len(s.adapters)
 }
 
 func (s *Syncer) Sync(ctx context.Context, source string, start time.Time) error {
+	return s.SyncChecksum(ctx, source, "", nil, start)
+}
+
+// SyncChecksum same as Sync, using the precomputed checksum of the source in the checksum algorithm
+// instead of computing it, nil to compute it as usual. The checksum is trusted, not verified.
+// The old backups matching the compactFileName pattern (e.g. db(.gz)?.sinbak) are compacted after syncing,
+// empty to compact the backups of source.
+func (s *Syncer) SyncChecksum(ctx context.Context, source string, compactFileName string, checksum []byte, start time.Time) error {
 	if len(s.adapters) == 0 {
 		return nil
 	}
 
 	filename := strings.TrimSuffix(filepath.Base(source), core.BackupFileExt)
+	compactFileName = cmp.Or(strings.TrimSuffix(compactFileName, core.BackupFileExt), filename)
 	pterm.Printf("Start sync to %d destinations\n", len(s.adapters))
-	errs := make([]error, 0, len(s.adapters))
-	successes := make([]Adapter, 0, len(s.adapters))
-	for _, adapter := range s.adapters {
+	dest := utils.FormatBackupName(start, filename+core.BackupFileExt)
+
+	// The checksum of the backup before syncing, for telling whether the local backup changed
+	// when verifying after upload finds a mismatch.
+	sourceChecksum := checksum
+	if sourceChecksum == nil && (s.verifyAfterUpload || s.manifest != nil || s.signingKey != nil) && !s.dryRun {
+		checksum, err := utils.FileChecksum(source, s.checksumAlgo)
+		if err != nil {
+			return errors.Wrapf(err, "error calculating checksum file %s", source)
+		}
+		sourceChecksum = checksum
+	}
+	if checksum != nil {
+		// Let the adapters use the precomputed checksum instead of computing their own.
+		ctx = withSourceChecksum(ctx, checksum)
+	}
+	// Append to the manifest before syncing, so the backup is never on targets without a manifest entry.
+	if err := s.appendManifest(ctx, dest, sourceChecksum); err != nil {
+		return err
+	}
+	signature, err := s.writeSignature(dest, sourceChecksum)
+	if err != nil {
+		return err
+	}
+	if signature != "" {
+		defer os.Remove(signature)
+	}
+
+	// Sync to targets concurrently, bounded by concurrency.
+	// Each adapter instance is only used by one goroutine.
+	results := make([]error, len(s.adapters))
+	durations := make([]time.Duration, len(s.adapters))
+	synced := make([]bool, len(s.adapters))
+	sem := make(chan struct{}, s.concurrency)
+	wg := sync.WaitGroup{}
+	progress := s.startProgress("Syncing")
+	for i, adapter := range s.adapters {
 		conf := adapter.Config()
-		if conf.Each > 1 && s.iter%int64(conf.Each) != 0 {
+		if !shouldSync(adapter, s.iter) {
 			slog.Info("Skip sync due to config",
 				slog.String("adapter", conf.Name),
 				slog.String("filename", filename),
@@ -109,45 +255,78 @@ func (s *Syncer) Sync(ctx context.Context, source string, start time.Time) error
 			continue
 		}
 
-		pterm.Debug.Println("Start sync to", conf.Name)
-		dest := start.Format("060102_1504_") + filename + core.BackupFileExt
-		slog.Info("Start sync", slog.String("adapter", conf.Name), slog.String("filename", filename))
+		sem <- struct{}{}
+		wg.Add(1)
+		synced[i] = true
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			results[i] = s.save(ctx, progress, adapter, source, dest, filename, sourceChecksum, signature)
+			durations[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	progress.Stop()
+	defer s.waitBackground()
+	s.report = newSyncReport(source, dest, s.adapters, synced, results, durations)
+	return s.compactSynced(ctx, compactFileName, dest, synced, results)
+}
 
-		// Send the file.
-		// The adapter must handle retry if error happens.
-		start := time.Now()
-		err := adapter.Save(ctx, source, dest)
-		if err != nil {
-			// Only report instead of stop completely.
-			pterm.Error.Println("Error syncing to", conf.Name, err)
-			slog.Error("Error syncing",
-				slog.String("adapter", conf.Name),
-				slog.String("filename", filename),
-				slog.Any("err", err))
-			errs = append(errs, errors.Wrapf(err, "error syncing %s", conf.Name))
+// waitBackground waits for the background work of the adapters after syncing, such as retrying checksum uploads.
+func (s *Syncer) waitBackground() {
+	for _, adapter := range s.adapters {
+		if waiter, ok := adapter.(backgroundWaiter); ok {
+			waiter.waitBackground()
+		}
+	}
+}
+
+// compactSynced compacts the targets the backup was synced to, after syncing it.
+// Return the errors of syncing and compacting, based on fail-fast.
+func (s *Syncer) compactSynced(ctx context.Context, filename string, dest string, synced []bool, results []error) error {
+	errs := make([]error, 0, len(s.adapters))
+	successes := make([]Adapter, 0, len(s.adapters))
+	for i, adapter := range s.adapters {
+		if !synced[i] {
+			continue
+		}
+		if results[i] != nil {
+			errs = append(errs, errors.Wrapf(results[i], "error syncing %s", adapter.Config().Name))
 			continue
 		}
-		pterm.Success.Println("Synced to", conf.Name, "took", time.Since(start).String())
-		slog.Info("Complete sync",
-			slog.String("adapter", conf.Name),
-			slog.String("filename", filename),
-			slog.String("took", time.Since(start).String()))
 		successes = append(successes, adapter)
 	}
 
 	if len(successes) == 0 {
+		if len(errs) == 0 {
+			// All skipped, move to the next iteration.
+			s.iter++
+		}
 		slog.Warn("All sync failed/skipped")
 		pterm.Warning.Println("All sync failed/skipped")
-		if s.failFast && len(errs) > 0 {
-			return errors.Join(errs...)
-		}
-		return nil
+		return s.syncResult(errs)
 	}
 
 	// Compacting.
+	iter := s.iter
 	s.iter++
-	for _, adapter := range successes {
-		if err := s.compact(ctx, adapter, filename); err != nil {
+	if iter%int64(s.compactEvery) != 0 {
+		slog.Info("Skip compact due to config",
+			slog.String("filename", filename),
+			slog.Int("compactEvery", s.compactEvery))
+		pterm.Println("Synced to", len(successes), "destinations")
+		return s.syncResult(errs)
+	}
+	for i, adapter := range s.adapters {
+		if !synced[i] || results[i] != nil {
+			continue
+		}
+		reclaimed, err := s.compact(ctx, adapter, filename, dest)
+		s.report.Targets[i].Reclaimed = reclaimed
+		if err != nil {
 			errs = append(errs, errors.Wrapf(err, "error compacting %s", adapter.Config().Name))
 			// Currently we ignore compact error as it is not critical, and compact can be run again next sync.
 			// But if the error happens continuously, it could be a problem.
@@ -158,18 +337,460 @@ func (s *Syncer) Sync(ctx context.Context, source string, start time.Time) error
 		}
 	}
 	pterm.Println("Synced to", len(successes), "destinations")
+	return s.syncResult(errs)
+}
+
+// ValidateStream check that every target supports syncing a backup from a stream.
+func (s *Syncer) ValidateStream() error {
+	if len(s.adapters) == 0 {
+		return errors.Wrapf(ErrNoTargets, "streaming requires at least one enabled target")
+	}
+	for _, adapter := range s.adapters {
+		if _, ok := adapter.(StreamSaver); !ok {
+			return errors.Newf("target %s does not support streaming", adapter.Config().Name)
+		}
+	}
+	return nil
+}
+
+// SyncStream syncs the backup read from the reader to the targets, without a local backup file.
+// The reader is streamed to all synced targets at once regardless of the concurrency,
+// so the slowest target limits the others. A failed target does not stop streaming to the others,
+// and the reader is always read until EOF, unless reading it fails.
+func (s *Syncer) SyncStream(ctx context.Context, reader io.Reader, destFileName string, start time.Time) error {
+	if len(s.adapters) == 0 {
+		return nil
+	}
+
+	filename := strings.TrimSuffix(destFileName, core.BackupFileExt)
+	pterm.Printf("Start streaming to %d destinations\n", len(s.adapters))
+	dest := utils.FormatBackupName(start, filename+core.BackupFileExt)
+
+	results := make([]error, len(s.adapters))
+	durations := make([]time.Duration, len(s.adapters))
+	synced := make([]bool, len(s.adapters))
+	writers := make([]io.Writer, 0, len(s.adapters))
+	pipes := make([]*io.PipeWriter, 0, len(s.adapters))
+	wg := sync.WaitGroup{}
+	progress := s.startProgress("Streaming")
+	for i, adapter := range s.adapters {
+		conf := adapter.Config()
+		if !shouldSync(adapter, s.iter) {
+			slog.Info("Skip sync due to config",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", filename),
+				slog.Int("each", conf.Each))
+			pterm.Success.Println("Skipped sync", conf.Name)
+			continue
+		}
+
+		pr, pw := io.Pipe()
+		writers = append(writers, &streamWriter{w: pw})
+		pipes = append(pipes, pw)
+		wg.Add(1)
+		synced[i] = true
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = s.saveStream(ctx, progress, adapter, pr, dest, filename)
+			durations[i] = time.Since(start)
+			// Unblock the writer if the target stopped reading.
+			_ = pr.CloseWithError(results[i])
+		}()
+	}
+
+	// The checksum of the streamed backup for the manifest.
+	h := utils.NewChecksumHash(s.checksumAlgo)
+	writers = append(writers, h)
+	size, err := io.Copy(io.MultiWriter(writers...), utils.ContextReader(ctx, reader))
+	for _, pw := range pipes {
+		// Closing with nil error ends the stream with EOF.
+		_ = pw.CloseWithError(err)
+	}
+	wg.Wait()
+	progress.Stop()
+	defer s.waitBackground()
+	if err != nil {
+		return errors.Wrapf(err, "error reading backup stream")
+	}
+	// The checksum is only known after streaming, so it is appended to the manifest and signed after syncing.
+	checksum := h.Sum(nil)
+	if err := s.appendManifest(ctx, dest, checksum); err != nil {
+		return err
+	}
+	signature, err := s.writeSignature(dest, checksum)
+	if err != nil {
+		return err
+	}
+	if signature != "" {
+		defer os.Remove(signature)
+		for i, adapter := range s.adapters {
+			if synced[i] && results[i] == nil {
+				results[i] = s.saveSignature(ctx, adapter, signature, dest)
+			}
+		}
+	}
+	s.report = newSyncReport("", dest, s.adapters, synced, results, durations)
+	s.report.Size = size
+	return s.compactSynced(ctx, filename, dest, synced, results)
+}
+
+// streamWriter writes to the stream of a target, discarding writes after the target failed,
+// so a failed target does not stop streaming to the others.
+type streamWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// PingResult the result of pinging a target.
+type PingResult struct {
+	Target string
+	Type   string
+	// Supported whether the adapter can be pinged, unsupported adapters are not checked.
+	Supported bool
+	Err       error
+	Duration  time.Duration
+}
+
+// PingEach pings each adapter that can be pinged, in order.
+func (s *Syncer) PingEach(ctx context.Context) []PingResult {
+	results := make([]PingResult, 0, len(s.adapters))
+	for _, adapter := range s.adapters {
+		result := PingResult{Target: adapter.Config().Name, Type: adapter.Type()}
+		if pinger, ok := adapter.(Pinger); ok {
+			start := time.Now()
+			result.Supported = true
+			result.Err = pinger.Ping(ctx)
+			result.Duration = time.Since(start)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Ping pings every adapter that can be pinged, returning the errors of all unreachable targets.
+func (s *Syncer) Ping(ctx context.Context) error {
+	var errs []error
+	for _, result := range s.PingEach(ctx) {
+		if result.Err != nil {
+			errs = append(errs, errors.Wrapf(result.Err, "target %s is unreachable", result.Target))
+			continue
+		}
+		if result.Supported {
+			slog.Info("Pinged target",
+				slog.String("adapter", result.Target),
+				slog.String("took", result.Duration.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Report return the report of the last sync without clearing it.
+// Return nil if no sync happened since the last TakeReport call.
+func (s *Syncer) Report() *SyncReport {
+	return s.report
+}
+
+// TakeReport return the report of the last sync and clears it.
+// Return nil if no sync happened since the last call.
+func (s *Syncer) TakeReport() *SyncReport {
+	report := s.report
+	s.report = nil
+	return report
+}
+
+func newSyncReport(source string, dest string, adapters []Adapter, synced []bool, results []error, durations []time.Duration) *SyncReport {
+	report := SyncReport{
+		Backup:  dest,
+		Source:  source,
+		Targets: make([]SyncResult, 0, len(adapters)),
+	}
+	if info, err := os.Stat(source); err == nil {
+		report.Size = info.Size()
+	}
+	for i, adapter := range adapters {
+		result := SyncResult{
+			Target:   adapter.Config().Name,
+			Skipped:  !synced[i],
+			Duration: durations[i],
+		}
+		if results[i] != nil {
+			result.Error = results[i].Error()
+		}
+		report.Targets = append(report.Targets, result)
+	}
+	return &report
+}
+
+// syncResult return the errors of the sync if fail-fast is enabled.
+func (s *Syncer) syncResult(errs []error) error {
 	if s.failFast {
 		return errors.Join(errs...)
 	}
+	// The backup must be created again, regardless of fail-fast.
+	if changed := lo.Filter(errs, func(err error, _ int) bool {
+		return errors.Is(err, ErrSourceChanged)
+	}); len(changed) > 0 {
+		return errors.Join(changed...)
+	}
 	return nil
 }
 
-func (s *Syncer) List(ctx context.Context, filename string, adapterNames ...string) error {
+type sourceChecksumKey struct{}
+
+// withSourceChecksum return a copy of ctx that carries the precomputed checksum of the backup being saved.
+func withSourceChecksum(ctx context.Context, checksum []byte) context.Context {
+	return context.WithValue(ctx, sourceChecksumKey{}, checksum)
+}
+
+// sourceChecksumFrom return the precomputed checksum of the backup being saved carried by ctx, or nil if there is none.
+func sourceChecksumFrom(ctx context.Context) []byte {
+	checksum, _ := ctx.Value(sourceChecksumKey{}).([]byte)
+	return checksum
+}
+
+// save sends the backup file to the adapter, followed by its metadata and signature files if any.
+// The sourceChecksum is the checksum of the backup before syncing, only used when verifying after upload.
+// The signature is the path of the signature file, empty if signing is disabled.
+// Only the progress of sending the backup file is displayed.
+func (s *Syncer) save(ctx context.Context, progress *progressDisplay, adapter Adapter, source string, dest string, filename string, sourceChecksum []byte, signature string) error {
+	conf := adapter.Config()
+	pterm.Debug.Println("Start sync to", conf.Name)
+	slog.Info("Start sync", slog.String("adapter", conf.Name), slog.String("filename", filename))
+
+	if s.dryRun {
+		pterm.Info.Println("(dry-run) Would sync", dest, "to", conf.Name)
+		slog.Info("Would sync (dry-run)", slog.String("adapter", conf.Name), slog.String("target", dest))
+		return nil
+	}
+
+	// Send the file.
+	// The adapter must handle retry if error happens.
+	start := time.Now()
+	saveCtx, transfer := progress.track(ctx, conf.Name, localFileSize(source))
+	// The precomputed checksum is only of the backup file, not of its metadata and signature files.
+	ctx = withSourceChecksum(ctx, nil)
+	err := adapter.Save(saveCtx, source, dest)
+	progress.finish(transfer, err)
+	if err != nil {
+		// Only report instead of stop completely.
+		pterm.Error.Println("Error syncing to", conf.Name, err)
+		slog.Error("Error syncing",
+			slog.String("adapter", conf.Name),
+			slog.String("filename", filename),
+			slog.Any("err", err))
+		return err
+	}
+
+	if err := s.verifyUpload(ctx, adapter, source, dest, filename, sourceChecksum); err != nil {
+		pterm.Error.Println("Error verifying upload to", conf.Name, err)
+		slog.Error("Error verifying upload",
+			slog.String("adapter", conf.Name),
+			slog.String("filename", filename),
+			slog.Any("err", err))
+		return err
+	}
+
+	// Send the metadata file if exists.
+	if exists, err := utils.FileExists(source + utils.MetadataExt); err != nil {
+		return errors.Wrapf(err, "error checking metadata file")
+	} else if exists {
+		if err := adapter.Save(ctx, source+utils.MetadataExt, dest+utils.MetadataExt); err != nil {
+			pterm.Error.Println("Error syncing metadata to", conf.Name, err)
+			slog.Error("Error syncing metadata",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", filename),
+				slog.Any("err", err))
+			return errors.Wrapf(err, "error syncing metadata")
+		}
+	}
+	if err := s.saveSignature(ctx, adapter, signature, dest); err != nil {
+		pterm.Error.Println("Error syncing signature to", conf.Name, err)
+		slog.Error("Error syncing signature",
+			slog.String("adapter", conf.Name),
+			slog.String("filename", filename),
+			slog.Any("err", err))
+		return err
+	}
+	pterm.Success.Println("Synced to", conf.Name, "took", time.Since(start).String())
+	slog.Info("Complete sync",
+		slog.String("adapter", conf.Name),
+		slog.String("filename", filename),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
+
+// saveStream sends the backup read from the reader to the adapter.
+// The streamed backup cannot be uploaded again, so the verification after upload is not retried.
+func (s *Syncer) saveStream(ctx context.Context, progress *progressDisplay, adapter Adapter, reader io.Reader, dest string, filename string) error {
+	conf := adapter.Config()
+	pterm.Debug.Println("Start streaming to", conf.Name)
+	slog.Info("Start sync", slog.String("adapter", conf.Name), slog.String("filename", filename))
+
+	if s.dryRun {
+		pterm.Info.Println("(dry-run) Would sync", dest, "to", conf.Name)
+		slog.Info("Would sync (dry-run)", slog.String("adapter", conf.Name), slog.String("target", dest))
+		_, err := io.Copy(io.Discard, reader)
+		return err
+	}
+
+	saver, ok := adapter.(StreamSaver)
+	if !ok {
+		return errors.Newf("target %s does not support streaming", conf.Name)
+	}
+	start := time.Now()
+	saveCtx, transfer := progress.track(ctx, conf.Name, 0)
+	err := saver.SaveStream(saveCtx, reader, -1, dest)
+	progress.finish(transfer, err)
+	if err == nil && s.verifyAfterUpload {
+		if waiter, ok := adapter.(backgroundWaiter); ok {
+			waiter.waitBackground()
+		}
+		if verifier, ok := adapter.(Verifier); ok {
+			err = verifier.Verify(ctx, dest)
+		}
+	}
+	if err != nil {
+		pterm.Error.Println("Error syncing to", conf.Name, err)
+		slog.Error("Error syncing",
+			slog.String("adapter", conf.Name),
+			slog.String("filename", filename),
+			slog.Any("err", err))
+		return err
+	}
+	pterm.Success.Println("Synced to", conf.Name, "took", time.Since(start).String())
+	slog.Info("Complete sync",
+		slog.String("adapter", conf.Name),
+		slog.String("filename", filename),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
+
+// verifyUpload verifies the uploaded backup against its checksum file, if enabled and supported by the adapter.
+// On checksum mismatch, the backup is uploaded again up to uploadRetries times if the local backup is unchanged,
+// otherwise ErrSourceChanged is returned, as the local backup must be created again.
+func (s *Syncer) verifyUpload(ctx context.Context, adapter Adapter, source string, dest string, filename string, sourceChecksum []byte) error {
+	verifier, ok := adapter.(Verifier)
+	if !s.verifyAfterUpload || !ok {
+		return nil
+	}
+	conf := adapter.Config()
+	if waiter, ok := adapter.(backgroundWaiter); ok {
+		// The checksum file may be uploading in the background.
+		waiter.waitBackground()
+	}
+	for retry := 0; ; retry++ {
+		err := verifier.Verify(ctx, dest)
+		if err == nil {
+			slog.Info("Verified upload",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", filename),
+				slog.Int("retries", retry))
+			return nil
+		}
+		if !errors.Is(err, utils.ErrChecksumMismatch) {
+			return errors.Wrapf(err, "error verifying upload")
+		}
+		checksum, cerr := utils.FileChecksum(source, s.checksumAlgo)
+		if cerr != nil {
+			return errors.Wrapf(cerr, "error calculating checksum file %s", source)
+		}
+		if !bytes.Equal(checksum, sourceChecksum) {
+			return errors.Wrapf(ErrSourceChanged, "%s changed while syncing", filepath.Base(source))
+		}
+		if retry >= s.uploadRetries {
+			return errors.Wrapf(err, "upload corrupted after %d retries", retry)
+		}
+		pterm.Warning.Printf("Checksum mismatch after upload to %s, re-uploading (%d/%d)\n", conf.Name, retry+1, s.uploadRetries)
+		slog.Warn("Checksum mismatch after upload, re-uploading",
+			slog.String("adapter", conf.Name),
+			slog.String("filename", filename),
+			slog.Int("retry", retry+1),
+			slog.Int("retries", s.uploadRetries))
+		// Delete the corrupted upload first, so it is not mistaken for an already uploaded backup.
+		if err := adapter.Del(ctx, dest); err != nil {
+			return errors.Wrapf(err, "error deleting corrupted upload")
+		}
+		if err := adapter.Save(ctx, source, dest); err != nil {
+			return err
+		}
+	}
+}
+
+// Iter return the current backup iteration.
+func (s *Syncer) Iter() int64 {
+	return s.iter
+}
+
+// WillSyncAny check whether at least one target would sync the given backup iteration, based on Each config.
+func (s *Syncer) WillSyncAny(iter int64) bool {
+	return lo.SomeBy(s.adapters, func(adapter Adapter) bool {
+		return shouldSync(adapter, iter)
+	})
+}
+
+// SkipIteration skips the current backup iteration, as if all targets skipped syncing it.
+func (s *Syncer) SkipIteration() {
+	s.iter++
+}
+
+// shouldSync check whether the adapter should sync the given backup iteration, based on Each config.
+func shouldSync(adapter Adapter, iter int64) bool {
+	conf := adapter.Config()
+	return conf.Each <= 1 || iter%int64(conf.Each) == 0
+}
+
+// ListOptions options of listing the backups of targets.
+type ListOptions struct {
+	// Tags only lists backups having all the tags.
+	Tags []string
+	// WarnEmpty warns about targets having no backups, as it often means a misconfigured target.
+	WarnEmpty bool
+	// SizeTotal prints the number and total size of the backups of each target, and the grand total of all targets.
+	SizeTotal bool
+	// JSON prints the listing as json to stdout instead.
+	JSON bool
+}
+
+// TargetListing the backups of a target.
+type TargetListing struct {
+	Target  string   `json:"target"`
+	Backups []string `json:"backups"`
+	Count   int      `json:"count"`
+	// Size the total size of the backups, nil if SizeTotal is disabled or the target does not report sizes.
+	Size *int64 `json:"size,omitempty"`
+	// Error empty if the target is listed successfully.
+	Error string `json:"error,omitempty"`
+}
+
+// Listing the backups of the listed targets.
+type Listing struct {
+	Targets []TargetListing `json:"targets"`
+	// Count the total number of backups of all targets.
+	Count int `json:"count"`
+	// Size the total size of the backups of all targets reporting sizes, nil if SizeTotal is disabled.
+	Size *int64 `json:"size,omitempty"`
+}
+
+// List prints the backups of each target.
+func (s *Syncer) List(ctx context.Context, filename string, opts ListOptions, adapterNames ...string) error {
 	if len(s.adapters) == 0 {
-		return errors.New("empty list of targets")
+		return errors.Wrapf(ErrNoTargets, "empty list of targets")
 	}
 	filename = strings.TrimSuffix(filename, core.BackupFileExt)
 
+	listing := Listing{Targets: make([]TargetListing, 0, len(s.adapters))}
+	if opts.SizeTotal {
+		listing.Size = new(int64)
+	}
+	unsized := make([]string, 0)
 	errs := make([]error, 0, len(s.adapters))
 	for _, adapter := range s.adapters {
 		if len(adapterNames) > 0 && !slices.Contains(adapterNames, adapter.Config().Name) {
@@ -177,67 +798,349 @@ func (s *Syncer) List(ctx context.Context, filename string, adapterNames ...stri
 		}
 
 		conf := adapter.Config()
-		names, err := adapter.ListFileNames(ctx)
+		names, infos, err := listBackupFiles(ctx, adapter)
 		total := len(names)
-		names = utils.FilterBackupFileNames(names, filename)
+		names = utils.FilterBackupFileNamesByTags(names, filename, opts.Tags)
+		if err == nil && infos == nil {
+			infos, err = statBackupFiles(ctx, adapter, names)
+		}
 		backups := len(names)
-		pterm.Info.Println("Files in", conf.Name, pterm.Sprintf("(%d/%d)", backups, total))
+		target := TargetListing{Target: conf.Name, Backups: names, Count: backups}
+		if !opts.JSON {
+			pterm.Info.Println("Files in", conf.Name, pterm.Sprintf("(%d/%d)", backups, total))
+		}
 		if err != nil {
-			pterm.Warning.Println("Error listing", conf.Name, err)
+			if !opts.JSON {
+				pterm.Warning.Println("Error listing", conf.Name, err)
+			}
+			target.Error = err.Error()
+			listing.Targets = append(listing.Targets, target)
 			errs = append(errs, errors.Wrapf(err, "error listing %s", conf.Name))
 			if s.failFast {
-				return errors.Join(errs...)
+				break
+			}
+			continue
+		}
+		if opts.WarnEmpty && backups == 0 {
+			if !opts.JSON {
+				pterm.Warning.Printf("No backups found in %s, check the target path, name and extension filter\n", conf.Name)
+			}
+			slog.Warn("No backups found",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", filename),
+				slog.Int("total", total))
+		}
+		listing.Count += backups
+		if opts.SizeTotal && infos != nil {
+			size := int64(0)
+			for _, name := range names {
+				size += infos[name].Size
+			}
+			target.Size = &size
+			*listing.Size += size
+		} else if opts.SizeTotal {
+			unsized = append(unsized, conf.Name)
+		}
+		listing.Targets = append(listing.Targets, target)
+		if opts.JSON {
+			continue
+		}
+		errs = append(errs, renderBackupFiles(names, infos))
+		if opts.SizeTotal {
+			if target.Size != nil {
+				pterm.Println(backups, "backups, total", utils.FormatBytes(*target.Size))
+			} else {
+				pterm.Println(backups, "backups (size not reported by target)")
 			}
+		}
+	}
+
+	if opts.JSON {
+		b, err := json.MarshalIndent(listing, "", "  ")
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		// Print to stdout directly, so the output can be piped.
+		fmt.Println(string(b))
+		return errors.Join(errs...)
+	}
+	if opts.SizeTotal && len(listing.Targets) > 1 {
+		pterm.Println("Grand total", listing.Count, "backups,", utils.FormatBytes(*listing.Size), "in", len(listing.Targets), "targets")
+		if len(unsized) > 0 {
+			pterm.Println("Size excludes targets not reporting sizes:", strings.Join(unsized, ", "))
+		}
+	}
+	pterm.Println("Completed.")
+	return errors.Join(errs...)
+}
+
+// LatestBackupSize return the size of the latest backup of filename on the first target listing sizes,
+// false if there is no such target or backup.
+func (s *Syncer) LatestBackupSize(ctx context.Context, filename string) (int64, bool, error) {
+	filename = strings.TrimSuffix(filename, core.BackupFileExt)
+	for _, adapter := range s.adapters {
+		lister, ok := adapter.(Lister)
+		if !ok {
 			continue
 		}
+		files, err := lister.ListFiles(ctx)
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "error listing %s", adapter.Config().Name)
+		}
+		sizes := make(map[string]int64, len(files))
+		for _, file := range files {
+			sizes[file.Name] = file.Size
+		}
+		names := utils.FilterBackupFileNames(lo.Keys(sizes), filename)
+		if len(names) == 0 {
+			return 0, false, nil
+		}
+		return sizes[names[len(names)-1]], true, nil
+	}
+	return 0, false, nil
+}
+
+// listBackupFiles lists the file names of the target, with their infos if the target reports them when listing.
+// The infos are nil if the target does not report them.
+func listBackupFiles(ctx context.Context, adapter Adapter) ([]string, map[string]FileInfo, error) {
+	lister, ok := adapter.(Lister)
+	if !ok {
+		names, err := listFileNames(ctx, adapter)
+		return names, nil, err
+	}
+	files, err := lister.ListFiles(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		// Check the target path.
+		names, err := listFileNames(ctx, adapter)
+		return names, map[string]FileInfo{}, err
+	}
+	names := make([]string, 0, len(files))
+	infos := make(map[string]FileInfo, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+		infos[file.Name] = file
+	}
+	return names, infos, nil
+}
+
+// statBackupFiles return the infos of the named files of the target, nil if the target cannot stat files.
+// Used for targets that do not report the infos when listing.
+func statBackupFiles(ctx context.Context, adapter Adapter, names []string) (map[string]FileInfo, error) {
+	stater, ok := adapter.(Stater)
+	if !ok {
+		return nil, nil
+	}
+	files, err := statFiles(ctx, names, adapter.Config().StatConcurrency, func(ctx context.Context, name string) (FileInfo, error) {
+		return stater.Stat(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]FileInfo, len(files))
+	for i, file := range files {
+		infos[names[i]] = file
+	}
+	return infos, nil
+}
+
+// renderBackupFiles prints the backup names as a table with their sizes and ages,
+// or as a list of names only if their infos are not known.
+func renderBackupFiles(names []string, infos map[string]FileInfo) error {
+	if infos == nil || len(names) == 0 {
 		items := lo.Map(names, func(item string, _ int) pterm.BulletListItem {
 			return pterm.BulletListItem{Level: 0, Text: item}
 		})
-		errs = append(errs, pterm.DefaultBulletList.WithItems(items).Render())
+		return pterm.DefaultBulletList.WithItems(items).Render()
 	}
-	pterm.Println("Completed.")
-	return errors.Join(errs...)
+	data := make(pterm.TableData, 0, len(names)+1)
+	data = append(data, []string{"Name", "Size", "Age"})
+	now := time.Now()
+	for _, name := range names {
+		info := infos[name]
+		age := "-"
+		if !info.ModTime.IsZero() {
+			age = utils.FormatAge(now.Sub(info.ModTime))
+		}
+		data = append(data, []string{name, utils.FormatBytes(info.Size), age})
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
 }
 
-// compact deletes old backup to keep the total number of backup bellows Keep config.
-func (s *Syncer) compact(ctx context.Context, adapter Adapter, filename string) error {
-	conf := adapter.Config()
-	keep := adapter.Config().Keep
-	if keep == 0 {
-		keep = s.keep
+// Move renames a backup on the named target.
+// The destination must still be a managed backup of filename, so it won't be orphaned by compaction.
+func (s *Syncer) Move(ctx context.Context, filename string, adapterName string, source string, destination string) error {
+	filename = strings.TrimSuffix(filename, core.BackupFileExt)
+	if len(utils.FilterBackupFileNamesByTags([]string{destination}, filename, utils.ParseTags(destination))) == 0 {
+		return errors.Newf("destination %s does not match the backup naming of %s", destination, filename)
+	}
+
+	adapter, ok := lo.Find(s.adapters, func(adapter Adapter) bool {
+		return adapter.Config().Name == adapterName
+	})
+	if !ok {
+		return errors.New("target not found: " + adapterName)
 	}
-	if keep < 1 {
+	mover, ok := adapter.(Mover)
+	if !ok {
+		return errors.New("target does not support moving file: " + adapterName)
+	}
+
+	if s.dryRun {
+		pterm.Info.Println("(dry-run) Would move", source, "to", destination, "on", adapterName)
+		return nil
+	}
+	start := time.Now()
+	sig, err := s.renameSignature(ctx, adapter, source, destination)
+	if err != nil {
+		return errors.Wrapf(err, "error moving signature of %s on %s", source, adapterName)
+	}
+	if err := mover.Move(ctx, source, destination); err != nil {
+		return errors.Wrapf(err, "error moving %s on %s", source, adapterName)
+	}
+	for _, ext := range backupSidecarExts {
+		err := mover.Move(ctx, source+ext, destination+ext)
+		if err != nil && !errors.Is(err, ErrFileNotFound) {
+			return errors.Wrapf(err, "error moving %s of %s on %s", ext, source, adapterName)
+		}
+	}
+	if err := s.saveRenamedSignature(ctx, adapter, sig, destination); err != nil {
+		return errors.Wrapf(err, "error moving signature of %s on %s", source, adapterName)
+	}
+	pterm.Success.Println("Moved", source, "to", destination, "on", adapterName, "took", time.Since(start).String())
+	slog.Info("Moved",
+		slog.String("adapter", adapterName),
+		slog.String("source", source),
+		slog.String("target", destination),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
+
+// compact deletes old backup to keep the total number of backup bellows Keep config,
+// or the backups not kept by the Retention policy.
+// The synced backup is considered present on the target in dry-run, as it is not actually saved.
+// Return the total size of deleted backups (or would be deleted in dry-run), zero if the target does not report sizes.
+func (s *Syncer) compact(ctx context.Context, adapter Adapter, filename string, synced string) (int64, error) {
+	conf := adapter.Config()
+	keep, retention := s.retentionOf(adapter)
+	if keep < 1 && !retention.Enabled() {
 		slog.Info("Skip delete old backup due to config",
 			slog.String("adapter", conf.Name),
 			slog.String("filename", filename),
 			slog.Int("keep", keep))
-		return nil
+		return 0, nil
 	}
 
-	names, err := adapter.ListFileNames(ctx)
+	allNames, sizes, err := listFilesWithSize(ctx, adapter)
 	if err != nil {
-		return errors.Wrapf(err, "error listing file names for destinations %s", conf.Name)
+		return 0, errors.Wrapf(err, "error listing file names for destinations %s", conf.Name)
 	}
-	names = utils.FilterBackupFileNames(names, filename)
-	if len(names) <= keep {
+	if s.dryRun && !slices.Contains(allNames, synced) {
+		allNames = append(allNames, synced)
+	}
+	names := utils.FilterBackupFileNames(allNames, filename)
+	deletions := selectOldBackups(names, keep, retention)
+	if len(deletions) == 0 {
 		slog.Info("Skip delete old backup",
 			slog.String("adapter", conf.Name),
 			slog.String("filename", filename),
 			slog.Int("keep", keep),
 			slog.Int("count", len(names)))
-		return nil
+		return 0, nil
+	}
+
+	return deleteBackups(ctx, adapter, filename, deletions, allNames, sizes, s.dryRun)
+}
+
+// deleteBackups deletes the backups of filename on the target with their sidecar files, or only prints them in dry-run.
+// Return the total size of deleted backups (or would be deleted in dry-run), zero if the target does not report sizes.
+func deleteBackups(ctx context.Context, adapter Adapter, filename string, deletions []string, allNames []string, sizes map[string]int64, dryRun bool) (int64, error) {
+	conf := adapter.Config()
+	reclaimed := int64(0)
+	if dryRun {
+		for _, name := range deletions {
+			size := sizes[name]
+			for _, ext := range backupSidecarExts {
+				size += sizes[name+ext]
+			}
+			reclaimed += size
+			pterm.Info.Println("(dry-run) Would delete", name, "on", conf.Name, pterm.Sprintf("(%s)", utils.FormatBytes(size)))
+			slog.Info("Would delete old backup (dry-run)",
+				slog.String("adapter", conf.Name),
+				slog.String("filename", filename),
+				slog.String("target", name),
+				slog.Int64("size", size))
+		}
+		pterm.Info.Println("(dry-run) Would reclaim", utils.FormatBytes(reclaimed), "on", conf.Name)
+		return reclaimed, nil
 	}
 
 	// Delete old backup.
-	for _, name := range names[:len(names)-keep] {
+	for _, name := range deletions {
+		size := sizes[name]
 		slog.Info("Deleting old backup",
 			slog.String("adapter", conf.Name),
 			slog.String("filename", filename),
 			slog.String("target", name),
+			slog.Int64("size", size),
 		)
 		if err := adapter.Del(ctx, name); err != nil {
-			return errors.Wrapf(err, "error deleting old backup")
+			return reclaimed, errors.Wrapf(err, "error deleting old backup")
+		}
+		reclaimed += size
+		for _, ext := range backupSidecarExts {
+			if !slices.Contains(allNames, name+ext) {
+				continue
+			}
+			if err := adapter.Del(ctx, name+ext); err != nil {
+				return reclaimed, errors.Wrapf(err, "error deleting old backup %s", ext)
+			}
+			reclaimed += sizes[name+ext]
 		}
+		pterm.Println("Deleted", name, "on", conf.Name, pterm.Sprintf("(%s)", utils.FormatBytes(size)))
 	}
-	return nil
+	pterm.Println("Reclaimed", utils.FormatBytes(reclaimed), "from", len(deletions), "old backups on", conf.Name)
+	slog.Info("Compacted old backup",
+		slog.String("adapter", conf.Name),
+		slog.String("filename", filename),
+		slog.Int("deleted", len(deletions)),
+		slog.Int64("reclaimed", reclaimed))
+	return reclaimed, nil
+}
+
+// retentionOf return the keep and retention config of the target, or the global config if the target has none.
+func (s *Syncer) retentionOf(adapter Adapter) (int, core.RetentionPolicy) {
+	conf := adapter.Config()
+	if !conf.Retention.Enabled() && conf.Keep == 0 {
+		return s.keep, s.retention
+	}
+	return conf.Keep, conf.Retention
+}
+
+// listFilesWithSize list the file names of the adapter, with their sizes if the adapter is a Lister.
+// The files in subdirectories are included if the adapter is configured to be recursive and supports it.
+// The sizes are nil if the adapter does not support it.
+func listFilesWithSize(ctx context.Context, adapter Adapter) ([]string, map[string]int64, error) {
+	var files []FileInfo
+	var err error
+	if lister, ok := adapter.(RecursiveLister); ok && adapter.Config().Recursive {
+		files, err = lister.ListFilesRecursive(ctx)
+	} else if lister, ok := adapter.(Lister); ok {
+		files, err = lister.ListFiles(ctx)
+	} else {
+		names, err := adapter.ListFileNames(ctx)
+		return names, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, 0, len(files))
+	sizes := make(map[string]int64, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+		sizes[file.Name] = file.Size
+	}
+	return names, sizes, nil
 }
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestSyncerNoTargets(t *testing.T) {
+	s := &Syncer{pullTargetDir: t.TempDir()}
+	if err := s.Pull(context.Background(), "db", nil); !errors.Is(err, ErrNoTargets) {
+		t.Errorf("Pull() error = %v, want %v", err, ErrNoTargets)
+	}
+	if err := s.List(context.Background(), "db", ListOptions{}); !errors.Is(err, ErrNoTargets) {
+		t.Errorf("List() error = %v, want %v", err, ErrNoTargets)
+	}
+
+	app := &core.App{Ctx: context.Background()}
+	app.RequireTargets = true
+	app.Targets = []map[string]any{{"type": "file", "name": "disabled", "dir": t.TempDir(), "disabled": true}}
+	if _, err := NewSyncer(app); !errors.Is(err, ErrNoTargets) {
+		t.Errorf("NewSyncer() error = %v, want %v", err, ErrNoTargets)
+	}
+}
+
+func TestSyncerCompactEvery(t *testing.T) {
+	dir := t.TempDir()
+	app := &core.App{Ctx: context.Background()}
+	app.Keep = 1
+	app.CompactEvery = 3
+	app.ChecksumAlgo = core.ChecksumSHA256
+	app.BackupTempDir = t.TempDir()
+	app.Targets = []map[string]any{{"type": "file", "name": "local", "dir": dir}}
+	s, err := NewSyncer(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := writeTestFile(t, "db.sinbak", []byte("backup content"))
+
+	// Compaction only runs on every 3rd sync, starting from the first.
+	want := []int{1, 2, 3, 1, 2}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	for i, count := range want {
+		if err := s.Sync(context.Background(), source, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Sync() error = %s", err)
+		}
+		names, err := utils.ListFileNames(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(utils.FilterBackupFileNames(names, "db")); got != count {
+			t.Errorf("backups after sync %d = %d, want %d", i+1, got, count)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"reflect"
+	"sin/internal/core"
+	"slices"
+	"strings"
+)
+
+// TargetValidation the result of validating a target config.
+type TargetValidation struct {
+	Name string
+	Type string
+	// Disabled whether the target is disabled, so it is skipped when syncing.
+	Disabled bool
+	// Err the error constructing the adapter of the target, nil if the target is valid.
+	Err error
+	// UnknownKeys the keys of the target config not used by the adapter, usually typos.
+	UnknownKeys []string
+}
+
+// ValidateTargets constructs the adapter of every target in the config, including disabled targets,
+// and reports the problems of each target instead of stopping at the first one.
+func ValidateTargets(app *core.App) []TargetValidation {
+	results := make([]TargetValidation, 0, len(app.Targets))
+	for _, target := range app.Targets {
+		result := TargetValidation{Disabled: isTargetDisabled(target)}
+		result.Name, _ = target["name"].(string)
+		result.Type, _ = target["type"].(string)
+		_, result.Err = newAdapter(target, app.UserAgentHeader(), app.ChecksumAlgo)
+		result.UnknownKeys = unknownTargetKeys(target, result.Type)
+		results = append(results, result)
+	}
+	return results
+}
+
+// adapterConfigTypes the config struct of each adapter type, used for finding unknown keys.
+var adapterConfigTypes = map[string]reflect.Type{
+	AdapterFileType: reflect.TypeOf(fileAdapter{}),
+	AdapterS3Type:   reflect.TypeOf(s3Adapter{}),
+	AdapterMockType: reflect.TypeOf(mockAdapter{}),
+}
+
+// unknownTargetKeys return the keys of the target config that are not fields of the adapter config, sorted.
+// Keys are compared case-insensitively, the same as decoding the config.
+// Return nil if the adapter type is unknown.
+func unknownTargetKeys(target map[string]any, adapterType string) []string {
+	t, ok := adapterConfigTypes[adapterType]
+	if !ok {
+		return nil
+	}
+	known := map[string]struct{}{"type": {}}
+	collectJSONKeys(t, known)
+	unknown := make([]string, 0)
+	for key := range target {
+		if _, ok := known[strings.ToLower(key)]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// collectJSONKeys adds the lower-cased json keys of the struct fields into keys, including squashed embedded structs.
+func collectJSONKeys(t reflect.Type, keys map[string]struct{}) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectJSONKeys(field.Type, keys)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		keys[strings.ToLower(name)] = struct{}{}
+	}
+}
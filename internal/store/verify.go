@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"math/rand/v2"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sample strategies for choosing backups to verify.
+const (
+	VerifySampleAll    = "all"
+	VerifySampleOldest = "oldest"
+	VerifySampleNewest = "newest"
+	VerifySampleRandom = "random"
+)
+
+// Verify checks the backups of each target against their checksum files, without downloading them to local.
+// If the checksum manifest or the signing public key is enabled, backups are checked against the manifest
+// and their signatures instead, and backups not in the manifest or without a signature are reported as failed.
+// Only backups chosen by the sample strategies are verified, all backups if no strategies are specified.
+// If tags are specified, only backups having all the tags are verified.
+func (s *Syncer) Verify(ctx context.Context, filename string, tags []string, samples []string, adapterNames ...string) error {
+	filename = strings.TrimSuffix(filename, core.BackupFileExt)
+	for _, sample := range samples {
+		if !slices.Contains([]string{VerifySampleAll, VerifySampleOldest, VerifySampleNewest, VerifySampleRandom}, sample) {
+			return errors.Newf("invalid verify sample strategy '%s'", sample)
+		}
+	}
+
+	verifiers := make([]Verifier, 0, len(s.adapters))
+	for _, adapter := range s.adapters {
+		if len(adapterNames) > 0 && !slices.Contains(adapterNames, adapter.Config().Name) {
+			continue
+		}
+		v, ok := adapter.(Verifier)
+		if !ok {
+			pterm.Warning.Println("Target does not support verifying, skipped:", adapter.Config().Name)
+			continue
+		}
+		if _, ok := adapter.(Hasher); !ok && (s.manifest != nil || s.signingPublicKey != nil) {
+			pterm.Warning.Println("Target does not support verifying against checksum manifest or signature, skipped:", adapter.Config().Name)
+			continue
+		}
+		verifiers = append(verifiers, v)
+	}
+	if len(verifiers) == 0 {
+		return errors.Wrapf(ErrNoTargets, "empty list of verifiable targets")
+	}
+	manifest, err := s.loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	errs := make([]error, 0, len(verifiers))
+	ok, bad, missing := 0, 0, 0
+	for _, verifier := range verifiers {
+		conf := verifier.Config()
+		names, err := listFileNames(ctx, verifier)
+		if err != nil {
+			pterm.Warning.Println("Error listing", conf.Name, err)
+			errs = append(errs, errors.Wrapf(err, "error listing %s", conf.Name))
+			continue
+		}
+		names = sampleBackups(utils.FilterBackupFileNamesByTags(names, filename, tags), samples)
+		pterm.Info.Println("Verifying", len(names), "backups in", conf.Name)
+
+		// Verify concurrently, the results are reported in order of names.
+		results := utils.BatchFileChecksum(ctx, names, s.checksumWorkers, func(name string) ([]byte, error) {
+			return nil, s.verifyRemote(ctx, verifier, manifest, name)
+		})
+		for _, result := range results {
+			switch {
+			case result.Err == nil:
+				ok++
+			case errors.Is(result.Err, ErrNoChecksum):
+				missing++
+			default:
+				bad++
+				errs = append(errs, errors.Wrapf(result.Err, "error verifying %s on %s", result.Path, conf.Name))
+			}
+			reportVerify(conf.Name, result.Path, result.Err)
+		}
+	}
+	pterm.Printf("Verified %d OK, %d BAD, %d MISSING-CHECKSUM took %s\n", ok, bad, missing, time.Since(start).String())
+	return errors.Join(errs...)
+}
+
+// verifyRemote verifies the backup on the target without downloading it.
+// If the checksum manifest or the signing public key is configured, the backup is verified against
+// its manifest entry and its signature instead of its checksum file.
+func (s *Syncer) verifyRemote(ctx context.Context, verifier Verifier, manifest map[string]manifestEntry, name string) error {
+	if manifest == nil && s.signingPublicKey == nil {
+		return verifier.Verify(ctx, name)
+	}
+	hasher := verifier.(Hasher)
+	// The backup is only hashed once per algorithm.
+	checksums := make(map[string][]byte, 1)
+	checksum := func(algo string) ([]byte, error) {
+		if c, ok := checksums[algo]; ok {
+			return c, nil
+		}
+		c, err := hasher.Checksum(ctx, algo, name)
+		checksums[algo] = c
+		return c, err
+	}
+
+	if manifest != nil {
+		entry, ok := manifest[name]
+		if !ok {
+			return errors.Wrapf(ErrNotInManifest, "%s", name)
+		}
+		c, err := checksum(entry.ChecksumAlgo)
+		if err != nil {
+			return err
+		}
+		if err := verifyManifestChecksum(entry, c); err != nil {
+			return err
+		}
+	}
+	if s.signingPublicKey != nil {
+		sig, err := readSignature(ctx, verifier, name)
+		if err != nil {
+			return err
+		}
+		c, err := checksum(sig.ChecksumAlgo)
+		if err != nil {
+			return err
+		}
+		if err := sig.Verify(s.signingPublicKey, name, c); err != nil {
+			return errors.Wrapf(err, "error verifying signature of %s", name)
+		}
+	}
+	return nil
+}
+
+// reportVerify reports the verification result of a backup.
+// Backups without checksum files are reported but not considered as failed.
+func reportVerify(adapterName string, name string, err error) {
+	switch {
+	case err == nil:
+		pterm.Success.Println("OK", name)
+		slog.Info("Verified", slog.String("adapter", adapterName), slog.String("filename", name))
+		return
+	case errors.Is(err, ErrNoChecksum):
+		pterm.Warning.Println("MISSING-CHECKSUM", name)
+		slog.Warn("Missing checksum", slog.String("adapter", adapterName), slog.String("filename", name))
+		return
+	case errors.Is(err, utils.ErrChecksumMismatch), errors.Is(err, utils.ErrInvalidSignature):
+		pterm.Error.Println("BAD", name, err)
+	default:
+		pterm.Error.Println("ERROR", name, err)
+	}
+	slog.Error("Error verifying",
+		slog.String("adapter", adapterName),
+		slog.String("filename", name),
+		slog.Any("err", err))
+}
+
+// sampleBackups chooses the backups to verify by the sample strategies.
+// The names must be sorted, and the result keeps the order.
+func sampleBackups(names []string, samples []string) []string {
+	if len(names) == 0 || len(samples) == 0 || slices.Contains(samples, VerifySampleAll) {
+		return names
+	}
+	chosen := make(map[int]struct{}, len(samples))
+	for _, sample := range samples {
+		switch sample {
+		case VerifySampleOldest:
+			chosen[0] = struct{}{}
+		case VerifySampleNewest:
+			chosen[len(names)-1] = struct{}{}
+		case VerifySampleRandom:
+			chosen[rand.IntN(len(names))] = struct{}{}
+		}
+	}
+	sampled := make([]string, 0, len(chosen))
+	for i, name := range names {
+		if _, ok := chosen[i]; ok {
+			sampled = append(sampled, name)
+		}
+	}
+	return sampled
+}
@@ -0,0 +1,179 @@
+package task
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"github.com/mawngo/go-errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strings"
+)
+
+// ArchiveEntry an entry inside a zip/tar backup.
+type ArchiveEntry struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"isDir"`
+}
+
+// isTarBackup check whether the backup is a tar archive, based on its extension.
+func isTarBackup(backup string) bool {
+	return filepath.Ext(strings.TrimSuffix(backup, core.BackupFileExt)) == ".tar"
+}
+
+// ListArchive lists the entries inside the zip/tar backup.
+func ListArchive(backup string) ([]ArchiveEntry, error) {
+	entries := make([]ArchiveEntry, 0)
+	err := walkArchive(backup, func(name string, info os.FileInfo, _ func() (io.ReadCloser, error)) error {
+		entries = append(entries, ArchiveEntry{Name: name, Size: info.Size(), IsDir: info.IsDir()})
+		return nil
+	})
+	return entries, err
+}
+
+// ExtractArchive extracts the entry (a file or a directory subtree) inside the zip/tar backup into the dest directory.
+// The entry is placed directly under dest, for example extracting "a/b" creates "dest/b".
+// Empty entry (or ".") extracts the whole archive.
+func ExtractArchive(ctx context.Context, backup string, entry string, dest string) error {
+	entry = strings.Trim(path.Clean("/"+filepath.ToSlash(entry)), "/")
+	parent := path.Dir(entry)
+	found := false
+	// symlinks the extracted paths of symlink entries, entries inside them are rejected to avoid writing outside dest.
+	symlinks := make([]string, 0)
+	err := walkArchive(backup, func(name string, info os.FileInfo, open func() (io.ReadCloser, error)) error {
+		raw := name
+		// Match and place the cleaned name, rejecting entries still escaping the archive root once cleaned.
+		name = path.Clean(name)
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return errors.Newf("invalid archive entry %s", raw)
+		}
+		if entry != "" && name != entry && !strings.HasPrefix(name, entry+"/") {
+			return nil
+		}
+		found = true
+
+		rel := name
+		if parent != "." {
+			rel = strings.TrimPrefix(name, parent+"/")
+		}
+		// Guard against entries escaping the destination.
+		out := filepath.Join(dest, filepath.FromSlash(rel))
+		if !strings.HasPrefix(out, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return errors.Newf("invalid archive entry %s", name)
+		}
+		for _, link := range symlinks {
+			if strings.HasPrefix(out, link+string(os.PathSeparator)) {
+				return errors.Newf("invalid archive entry %s inside symlink %s", name, link)
+			}
+		}
+		if err := checkSymlinkParents(dest, out); err != nil {
+			return errors.Wrapf(err, "invalid archive entry %s", name)
+		}
+		if info.IsDir() {
+			return os.MkdirAll(out, os.ModePerm)
+		}
+		if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+			return err
+		}
+		r, err := open()
+		if err != nil {
+			return errors.Wrapf(err, "error reading archive entry %s", name)
+		}
+		defer r.Close()
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := io.ReadAll(r)
+			if err != nil {
+				return errors.Wrapf(err, "error reading archive entry %s", name)
+			}
+			symlinks = append(symlinks, out)
+			if err := os.Remove(out); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return errors.Wrapf(err, "error replacing archive entry %s", name)
+			}
+			return os.Symlink(string(target), out)
+		}
+		if err := utils.CopyToFile(ctx, r, out); err != nil {
+			return errors.Wrapf(err, "error extracting archive entry %s", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Newf("entry %s not found in archive", entry)
+	}
+	return nil
+}
+
+// checkSymlinkParents check that no parent of out under dest is a symlink,
+// including symlinks already existing in dest, so extracting out cannot write outside dest.
+func checkSymlinkParents(dest string, out string) error {
+	rel, err := filepath.Rel(dest, filepath.Dir(out))
+	if err != nil || rel == "." {
+		return err
+	}
+	p := filepath.Clean(dest)
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Newf("parent %s is a symlink", p)
+		}
+	}
+	return nil
+}
+
+// walkArchive calls fn for each entry inside the zip/tar backup.
+// The open function is only valid during the call.
+func walkArchive(backup string, fn func(name string, info os.FileInfo, open func() (io.ReadCloser, error)) error) error {
+	if isTarBackup(backup) {
+		f, err := os.Open(backup)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r := tar.NewReader(f)
+		for {
+			header, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "error reading tar archive %s", backup)
+			}
+			err = fn(header.Name, header.FileInfo(), func() (io.ReadCloser, error) {
+				if header.Typeflag == tar.TypeSymlink {
+					// Same as zip, the content of symlink entry is the link target.
+					return io.NopCloser(strings.NewReader(header.Linkname)), nil
+				}
+				return io.NopCloser(r), nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	r, err := zip.OpenReader(backup)
+	if err != nil {
+		return errors.Wrapf(err, "error reading zip archive %s", backup)
+	}
+	defer r.Close()
+	for _, file := range r.File {
+		if err := fn(file.Name, file.FileInfo(), file.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package task
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testArchiveEntry an entry of the zip backup created by writeTestZip.
+type testArchiveEntry struct {
+	name string
+	// content the file content, or the link target of symlink.
+	content string
+	symlink bool
+}
+
+// writeTestZip creates a zip backup containing the entries, return its path.
+func writeTestZip(t *testing.T, entries ...testArchiveEntry) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "data.zip.sinbak")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		header.SetMode(0644)
+		if e.symlink {
+			header.SetMode(os.ModeSymlink | 0777)
+		}
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExtractArchiveEntryNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testArchiveEntry
+		entry   string
+		// want the extracted files relative to dest.
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "cleaned name",
+			entries: []testArchiveEntry{{name: "a/../b.txt", content: "b"}},
+			want:    []string{"b.txt"},
+		},
+		{
+			name:    "cleaned name matching entry",
+			entries: []testArchiveEntry{{name: "a/../b/./c.txt", content: "c"}, {name: "a/other.txt", content: "o"}},
+			entry:   "b",
+			want:    []string{"b/c.txt"},
+		},
+		{
+			name:    "parent",
+			entries: []testArchiveEntry{{name: "../evil.txt", content: "evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "parent once cleaned",
+			entries: []testArchiveEntry{{name: "a/../../evil.txt", content: "evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "absolute",
+			entries: []testArchiveEntry{{name: "/evil.txt", content: "evil"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := writeTestZip(t, tt.entries...)
+			root := t.TempDir()
+			dest := filepath.Join(root, "dest")
+
+			err := ExtractArchive(context.Background(), backup, tt.entry, dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(root, "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("entry is extracted outside dest")
+			}
+			for _, name := range tt.want {
+				if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name))); err != nil {
+					t.Errorf("entry %s is not extracted: %s", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSymlinks(t *testing.T) {
+	// outsideTarget replaced by the directory outside dest in the symlink targets.
+	const outsideTarget = "<outside>"
+	tests := []struct {
+		name    string
+		entries []testArchiveEntry
+		// existingLink the symlink to outside already existing in dest, empty if none.
+		existingLink string
+		wantErr      bool
+	}{
+		{
+			name:    "symlink",
+			entries: []testArchiveEntry{{name: "data/a.txt", content: "a"}, {name: "data/link", content: "a.txt", symlink: true}},
+		},
+		{
+			name:    "entry inside symlink",
+			entries: []testArchiveEntry{{name: "link", content: outsideTarget, symlink: true}, {name: "link/evil.txt", content: "evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "uncleaned entry inside symlink",
+			entries: []testArchiveEntry{{name: "link", content: outsideTarget, symlink: true}, {name: "b/../link/evil.txt", content: "evil"}},
+			wantErr: true,
+		},
+		{
+			name:         "entry inside existing symlink",
+			entries:      []testArchiveEntry{{name: "link/evil.txt", content: "evil"}},
+			existingLink: "link",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outside := t.TempDir()
+			for i, e := range tt.entries {
+				if e.symlink && e.content == outsideTarget {
+					tt.entries[i].content = outside
+				}
+			}
+			backup := writeTestZip(t, tt.entries...)
+			dest := t.TempDir()
+			if tt.existingLink != "" {
+				if err := os.Symlink(outside, filepath.Join(dest, tt.existingLink)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := ExtractArchive(context.Background(), backup, "", dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("entry is extracted outside dest through the symlink")
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, err := os.ReadFile(filepath.Join(dest, "data", "link")); err != nil || string(got) != "a" {
+				t.Errorf("symlink content = %q, %v, want %q", got, err, "a")
+			}
+		})
+	}
+}
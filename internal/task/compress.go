@@ -0,0 +1,242 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/mawngo/go-errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// compressExtByCmd file extension of supported external compression commands.
+var compressExtByCmd = map[string]string{
+	"gzip":   ".gz",
+	"pigz":   ".gz",
+	"lz4":    ".lz4",
+	"zstd":   ".zst",
+	"pzstd":  ".zst",
+	"xz":     ".xz",
+	"bzip2":  ".bz2",
+	"pbzip2": ".bz2",
+}
+
+// compressor compresses backup using an external compression command.
+// The command must compress stdin to stdout when called with `-c`.
+type compressor struct {
+	path string
+	ext  string
+	// priority the command prefix setting the CPU and IO priority, see core.App.PriorityArgs.
+	priority []string
+}
+
+func newCompressor(path string) (*compressor, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".exe")
+	ext, ok := compressExtByCmd[name]
+	if !ok {
+		return nil, errors.Newf("unsupported compress command '%s'", name)
+	}
+	p, err := exec.LookPath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid compress command")
+	}
+	return &compressor{path: p, ext: ext}, nil
+}
+
+// priorityCommand return the command run using the priority prefix, see core.App.PriorityArgs.
+func priorityCommand(ctx context.Context, priority []string, name string, args ...string) *exec.Cmd {
+	if len(priority) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	args = append(append(slices.Clone(priority[1:]), name), args...)
+	return exec.CommandContext(ctx, priority[0], args...)
+}
+
+// runCompressed runs the command, compressing its stdout into dest if the compressor is specified.
+func runCompressed(ctx context.Context, c *compressor, command *exec.Cmd, dest string) error {
+	if c == nil {
+		return command.Run()
+	}
+	return c.pipe(ctx, command, dest)
+}
+
+// runStreamed runs the command, writing its stdout (compressed if the compressor is specified) into out.
+func runStreamed(ctx context.Context, c *compressor, command *exec.Cmd, out io.Writer) error {
+	if c == nil {
+		command.Stdout = out
+		return command.Run()
+	}
+	return c.pipeTo(ctx, command, out)
+}
+
+// pipe runs the command, compressing its stdout into dest.
+func (c *compressor) pipe(ctx context.Context, command *exec.Cmd, dest string) (err error) {
+	out, err := os.Create(dest)
+	if err != nil {
+		return errors.Wrapf(err, "error creating file %s", dest)
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	if err := c.pipeTo(ctx, command, out); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// pipeTo runs the command, compressing its stdout into out.
+func (c *compressor) pipeTo(ctx context.Context, command *exec.Cmd, out io.Writer) (err error) {
+	compress := priorityCommand(ctx, c.priority, c.path, "-c")
+	compress.Stdout = out
+	compress.Stderr = os.Stderr
+	compress.Stdin, err = command.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := compress.Start(); err != nil {
+		return errors.Wrapf(err, "error starting compress command")
+	}
+	err = command.Run()
+	if cerr := compress.Wait(); cerr != nil {
+		err = errors.Join(err, errors.Wrapf(cerr, "error running compress command"))
+	}
+	return err
+}
+
+// compressFile compresses the src file into dest.
+func (c *compressor) compressFile(ctx context.Context, src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return errors.Wrapf(err, "error creating file %s", dest)
+	}
+	defer out.Close()
+
+	compress := priorityCommand(ctx, c.priority, c.path, "-c")
+	compress.Stdin = in
+	compress.Stdout = out
+	compress.Stderr = os.Stderr
+	if err := compress.Run(); err != nil {
+		return errors.Wrapf(err, "error running compress command")
+	}
+	return out.Sync()
+}
+
+// sampleRatio return the compressed/original size ratio of the first n bytes of the src file.
+func (c *compressor) sampleRatio(ctx context.Context, src string, n int64) (float64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	sample := &countingWriter{}
+	out := &countingWriter{}
+	compress := priorityCommand(ctx, c.priority, c.path, "-c")
+	compress.Stdin = io.TeeReader(io.LimitReader(in, n), sample)
+	compress.Stdout = out
+	compress.Stderr = os.Stderr
+	if err := compress.Run(); err != nil {
+		return 0, errors.Wrapf(err, "error running compress command")
+	}
+	if sample.n == 0 {
+		return 1, nil
+	}
+	return float64(out.n) / float64(sample.n), nil
+}
+
+// countingWriter discards the written bytes, only counting them.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// decompressFile decompresses the src file into dest.
+// Return the SHA256 checksum of the decompressed content.
+func (c *compressor) decompressFile(ctx context.Context, src string, dest string) ([]byte, error) {
+	out, err := os.Create(dest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating file %s", dest)
+	}
+	defer out.Close()
+
+	checksum, err := c.decompress(ctx, src, out)
+	if err != nil {
+		return nil, err
+	}
+	return checksum, out.Sync()
+}
+
+// decompress decompresses the src file into out.
+// Return the SHA256 checksum of the decompressed content.
+func (c *compressor) decompress(ctx context.Context, src string, out io.Writer) ([]byte, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	hash := sha256.New()
+	decompress := priorityCommand(ctx, c.priority, c.path, "-dc")
+	decompress.Stdin = in
+	decompress.Stdout = io.MultiWriter(out, hash)
+	decompress.Stderr = os.Stderr
+	if err := decompress.Run(); err != nil {
+		return nil, errors.Wrapf(err, "error running decompress command")
+	}
+	return hash.Sum(nil), nil
+}
+
+// compressCmdByMagic the decompression command of the file magic bytes.
+var compressCmdByMagic = map[string]string{
+	"\x1f\x8b":                 "gzip",
+	"\x04\x22\x4d\x18":         "lz4",
+	"\x28\xb5\x2f\xfd":         "zstd",
+	"\xfd\x37\x7a\x58\x5a\x00": "xz",
+	"BZh":                      "bzip2",
+}
+
+// detectCompressCmd return the decompression command of the file based on its magic bytes,
+// or empty if the file is not compressed.
+func detectCompressCmd(path string) (string, error) {
+	header, err := readFileHeader(path, 6)
+	if err != nil {
+		return "", err
+	}
+	for magic, cmd := range compressCmdByMagic {
+		if strings.HasPrefix(header, magic) {
+			return cmd, nil
+		}
+	}
+	return "", nil
+}
+
+// readFileHeader return the first n bytes of the file, or fewer if the file is smaller.
+func readFileHeader(path string, n int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	read, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return string(buf[:read]), nil
+}
@@ -1,100 +1,388 @@
 package task
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"encoding/hex"
 	"github.com/mawngo/go-errors"
 	"github.com/pterm/pterm"
+	"io"
 	"os"
 	"path/filepath"
 	"sin/internal/core"
 	"sin/internal/store"
 	"sin/internal/utils"
 	"strings"
-	"time"
 )
 
-var _ SyncTask = (*syncFile)(nil)
+var _ Source = (*fileSource)(nil)
 
-type syncFile struct {
-	app          *core.App
-	syncer       *store.Syncer
-	isDir        bool
-	destFileName string
+const (
+	defaultAutoCompressMaxRatio = 0.9
+	// autoCompressSampleSize the size of the sample for testing the compression ratio.
+	autoCompressSampleSize = 4 * 1024 * 1024
+)
+
+type fileSource struct {
+	app   *core.App
+	isDir bool
+	// archivePrefix the path of the source directory inside the archive.
+	archivePrefix string
+	filter        pathFilter
+	compressor    *compressor
 	SyncFileConfig
 }
 
+// StdinSource the source path reading the backup from stdin.
+const StdinSource = "-"
+
 type SyncFileConfig struct {
+	// SourcePath the file or directory to back up, or StdinSource to read the backup from stdin.
 	SourcePath string
-	Tag        string
+	// Ext the extension of the backup read from stdin (e.g. sql), as there is no file name to derive it from.
+	Ext string
+	// Stdin the reader of the stdin source, default os.Stdin.
+	Stdin io.Reader
+	Tags  []string
+	// CompressCmd external compression command (e.g. pigz, lz4) to compress the backup.
+	// By default, no compression is used.
+	CompressCmd string
+	// ArchiveRoot controls the structure of the directory backup archive:
+	// include-parent (default), contents-only, or a custom prefix path.
+	ArchiveRoot string
+	// Exclude glob patterns of paths to skip in directory backup, matched against the path relative to the source.
+	// A trailing '/' only matches directories, skipping their contents.
+	Exclude []string
+	// Include glob patterns of paths to keep in directory backup, keep all if empty.
+	// Exclude takes precedence over Include.
+	Include []string
+	// FollowSymlinks archives the contents of symlink targets in directory backup,
+	// instead of storing symlinks as symlink entries.
+	FollowSymlinks bool
+	// AutoCompress only keeps the backup compressed by CompressCmd if it is worth it:
+	// the backup is at least AutoCompressMinSize, and compresses below AutoCompressMaxRatio.
+	AutoCompress bool
+	// AutoCompressMinSize the minimum size in bytes of the backup to compress, used with AutoCompress.
+	AutoCompressMinSize int64
+	// AutoCompressMaxRatio the maximum compressed/original size ratio to keep the compressed backup, used with AutoCompress.
+	// The ratio is tested on a sample before compressing the whole backup. Default 0.9.
+	AutoCompressMaxRatio float64
+	// SourceChecksum the precomputed hex encoded checksum of the source in the checksum algorithm,
+	// used instead of computing the checksum of the backup. Only for a single file or stdin source,
+	// without compression or encryption, so the backup is the same as the source.
+	SourceChecksum string
+	// SourceChecksumFile the file containing the precomputed checksum of the source, alternative to SourceChecksum.
+	// The file contains only the checksum, or is in the sha256sum output format. It is read on each backup.
+	SourceChecksumFile string
+	// VerifySourceChecksum verifies the precomputed checksum once while creating the local backup,
+	// failing the backup on mismatch, instead of trusting it.
+	VerifySourceChecksum bool
+	// MinBackupBytes fails the backup if the created local backup is smaller than it, overriding the global
+	// minBackupBytes if specified.
+	MinBackupBytes int64
 }
 
 func NewSyncFile(app *core.App, syncer *store.Syncer, config SyncFileConfig) (SyncTask, error) {
 	isDir := false
+	isStdin := config.SourcePath == StdinSource
 	//nolint:revive
-	if info, err := os.Stat(config.SourcePath); err != nil {
+	if isStdin {
+		if err := validateStdinSource(app, &config); err != nil {
+			return nil, err
+		}
+	} else if config.Ext != "" {
+		return nil, errors.New("extension must only be specified for stdin source")
+	} else if info, err := os.Stat(config.SourcePath); err != nil {
 		return nil, errors.Wrapf(err, "invalid source file %s", config.SourcePath)
 	} else {
 		isDir = info.IsDir()
 	}
 
-	destFileName := app.Name
-	if config.Tag != "" {
-		destFileName = fmt.Sprintf("[%s] %s", config.Tag, destFileName)
-	}
+	ext := ""
+	prefix := ""
+	var filter pathFilter
 	if isDir {
-		destFileName += ".zip"
+		ext = ".zip"
+		var err error
+		if prefix, err = archivePrefix(config.SourcePath, config.ArchiveRoot); err != nil {
+			return nil, err
+		}
+		if filter, err = newPathFilter(config.Exclude, config.Include); err != nil {
+			return nil, err
+		}
 	} else {
+		if len(config.Exclude) > 0 || len(config.Include) > 0 {
+			return nil, errors.New("exclude and include patterns only apply to directory backup")
+		}
 		_, extname, hasExt := strings.Cut(filepath.Base(config.SourcePath), ".")
+		if isStdin {
+			extname, hasExt = config.Ext, config.Ext != ""
+		}
 		if hasExt {
-			destFileName += "." + extname
+			ext = "." + extname
 		}
 	}
 
-	return &syncFile{
+	var c *compressor
+	if config.CompressCmd != "" {
+		var err error
+		if c, err = newCompressor(config.CompressCmd); err != nil {
+			return nil, err
+		}
+		c.priority = app.PriorityArgs()
+		ext += c.ext
+	}
+	if config.AutoCompress {
+		if c == nil {
+			return nil, errors.New("auto compress requires a compress command")
+		}
+		if config.AutoCompressMaxRatio <= 0 {
+			config.AutoCompressMaxRatio = defaultAutoCompressMaxRatio
+		}
+		if config.AutoCompressMaxRatio > 1 {
+			return nil, errors.New("auto compress ratio must not be greater than 1")
+		}
+	}
+
+	if err := validateSourceChecksum(app, isDir, &config); err != nil {
+		return nil, err
+	}
+
+	source := &fileSource{
 		app:            app,
-		syncer:         syncer,
 		isDir:          isDir,
-		destFileName:   destFileName + core.BackupFileExt,
+		archivePrefix:  prefix,
+		filter:         filter,
+		compressor:     c,
 		SyncFileConfig: config,
-	}, nil
+	}
+	taskConfig := sourceTaskConfig{
+		Tags:           config.Tags,
+		Ext:            ext,
+		MinBackupBytes: config.MinBackupBytes,
+	}
+	if config.AutoCompress {
+		// The backups not worth compressing are named without the compression extension.
+		taskConfig.OptionalExt = c.ext
+	}
+	return newSourceTask(app, syncer, source, taskConfig)
 }
 
-func (f *syncFile) ExecSync() error {
-	prefix := ""
-	if f.Tag != "" {
-		prefix = fmt.Sprintf("[%s]: ", f.Tag)
+// validateStdinSource check that the stdin source can be backed up, normalizing its extension.
+// The backup must be named, as there is no file name to derive it from,
+// and it cannot be scheduled, as stdin can only be read once.
+func validateStdinSource(app *core.App, config *SyncFileConfig) error {
+	if app.Name == core.DefaultAppName {
+		return errors.New("stdin source requires a name, specify --name or name in config")
+	}
+	if app.Frequency != "" {
+		return errors.New("stdin source must not be used with frequency, as stdin can only be read once")
+	}
+	config.Ext = strings.TrimPrefix(config.Ext, ".")
+	if strings.ContainsAny(config.Ext, `/\`) {
+		return errors.Newf("invalid extension '%s'", config.Ext)
+	}
+	if config.Stdin == nil {
+		config.Stdin = os.Stdin
+	}
+	return nil
+}
+
+// validateSourceChecksum check that the precomputed checksum of the source can be used for the backup,
+// normalizing the checksum.
+func validateSourceChecksum(app *core.App, isDir bool, config *SyncFileConfig) error {
+	if config.SourceChecksum == "" && config.SourceChecksumFile == "" {
+		if config.VerifySourceChecksum {
+			return errors.New("verify source checksum requires a source checksum or source checksum file")
+		}
+		return nil
+	}
+	if config.SourceChecksum != "" && config.SourceChecksumFile != "" {
+		return errors.New("source checksum and source checksum file must not be used together")
+	}
+	if isDir {
+		return errors.New("source checksum must not be used with directory backup, as the backup is an archive of the source")
+	}
+	if config.CompressCmd != "" {
+		return errors.New("source checksum must not be used with compression, as the backup differs from the source")
+	}
+	if app.EncryptionPassphrase() != nil || app.AgeRecipientKeys() != nil {
+		return errors.New("source checksum must not be used with encryption, as the backup differs from the source")
+	}
+	if config.SourceChecksum != "" {
+		if app.Frequency != "" {
+			return errors.New("source checksum must not be used with frequency, as it only matches one backup, use source checksum file instead")
+		}
+		checksum, err := utils.ParseChecksum(config.SourceChecksum, app.ChecksumAlgo)
+		if err != nil {
+			return err
+		}
+		config.SourceChecksum = hex.EncodeToString(checksum)
 	}
+	return nil
+}
+
+// sourceChecksum return the precomputed checksum of the source, or nil if not specified.
+func (f *fileSource) sourceChecksum() ([]byte, error) {
+	if f.SourceChecksumFile != "" {
+		checksum, err := utils.ReadChecksumFile(f.SourceChecksumFile, f.app.ChecksumAlgo)
+		return checksum, errors.Wrapf(err, "error reading source checksum file %s", f.SourceChecksumFile)
+	}
+	if f.SourceChecksum != "" {
+		return hex.DecodeString(f.SourceChecksum)
+	}
+	return nil, nil
+}
 
-	dest := filepath.Join(f.app.Config.BackupTempDir, f.destFileName)
-	pterm.Printf("%sCreating local backup %s\n", prefix, f.destFileName)
-	if err := removeIfExist(dest); err != nil {
-		return errors.Wrapf(err, "error local backup with same name exist")
+// copySource copies the single file or stdin source to the archive,
+// return the checksum of the source if the precomputed source checksum is to be verified, otherwise nil.
+func (f *fileSource) copySource(ctx context.Context, archive string) ([]byte, error) {
+	in := f.Stdin
+	if f.SourcePath != StdinSource {
+		file, err := os.Open(f.SourcePath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+	if !f.VerifySourceChecksum {
+		return nil, utils.CopyToFile(ctx, in, archive)
+	}
+	h := utils.NewChecksumHash(f.app.ChecksumAlgo)
+	if err := utils.CopyToFile(ctx, io.TeeReader(in, h), archive); err != nil {
+		return nil, err
 	}
+	return h.Sum(nil), nil
+}
 
-	start := time.Now()
+func (f *fileSource) Produce(ctx context.Context, dest string) (SourceBackup, error) {
+	prefix := logPrefix(f.Tags)
+	plain := dest
+	if f.compressor != nil {
+		// Create the uncompressed backup first, then compress it into dest.
+		plain = strings.TrimSuffix(dest, f.compressor.ext+core.BackupFileExt) + core.BackupFileExt
+		if err := removeIfExist(plain); err != nil {
+			return SourceBackup{}, errors.Wrapf(err, "error local backup with same name exist")
+		}
+	}
+
+	sourceChecksum, err := f.sourceChecksum()
+	if err != nil {
+		return SourceBackup{}, err
+	}
+
+	archive := plain
+	if f.compressor != nil {
+		archive = plain + utils.PartialExt
+	}
+	f.app.TrackTempFile(plain, archive)
+	// keepErrored keeps the uncompressed archive of the failed backup as errored for inspection.
+	// Without compression, the archive is the backup, which is renamed as errored by the task.
+	keepErrored := func() {
+		if archive == dest {
+			return
+		}
+		trackDumpBackup(f.app, plain)
+		if err := os.Rename(archive, plain); err != nil {
+			_ = os.Remove(archive)
+			return
+		}
+		if err := renameErrored(plain, f.app.ErrorDir); err != nil {
+			pterm.Warning.Printf("%sFailed to rename errored backup %s\n", prefix, filepath.Base(plain))
+		}
+	}
 	if f.isDir {
-		if err := zipDir(f.SourcePath, dest); err != nil {
-			_ = os.Remove(dest)
-			return errors.Wrapf(err, "error creating backup")
+		if err := zipDir(f.SourcePath, archive, f.archivePrefix, f.filter, f.FollowSymlinks); err != nil {
+			keepErrored()
+			return SourceBackup{}, errors.Wrapf(err, "error creating backup")
 		}
 	} else {
-		if err := utils.CopyFile(f.app.Ctx, f.SourcePath, dest); err != nil {
-			_ = os.Remove(dest)
-			return errors.Wrapf(err, "error creating backup")
+		checksum, err := f.copySource(ctx, archive)
+		if err != nil {
+			keepErrored()
+			if f.SourcePath == StdinSource {
+				return SourceBackup{}, errors.Wrapf(err, "error reading backup from stdin")
+			}
+			return SourceBackup{}, errors.Wrapf(err, "error creating backup")
+		}
+		if checksum != nil && !bytes.Equal(checksum, sourceChecksum) {
+			keepErrored()
+			return SourceBackup{}, errors.Wrapf(utils.ErrChecksumMismatch, "source checksum %s does not match the backup checksum %s",
+				hex.EncodeToString(sourceChecksum), hex.EncodeToString(checksum))
 		}
 	}
-	pterm.Printf("%sLocal backup %s created took %s\n", prefix, f.destFileName, time.Since(start).String())
-	if f.syncer.AdaptersCount() == 0 {
-		pterm.Printf("%sLocal backup are kept as there are no targets configured\n", prefix)
-		return utils.CreateFileSHA256Checksum(dest)
+	compressed := f.compressor != nil
+	if compressed && f.AutoCompress {
+		var err error
+		if compressed, err = f.autoCompress(ctx, archive, dest, prefix); err != nil {
+			_ = os.Remove(archive)
+			return SourceBackup{}, err
+		}
+		if !compressed {
+			// Name the uncompressed backup without the compression extension, so extension based tools handle it.
+			// The task counts the backups with and without the extension together by keep.
+			if err := os.Rename(archive, plain); err != nil {
+				_ = os.Remove(archive)
+				return SourceBackup{}, errors.Wrapf(err, "error creating backup")
+			}
+			dest = plain
+		}
+	} else if compressed {
+		err := f.compressor.compressFile(ctx, archive, dest)
+		_ = os.Remove(archive)
+		if err != nil {
+			return SourceBackup{}, errors.Wrapf(err, "error compressing backup")
+		}
 	}
-	err := f.syncer.Sync(f.app.Ctx, dest, start)
-	if !f.app.KeepTempFile {
-		err = errors.Join(err, os.Remove(dest))
-	} else {
-		err = errors.Join(err, utils.CreateFileSHA256Checksum(dest))
-		pterm.Printf("%sLocal backup are kept\n", prefix)
+
+	metadata := utils.BackupMetadata{
+		Engine: SourceTypeFile,
+		Source: f.SourcePath,
+	}
+	if f.isDir {
+		metadata.Format = "zip"
+	}
+	if compressed {
+		metadata.Compression = filepath.Base(f.compressor.path)
+	}
+	return SourceBackup{Path: dest, Metadata: metadata, Checksum: sourceChecksum}, nil
+}
+
+// autoCompress compresses the archive into dest if it is worth it, based on the size and compression ratio.
+// The compressed archive is removed if it is not worth it.
+// Return whether the archive is compressed into dest, the archive is removed if so.
+func (f *fileSource) autoCompress(ctx context.Context, archive string, dest string, prefix string) (bool, error) {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading backup")
+	}
+	if info.Size() < f.AutoCompressMinSize {
+		pterm.Printf("%sSkip compressing backup smaller than %s\n", prefix, utils.FormatBytes(f.AutoCompressMinSize))
+		return false, nil
+	}
+	ratio, err := f.compressor.sampleRatio(ctx, archive, autoCompressSampleSize)
+	if err != nil {
+		return false, errors.Wrapf(err, "error compressing backup sample")
+	}
+	if ratio > f.AutoCompressMaxRatio {
+		pterm.Printf("%sSkip compressing backup as sample compression ratio %.2f > %.2f\n", prefix, ratio, f.AutoCompressMaxRatio)
+		return false, nil
+	}
+
+	if err := f.compressor.compressFile(ctx, archive, dest); err != nil {
+		_ = os.Remove(dest)
+		return false, errors.Wrapf(err, "error compressing backup")
+	}
+	compressedInfo, err := os.Stat(dest)
+	if err != nil {
+		_ = os.Remove(dest)
+		return false, errors.Wrapf(err, "error reading compressed backup")
+	}
+	ratio = float64(compressedInfo.Size()) / float64(max(info.Size(), 1))
+	if ratio > f.AutoCompressMaxRatio {
+		pterm.Printf("%sDiscard compressed backup as compression ratio %.2f > %.2f\n", prefix, ratio, f.AutoCompressMaxRatio)
+		return false, os.Remove(dest)
 	}
-	pterm.Printf("%sSync %s finished\n", prefix, f.destFileName)
-	return err
+	return true, os.Remove(archive)
 }
@@ -0,0 +1,315 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/utils"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFileSourceAutoCompress(t *testing.T) {
+	c, err := newCompressor("gzip")
+	if err != nil {
+		t.Skip("gzip is not available:", err)
+	}
+	compressible := bytes.Repeat([]byte("backup content "), 64*1024)
+	incompressible := make([]byte, len(compressible))
+	if _, err := rand.Read(incompressible); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		content        []byte
+		minSize        int64
+		wantCompressed bool
+	}{
+		{name: "above threshold", content: compressible, minSize: 1024, wantCompressed: true},
+		{name: "below threshold", content: compressible, minSize: int64(len(compressible)) + 1},
+		{name: "incompressible", content: incompressible, minSize: 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "data.db")
+			if err := os.WriteFile(source, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			f := &fileSource{
+				app:        &core.App{},
+				compressor: c,
+				SyncFileConfig: SyncFileConfig{
+					SourcePath:           source,
+					AutoCompress:         true,
+					AutoCompressMinSize:  tt.minSize,
+					AutoCompressMaxRatio: defaultAutoCompressMaxRatio,
+				},
+			}
+			dest := filepath.Join(dir, "data.db.gz"+core.BackupFileExt)
+
+			backup, err := f.Produce(context.Background(), dest)
+			if err != nil {
+				t.Fatalf("Produce() error = %s", err)
+			}
+			// The uncompressed backup is named without the compression extension.
+			want := filepath.Join(dir, "data.db"+core.BackupFileExt)
+			if tt.wantCompressed {
+				want = dest
+			}
+			if backup.Path != want {
+				t.Errorf("backup path = %s, want %s", backup.Path, want)
+			}
+			cmd, err := detectCompressCmd(backup.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed := cmd != ""; compressed != tt.wantCompressed {
+				t.Errorf("backup compressed = %v, want %v", compressed, tt.wantCompressed)
+			}
+			if compressed := backup.Metadata.Compression != ""; compressed != tt.wantCompressed {
+				t.Errorf("metadata compression = %q, want compressed %v", backup.Metadata.Compression, tt.wantCompressed)
+			}
+			if !tt.wantCompressed {
+				content, err := os.ReadFile(backup.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(content, tt.content) {
+					t.Errorf("uncompressed backup differs from the source")
+				}
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("files left = %d, want the source and the backup only", len(entries))
+			}
+		})
+	}
+}
+
+func TestSyncFileAutoCompressKeep(t *testing.T) {
+	if _, err := newCompressor("gzip"); err != nil {
+		t.Skip("gzip is not available:", err)
+	}
+	source := filepath.Join(t.TempDir(), "data.db")
+	if err := os.WriteFile(source, []byte("small backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	targetDir := t.TempDir()
+	old := []string{"260101_0000_db.db.gz" + core.BackupFileExt, "260102_0000_db.db" + core.BackupFileExt, "260103_0000_db.db.gz" + core.BackupFileExt}
+	for _, name := range old {
+		if err := os.WriteFile(filepath.Join(targetDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := newTestApp(t, map[string]any{"type": "file", "name": "local", "dir": targetDir})
+	app.Keep = 3
+	syncer, err := store.NewSyncer(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := NewSyncFile(app, syncer, SyncFileConfig{
+		SourcePath:          source,
+		CompressCmd:         "gzip",
+		AutoCompress:        true,
+		AutoCompressMinSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("NewSyncFile() error = %s", err)
+	}
+
+	if err := task.ExecSync(); err != nil {
+		t.Fatalf("ExecSync() error = %s", err)
+	}
+	names, err := utils.ListFileNames(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backups with and without the compression extension are counted together.
+	backups := utils.FilterBackupFileNames(names, "db.db(.gz)?")
+	if len(backups) != 3 || !slices.Equal(backups[:2], old[1:]) || !strings.HasSuffix(backups[2], "_db.db"+core.BackupFileExt) {
+		t.Errorf("backups left = %v, want %v and the new uncompressed backup", backups, old[1:])
+	}
+}
+
+func TestSyncFileStdin(t *testing.T) {
+	content := []byte("piped backup content")
+	targetDir := t.TempDir()
+	app := newTestApp(t, map[string]any{"type": "file", "name": "local", "dir": targetDir})
+	syncer, err := store.NewSyncer(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := NewSyncFile(app, syncer, SyncFileConfig{
+		SourcePath: StdinSource,
+		Ext:        ".sql",
+		Stdin:      bytes.NewReader(content),
+	})
+	if err != nil {
+		t.Fatalf("NewSyncFile() error = %s", err)
+	}
+	if want := "db.sql" + core.BackupFileExt; task.DestFileName() != want {
+		t.Errorf("DestFileName() = %s, want %s", task.DestFileName(), want)
+	}
+
+	if err := task.ExecSync(); err != nil {
+		t.Fatalf("ExecSync() error = %s", err)
+	}
+	names, err := utils.ListFileNames(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := utils.FilterBackupFileNames(names, strings.TrimSuffix(task.DestFileName(), core.BackupFileExt))
+	if len(saved) != 1 {
+		t.Fatalf("saved backups = %v, want 1", names)
+	}
+	if got, _ := os.ReadFile(filepath.Join(targetDir, saved[0])); !bytes.Equal(got, content) {
+		t.Errorf("saved backup = %q, want %q", got, content)
+	}
+}
+
+func TestNewSyncFileStdinInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config SyncFileConfig
+		setup  func(app *core.App)
+	}{
+		{
+			name:   "default name",
+			config: SyncFileConfig{SourcePath: StdinSource},
+			setup:  func(app *core.App) { app.Name = core.DefaultAppName },
+		},
+		{
+			name:   "frequency",
+			config: SyncFileConfig{SourcePath: StdinSource},
+			setup:  func(app *core.App) { app.Frequency = "1h" },
+		},
+		{
+			name:   "invalid extension",
+			config: SyncFileConfig{SourcePath: StdinSource, Ext: "a/b"},
+		},
+		{
+			name:   "extension of a file source",
+			config: SyncFileConfig{SourcePath: "file_test.go", Ext: "sql"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			if tt.setup != nil {
+				tt.setup(app)
+			}
+			tt.config.Stdin = bytes.NewReader(nil)
+			if _, err := NewSyncFile(app, nil, tt.config); err == nil {
+				t.Errorf("NewSyncFile() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSyncFileErrored(t *testing.T) {
+	tests := []struct {
+		name        string
+		compressCmd string
+		errorDir    bool
+		// config return the config of the failing backup.
+		config func(t *testing.T) SyncFileConfig
+		// wantErrored the name of the errored backup.
+		wantErrored string
+	}{
+		{
+			name:        "failed reading",
+			config:      failingStdinConfig,
+			wantErrored: "db.sql.sinbak.error",
+		},
+		{
+			name:        "failed reading with compression",
+			compressCmd: "gzip",
+			config:      failingStdinConfig,
+			wantErrored: "db.sql.sinbak.error",
+		},
+		{
+			name:        "failed reading into error dir",
+			errorDir:    true,
+			config:      failingStdinConfig,
+			wantErrored: "db.sql.sinbak.error",
+		},
+		{
+			name: "source checksum mismatch",
+			config: func(t *testing.T) SyncFileConfig {
+				source := filepath.Join(t.TempDir(), "data.db")
+				if err := os.WriteFile(source, []byte("backup content"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				checksum := sha256.Sum256([]byte("other content"))
+				return SyncFileConfig{SourcePath: source, SourceChecksum: hex.EncodeToString(checksum[:]), VerifySourceChecksum: true}
+			},
+			wantErrored: "db.db.sinbak.error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.compressCmd != "" {
+				if _, err := newCompressor(tt.compressCmd); err != nil {
+					t.Skip(tt.compressCmd, "is not available:", err)
+				}
+			}
+			app := newTestApp(t, map[string]any{"type": "file", "name": "local", "dir": t.TempDir()})
+			errorDir := app.BackupTempDir
+			if tt.errorDir {
+				errorDir = t.TempDir()
+				app.ErrorDir = errorDir
+			}
+			syncer, err := store.NewSyncer(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := tt.config(t)
+			config.CompressCmd = tt.compressCmd
+			task, err := NewSyncFile(app, syncer, config)
+			if err != nil {
+				t.Fatalf("NewSyncFile() error = %s", err)
+			}
+
+			if err := task.ExecSync(); err == nil {
+				t.Fatalf("ExecSync() error = nil, want error")
+			}
+			errored, err := utils.ListFileNames(errorDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(errored, []string{tt.wantErrored}) {
+				t.Errorf("errored files = %v, want %v", errored, []string{tt.wantErrored})
+			}
+			if !tt.errorDir {
+				return
+			}
+			if local, _ := utils.ListFileNames(app.BackupTempDir); len(local) > 0 {
+				t.Errorf("local files = %v, want moved to the error dir", local)
+			}
+		})
+	}
+}
+
+// failingStdinConfig return the config of the stdin source failing after reading part of the backup.
+func failingStdinConfig(*testing.T) SyncFileConfig {
+	return SyncFileConfig{
+		SourcePath: StdinSource,
+		Ext:        "sql",
+		Stdin:      io.MultiReader(strings.NewReader("partial backup"), iotest.ErrReader(errors.New("broken pipe"))),
+	}
+}
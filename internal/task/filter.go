@@ -0,0 +1,56 @@
+package task
+
+import (
+	"github.com/mawngo/go-errors"
+	"path"
+	"strings"
+)
+
+// pathFilter filters the paths of a directory backup using glob patterns.
+// Patterns are matched against the slash separated path relative to the source root,
+// patterns without '/' are also matched against the base name at any depth (*.log),
+// and patterns with a trailing '/' only match directories, including their contents (cache/).
+type pathFilter struct {
+	// exclude skips the matched paths, takes precedence over include.
+	exclude []string
+	// include only keeps the matched files, or files inside the matched directories.
+	// Keep all files if empty.
+	include []string
+}
+
+func newPathFilter(exclude []string, include []string) (pathFilter, error) {
+	for _, pattern := range append(append([]string{}, exclude...), include...) {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return pathFilter{}, errors.Wrapf(err, "invalid pattern '%s'", pattern)
+		}
+	}
+	return pathFilter{exclude: exclude, include: include}, nil
+}
+
+// excluded whether the path, relative to the source root, matches any exclude pattern.
+func (f pathFilter) excluded(rel string, isDir bool) bool {
+	return matchAny(f.exclude, rel, isDir)
+}
+
+// included whether the path is matched by the include patterns.
+// inDir whether the parent directory is already included.
+func (f pathFilter) included(rel string, isDir bool, inDir bool) bool {
+	return len(f.include) == 0 || inDir || matchAny(f.include, rel, isDir)
+}
+
+func matchAny(patterns []string, rel string, isDir bool) bool {
+	for _, pattern := range patterns {
+		pattern, dirOnly := strings.CutSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
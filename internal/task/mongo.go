@@ -1,10 +1,9 @@
 package task
 
 import (
-	"fmt"
+	"context"
 	"github.com/mawngo/go-errors"
-	"github.com/pterm/pterm"
-	"log/slog"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,44 +11,41 @@
 	"sin/internal/store"
 	"sin/internal/utils"
 	"strings"
-	"time"
 )
 
-var _ SyncTask = (*syncMongo)(nil)
+var _ StreamSource = (*mongoSource)(nil)
 
 type SyncMongoConfig struct {
 	URI           string
 	MongodumpPath string
 	EnableGzip    bool
-	Tag           string
+	Tags          []string
+	// CompressCmd external compression command (e.g. pigz, lz4) to compress the mongodump archive.
+	// Cannot be used with gzip.
+	CompressCmd string
+	// DumpArgs additional args passed to mongodump, appended after the sin managed args.
+	// Must not override the output, compression, config or uri flags.
+	DumpArgs []string
+	// Stream streams the mongodump archive to the targets without creating a local backup.
+	Stream bool
+	// MinBackupBytes fails the backup if the created local backup is smaller than it, overriding the global
+	// minBackupBytes if specified. Not checked when streaming.
+	MinBackupBytes int64
 }
 
-type syncMongo struct {
+type mongoSource struct {
 	app           *core.App
-	syncer        *store.Syncer
 	useConfigFile bool
-	destFileName  string
+	compressor    *compressor
 	SyncMongoConfig
 }
 
 func NewSyncMongo(app *core.App, syncer *store.Syncer, config SyncMongoConfig) (SyncTask, error) {
-	useConfigFile := false
-	if !isMongoConnectionString(config.URI) {
-		if err := validateFilePath(config.URI, "mongo config"); err != nil {
-			return nil, err
-		}
-		v, err := readFileTrim(config.URI)
-		if err != nil {
-			return nil, err
-		}
-
-		// Support connection string in a text file, not necessary mongo config file format.
-		if isMongoConnectionString(v) {
-			config.URI = v
-		} else {
-			useConfigFile = true
-		}
+	uri, useConfigFile, err := resolveMongoURI(config.URI)
+	if err != nil {
+		return nil, err
 	}
+	config.URI = uri
 
 	if config.MongodumpPath != "" && strings.ContainsRune(config.MongodumpPath, os.PathSeparator) {
 		if err := validateFilePath(config.MongodumpPath, "mongodump"); err != nil {
@@ -59,36 +55,71 @@ func NewSyncMongo(app *core.App, syncer *store.Syncer, config SyncMongoConfig) (
 		config.MongodumpPath = "mongodump"
 	}
 
-	destFileName := app.Name
-	if config.Tag != "" {
-		destFileName = fmt.Sprintf("[%s] %s", config.Tag, destFileName)
-	}
+	ext := ""
 	if config.EnableGzip {
-		destFileName += ".gz"
+		ext = ".gz"
+	}
+
+	if err := validateDumpArgs(config.DumpArgs, "--archive", "--out", "-o", "--gzip", "--config", "--uri"); err != nil {
+		return nil, err
+	}
+
+	var c *compressor
+	if config.CompressCmd != "" {
+		if config.EnableGzip {
+			return nil, errors.New("compress command must not be used with gzip")
+		}
+		if c, err = newCompressor(config.CompressCmd); err != nil {
+			return nil, err
+		}
+		c.priority = app.PriorityArgs()
+		ext += c.ext
 	}
 
-	return &syncMongo{
+	source := &mongoSource{
 		app:             app,
-		syncer:          syncer,
 		SyncMongoConfig: config,
 		useConfigFile:   useConfigFile,
-		destFileName:    destFileName + core.BackupFileExt,
-	}, nil
+		compressor:      c,
+	}
+	return newSourceTask(app, syncer, source, sourceTaskConfig{
+		Tags:           config.Tags,
+		Ext:            ext,
+		Stream:         config.Stream,
+		MinBackupBytes: config.MinBackupBytes,
+	})
+}
+
+// resolveMongoURI return the connection string uri, or the mongo config file path and true if the uri is a config file.
+// The file may also contain just the connection string.
+func resolveMongoURI(uri string) (string, bool, error) {
+	if isMongoConnectionString(uri) {
+		return uri, false, nil
+	}
+	if err := validateFilePath(uri, "mongo config"); err != nil {
+		return "", false, err
+	}
+	v, err := readFileTrim(uri)
+	if err != nil {
+		return "", false, err
+	}
+	// Support connection string in a text file, not necessary mongo config file format.
+	if isMongoConnectionString(v) {
+		return v, false, nil
+	}
+	return uri, true, nil
 }
 
 func isMongoConnectionString(uri string) bool {
 	return strings.HasPrefix(uri, "mongodb://") || strings.HasPrefix(uri, "mongodb+srv://")
 }
 
-func (f *syncMongo) ExecSync() error {
-	prefix := ""
-	if f.Tag != "" {
-		prefix = fmt.Sprintf("[%s]: ", f.Tag)
-	}
-
-	dest := filepath.Join(f.app.Config.BackupTempDir, f.destFileName)
-	dumpArgs := []string{
-		"--archive=" + dest,
+// dumpCommand return the mongodump command writing the archive to out, or to stdout if out is empty.
+func (f *mongoSource) dumpCommand(ctx context.Context, out string) *exec.Cmd {
+	// Write the archive to stdout if compress command is used.
+	dumpArgs := []string{"--archive"}
+	if f.compressor == nil && out != "" {
+		dumpArgs = []string{"--archive=" + out}
 	}
 	if f.EnableGzip {
 		dumpArgs = append(dumpArgs, "--gzip")
@@ -98,37 +129,38 @@ func (f *syncMongo) ExecSync() error {
 	} else {
 		dumpArgs = append(dumpArgs, f.URI)
 	}
+	dumpArgs = append(dumpArgs, f.DumpArgs...)
 
-	command := exec.CommandContext(f.app.Ctx, f.MongodumpPath, dumpArgs...)
+	command := priorityCommand(ctx, f.app.PriorityArgs(), f.MongodumpPath, dumpArgs...)
 	command.Stderr = os.Stderr
-	pterm.Printf("%sCreating local backup %s\n", prefix, f.destFileName)
-	if err := removeIfExist(dest); err != nil {
-		return errors.Wrapf(err, "error local backup with same name exist")
-	}
+	return command
+}
 
-	start := time.Now()
-	if err := command.Run(); err != nil {
-		if err := os.Rename(dest, dest+".error"); err != nil {
-			pterm.Warning.Printf("%sFailed to rename errored backup %s\n", prefix, f.destFileName)
-		}
-		return errors.Wrapf(err, "error running mongodump")
+func (f *mongoSource) ProduceStream(ctx context.Context, w io.Writer) error {
+	if err := runStreamed(ctx, f.compressor, f.dumpCommand(ctx, ""), w); err != nil {
+		return errors.Wrapf(errors.Join(ErrDumpFailed, err), "error running mongodump")
 	}
-	pterm.Printf("%sLocal backup %s created took %s\n", prefix, f.destFileName, time.Since(start).String())
+	return nil
+}
 
-	slog.Info(fmt.Sprintf("%sLocal backup created", prefix),
-		slog.String("name", f.app.Name),
-		slog.String("took", time.Since(start).String()))
-	if f.syncer.AdaptersCount() == 0 {
-		pterm.Printf("%sLocal backup are kept as there are no targets configured\n", prefix)
-		return utils.CreateFileSHA256Checksum(dest)
+func (f *mongoSource) Produce(ctx context.Context, dest string) (SourceBackup, error) {
+	if err := runCompressed(ctx, f.compressor, f.dumpCommand(ctx, dest), dest); err != nil {
+		return SourceBackup{}, errors.Wrapf(errors.Join(ErrDumpFailed, err), "error running mongodump")
 	}
-	err := f.syncer.Sync(f.app.Ctx, dest, start)
-	if !f.app.KeepTempFile {
-		err = errors.Join(err, os.Remove(dest))
-	} else {
-		err = errors.Join(err, utils.CreateFileSHA256Checksum(dest))
-		pterm.Printf("%sLocal backup are kept\n", prefix)
+	metadata := utils.BackupMetadata{
+		Engine: SourceTypeMongo,
+		Format: "archive",
+	}
+	if !f.useConfigFile {
+		metadata.Source = redactURI(f.URI)
+	}
+	if f.EnableGzip {
+		metadata.Compression = "gzip"
+	} else if f.compressor != nil {
+		metadata.Compression = filepath.Base(f.compressor.path)
+	}
+	if f.app.WriteMetadata {
+		metadata.EngineVersion = dumpVersion(ctx, f.MongodumpPath)
 	}
-	pterm.Printf("%sSync %s finished\n", prefix, f.destFileName)
-	return err
+	return SourceBackup{Path: dest, Metadata: metadata}, nil
 }
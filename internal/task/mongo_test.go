@@ -0,0 +1,58 @@
+package task
+
+import (
+	"context"
+	"sin/internal/store"
+	"slices"
+	"testing"
+)
+
+func TestNewSyncMongoDumpArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		dumpArgs []string
+		wantErr  bool
+	}{
+		{name: "passthrough", dumpArgs: []string{"--db=app", "--excludeCollection=logs"}},
+		{name: "archive", dumpArgs: []string{"--archive=other.archive"}, wantErr: true},
+		{name: "out", dumpArgs: []string{"-o", "dump"}, wantErr: true},
+		{name: "gzip", dumpArgs: []string{"--gzip"}, wantErr: true},
+		{name: "uri", dumpArgs: []string{"--uri=mongodb://other:27017"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			syncer, err := store.NewSyncer(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewSyncMongo(app, syncer, SyncMongoConfig{
+				URI:      "mongodb://localhost:27017",
+				DumpArgs: tt.dumpArgs,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSyncMongo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMongoSourceDumpCommandArgs(t *testing.T) {
+	f := &mongoSource{
+		app: newTestApp(t),
+		SyncMongoConfig: SyncMongoConfig{
+			URI:           "mongodb://localhost:27017",
+			MongodumpPath: "mongodump",
+			DumpArgs:      []string{"--db=app", "--excludeCollection=logs"},
+		},
+	}
+
+	args := f.dumpCommand(context.Background(), "db.sinbak").Args
+	if !slices.Contains(args, "--archive=db.sinbak") {
+		t.Errorf("mongodump args = %v, want the managed --archive=db.sinbak", args)
+	}
+	// Passthrough args are appended after the sin managed args.
+	if !slices.Equal(args[len(args)-2:], f.DumpArgs) {
+		t.Errorf("mongodump args = %v, want ending with %v", args, f.DumpArgs)
+	}
+}
@@ -0,0 +1,88 @@
+package task
+
+import (
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sin/internal/core"
+	"strings"
+	"time"
+)
+
+type RestoreMongoConfig struct {
+	// URI the connection string uri, or a mongo config file, or a file containing the uri.
+	URI              string
+	MongorestorePath string
+	// Drop drops each collection before restoring it.
+	Drop bool
+	// NSInclude namespaces (db.collection, wildcard supported) to restore, restore all if empty.
+	NSInclude []string
+	// RestoreArgs additional args passed to mongorestore, appended after the sin managed args.
+	RestoreArgs []string
+}
+
+// RestoreMongo restores the local mongodump archive backup into the database.
+// Archives compressed by mongodump (.gz) are restored using --gzip,
+// archives compressed by an external compression command are decompressed first.
+func RestoreMongo(app *core.App, backup string, config RestoreMongoConfig) error {
+	uri, useConfigFile, err := resolveMongoURI(config.URI)
+	if err != nil {
+		return err
+	}
+	if config.MongorestorePath == "" {
+		config.MongorestorePath = "mongorestore"
+	}
+	if err := validateDumpArgs(config.RestoreArgs, "--archive", "--gzip", "--config", "--uri"); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp(app.BackupTempDir, ".sin-"+app.Name+"-restore-")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temp directory")
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	src, err := decompressBackup(app.Ctx, backup, dir)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"--archive=" + src}
+	// Archive is compressed by mongodump, which is not detectable by the file header.
+	if src == backup && strings.HasSuffix(strings.TrimSuffix(backup, core.BackupFileExt), ".gz") {
+		args = append(args, "--gzip")
+	}
+	if config.Drop {
+		args = append(args, "--drop")
+	}
+	for _, ns := range config.NSInclude {
+		args = append(args, "--nsInclude="+ns)
+	}
+	if useConfigFile {
+		args = append(args, "--config", uri)
+	} else {
+		args = append(args, uri)
+	}
+	args = append(args, config.RestoreArgs...)
+
+	command := exec.CommandContext(app.Ctx, config.MongorestorePath, args...)
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	start := time.Now()
+	pterm.Printf("Restoring %s using %s\n", filepath.Base(backup), filepath.Base(command.Path))
+	if err := command.Run(); err != nil {
+		return errors.Wrapf(err, "error running %s", filepath.Base(command.Path))
+	}
+	pterm.Success.Println("Restored", filepath.Base(backup), "took", time.Since(start).String())
+	slog.Info("Restored mongo backup",
+		slog.String("name", app.Name),
+		slog.String("backup", backup),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
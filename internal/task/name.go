@@ -0,0 +1,61 @@
+package task
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SourceTypeFile     = "file"
+	SourceTypePostgres = "pg"
+	SourceTypeMongo    = "mongo"
+)
+
+// DeriveSourceName return the backup name derived from the source,
+// or empty if the name cannot be derived.
+//
+// For file source, it is the file/directory name without extension.
+// For database source, it is the database name in the connection string uri, or the postgres service name.
+func DeriveSourceName(sourceType string, source string) string {
+	switch sourceType {
+	case SourceTypeFile:
+		if source == StdinSource {
+			return ""
+		}
+		name, _, _ := strings.Cut(filepath.Base(filepath.Clean(source)), ".")
+		return name
+	case SourceTypePostgres:
+		if !isPostgresConnectionString(source) && !isPostgresService(source) {
+			// Support connection string in a text file.
+			v, err := readFileTrim(source)
+			if err != nil || (!isPostgresConnectionString(v) && !isPostgresService(v)) {
+				return ""
+			}
+			source = v
+		}
+		if service, ok := pgServiceName(source); ok {
+			return service
+		}
+		return uriDatabaseName(source)
+	case SourceTypeMongo:
+		if !isMongoConnectionString(source) {
+			// Mongo config file is not supported.
+			v, err := readFileTrim(source)
+			if err != nil || !isMongoConnectionString(v) {
+				return ""
+			}
+			source = v
+		}
+		return uriDatabaseName(source)
+	}
+	return ""
+}
+
+func uriDatabaseName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(u.Path, "/")
+}
@@ -1,10 +1,10 @@
 package task
 
 import (
-	"fmt"
+	"context"
 	"github.com/mawngo/go-errors"
 	"github.com/pterm/pterm"
-	"log/slog"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,16 +13,16 @@
 	"sin/internal/utils"
 	"strconv"
 	"strings"
-	"time"
 )
 
-var _ SyncTask = (*syncPostgres)(nil)
+var _ StreamSource = (*postgresSource)(nil)
 
 type SyncPostgresConfig struct {
+	// URI the connection string uri, or a postgres service (service=name).
 	URI        string
 	PGDumpPath string
 	EnableGzip bool
-	Tag        string
+	Tags       []string
 
 	// Compress specifies compression algorithm and/or level,
 	// basically the compress flag of pg_dump with some constraint.
@@ -39,31 +39,36 @@ type SyncPostgresConfig struct {
 	Format string
 	// NumberOfJobs parallel pg_dump, only applicable to directory format.
 	NumberOfJobs int
+	// CompressCmd external compression command (e.g. pigz, lz4) to compress the pg_dump output.
+	// Cannot be used with directory format or pg_dump compression.
+	CompressCmd string
+	// DumpArgs additional args passed to pg_dump, appended after the sin managed args.
+	// Must not override the output file, format, compression or database flags.
+	DumpArgs []string
+	// ServiceFile the postgres service file (PGSERVICEFILE) to look up the service.
+	ServiceFile string
+	// PassFile the password file (PGPASSFILE) of pg_dump.
+	PassFile string
+	// Stream streams the pg_dump output to the targets without creating a local backup.
+	// Not supported with directory format.
+	Stream bool
+	// MinBackupBytes fails the backup if the created local backup is smaller than it, overriding the global
+	// minBackupBytes if specified. Not checked when streaming.
+	MinBackupBytes int64
 }
 
-type syncPostgres struct {
-	app          *core.App
-	syncer       *store.Syncer
-	destFileName string
+type postgresSource struct {
+	app        *core.App
+	compressor *compressor
 	SyncPostgresConfig
 }
 
 func NewSyncPostgres(app *core.App, syncer *store.Syncer, config SyncPostgresConfig) (SyncTask, error) {
-	if !isPostgresConnectionString(config.URI) {
-		if err := validateFilePath(config.URI, "postgres connection string"); err != nil {
-			return nil, err
-		}
-		v, err := readFileTrim(config.URI)
-		if err != nil {
-			return nil, err
-		}
-		// Support connection string in a text file.
-		if isPostgresConnectionString(v) {
-			config.URI = v
-		} else {
-			return nil, errors.New("invalid connection string uri")
-		}
+	uri, err := resolvePostgresURI(config.URI, config.ServiceFile, config.PassFile)
+	if err != nil {
+		return nil, err
 	}
+	config.URI = uri
 
 	if config.PGDumpPath != "" && strings.ContainsRune(config.PGDumpPath, os.PathSeparator) {
 		if err := validateFilePath(config.PGDumpPath, "pg_dump"); err != nil {
@@ -73,11 +78,6 @@ func NewSyncPostgres(app *core.App, syncer *store.Syncer, config SyncPostgresCon
 		config.PGDumpPath = "pg_dump"
 	}
 
-	destFileName := app.Name
-	if config.Tag != "" {
-		destFileName = fmt.Sprintf("[%s] %s", config.Tag, destFileName)
-	}
-
 	if config.EnableGzip {
 		if config.Compress != "" {
 			if !utils.IsNumeric(config.Compress) {
@@ -99,114 +99,182 @@ func NewSyncPostgres(app *core.App, syncer *store.Syncer, config SyncPostgresCon
 	}
 
 	// Handle extension.
+	ext := ""
 	if config.Format == "directory" {
-		destFileName += ".zip"
+		ext = ".zip"
 	} else if config.EnableGzip {
-		destFileName += ".gz"
+		ext = ".gz"
 	}
 
 	if config.Format != "custom" && config.Format != "directory" && config.Format != "plain" {
 		return nil, errors.Newf("invalid format '%s'", config.Format)
 	}
+	if err := validateDumpArgs(config.DumpArgs, "-f", "--file", "-F", "--format", "-Z", "--compress", "-d", "--dbname"); err != nil {
+		return nil, err
+	}
 
-	return &syncPostgres{
+	if config.Stream && config.Format == "directory" {
+		return nil, errors.New("streaming is not supported for directory format")
+	}
+
+	var c *compressor
+	if config.CompressCmd != "" {
+		if config.Format == "directory" {
+			return nil, errors.New("compress command is not supported for directory format")
+		}
+		if config.Compress != "none" {
+			return nil, errors.New("compress command must not be used with pg_dump compression")
+		}
+		var err error
+		if c, err = newCompressor(config.CompressCmd); err != nil {
+			return nil, err
+		}
+		c.priority = app.PriorityArgs()
+		ext += c.ext
+	}
+
+	source := &postgresSource{
 		app:                app,
-		syncer:             syncer,
+		compressor:         c,
 		SyncPostgresConfig: config,
-		destFileName:       destFileName + core.BackupFileExt,
-	}, nil
+	}
+	return newSourceTask(app, syncer, source, sourceTaskConfig{
+		Tags:           config.Tags,
+		Ext:            ext,
+		Stream:         config.Stream,
+		MinBackupBytes: config.MinBackupBytes,
+	})
+}
+
+// resolvePostgresURI return the connection string uri or postgres service,
+// which can be specified directly or in a text file, validating the service and password files.
+func resolvePostgresURI(uri string, serviceFile string, passFile string) (string, error) {
+	if !isPostgresConnectionString(uri) && !isPostgresService(uri) {
+		if err := validateFilePath(uri, "postgres connection string"); err != nil {
+			return "", err
+		}
+		v, err := readFileTrim(uri)
+		if err != nil {
+			return "", err
+		}
+		// Support connection string in a text file.
+		if !isPostgresConnectionString(v) && !isPostgresService(v) {
+			return "", errors.New("invalid connection string uri")
+		}
+		uri = v
+	}
+	if service, ok := pgServiceName(uri); ok {
+		if err := validatePGService(service, serviceFile); err != nil {
+			return "", err
+		}
+	} else if serviceFile != "" {
+		return "", errors.New("service file must only be used with postgres service (service=name)")
+	}
+	if passFile != "" {
+		if err := validateFilePath(passFile, "postgres password"); err != nil {
+			return "", err
+		}
+	}
+	return uri, nil
+}
+
+// pgCommandEnv return the environment of the postgres commands, or nil to inherit the current environment.
+func pgCommandEnv(serviceFile string, passFile string) []string {
+	if serviceFile == "" && passFile == "" {
+		return nil
+	}
+	env := os.Environ()
+	if serviceFile != "" {
+		env = append(env, "PGSERVICEFILE="+serviceFile)
+	}
+	if passFile != "" {
+		env = append(env, "PGPASSFILE="+passFile)
+	}
+	return env
 }
 
 func isPostgresConnectionString(uri string) bool {
 	return strings.HasPrefix(uri, "postgresql://") || strings.HasPrefix(uri, "postgres://")
 }
 
-func (p *syncPostgres) ExecSync() error {
-	prefix := ""
-	if p.Tag != "" {
-		prefix = fmt.Sprintf("[%s]: ", p.Tag)
-	}
+func isPostgresService(uri string) bool {
+	_, ok := pgServiceName(uri)
+	return ok
+}
 
-	dest := filepath.Join(p.app.Config.BackupTempDir, p.destFileName)
-	if p.Format == "directory" {
-		dest = strings.TrimSuffix(dest, ".zip"+core.BackupFileExt)
-	}
+// dumpCommand return the pg_dump command writing the dump to out, or to stdout if out is empty.
+func (p *postgresSource) dumpCommand(ctx context.Context, out string) *exec.Cmd {
 	dumpArgs := []string{
 		"-d", p.URI,
 		"-v",
 		"-F", p.Format,
 		"-Z", p.Compress,
-		"-f", dest,
 	}
+	// Write the dump to stdout if compress command is used.
+	if p.compressor == nil && out != "" {
+		dumpArgs = append(dumpArgs, "-f", out)
+	}
+	if p.Format == "directory" && p.NumberOfJobs > 0 {
+		dumpArgs = append([]string{"-j", strconv.Itoa(p.NumberOfJobs)}, dumpArgs...)
+	}
+	dumpArgs = append(dumpArgs, p.DumpArgs...)
 
-	command := exec.CommandContext(p.app.Ctx, p.PGDumpPath, dumpArgs...)
+	command := priorityCommand(ctx, p.app.PriorityArgs(), p.PGDumpPath, dumpArgs...)
 	command.Stderr = os.Stderr
-	pterm.Printf("%sCreating local backup %s\n", prefix, p.destFileName)
+	command.Env = pgCommandEnv(p.ServiceFile, p.PassFile)
+	return command
+}
 
+func (p *postgresSource) ProduceStream(ctx context.Context, w io.Writer) error {
+	if err := runStreamed(ctx, p.compressor, p.dumpCommand(ctx, ""), w); err != nil {
+		return errors.Wrapf(errors.Join(ErrDumpFailed, err), "error running pg_dump")
+	}
+	return nil
+}
+
+func (p *postgresSource) Produce(ctx context.Context, dest string) (SourceBackup, error) {
+	prefix := logPrefix(p.Tags)
+	out := dest
 	if p.Format == "directory" {
-		if p.NumberOfJobs > 0 {
-			dumpArgs = append([]string{"-j", strconv.Itoa(p.NumberOfJobs)}, dumpArgs...)
-		}
-		if err := removeAllIfExist(dest); err != nil {
-			return errors.Wrapf(err, "error local backup directory with same name exist")
-		}
-	} else {
-		if err := removeIfExist(dest); err != nil {
-			return errors.Wrapf(err, "error local backup with same name exist")
+		out = strings.TrimSuffix(dest, ".zip"+core.BackupFileExt)
+		trackDumpBackup(p.app, out)
+		if err := removeAllIfExist(out); err != nil {
+			return SourceBackup{}, errors.Wrapf(err, "error local backup directory with same name exist")
 		}
 	}
 
-	start := time.Now()
-	if err := command.Run(); err != nil {
+	if err := runCompressed(ctx, p.compressor, p.dumpCommand(ctx, out), out); err != nil {
 		if p.Format == "directory" {
-			err = errors.Join(
-				removeAllIfExist(dest+".error"),
-				os.Rename(dest, dest+".error"),
-			)
-			if err != nil {
-				pterm.Warning.Printf("%sFailed to rename errored backup directory %s\n", prefix, dest)
-			}
-		} else {
-			if err := os.Rename(dest, dest+".error"); err != nil {
-				pterm.Warning.Printf("%sFailed to rename errored backup %s\n", prefix, p.destFileName)
+			if err := renameErrored(out, p.app.ErrorDir); err != nil {
+				pterm.Warning.Printf("%sFailed to rename errored backup directory %s\n", prefix, out)
 			}
 		}
-		return errors.Wrapf(err, "error running pg_dump")
+		return SourceBackup{}, errors.Wrapf(errors.Join(ErrDumpFailed, err), "error running pg_dump")
 	}
 
 	if p.Format == "directory" {
-		dumpDir := dest
-		dest = dest + ".zip" + core.BackupFileExt
-		pterm.Printf("%sZiping pg_dump output directory %s\n", prefix, dumpDir)
-		if err := removeIfExist(dest); err != nil {
-			return errors.Wrapf(err, "error local backup with same name exist")
-		}
-
-		if err := zipDir(dumpDir, dest); err != nil {
+		pterm.Printf("%sZiping pg_dump output directory %s\n", prefix, out)
+		if err := zipDir(out, dest, filepath.Base(out), pathFilter{}, false); err != nil {
 			_ = os.Remove(dest)
-			return errors.Wrapf(err, "error zipping pg_dump output directory")
+			return SourceBackup{}, errors.Wrapf(err, "error zipping pg_dump output directory")
 		}
-		if err := os.RemoveAll(dumpDir); err != nil {
-			pterm.Warning.Printf("%sCannot remove pg_dump output directory %s: %s\n", prefix, dumpDir, err.Error())
+		if err := os.RemoveAll(out); err != nil {
+			pterm.Warning.Printf("%sCannot remove pg_dump output directory %s: %s\n", prefix, out, err.Error())
 		}
 	}
 
-	pterm.Printf("%sLocal backup %s created took %s\n", prefix, p.destFileName, time.Since(start).String())
-	slog.Info(fmt.Sprintf("%sLocal backup created", prefix),
-		slog.String("name", p.app.Name),
-		slog.String("took", time.Since(start).String()),
-	)
-	if p.syncer.AdaptersCount() == 0 {
-		pterm.Printf("%sLocal backup are kept as there are no targets configured\n", prefix)
-		return utils.CreateFileSHA256Checksum(dest)
+	metadata := utils.BackupMetadata{
+		Engine: SourceTypePostgres,
+		Source: redactURI(p.URI),
+		Format: p.Format,
 	}
-	err := p.syncer.Sync(p.app.Ctx, dest, start)
-	if !p.app.KeepTempFile {
-		err = errors.Join(err, os.Remove(dest))
-	} else {
-		err = errors.Join(err, utils.CreateFileSHA256Checksum(dest))
-		pterm.Printf("%sLocal backup are kept\n", prefix)
+	if p.Compress != "none" {
+		metadata.Compression = p.Compress
+	} else if p.compressor != nil {
+		metadata.Compression = filepath.Base(p.compressor.path)
+	}
+	if p.app.WriteMetadata {
+		metadata.EngineVersion = dumpVersion(ctx, p.PGDumpPath)
 	}
-	pterm.Printf("%sSync %s finished\n", prefix, p.destFileName)
-	return err
+	return SourceBackup{Path: dest, Metadata: metadata}, nil
 }
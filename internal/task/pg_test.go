@@ -0,0 +1,90 @@
+package task
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"os/exec"
+	"path/filepath"
+	"sin/internal/store"
+	"slices"
+	"testing"
+)
+
+func TestPostgresSourceDumpFailed(t *testing.T) {
+	dumpPath, err := exec.LookPath("false")
+	if err != nil {
+		t.Skip("false is not available:", err)
+	}
+	p := &postgresSource{
+		app: newTestApp(t),
+		SyncPostgresConfig: SyncPostgresConfig{
+			URI:        "postgresql://localhost:5432/db",
+			PGDumpPath: dumpPath,
+			Format:     "custom",
+			Compress:   "0",
+		},
+	}
+
+	_, err = p.Produce(context.Background(), filepath.Join(t.TempDir(), "db.sinbak"))
+	if !errors.Is(err, ErrDumpFailed) {
+		t.Fatalf("Produce() error = %v, want %v", err, ErrDumpFailed)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("Produce() error = %v, want the exit error of pg_dump", err)
+	}
+}
+
+func TestNewSyncPostgresDumpArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		dumpArgs []string
+		wantErr  bool
+	}{
+		{name: "passthrough", dumpArgs: []string{"--no-owner", "-n", "public", "--exclude-table=logs"}},
+		{name: "long flag sharing a protected prefix", dumpArgs: []string{"--format-extra"}},
+		{name: "short flag", dumpArgs: []string{"-f", "other.sql"}, wantErr: true},
+		{name: "attached short flag", dumpArgs: []string{"-Fp"}, wantErr: true},
+		{name: "long flag", dumpArgs: []string{"--file", "other.sql"}, wantErr: true},
+		{name: "long flag with value", dumpArgs: []string{"--compress=9"}, wantErr: true},
+		{name: "database", dumpArgs: []string{"--dbname=other"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			syncer, err := store.NewSyncer(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewSyncPostgres(app, syncer, SyncPostgresConfig{
+				URI:      "postgresql://localhost:5432/db",
+				DumpArgs: tt.dumpArgs,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSyncPostgres() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPostgresSourceDumpCommandArgs(t *testing.T) {
+	p := &postgresSource{
+		app: newTestApp(t),
+		SyncPostgresConfig: SyncPostgresConfig{
+			URI:        "postgresql://localhost:5432/db",
+			PGDumpPath: "pg_dump",
+			Format:     "custom",
+			Compress:   "none",
+			DumpArgs:   []string{"--no-owner", "-n", "public"},
+		},
+	}
+
+	args := p.dumpCommand(context.Background(), "db.sinbak").Args
+	if i := slices.Index(args, "-f"); i < 0 || i+1 >= len(args) || args[i+1] != "db.sinbak" {
+		t.Errorf("pg_dump args = %v, want the managed -f db.sinbak", args)
+	}
+	// Passthrough args are appended after the sin managed args.
+	if !slices.Equal(args[len(args)-3:], p.DumpArgs) {
+		t.Errorf("pg_dump args = %v, want ending with %v", args, p.DumpArgs)
+	}
+}
@@ -0,0 +1,180 @@
+package task
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sin/internal/core"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pgCustomMagic header of pg_dump custom format.
+	pgCustomMagic = "PGDMP"
+	// zipMagic header of zip archive, used for pg_dump directory format.
+	zipMagic = "PK\x03\x04"
+	// pgTOCFile the table of contents file of pg_dump directory format.
+	pgTOCFile = "toc.dat"
+)
+
+type RestorePostgresConfig struct {
+	// URI the connection string uri, or a postgres service (service=name), or a file containing it.
+	URI           string
+	PGRestorePath string
+	PSQLPath      string
+	// Clean drops database objects before recreating them.
+	Clean bool
+	// Create creates the database before restoring into it.
+	Create bool
+	// Jobs number of concurrent pg_restore jobs, not applicable to plain format.
+	Jobs int
+	// RestoreArgs additional args passed to pg_restore/psql, appended after the sin managed args.
+	RestoreArgs []string
+	// ServiceFile the postgres service file (PGSERVICEFILE) to look up the service.
+	ServiceFile string
+	// PassFile the password file (PGPASSFILE).
+	PassFile string
+}
+
+// RestorePostgres restores the local pg backup into the database.
+// The format is detected from the backup content: custom and zipped directory formats are restored using pg_restore,
+// plain format is restored using psql. Compressed backups are decompressed first.
+func RestorePostgres(app *core.App, backup string, config RestorePostgresConfig) error {
+	uri, err := resolvePostgresURI(config.URI, config.ServiceFile, config.PassFile)
+	if err != nil {
+		return err
+	}
+	config.URI = uri
+	if config.PGRestorePath == "" {
+		config.PGRestorePath = "pg_restore"
+	}
+	if config.PSQLPath == "" {
+		config.PSQLPath = "psql"
+	}
+
+	dir, err := os.MkdirTemp(app.BackupTempDir, ".sin-"+app.Name+"-restore-")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temp directory")
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	src, err := decompressBackup(app.Ctx, backup, dir)
+	if err != nil {
+		return err
+	}
+	header, err := readFileHeader(src, len(pgCustomMagic))
+	if err != nil {
+		return errors.Wrapf(err, "error reading backup %s", src)
+	}
+
+	var command *exec.Cmd
+	switch {
+	case strings.HasPrefix(header, pgCustomMagic):
+		command = pgRestoreCommand(app.Ctx, config, "custom", src)
+	case strings.HasPrefix(header, zipMagic):
+		dumpDir, err := unzipPGDirectory(app.Ctx, src, filepath.Join(dir, "directory"))
+		if err != nil {
+			return err
+		}
+		command = pgRestoreCommand(app.Ctx, config, "directory", dumpDir)
+	default:
+		if config.Clean || config.Create || config.Jobs > 0 {
+			pterm.Warning.Println("Clean, create and jobs options are ignored for plain format backup")
+		}
+		args := append([]string{"-d", config.URI, "-v", "ON_ERROR_STOP=1", "-f", src}, config.RestoreArgs...)
+		command = exec.CommandContext(app.Ctx, config.PSQLPath, args...)
+	}
+	command.Env = pgCommandEnv(config.ServiceFile, config.PassFile)
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	start := time.Now()
+	pterm.Printf("Restoring %s using %s\n", filepath.Base(backup), filepath.Base(command.Path))
+	if err := command.Run(); err != nil {
+		return errors.Wrapf(err, "error running %s", filepath.Base(command.Path))
+	}
+	pterm.Success.Println("Restored", filepath.Base(backup), "took", time.Since(start).String())
+	slog.Info("Restored postgres backup",
+		slog.String("name", app.Name),
+		slog.String("backup", backup),
+		slog.String("took", time.Since(start).String()))
+	return nil
+}
+
+func pgRestoreCommand(ctx context.Context, config RestorePostgresConfig, format string, src string) *exec.Cmd {
+	args := []string{"-d", config.URI, "-v", "-F", format}
+	if config.Clean {
+		args = append(args, "--clean", "--if-exists")
+	}
+	if config.Create {
+		args = append(args, "--create")
+	}
+	if config.Jobs > 0 {
+		args = append(args, "-j", strconv.Itoa(config.Jobs))
+	}
+	args = append(args, config.RestoreArgs...)
+	args = append(args, src)
+	return exec.CommandContext(ctx, config.PGRestorePath, args...)
+}
+
+// decompressBackup decompresses the backup into dir if it is compressed by gzip or an external compression command.
+// The decompressed content is verified against the content checksum in the metadata file, if any.
+// Return the path of the decompressed backup, or the backup itself if it is not compressed.
+func decompressBackup(ctx context.Context, backup string, dir string) (string, error) {
+	cmd, err := detectCompressCmd(backup)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading backup %s", backup)
+	}
+	if cmd == "" {
+		return backup, nil
+	}
+	c, err := newCompressor(cmd)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, "dump")
+	pterm.Println("Decompressing backup using", cmd)
+	checksum, err := c.decompressFile(ctx, backup, dest)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyContentChecksum(backup, checksum); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// unzipPGDirectory extracts the zipped pg_dump directory format backup into dest.
+// Return the directory containing the table of contents.
+func unzipPGDirectory(ctx context.Context, backup string, dest string) (string, error) {
+	if err := ExtractArchive(ctx, backup, "", dest); err != nil {
+		return "", errors.Wrapf(err, "error extracting directory format backup")
+	}
+	dumpDir := ""
+	err := filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == pgTOCFile {
+			dumpDir = filepath.Dir(path)
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if dumpDir == "" {
+		return "", errors.Newf("invalid directory format backup, %s not found", pgTOCFile)
+	}
+	return dumpDir, nil
+}
@@ -0,0 +1,80 @@
+package task
+
+import (
+	"bufio"
+	"github.com/mawngo/go-errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pgServicePrefix prefix of the postgres service connection string (service=name).
+const pgServicePrefix = "service="
+
+// pgServiceName return the service name if the connection string references a postgres service.
+// Other connection parameters after the service (service=name dbname=db) are ignored.
+func pgServiceName(uri string) (string, bool) {
+	rest, ok := strings.CutPrefix(uri, pgServicePrefix)
+	name, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	return name, ok && name != ""
+}
+
+// pgServiceFiles return the service files that libpq would read, in order of precedence:
+// the specified file (or PGSERVICEFILE, or ~/.pg_service.conf), then PGSYSCONFDIR/pg_service.conf.
+func pgServiceFiles(serviceFile string) []string {
+	files := make([]string, 0, 2)
+	if serviceFile == "" {
+		serviceFile = os.Getenv("PGSERVICEFILE")
+	}
+	if serviceFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			serviceFile = filepath.Join(home, ".pg_service.conf")
+		}
+	}
+	if serviceFile != "" {
+		files = append(files, serviceFile)
+	}
+	if dir := os.Getenv("PGSYSCONFDIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "pg_service.conf"))
+	}
+	return files
+}
+
+// validatePGService check that the service is defined in one of the service files.
+func validatePGService(name string, serviceFile string) error {
+	if serviceFile != "" {
+		if err := validateFilePath(serviceFile, "postgres service"); err != nil {
+			return err
+		}
+	}
+	for _, file := range pgServiceFiles(serviceFile) {
+		found, err := hasPGService(file, name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return errors.Wrapf(err, "error reading postgres service file %s", file)
+		}
+		if found {
+			return nil
+		}
+	}
+	return errors.Newf("postgres service %s not found in service files", name)
+}
+
+// hasPGService check whether the ini style service file has the [name] section.
+func hasPGService(file string, name string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "["+name+"]" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
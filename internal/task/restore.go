@@ -0,0 +1,87 @@
+package task
+
+import (
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"strings"
+)
+
+// RestoreInfo describes how to restore a backup.
+type RestoreInfo struct {
+	// Engine the type of backup (file, pg, mongo), empty if unknown.
+	Engine string
+	// Format the output format of the dump tool, or zip for archived directory.
+	Format string
+	// Compression the compression algorithm/command, empty if not compressed.
+	Compression string
+	// Encryption the encryption algorithm, empty if not encrypted.
+	Encryption string
+	// FromMetadata whether the info is read from the metadata file.
+	FromMetadata bool
+}
+
+// ResolveRestoreInfo return the info for restoring the local backup at path.
+// It reads the metadata file (path.meta.json) if exists, which must match the backup checksum,
+// otherwise guesses the info from the filename extensions.
+func ResolveRestoreInfo(path string) (RestoreInfo, error) {
+	exists, err := utils.FileExists(path + utils.MetadataExt)
+	if err != nil {
+		return RestoreInfo{}, errors.Wrapf(err, "error checking metadata file")
+	}
+	if !exists {
+		return guessRestoreInfo(path), nil
+	}
+
+	metadata, err := utils.ReadBackupMetadata(path + utils.MetadataExt)
+	if err != nil {
+		return RestoreInfo{}, err
+	}
+	checksum, err := utils.FileChecksum(path, metadata.ChecksumAlgo)
+	if err != nil {
+		return RestoreInfo{}, errors.Wrapf(err, "error calculating checksum file %s", path)
+	}
+	if metadata.Checksum != hex.EncodeToString(checksum) {
+		return RestoreInfo{}, errors.Wrapf(utils.ErrChecksumMismatch, "metadata does not match backup %s", path)
+	}
+	return RestoreInfo{
+		Engine:       metadata.Engine,
+		Format:       metadata.Format,
+		Compression:  metadata.Compression,
+		Encryption:   metadata.Encryption,
+		FromMetadata: true,
+	}, nil
+}
+
+// compressCmdByExt compression of file extensions, for guessing restore info.
+var compressCmdByExt = map[string]string{
+	".gz":  "gzip",
+	".lz4": "lz4",
+	".zst": "zstd",
+	".xz":  "xz",
+	".bz2": "bzip2",
+}
+
+// guessRestoreInfo guesses the restore info from the filename extensions.
+// The engine cannot be guessed, so it is always empty.
+func guessRestoreInfo(path string) RestoreInfo {
+	info := RestoreInfo{}
+	name := strings.TrimSuffix(filepath.Base(path), core.BackupFileExt)
+	ext := filepath.Ext(name)
+	if _, encryption := utils.DecryptedFileName(filepath.Base(path)); encryption != "" {
+		info.Encryption = encryption
+		name = strings.TrimSuffix(name, ext)
+		ext = filepath.Ext(name)
+	}
+	if cmd, ok := compressCmdByExt[ext]; ok {
+		info.Compression = cmd
+		name = strings.TrimSuffix(name, ext)
+		ext = filepath.Ext(name)
+	}
+	if ext == ".zip" {
+		info.Format = "zip"
+	}
+	return info
+}
@@ -0,0 +1,96 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/utils"
+	"testing"
+)
+
+func TestResolveRestoreInfo(t *testing.T) {
+	content := []byte("backup content")
+	checksum := sha256.Sum256(content)
+
+	tests := []struct {
+		name     string
+		filename string
+		// metadata the metadata file of the backup, nil for no metadata file.
+		metadata *utils.BackupMetadata
+		want     RestoreInfo
+		wantErr  error
+	}{
+		{
+			name:     "metadata present",
+			filename: "260101_0000_db.sinbak",
+			metadata: &utils.BackupMetadata{
+				Engine: SourceTypePostgres, Format: "custom", Compression: "zstd",
+				ChecksumAlgo: core.ChecksumSHA256, Checksum: hex.EncodeToString(checksum[:]),
+			},
+			want: RestoreInfo{Engine: SourceTypePostgres, Format: "custom", Compression: "zstd", FromMetadata: true},
+		},
+		{
+			name:     "metadata overrides the extensions",
+			filename: "260101_0000_db.sql.gz.sinbak",
+			metadata: &utils.BackupMetadata{
+				Engine:       SourceTypeFile,
+				ChecksumAlgo: core.ChecksumSHA256, Checksum: hex.EncodeToString(checksum[:]),
+			},
+			want: RestoreInfo{Engine: SourceTypeFile, FromMetadata: true},
+		},
+		{
+			name:     "metadata of another backup",
+			filename: "260101_0000_db.sinbak",
+			metadata: &utils.BackupMetadata{
+				Engine:       SourceTypePostgres,
+				ChecksumAlgo: core.ChecksumSHA256, Checksum: hex.EncodeToString(make([]byte, sha256.Size)),
+			},
+			wantErr: utils.ErrChecksumMismatch,
+		},
+		{
+			name:     "metadata absent compressed",
+			filename: "260101_0000_db.sql.gz.sinbak",
+			want:     RestoreInfo{Compression: "gzip"},
+		},
+		{
+			name:     "metadata absent encrypted zip",
+			filename: "260101_0000_data.zip.zst.enc.sinbak",
+			want:     RestoreInfo{Format: "zip", Compression: "zstd", Encryption: utils.EncryptionAES256GCM},
+		},
+		{
+			name:     "metadata absent plain",
+			filename: "260101_0000_db.sinbak",
+			want:     RestoreInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.filename)
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.metadata != nil {
+				if err := utils.WriteBackupMetadata(path+utils.MetadataExt, *tt.metadata); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := ResolveRestoreInfo(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRestoreInfo() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveRestoreInfo() error = %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRestoreInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package task
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/utils"
+	"strings"
+	"time"
+)
+
+var _ SyncTask = (*sourceTask)(nil)
+
+// Source creates the local backups of a backup engine.
+// Everything else is handled by the task running the source: naming the backup, renaming it as errored on failure,
+// checking its size, checksums, encryption, metadata, syncing it to the targets and keeping it locally.
+type Source interface {
+	// Produce creates the backup at destPath.
+	// On error, anything left at destPath is renamed as an errored backup.
+	Produce(ctx context.Context, destPath string) (SourceBackup, error)
+}
+
+// StreamSource a Source that can stream the backup to the targets without creating a local backup.
+type StreamSource interface {
+	Source
+	// ProduceStream writes the backup to w.
+	ProduceStream(ctx context.Context, w io.Writer) error
+}
+
+// SourceBackup the local backup created by a Source.
+type SourceBackup struct {
+	// Path the path of the created backup, which may differ from the requested path,
+	// such as when the source decides not to compress it.
+	Path string
+	// Metadata describes the source of the backup.
+	// The name, size, checksums and encryption are filled by the task.
+	Metadata utils.BackupMetadata
+	// Checksum the precomputed checksum of the backup, nil to compute it.
+	Checksum []byte
+}
+
+// sourceTaskConfig the config of the task running a Source.
+type sourceTaskConfig struct {
+	Tags []string
+	// Ext the extension of the backup file name (e.g. .gz), appended after the backup name.
+	Ext string
+	// OptionalExt the suffix of Ext the source may omit, such as the compression extension of a backup it does not compress.
+	// Backups with and without it are counted together by keep.
+	OptionalExt string
+	// Stream streams the backup to the targets without creating a local backup.
+	// The source must be a StreamSource.
+	Stream bool
+	// MinBackupBytes fails the backup if the created local backup is smaller than it,
+	// overriding the global minBackupBytes if specified.
+	MinBackupBytes int64
+}
+
+// sourceTask the SyncTask running a Source.
+type sourceTask struct {
+	app          *core.App
+	syncer       *store.Syncer
+	source       Source
+	prefix       string
+	destFileName string
+	sourceTaskConfig
+}
+
+// newSourceTask creates the SyncTask running the source.
+// The syncer may be nil when only validating the config.
+func newSourceTask(app *core.App, syncer *store.Syncer, source Source, config sourceTaskConfig) (SyncTask, error) {
+	if err := utils.ValidateTags(config.Tags); err != nil {
+		return nil, err
+	}
+	config.Tags = utils.NormalizeTags(config.Tags)
+	if config.Stream {
+		if _, ok := source.(StreamSource); !ok {
+			return nil, errors.New("streaming is not supported by the source")
+		}
+		if syncer != nil {
+			if err := validateStream(app, syncer); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &sourceTask{
+		app:              app,
+		syncer:           syncer,
+		source:           source,
+		prefix:           logPrefix(config.Tags),
+		destFileName:     utils.FormatTags(config.Tags) + app.Name + config.Ext + core.BackupFileExt,
+		sourceTaskConfig: config,
+	}, nil
+}
+
+// logPrefix return the prefix of the output of the backup with tags.
+func logPrefix(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s]: ", strings.Join(utils.NormalizeTags(tags), ","))
+}
+
+func (t *sourceTask) DestFileName() string {
+	return t.destFileName
+}
+
+// compactFileName return the file name pattern of the backups counted together by keep,
+// matching the backups with and without OptionalExt.
+func (t *sourceTask) compactFileName() string {
+	if t.OptionalExt == "" {
+		return t.destFileName
+	}
+	name := strings.TrimSuffix(t.destFileName, t.OptionalExt+core.BackupFileExt)
+	return name + "(" + t.OptionalExt + ")?" + core.BackupFileExt
+}
+
+func (t *sourceTask) ExecSync() error {
+	if skipIdleBackup(t.app, t.syncer, t.prefix, t.destFileName) {
+		return nil
+	}
+	if t.Stream {
+		pterm.Printf("%sStreaming backup %s\n", t.prefix, t.destFileName)
+		err := t.stream(time.Now())
+		pterm.Printf("%sSync %s finished\n", t.prefix, t.destFileName)
+		return err
+	}
+
+	dest := filepath.Join(t.app.Config.BackupTempDir, t.destFileName)
+	trackDumpBackup(t.app, dest)
+	pterm.Printf("%sCreating local backup %s\n", t.prefix, t.destFileName)
+	if err := removeIfExist(dest); err != nil {
+		return errors.Wrapf(err, "error local backup with same name exist")
+	}
+
+	start := time.Now()
+	backup, err := t.source.Produce(t.app.Ctx, dest)
+	if err != nil {
+		t.renameErrored(dest)
+		return err
+	}
+	name := filepath.Base(backup.Path)
+	pterm.Printf("%sLocal backup %s created took %s\n", t.prefix, name, time.Since(start).String())
+	slog.Info(fmt.Sprintf("%sLocal backup created", t.prefix),
+		slog.String("name", t.app.Name),
+		slog.String("took", time.Since(start).String()))
+	if err := checkBackupSize(t.app, t.syncer, t.prefix, backup.Path, t.MinBackupBytes); err != nil {
+		return err
+	}
+
+	metadata := backup.Metadata
+	if backup.Checksum != nil {
+		metadata.Checksum = hex.EncodeToString(backup.Checksum)
+	}
+	if err := setContentChecksum(t.app, backup.Path, &metadata); err != nil {
+		return err
+	}
+	dest, err = encryptBackup(t.app, backup.Path, &metadata)
+	if err != nil {
+		return err
+	}
+	if err := writeMetadata(t.app, dest, metadata); err != nil {
+		return err
+	}
+	if t.syncer.AdaptersCount() == 0 {
+		pterm.Printf("%sLocal backup are kept as %s\n", t.prefix, noSyncReason(t.app))
+		return keepLocalBackup(t.app, t.syncer, dest, t.compactFileName(), backup.Checksum, start)
+	}
+	err = t.syncer.SyncChecksum(t.app.Ctx, dest, t.compactFileName(), backup.Checksum, start)
+	if !t.app.KeepTempFile {
+		err = errors.Join(err, os.Remove(dest), removeIfExist(dest+utils.MetadataExt))
+	} else {
+		err = errors.Join(err, keepLocalBackup(t.app, t.syncer, dest, t.compactFileName(), backup.Checksum, start))
+		pterm.Printf("%sLocal backup are kept\n", t.prefix)
+	}
+	pterm.Printf("%sSync %s finished\n", t.prefix, name)
+	return err
+}
+
+// renameErrored renames the backup left at dest by the failed source as errored, if any.
+func (t *sourceTask) renameErrored(dest string) {
+	if exists, _ := utils.FileExists(dest); !exists {
+		return
+	}
+	if err := renameErrored(dest, t.app.ErrorDir); err != nil {
+		pterm.Warning.Printf("%sFailed to rename errored backup %s\n", t.prefix, t.destFileName)
+	}
+}
+
+// stream streams the backup of the source to the targets without creating a local backup.
+func (t *sourceTask) stream(start time.Time) error {
+	source := t.source.(StreamSource)
+	pr, pw := io.Pipe()
+	produceErr := make(chan error, 1)
+	go func() {
+		err := source.ProduceStream(t.app.Ctx, pw)
+		// Closing with nil error ends the stream with EOF.
+		_ = pw.CloseWithError(err)
+		produceErr <- err
+	}()
+	err := t.syncer.SyncStream(t.app.Ctx, pr, t.destFileName, start)
+	// Unblock the source if the stream stopped reading.
+	_ = pr.Close()
+	if perr := <-produceErr; perr != nil {
+		return perr
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package task
+
+import (
+	"context"
+	"github.com/mawngo/go-errors"
+	"os"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/utils"
+	"slices"
+	"testing"
+)
+
+// countingSource a Source writing a fixed backup, counting the number of produced backups.
+type countingSource struct {
+	produced int
+}
+
+func (s *countingSource) Produce(_ context.Context, destPath string) (SourceBackup, error) {
+	s.produced++
+	return SourceBackup{Path: destPath}, os.WriteFile(destPath, []byte("backup content"), 0644)
+}
+
+// failingSource a Source leaving a partial backup, then failing.
+type failingSource struct{}
+
+func (failingSource) Produce(_ context.Context, destPath string) (SourceBackup, error) {
+	if err := os.WriteFile(destPath, []byte("partial"), 0644); err != nil {
+		return SourceBackup{}, err
+	}
+	return SourceBackup{}, errors.New("source failed")
+}
+
+// newTestApp return the app backing up into a temp directory, syncing to the file targets.
+func newTestApp(t *testing.T, targets ...map[string]any) *core.App {
+	t.Helper()
+	app := &core.App{Ctx: context.Background()}
+	app.Name = "db"
+	app.Keep = -1
+	app.BackupTempDir = t.TempDir()
+	app.ChecksumAlgo = core.ChecksumSHA256
+	app.Targets = targets
+	return app
+}
+
+func TestSourceTaskSkipIdleBackup(t *testing.T) {
+	app := newTestApp(t, map[string]any{"type": "file", "name": "every-2", "dir": t.TempDir(), "each": 2})
+	syncer, err := store.NewSyncer(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &countingSource{}
+	task, err := newSourceTask(app, syncer, source, sourceTaskConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The target only syncs even iterations.
+	syncer.SkipIteration()
+	if err := task.ExecSync(); err != nil {
+		t.Fatalf("ExecSync() error = %s", err)
+	}
+	if source.produced != 0 {
+		t.Errorf("produced %d backups while all targets skip, want 0", source.produced)
+	}
+	if err := task.ExecSync(); err != nil {
+		t.Fatalf("ExecSync() error = %s", err)
+	}
+	if source.produced != 1 {
+		t.Errorf("produced %d backups while the target is due, want 1", source.produced)
+	}
+}
+
+func TestSourceTaskLocalMode(t *testing.T) {
+	t.Chdir(t.TempDir())
+	app := &core.App{}
+	if err := app.LoadConfig(core.AppInitConfig{LocalMode: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = app.Close() })
+	// Local mode overrides the configured targets.
+	targetDir := t.TempDir()
+	app.Targets = []map[string]any{{"type": "file", "name": "local", "dir": targetDir}}
+	syncer, err := store.NewSyncer(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := newSourceTask(app, syncer, &countingSource{}, sourceTaskConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := task.ExecSync(); err != nil {
+		t.Fatalf("ExecSync() error = %s", err)
+	}
+	saved, err := utils.ListFileNames(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) > 0 {
+		t.Errorf("saved to the configured target in local mode: %v", saved)
+	}
+	for _, name := range []string{task.DestFileName(), task.DestFileName() + utils.ChecksumFileExt(app.ChecksumAlgo)} {
+		if exists, _ := utils.FileExists(name); !exists {
+			t.Errorf("local file %s is not kept", name)
+		}
+	}
+}
+
+func TestSourceTaskExecSync(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       Source
+		keepTempFile bool
+		wantErr      bool
+		// wantLocal the files left in the backup temp dir.
+		wantLocal []string
+		// wantSynced whether the backup and its checksum are synced to the target.
+		wantSynced bool
+	}{
+		{name: "synced", source: &countingSource{}, wantSynced: true},
+		{
+			name:         "synced and kept",
+			source:       &countingSource{},
+			keepTempFile: true,
+			wantLocal:    []string{"db.sinbak", "db.sinbak.sha256.txt"},
+			wantSynced:   true,
+		},
+		{name: "failed", source: failingSource{}, wantErr: true, wantLocal: []string{"db.sinbak" + utils.ErrorExt}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetDir := t.TempDir()
+			app := newTestApp(t, map[string]any{"type": "file", "name": "local", "dir": targetDir})
+			app.KeepTempFile = tt.keepTempFile
+			syncer, err := store.NewSyncer(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			task, err := newSourceTask(app, syncer, tt.source, sourceTaskConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = task.ExecSync()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExecSync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			local, err := utils.ListFileNames(app.BackupTempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(local)
+			if !slices.Equal(local, tt.wantLocal) {
+				t.Errorf("local files = %v, want %v", local, tt.wantLocal)
+			}
+			synced, err := utils.ListFileNames(targetDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backups := utils.FilterBackupFileNames(synced, "db")
+			if tt.wantSynced != (len(backups) == 1) {
+				t.Fatalf("synced files = %v, want synced %v", synced, tt.wantSynced)
+			}
+			if tt.wantSynced && !slices.Contains(synced, backups[0]+utils.ChecksumFileExt(app.ChecksumAlgo)) {
+				t.Errorf("synced files = %v, want the checksum of %s", synced, backups[0])
+			}
+		})
+	}
+}
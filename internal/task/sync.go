@@ -3,16 +3,297 @@
 import (
 	"archive/zip"
 	"compress/flate"
+	"context"
+	"encoding/hex"
 	"fmt"
 	"github.com/mawngo/go-errors"
+	"github.com/pterm/pterm"
 	"io"
+	"log/slog"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"sin/internal/core"
+	"sin/internal/store"
+	"sin/internal/utils"
 	"strings"
+	"time"
 )
 
+// ErrDumpFailed the dump tool (pg_dump, mongodump) exited with error.
+var ErrDumpFailed = errors.New("dump failed")
+
+// ErrBackupTooSmall the created backup is smaller than the minimum size, such as an empty or truncated dump.
+var ErrBackupTooSmall = errors.New("backup too small")
+
+// smallBackupRatio the ratio of the size of the latest backup on the targets, below which the new backup is warned.
+const smallBackupRatio = 0.5
+
 type SyncTask interface {
 	ExecSync() error
+	// DestFileName return the backup file name, without the backup time prefix.
+	DestFileName() string
+}
+
+// skipIdleBackup check whether the backup should be skipped as no targets would sync it.
+// If so, the current backup iteration is skipped.
+// The backup is always skipped if it would not be kept locally either.
+func skipIdleBackup(app *core.App, syncer *store.Syncer, prefix string, destFileName string) bool {
+	if !app.SkipIdleBackup && app.KeepTempFile {
+		return false
+	}
+	if syncer.AdaptersCount() == 0 || syncer.WillSyncAny(syncer.Iter()) {
+		return false
+	}
+	syncer.SkipIteration()
+	pterm.Printf("%sSkipped backup %s as no targets would sync it\n", prefix, destFileName)
+	slog.Info(fmt.Sprintf("%sSkipped backup", prefix),
+		slog.String("name", app.Name),
+		slog.String("filename", destFileName))
+	return true
+}
+
+// validateDumpArgs check that the passthrough args of the dump tool do not override the sin managed flags.
+// The protected flags are either short (-f) or long (--file) flags.
+func validateDumpArgs(args []string, protected ...string) error {
+	for _, arg := range args {
+		for _, flag := range protected {
+			if arg == flag ||
+				(strings.HasPrefix(flag, "--") && strings.HasPrefix(arg, flag+"=")) ||
+				(!strings.HasPrefix(flag, "--") && !strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, flag)) {
+				return errors.Newf("arg %s must not override flag %s managed by sin", arg, flag)
+			}
+		}
+	}
+	return nil
+}
+
+// noSyncReason return the reason why the backup is not synced when there are no targets.
+func noSyncReason(app *core.App) string {
+	if app.LocalMode() {
+		return "local mode is enabled"
+	}
+	return "there are no targets configured"
+}
+
+// encryptBackup encrypts the backup if encryption (AES-256-GCM or age) is enabled, replacing the plain backup.
+// Return the path of the encrypted backup, or the given path if encryption is disabled.
+func encryptBackup(app *core.App, dest string, metadata *utils.BackupMetadata) (string, error) {
+	var encrypted string
+	var err error
+	if passphrase := app.EncryptionPassphrase(); passphrase != nil {
+		encrypted = utils.EncryptedFileName(dest, utils.EncryptedExt)
+		app.TrackTempFile(encrypted)
+		err = utils.EncryptFile(app.Ctx, dest, encrypted, passphrase)
+		metadata.Encryption = utils.EncryptionAES256GCM
+	} else if recipients := app.AgeRecipientKeys(); recipients != nil {
+		encrypted = utils.EncryptedFileName(dest, utils.AgeEncryptedExt)
+		app.TrackTempFile(encrypted)
+		err = utils.AgeEncryptFile(app.Ctx, dest, encrypted, recipients)
+		metadata.Encryption = utils.EncryptionAge
+	} else {
+		return dest, nil
+	}
+	if err != nil {
+		_ = os.Remove(encrypted)
+		return "", errors.Wrapf(err, "error encrypting backup")
+	}
+	if err := os.Remove(dest); err != nil {
+		return "", errors.Wrapf(err, "error removing unencrypted backup")
+	}
+	return encrypted, nil
+}
+
+// writeMetadata writes the metadata file of the backup at dest, if enabled.
+func writeMetadata(app *core.App, dest string, metadata utils.BackupMetadata) error {
+	if !app.WriteMetadata {
+		return nil
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return errors.Wrapf(err, "error writing metadata")
+	}
+	// The checksum may be precomputed by the task.
+	if metadata.Checksum == "" {
+		checksum, err := utils.FileChecksum(dest, app.ChecksumAlgo)
+		if err != nil {
+			return errors.Wrapf(err, "error writing metadata")
+		}
+		metadata.Checksum = hex.EncodeToString(checksum)
+	}
+	metadata.Name = app.Name
+	metadata.Revision = app.Revision
+	metadata.Size = info.Size()
+	metadata.ChecksumAlgo = app.ChecksumAlgo
+	metadata.CreatedAt = time.Now()
+	app.TrackTempFile(dest + utils.MetadataExt)
+	return utils.WriteBackupMetadata(dest+utils.MetadataExt, metadata)
+}
+
+// setContentChecksum sets the checksum of the decompressed content of the compressed backup at dest, if enabled.
+// The compression is detected the same way as decompressing on restore, so restore can verify it.
+func setContentChecksum(app *core.App, dest string, metadata *utils.BackupMetadata) error {
+	if !app.WriteMetadata || !app.ContentChecksum {
+		return nil
+	}
+	cmd, err := detectCompressCmd(dest)
+	if err != nil {
+		return errors.Wrapf(err, "error reading backup %s", dest)
+	}
+	if cmd == "" {
+		return nil
+	}
+	c, err := newCompressor(cmd)
+	if err != nil {
+		return err
+	}
+	c.priority = app.PriorityArgs()
+	checksum, err := c.decompress(app.Ctx, dest, io.Discard)
+	if err != nil {
+		return errors.Wrapf(err, "error calculating content checksum")
+	}
+	metadata.ContentChecksum = hex.EncodeToString(checksum)
+	return nil
+}
+
+// verifyContentChecksum compares the checksum of the decompressed content of the backup
+// to the content checksum in its metadata file. Does nothing if there is no metadata or content checksum.
+func verifyContentChecksum(backup string, checksum []byte) error {
+	exists, err := utils.FileExists(backup + utils.MetadataExt)
+	if err != nil || !exists {
+		return err
+	}
+	metadata, err := utils.ReadBackupMetadata(backup + utils.MetadataExt)
+	if err != nil {
+		return err
+	}
+	if metadata.ContentChecksum == "" {
+		return nil
+	}
+	if actual := hex.EncodeToString(checksum); actual != metadata.ContentChecksum {
+		return errors.Wrapf(utils.ErrChecksumMismatch, "decompressed content of %s: expected %s, got %s",
+			filepath.Base(backup), metadata.ContentChecksum, actual)
+	}
+	pterm.Success.Println("Verified decompressed content checksum")
+	return nil
+}
+
+// checkBackupSize fails if the local backup at dest is smaller than minBytes (the global minBackupBytes if 0),
+// renaming it as an errored backup. It also warns if the backup is much smaller than the latest backup
+// of the same name on the targets, as it may be truncated.
+func checkBackupSize(app *core.App, syncer *store.Syncer, prefix string, dest string, minBytes int64) error {
+	if minBytes <= 0 {
+		minBytes = app.MinBackupBytes
+	}
+	name := filepath.Base(dest)
+	info, err := os.Stat(dest)
+	if err != nil {
+		return errors.Wrapf(err, "error reading backup %s", name)
+	}
+	if info.Size() < minBytes {
+		trackDumpBackup(app, dest)
+		if err := renameErrored(dest, app.ErrorDir); err != nil {
+			pterm.Warning.Printf("%sFailed to rename errored backup %s\n", prefix, name)
+		}
+		return errors.Wrapf(ErrBackupTooSmall, "backup %s is %s, smaller than the minimum %s",
+			name, utils.FormatBytes(info.Size()), utils.FormatBytes(minBytes))
+	}
+
+	latest, ok, err := syncer.LatestBackupSize(app.Ctx, name)
+	if err != nil {
+		// Only a heuristic, so the backup continues.
+		slog.Warn("Cannot get the size of the latest backup", slog.String("filename", name), slog.Any("err", err))
+		return nil
+	}
+	if ok && float64(info.Size()) < float64(latest)*smallBackupRatio {
+		pterm.Warning.Printf("%sBackup %s is %s, less than half of the latest backup (%s), it may be truncated\n",
+			prefix, name, utils.FormatBytes(info.Size()), utils.FormatBytes(latest))
+		slog.Warn(fmt.Sprintf("%sBackup much smaller than the latest backup", prefix),
+			slog.String("filename", name),
+			slog.Int64("size", info.Size()),
+			slog.Int64("latest", latest))
+	}
+	return nil
+}
+
+// keepLocalBackup keeps the local backup at dest, untracking it from temp files and creating its checksum file.
+// The checksum is the precomputed checksum of the backup, nil to compute it.
+// If LocalKeep is specified, the backup is renamed with the backup time of start,
+// and the old kept backups matching the compactFileName pattern are deleted.
+func keepLocalBackup(app *core.App, syncer *store.Syncer, dest string, compactFileName string, checksum []byte, start time.Time) error {
+	app.UntrackTempFile(dest, dest+utils.MetadataExt)
+	if app.LocalKeep > 0 {
+		kept := filepath.Join(filepath.Dir(dest), utils.FormatBackupName(start, filepath.Base(dest)))
+		if err := os.Rename(dest, kept); err != nil {
+			return errors.Wrapf(err, "error renaming kept backup")
+		}
+		if err := renameIfExist(dest+utils.MetadataExt, kept+utils.MetadataExt); err != nil {
+			return errors.Wrapf(err, "error renaming kept backup metadata")
+		}
+		defer compactKept(syncer, compactFileName)
+		dest = kept
+	}
+	if checksum != nil {
+		return utils.WriteChecksum(dest+utils.ChecksumFileExt(app.ChecksumAlgo), checksum)
+	}
+	return utils.CreateFileChecksum(dest, app.ChecksumAlgo)
+}
+
+// compactKept deletes the old kept local backups of filename.
+// Errors are only warned, as the old backups are deleted again after the next backup.
+func compactKept(syncer *store.Syncer, filename string) {
+	if err := syncer.CompactKept(filename); err != nil {
+		pterm.Warning.Printf("Error compacting kept local backups: %s\n", err)
+		slog.Warn("Error compacting kept local backups", slog.Any("err", err))
+	}
+}
+
+// trackDumpBackup tracks the temp files of the dump backup at dest,
+// including the errored backup if it is kept in the temp dir.
+func trackDumpBackup(app *core.App, dest string) {
+	app.TrackTempFile(dest)
+	if app.ErrorDir == "" {
+		app.TrackTempFile(dest + utils.ErrorExt)
+	}
+}
+
+// validateStream check that the backup can be streamed to the targets,
+// as there is no local backup to encrypt, describe in a metadata file or keep.
+func validateStream(app *core.App, syncer *store.Syncer) error {
+	if err := syncer.ValidateStream(); err != nil {
+		return err
+	}
+	if app.EncryptionPassphrase() != nil || app.AgeRecipientKeys() != nil {
+		return errors.New("streaming does not support encryption")
+	}
+	if app.WriteMetadata {
+		return errors.New("streaming does not support writing metadata")
+	}
+	if app.KeepTempFile {
+		return errors.New("streaming does not support keeping the local backup")
+	}
+	return nil
+}
+
+// dumpVersion return the version of the dump tool, or empty if it cannot be determined.
+func dumpVersion(ctx context.Context, path string) string {
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return version
+}
+
+// redactURI return the uri with password redacted.
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
 }
 
 func validateFilePath(path string, msg string) error {
@@ -46,6 +327,13 @@ func removeIfExist(path string) error {
 	return nil
 }
 
+func renameIfExist(path string, newPath string) error {
+	if err := os.Rename(path, newPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "error renaming file")
+	}
+	return nil
+}
+
 func removeAllIfExist(path string) error {
 	if stats, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
@@ -61,8 +349,60 @@ func removeAllIfExist(path string) error {
 	return nil
 }
 
-// zipDir create a zip file from a directory, without any compression.
-func zipDir(src, dst string) (err error) {
+// renameErrored renames the errored backup file/directory to path.error,
+// moving it to errorDir if specified.
+func renameErrored(path string, errorDir string) error {
+	target := path + utils.ErrorExt
+	if errorDir != "" {
+		target = filepath.Join(errorDir, filepath.Base(target))
+	}
+	stats, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrapf(err, "error renaming errored backup")
+	}
+	if stats.IsDir() {
+		if err := removeAllIfExist(target); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(path, target); err != nil {
+		return errors.Wrapf(err, "error renaming errored backup")
+	}
+	return nil
+}
+
+// Archive root modes of directory backup.
+const (
+	// ArchiveRootIncludeParent archive contains the source directory as the top-level folder.
+	ArchiveRootIncludeParent = "include-parent"
+	// ArchiveRootContentsOnly archive contains the contents of the source directory at its root.
+	ArchiveRootContentsOnly = "contents-only"
+)
+
+// archivePrefix return the path of the source directory inside the archive, based on the archive root mode.
+// Any value other than the archive root modes is used as a custom prefix.
+func archivePrefix(src string, archiveRoot string) (string, error) {
+	switch archiveRoot {
+	case "", ArchiveRootIncludeParent:
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Base(abs), nil
+	case ArchiveRootContentsOnly:
+		return "", nil
+	}
+	prefix := path.Clean(filepath.ToSlash(archiveRoot))
+	if path.IsAbs(prefix) || prefix == ".." || strings.HasPrefix(prefix, "../") {
+		return "", errors.Newf("invalid archive root '%s': custom prefix must be a relative path inside the archive", archiveRoot)
+	}
+	return prefix, nil
+}
+
+// zipDir archives the src directory into dst without any compression, placing the directory contents under prefix inside the archive.
+// Paths not passing the filter are skipped.
+// Symlinks are stored as symlink entries, or archived as their target contents if followSymlinks.
+func zipDir(src, dst string, prefix string, filter pathFilter, followSymlinks bool) (err error) {
 	file, err := os.Create(dst)
 	if err != nil {
 		panic(err)
@@ -76,25 +416,50 @@ func zipDir(src, dst string) (err error) {
 	defer w.Close()
 
 	src, _ = filepath.Abs(src)
-	dir := filepath.Dir(src)
-	walker := func(path string, info os.FileInfo, err error) error {
+	// includedDirs the directories matched by the include patterns, whose contents are all included.
+	includedDirs := make(map[string]struct{})
+	walker := func(name string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		rel, err := filepath.Rel(dir, path)
+		rel, err := filepath.Rel(src, name)
 		if err != nil {
 			return err
 		}
+		if rel != "." {
+			rel = filepath.ToSlash(rel)
+			if filter.excluded(rel, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			_, inDir := includedDirs[path.Dir(rel)]
+			if !filter.included(rel, info.IsDir(), inDir) {
+				// Keep walking the directory, as its contents may be included.
+				return nil
+			}
+			if info.IsDir() {
+				includedDirs[rel] = struct{}{}
+			}
+		}
+		rel = path.Join(prefix, rel)
+		if rel == "." {
+			// Contents at the archive root, no entry for the root itself.
+			return nil
+		}
 
 		if info.IsDir() {
 			// Add a trailing slash for creating dir.
 			// Must use '/', not filepath.Separator.
-			path = fmt.Sprintf("%s%c", rel, '/')
-			_, err = w.Create(path)
+			_, err = w.Create(fmt.Sprintf("%s%c", rel, '/'))
 			return err
 		}
-		file, err := os.Open(path)
+		if info.Mode()&os.ModeSymlink != 0 {
+			return zipSymlink(w, name, rel, info)
+		}
+		file, err := os.Open(name)
 		if err != nil {
 			return err
 		}
@@ -111,5 +476,87 @@ func zipDir(src, dst string) (err error) {
 
 		return nil
 	}
-	return filepath.Walk(src, walker)
+	return walkDir(src, followSymlinks, walker)
+}
+
+// zipSymlink adds the symlink entry, storing the link target as its content like the zip command does.
+func zipSymlink(w *zip.Writer, name string, rel string, info os.FileInfo) error {
+	target, err := os.Readlink(name)
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	header.Method = zip.Store
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, target)
+	return err
+}
+
+// walkDir walks the root directory like filepath.Walk, in lexical order, always resolving the root itself.
+// If followSymlinks, symlinks are walked as their targets, with symlinked directories walked only if they are not
+// one of their ancestors, guarding against cycles. Broken symlinks are passed as is.
+func walkDir(root string, followSymlinks bool, fn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	err = walkDirEntry(root, info, followSymlinks, nil, fn)
+	if errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkDirEntry(name string, info os.FileInfo, followSymlinks bool, ancestors []os.FileInfo, fn filepath.WalkFunc) error {
+	if followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Stat(name); err == nil {
+			info = target
+		}
+	}
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			pterm.Warning.Printfln("Skipping symlink %s: cycle detected", name)
+			return nil
+		}
+	}
+	if err := fn(name, info, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) {
+			return nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return fn(name, info, err)
+	}
+	ancestors = append(ancestors, info)
+	for _, entry := range entries {
+		child := filepath.Join(name, entry.Name())
+		childInfo, err := os.Lstat(child)
+		if err != nil {
+			if err := fn(child, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+		err = walkDirEntry(child, childInfo, followSymlinks, ancestors, fn)
+		if errors.Is(err, filepath.SkipDir) {
+			// Skip the remaining entries of the directory, same as filepath.Walk.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
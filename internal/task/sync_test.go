@@ -0,0 +1,137 @@
+package task
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sin/internal/store"
+	"sin/internal/utils"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestZipDirArchiveRoot(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "data")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt")} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		archiveRoot string
+		want        []string
+		wantErr     bool
+	}{
+		{archiveRoot: "", want: []string{"data/a.txt", "data/sub/b.txt"}},
+		{archiveRoot: ArchiveRootIncludeParent, want: []string{"data/a.txt", "data/sub/b.txt"}},
+		{archiveRoot: ArchiveRootContentsOnly, want: []string{"a.txt", "sub/b.txt"}},
+		{archiveRoot: "backup/db/", want: []string{"backup/db/a.txt", "backup/db/sub/b.txt"}},
+		{archiveRoot: "../outside", wantErr: true},
+		{archiveRoot: "/abs", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.archiveRoot, func(t *testing.T) {
+			prefix, err := archivePrefix(src, tt.archiveRoot)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("archivePrefix(%q) error = nil, want error", tt.archiveRoot)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("archivePrefix(%q) error = %s", tt.archiveRoot, err)
+			}
+			dst := filepath.Join(t.TempDir(), "data.zip")
+			if err := zipDir(src, dst, prefix, pathFilter{}, false); err != nil {
+				t.Fatalf("zipDir() error = %s", err)
+			}
+
+			r, err := zip.OpenReader(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			var got []string
+			for _, f := range r.File {
+				if !strings.HasSuffix(f.Name, "/") {
+					got = append(got, f.Name)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceTaskLocalKeep(t *testing.T) {
+	old := []string{"260101_0000_db.sinbak", "260102_0000_db.sinbak"}
+	tests := []struct {
+		name      string
+		localKeep int
+		// wantLocal the old local backups left, in addition to the new backup.
+		wantLocal []string
+		// wantNewName whether the new local backup is named with its backup time.
+		wantNewName bool
+	}{
+		{name: "disabled", wantLocal: old},
+		{name: "keep 2", localKeep: 2, wantLocal: old[1:], wantNewName: true},
+		{name: "keep 1", localKeep: 1, wantNewName: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetDir := t.TempDir()
+			app := newTestApp(t, map[string]any{"type": "file", "name": "local", "dir": targetDir})
+			app.Keep = 5
+			app.LocalKeep = tt.localKeep
+			app.KeepTempFile = true
+			for _, dir := range []string{app.BackupTempDir, targetDir} {
+				for _, name := range old {
+					if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			syncer, err := store.NewSyncer(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			task, err := newSourceTask(app, syncer, &countingSource{}, sourceTaskConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := task.ExecSync(); err != nil {
+				t.Fatalf("ExecSync() error = %s", err)
+			}
+			local, err := utils.ListFileNames(app.BackupTempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backups := utils.FilterBackupFileNames(local, "db")
+			if tt.wantNewName {
+				// The new backup is the latest, sorted last.
+				n := len(backups) - 1
+				if n != len(tt.wantLocal) || !slices.Equal(backups[:n], tt.wantLocal) || slices.Contains(old, backups[n]) {
+					t.Errorf("local backups = %v, want %v and the new backup", backups, tt.wantLocal)
+				}
+			} else if !slices.Equal(backups, tt.wantLocal) || !slices.Contains(local, task.DestFileName()) {
+				t.Errorf("local files = %v, want %v and %s", local, tt.wantLocal, task.DestFileName())
+			}
+			// The targets apply keep independently.
+			synced, err := utils.ListFileNames(targetDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(utils.FilterBackupFileNames(synced, "db")); n != len(old)+1 {
+				t.Errorf("synced backups = %d, want %d", n, len(old)+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"github.com/mawngo/go-errors"
+	"github.com/zeebo/blake3"
+	"hash"
+	"io"
+	"os"
+	"sin/internal/core"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ChecksumAlgos the supported algorithms of checksum files, in order of precedence when finding the checksum file.
+var ChecksumAlgos = []string{core.ChecksumSHA256, core.ChecksumSHA512, core.ChecksumBLAKE3}
+
+// NewChecksumHash return the hash of the checksum algorithm, sha256 if empty.
+func NewChecksumHash(algo string) hash.Hash {
+	switch algo {
+	case core.ChecksumSHA512:
+		return sha512.New()
+	case core.ChecksumBLAKE3:
+		return blake3.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// ChecksumFileExt return the suffix of the checksum file of the algorithm (.<algo>.txt), sha256 if empty.
+func ChecksumFileExt(algo string) string {
+	if algo == "" {
+		return ChecksumExt
+	}
+	return "." + algo + ".txt"
+}
+
+// BadChecksumFileExt return the suffix of the bad checksum file of the algorithm (.<algo>.bad), sha256 if empty.
+func BadChecksumFileExt(algo string) string {
+	if algo == "" {
+		return BadChecksumExt
+	}
+	return "." + algo + ".bad"
+}
+
+// IsChecksumFile check whether the file is a checksum file of any algorithm.
+func IsChecksumFile(name string) bool {
+	return slices.ContainsFunc(ChecksumAlgos, func(algo string) bool {
+		return strings.HasSuffix(name, ChecksumFileExt(algo))
+	})
+}
+
+// PreferChecksumAlgo return the supported algorithms with the given algorithm first,
+// the order of looking up the checksum file of a backup.
+func PreferChecksumAlgo(algo string) []string {
+	algos := make([]string, 0, len(ChecksumAlgos))
+	if slices.Contains(ChecksumAlgos, algo) {
+		algos = append(algos, algo)
+	}
+	for _, a := range ChecksumAlgos {
+		if a != algo {
+			algos = append(algos, a)
+		}
+	}
+	return algos
+}
+
+// FindChecksumFile return the checksum file of the file at path and its algorithm, of whichever algorithm exists.
+// Return empty if the file has no checksum file.
+func FindChecksumFile(path string) (string, string, error) {
+	for _, algo := range ChecksumAlgos {
+		checksumFile := path + ChecksumFileExt(algo)
+		exists, err := FileExists(checksumFile)
+		if err != nil {
+			return "", "", err
+		}
+		if exists {
+			return checksumFile, algo, nil
+		}
+	}
+	return "", "", nil
+}
+
+// ParseChecksum decodes the hex encoded checksum of the algorithm, validating its length.
+func ParseChecksum(s string, algo string) ([]byte, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	checksum, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.Newf("invalid checksum '%s': must be hex encoded", s)
+	}
+	if size := NewChecksumHash(algo).Size(); len(checksum) != size {
+		return nil, errors.Newf("invalid checksum '%s': must be %d hex characters of %s", s, size*2, cmp.Or(algo, core.ChecksumSHA256))
+	}
+	return checksum, nil
+}
+
+// ReadChecksumFile reads the checksum of the algorithm from the checksum file,
+// either containing only the hex encoded checksum, or in the sha256sum output format (checksum followed by the file name).
+func ReadChecksumFile(path string, algo string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return nil, errors.Newf("empty checksum file %s", path)
+	}
+	return ParseChecksum(fields[0], algo)
+}
+
+// HashingFileWriter writes to the file at any offset while computing the checksum of the content in offset order,
+// for downloading parts of a file concurrently without reading the file again afterward.
+// Content written ahead of the hashed offset is hashed once everything before it is written,
+// reading it back from the file while it is still in the page cache.
+type HashingFileWriter struct {
+	file *os.File
+	hash hash.Hash
+
+	mu sync.Mutex
+	// hashed the offset that content before it is hashed.
+	hashed int64
+	// pending the written ranges after hashed, start to end.
+	pending map[int64]int64
+}
+
+// NewHashingFileWriter return the writer of the file computing the checksum using the algorithm.
+func NewHashingFileWriter(file *os.File, algo string) *HashingFileWriter {
+	return &HashingFileWriter{
+		file:    file,
+		hash:    NewChecksumHash(algo),
+		pending: make(map[int64]int64),
+	}
+}
+
+func (w *HashingFileWriter) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.file.WriteAt(p, off)
+	if n == 0 {
+		return n, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if off == w.hashed {
+		w.hash.Write(p[:n])
+		w.hashed += int64(n)
+	} else {
+		w.pending[off] = off + int64(n)
+	}
+	for {
+		end, ok := w.pending[w.hashed]
+		if !ok {
+			break
+		}
+		delete(w.pending, w.hashed)
+		if _, rerr := io.Copy(w.hash, io.NewSectionReader(w.file, w.hashed, end-w.hashed)); rerr != nil {
+			return n, errors.Join(err, rerr)
+		}
+		w.hashed = end
+	}
+	return n, err
+}
+
+// Reset discards the content written and the checksum computed so far, the file must be truncated by the caller.
+func (w *HashingFileWriter) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hash.Reset()
+	w.hashed = 0
+	clear(w.pending)
+}
+
+// Checksum return the checksum of the content written.
+// Return error if the written content has gaps, as it cannot be hashed in order.
+func (w *HashingFileWriter) Checksum() ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) > 0 {
+		return nil, errors.Newf("incomplete content, only hashed %d bytes", w.hashed)
+	}
+	return w.hash.Sum(nil), nil
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"filippo.io/age"
+	"github.com/mawngo/go-errors"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"os"
+	"sin/internal/core"
+	"strings"
+)
+
+const (
+	// EncryptedExt extension of AES-256-GCM encrypted backup, added before the backup extension.
+	EncryptedExt = ".enc"
+	// AgeEncryptedExt extension of age encrypted backup, added before the backup extension.
+	AgeEncryptedExt = ".age"
+	// EncryptionAES256GCM the name of the encryption algorithm, written to the metadata.
+	EncryptionAES256GCM = "aes-256-gcm"
+	// EncryptionAge the name of the age encryption, written to the metadata.
+	EncryptionAge = "age"
+
+	// encryptedMagic header of the encrypted file, including the format version.
+	encryptedMagic = "SINENC01"
+	// encryptedChunkSize size of the plaintext chunk, each chunk is sealed separately,
+	// so large backups can be encrypted and decrypted in a streaming way.
+	encryptedChunkSize = 64 * 1024
+	saltSize           = 16
+	noncePrefixSize    = 7
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrDecrypt = errors.New("cannot decrypt: wrong passphrase or corrupted file")
+
+// encryptionByExt encryption of encrypted backup extensions.
+var encryptionByExt = map[string]string{
+	EncryptedExt:    EncryptionAES256GCM,
+	AgeEncryptedExt: EncryptionAge,
+}
+
+// EncryptedFileName return the name of the encrypted backup, which has the extension (EncryptedExt, AgeEncryptedExt)
+// before the backup extension.
+func EncryptedFileName(name string, ext string) string {
+	return strings.TrimSuffix(name, core.BackupFileExt) + ext + core.BackupFileExt
+}
+
+// DecryptedFileName return the name of the decrypted backup, and the encryption of the backup.
+// The encryption is empty if the name is not of an encrypted backup.
+func DecryptedFileName(name string) (string, string) {
+	for ext, encryption := range encryptionByExt {
+		if strings.HasSuffix(name, ext+core.BackupFileExt) {
+			return strings.TrimSuffix(name, ext+core.BackupFileExt) + core.BackupFileExt, encryption
+		}
+	}
+	return name, ""
+}
+
+// EncryptFile encrypts the src file into dst using AES-256-GCM.
+// The key is stretched from the passphrase using scrypt with a random salt stored in the file header.
+//
+// File format: magic | salt | nonce prefix | chunks...
+// Each chunk is sealed with nonce = nonce prefix | chunk counter | last chunk flag,
+// so reordered, truncated or appended chunks are detected.
+func EncryptFile(ctx context.Context, src string, dst string, passphrase []byte) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	header := make([]byte, len(encryptedMagic)+saltSize+noncePrefixSize)
+	copy(header, encryptedMagic)
+	if _, err := rand.Read(header[len(encryptedMagic):]); err != nil {
+		return errors.Wrapf(err, "error generating salt")
+	}
+	salt := header[len(encryptedMagic) : len(encryptedMagic)+saltSize]
+	noncePrefix := header[len(encryptedMagic)+saltSize:]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(ContextReader(ctx, in))
+	buf := make([]byte, encryptedChunkSize, encryptedChunkSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readChunk(r, buf[:encryptedChunkSize])
+		if err != nil {
+			return err
+		}
+		sealed := aead.Seal(buf[:0], chunkNonce(noncePrefix, counter, last), buf[:n], nil)
+		if _, err := out.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			break
+		}
+		if counter == ^uint32(0) {
+			return errors.New("file too large to encrypt")
+		}
+	}
+	return out.Sync()
+}
+
+// DecryptFile decrypts the src file encrypted by EncryptFile into dst.
+// Return ErrDecrypt if the passphrase is wrong or the file is corrupted.
+func DecryptFile(ctx context.Context, src string, dst string, passphrase []byte) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r := bufio.NewReader(ContextReader(ctx, in))
+
+	header := make([]byte, len(encryptedMagic)+saltSize+noncePrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return errors.Wrapf(ErrDecrypt, "invalid encrypted file header %s", src)
+	}
+	salt := header[len(encryptedMagic) : len(encryptedMagic)+saltSize]
+	noncePrefix := header[len(encryptedMagic)+saltSize:]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	buf := make([]byte, encryptedChunkSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readChunk(r, buf)
+		if err != nil {
+			return err
+		}
+		plain, err := aead.Open(buf[:0], chunkNonce(noncePrefix, counter, last), buf[:n], nil)
+		if err != nil {
+			return errors.Wrapf(ErrDecrypt, "error decrypting chunk %d of %s", counter, src)
+		}
+		if _, err := out.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			break
+		}
+	}
+	return out.Sync()
+}
+
+// AgeEncryptFile encrypts the src file into dst to the age recipients.
+func AgeEncryptFile(ctx context.Context, src string, dst string, recipients []age.Recipient) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	w, err := age.Encrypt(out, recipients...)
+	if err != nil {
+		return errors.Wrapf(err, "error initializing age encryption")
+	}
+	if _, err := io.Copy(w, ContextReader(ctx, in)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// AgeDecryptFile decrypts the src file encrypted by AgeEncryptFile into dst using the age identities.
+// Return ErrDecrypt if no identities match or the file is corrupted.
+func AgeDecryptFile(ctx context.Context, src string, dst string, identities []age.Identity) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := age.Decrypt(ContextReader(ctx, in), identities...)
+	if err != nil {
+		return errors.Join(ErrDecrypt, err)
+	}
+	if err := CopyToFile(ctx, r, dst); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return errors.Join(ErrDecrypt, err)
+	}
+	return nil
+}
+
+func newAEAD(passphrase []byte, salt []byte) (cipher.AEAD, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty encryption passphrase")
+	}
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error deriving encryption key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readChunk fills the buffer, reporting whether it is the last chunk of the reader.
+func readChunk(r *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
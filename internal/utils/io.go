@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"cmp"
 	"context"
 	"encoding/hex"
 	"fmt"
@@ -9,15 +10,27 @@
 	"io"
 	"log/slog"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"sin/internal/core"
 	"slices"
 	"strings"
+	"time"
 )
 
 const (
+	// ChecksumExt suffix of the checksum file using the default sha256 algorithm.
 	ChecksumExt    = ".sha256.txt"
 	BadChecksumExt = ".sha256.bad"
+
+	// ErrorExt suffix of errored backup.
+	ErrorExt = ".error"
+	// PartialExt suffix of incomplete backup.
+	PartialExt = ".partial"
+
+	// BackupTimeLayout layout of the backup time prefix of backup names.
+	BackupTimeLayout = "060102_1504"
 )
 
 var ErrChecksumMismatch = errors.New("checksum mismatch")
@@ -35,6 +48,36 @@ func CopyFile(ctx context.Context, src string, dst string) (err error) {
 	return CopyToFile(ctx, in, dst)
 }
 
+// ContextReader wraps the reader for allowing context cancellation,
+// counting the read bytes into the core.ProgressCounter carried by ctx if any.
+func ContextReader(ctx context.Context, in io.Reader) io.Reader {
+	counter := core.ProgressCounterFrom(ctx)
+	return readerFunc(func(p []byte) (int, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		default:
+			n, err := in.Read(p)
+			counter.Add(n)
+			return n, err
+		}
+	})
+}
+
+// CopyFileChecksum copy the file while computing its checksum, reading the source only once.
+func CopyFileChecksum(ctx context.Context, src string, dst string, algo string) ([]byte, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	h := NewChecksumHash(algo)
+	if err := CopyToFile(ctx, io.TeeReader(in, h), dst); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
 func CopyToFile(ctx context.Context, in io.Reader, dst string) (err error) {
 	out, err := os.Create(dst)
 	if err != nil {
@@ -47,15 +90,7 @@ func CopyToFile(ctx context.Context, in io.Reader, dst string) (err error) {
 		}
 	}()
 
-	_, err = io.Copy(out, readerFunc(func(p []byte) (int, error) {
-		// Wrapper for allowing context cancellation.
-		select {
-		case <-ctx.Done():
-			return 0, ctx.Err()
-		default:
-			return in.Read(p)
-		}
-	}))
+	_, err = io.Copy(out, ContextReader(ctx, in))
 	if err != nil {
 		return err
 	}
@@ -87,24 +122,67 @@ func ListFileNames(path string) ([]string, error) {
 }
 
 // FilterBackupFileNames filters out non-managed backup files,
-// and sorts the remaining result based on alphabetical order.
+// and sorts the remaining result based on alphabetical order of the base names, so nested names are sorted by time.
+// Errored and incomplete backups are never included.
 func FilterBackupFileNames(names []string, filename string) []string {
 	if len(names) == 0 {
 		return names
 	}
-	reg, err := regexp.Compile(fmt.Sprintf(`\d{6}_\d{4}_%s%s%s$`, strings.ReplaceAll(filename, ".", "\\."), "\\", core.BackupFileExt))
+	reg, err := regexp.Compile(BackupFileNamePattern(filename))
 	if err != nil {
 		err = errors.Wrapf(err, "error compiling regexp for filename")
 		slog.Error("error compiling regexp", slog.String("filename", filename), slog.Any("err", err))
 		panic(err)
 	}
 	names = lo.Filter(names, func(name string, _ int) bool {
-		return reg.MatchString(name)
+		return !IsTransientFileName(name) && reg.MatchString(name)
 	})
-	slices.Sort(names)
+	SortBackupFileNames(names)
 	return names
 }
 
+// SortBackupFileNames sorts the backup names by their base names, then by the full names.
+func SortBackupFileNames(names []string) {
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(strings.Compare(path.Base(a), path.Base(b)), strings.Compare(a, b))
+	})
+}
+
+// BackupFileNamePattern return the regexp matching the managed backup names of filename (without the backup extension).
+// Dots and the tag segment brackets in filename are matched literally.
+func BackupFileNamePattern(filename string) string {
+	// Escape the tag segment.
+	filename = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(filename)
+	return fmt.Sprintf(`\d{6}_\d{4}_%s%s%s$`, strings.ReplaceAll(filename, ".", "\\."), "\\", core.BackupFileExt)
+}
+
+// FormatBackupName return the backup name of filename created at the given time, prefixed by the backup time (060102_1504_).
+func FormatBackupName(t time.Time, filename string) string {
+	return t.Format(BackupTimeLayout+"_") + filename
+}
+
+// ParseBackupTime parses the backup time from the name prefix (060102_1504_).
+// The two-digit year is always in the 2000s, unlike time.Parse which maps 69-99 to the 1900s.
+func ParseBackupTime(name string) (time.Time, bool) {
+	name = filepath.Base(name)
+	if len(name) < len(BackupTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(BackupTimeLayout, name[:len(BackupTimeLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if t.Year() < 2000 {
+		t = t.AddDate(100, 0, 0)
+	}
+	return t, true
+}
+
+// IsTransientFileName check whether the name is an errored or incomplete backup.
+func IsTransientFileName(name string) bool {
+	return strings.HasSuffix(name, ErrorExt) || strings.HasSuffix(name, PartialExt)
+}
+
 func DelFile(path string) error {
 	if info, err := os.Stat(path); err != nil || info.IsDir() {
 		if errors.Is(err, os.ErrNotExist) || info.IsDir() {
@@ -112,15 +190,17 @@ func DelFile(path string) error {
 		}
 		return err
 	}
-	checksum := path + ChecksumExt
 	err := os.Remove(path)
 	if err != nil {
 		return err
 	}
-	if _, err := os.Stat(checksum); errors.Is(err, os.ErrNotExist) {
-		return nil
+	for _, algo := range ChecksumAlgos {
+		err := os.Remove(path + ChecksumFileExt(algo))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
-	return os.Remove(checksum)
+	return nil
 }
 
 func FileExists(path string) (bool, error) {
@@ -134,76 +214,90 @@ func FileExists(path string) (bool, error) {
 	return !info.IsDir(), nil
 }
 
-func CreateFileSHA256Checksum(path string, dest ...string) error {
-	// Write the checksum file first.
-	checksum, err := FileSHA256Checksum(path)
+// CreateFileChecksum creates the checksum file of the file at path, or at dest if specified.
+func CreateFileChecksum(path string, algo string, dest ...string) error {
+	checksum, err := FileChecksum(path, algo)
 	if err != nil {
 		return err
 	}
-	destChecksum := path + ChecksumExt
+	destChecksum := path + ChecksumFileExt(algo)
 	if len(dest) > 0 {
 		destChecksum = dest[0]
 	}
+	return WriteChecksum(destChecksum, checksum)
+}
 
-	err = (func() (err error) {
-		fi, err := os.Create(destChecksum)
-		if err != nil {
-			return err
-		}
-		defer func() {
-			cerr := fi.Close()
-			if err == nil {
-				err = cerr
-			}
-		}()
-		_, err = fi.WriteString(hex.EncodeToString(checksum))
+// WriteChecksum write the hex encoded checksum to the checksum file.
+func WriteChecksum(destChecksum string, checksum []byte) (err error) {
+	fi, err := os.Create(destChecksum)
+	if err != nil {
 		return err
-	})()
+	}
+	defer func() {
+		cerr := fi.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	_, err = fi.WriteString(hex.EncodeToString(checksum))
 	return err
 }
 
-// VerifyFileSHA256Checksum verify the check sum specified in ChecksumExt file.
+// VerifyFileChecksum verify the checksum specified in the checksum file of the file, of whichever algorithm exists.
 // If the checksum file is not found or is empty, then the verification is skipped.
-// If the checksum is mismatched, then it generates a BadChecksumExt file contains current checksum.
-func VerifyFileSHA256Checksum(path string) error {
-	destChecksum := path + ChecksumExt
-	exists, err := FileExists(destChecksum)
-	if !exists {
+// If the checksum is mismatched, then it generates a bad checksum file (.<algo>.bad) contains current checksum.
+func VerifyFileChecksum(path string) error {
+	destChecksum, algo, err := FindChecksumFile(path)
+	if destChecksum == "" {
 		return err
 	}
-
-	b, err := os.ReadFile(destChecksum)
+	fileChecksum, err := FileChecksum(path, algo)
 	if err != nil {
 		return err
 	}
-	checksum := string(b)
-	if checksum == "" {
+	return VerifyChecksum(path, algo, fileChecksum)
+}
+
+// VerifyChecksum compares the already computed checksum of the file at path to its checksum file of the algorithm,
+// so the file is not read again. Same as VerifyFileChecksum, the verification is skipped if algo is empty,
+// or the checksum file is not found or is empty, and a bad checksum file is generated on mismatch.
+func VerifyChecksum(path string, algo string, fileChecksum []byte) error {
+	if algo == "" {
 		return nil
 	}
-
-	fileChecksum, err := FileSHA256Checksum(path)
+	b, err := os.ReadFile(path + ChecksumFileExt(algo))
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
 		return err
 	}
-	fileChecksumHex := hex.EncodeToString(fileChecksum)
-	if checksum == fileChecksumHex {
+	checksum := string(b)
+	if checksum == "" {
+		return nil
+	}
+	if checksum == hex.EncodeToString(fileChecksum) {
 		return nil
 	}
 
 	// Write current checksum to the bad checksum file.
-	err = (func() (err error) {
-		fi, err := os.Create(destChecksum)
-		if err != nil {
-			return err
-		}
-		defer func() {
-			cerr := fi.Close()
-			if err == nil {
-				err = cerr
-			}
-		}()
-		_, err = fi.WriteString(fileChecksumHex)
-		return err
-	})()
+	err = WriteChecksum(path+BadChecksumFileExt(algo), fileChecksum)
 	return errors.Join(ErrChecksumMismatch, err)
 }
+
+// CheckDirWritable check that the directory exists and a file can be created inside it.
+func CheckDirWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.Wrapf(err, "error accessing dir %s", dir)
+	}
+	if !info.IsDir() {
+		return errors.Newf("not a directory: %s", dir)
+	}
+	tmp, err := os.CreateTemp(dir, ".sin-check-")
+	if err != nil {
+		return errors.Wrapf(err, "dir %s is not writable", dir)
+	}
+	_ = tmp.Close()
+	return os.Remove(tmp.Name())
+}
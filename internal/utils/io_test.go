@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterBackupFileNames(t *testing.T) {
+	names := []string{
+		"260102_0000_db.sinbak",
+		"260101_0000_db.sinbak",
+		"260103_0000_db.sinbak" + ErrorExt,
+		"260103_0000_db.sinbak" + PartialExt,
+		"260101_0000_db.sinbak" + ChecksumFileExt("sha256"),
+		"260101_0000_other.sinbak",
+		"260101_0000_[daily] db.sinbak",
+		"db.sinbak",
+	}
+	want := []string{"260101_0000_db.sinbak", "260102_0000_db.sinbak"}
+	if got := FilterBackupFileNames(names, "db"); !slices.Equal(got, want) {
+		t.Errorf("FilterBackupFileNames() = %v, want %v", got, want)
+	}
+}
+
+func TestIsTransientFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "260101_0000_db.sinbak", want: false},
+		{name: "260101_0000_db.sinbak" + ErrorExt, want: true},
+		{name: "260101_0000_db.sinbak" + PartialExt, want: true},
+		{name: "260101_0000_db.error.sinbak", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientFileName(tt.name); got != tt.want {
+				t.Errorf("IsTransientFileName(%s) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
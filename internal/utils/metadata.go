@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/mawngo/go-errors"
+	"os"
+	"time"
+)
+
+// MetadataExt suffix of the backup metadata file.
+const MetadataExt = ".meta.json"
+
+// BackupMetadata describes how a backup was created, for choosing the right way to restore it.
+type BackupMetadata struct {
+	// Name the name of the backup process.
+	Name string `json:"name"`
+	// Engine the type of backup (file, pg, mongo).
+	Engine string `json:"engine"`
+	// EngineVersion the version of the dump tool, if any.
+	EngineVersion string `json:"engineVersion,omitempty"`
+	// Revision the revision of sin that created the backup.
+	Revision string `json:"revision"`
+	// Source the backup source, with credentials redacted.
+	Source string `json:"source"`
+	// Format the output format of the dump tool, if any.
+	Format string `json:"format,omitempty"`
+	// Compression the compression algorithm/command, empty if not compressed.
+	Compression string `json:"compression,omitempty"`
+	// Encryption the encryption algorithm, empty if not encrypted.
+	Encryption string `json:"encryption,omitempty"`
+	// Size the size of the backup file in bytes.
+	Size int64 `json:"size"`
+	// Checksum the hex encoded checksum of the backup file, using ChecksumAlgo.
+	Checksum string `json:"checksum"`
+	// ChecksumAlgo the algorithm of Checksum, sha256 if empty.
+	ChecksumAlgo string `json:"checksumAlgo,omitempty"`
+	// ContentChecksum the hex encoded SHA256 checksum of the decompressed content, if compressed and enabled.
+	ContentChecksum string    `json:"contentChecksum,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// WriteBackupMetadata writes the metadata into the file at path.
+func WriteBackupMetadata(path string, metadata BackupMetadata) error {
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "error encoding metadata")
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrapf(err, "error writing metadata file %s", path)
+	}
+	return nil
+}
+
+// ReadBackupMetadata reads the metadata from the file at path.
+func ReadBackupMetadata(path string) (BackupMetadata, error) {
+	metadata := BackupMetadata{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return metadata, errors.Wrapf(err, "error reading metadata file %s", path)
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return metadata, errors.Wrapf(err, "error decoding metadata file %s", path)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/mawngo/go-errors"
+	"os"
+	"path"
+	"slices"
+)
+
+// SignatureExt suffix of the signature file of the backup checksum.
+const SignatureExt = ".sig"
+
+// signatureContext prefixes the signed message, so the signature cannot be reused for other purposes.
+const signatureContext = "sin-backup-checksum-v2"
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// BackupSignature the signature of the checksum of a backup, stored as json in the signature file.
+type BackupSignature struct {
+	// Name the backup name the checksum is signed for, see SignatureName.
+	Name string `json:"name"`
+	// ChecksumAlgo the algorithm of Checksum.
+	ChecksumAlgo string `json:"checksumAlgo"`
+	// Checksum the hex encoded checksum of the backup file.
+	Checksum string `json:"checksum"`
+	// Signature the Ed25519 signature of the checksum.
+	Signature []byte `json:"signature"`
+}
+
+// SignatureName return the name of the backup that is signed, without the directory and the encryption extension,
+// so a signed backup cannot be passed off as another (e.g. an older backup replacing the latest).
+func SignatureName(name string) string {
+	name, _ = DecryptedFileName(path.Base(name))
+	return name
+}
+
+// SignChecksum signs the checksum of a backup named name.
+func SignChecksum(key ed25519.PrivateKey, name string, algo string, checksum []byte) BackupSignature {
+	sig := BackupSignature{Name: SignatureName(name), ChecksumAlgo: algo, Checksum: hex.EncodeToString(checksum)}
+	sig.Signature = ed25519.Sign(key, sig.message())
+	return sig
+}
+
+// Rename re-signs the signature for the backup renamed to name, after checking the signature using the public key of key.
+// Return ErrInvalidSignature if the signature is invalid.
+func (s BackupSignature) Rename(key ed25519.PrivateKey, name string) (BackupSignature, error) {
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), s.message(), s.Signature) {
+		return s, ErrInvalidSignature
+	}
+	s.Name = SignatureName(name)
+	s.Signature = ed25519.Sign(key, s.message())
+	return s, nil
+}
+
+func (s BackupSignature) message() []byte {
+	return []byte(signatureContext + "\n" + s.Name + "\n" + s.ChecksumAlgo + "\n" + s.Checksum)
+}
+
+// Verify checks the signature using the public key and that it is signed for the backup named name,
+// then compares the signed checksum to the checksum of the backup.
+// Return ErrInvalidSignature if the signature is invalid, ErrChecksumMismatch if the checksum does not match.
+func (s BackupSignature) Verify(key ed25519.PublicKey, name string, checksum []byte) error {
+	if !ed25519.Verify(key, s.message(), s.Signature) {
+		return ErrInvalidSignature
+	}
+	if expected := SignatureName(name); expected != s.Name {
+		return errors.Wrapf(ErrInvalidSignature, "signed for %s, got %s", s.Name, expected)
+	}
+	if actual := hex.EncodeToString(checksum); actual != s.Checksum {
+		return errors.Wrapf(ErrChecksumMismatch, "signed checksum %s, got %s", s.Checksum, actual)
+	}
+	return nil
+}
+
+// WriteBackupSignature writes the signature into the file at path.
+func WriteBackupSignature(path string, sig BackupSignature) error {
+	b, err := json.Marshal(sig)
+	if err != nil {
+		return errors.Wrapf(err, "error encoding signature")
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrapf(err, "error writing signature file %s", path)
+	}
+	return nil
+}
+
+// ParseBackupSignature decodes the content of the signature file.
+func ParseBackupSignature(b []byte) (BackupSignature, error) {
+	sig := BackupSignature{}
+	if err := json.Unmarshal(b, &sig); err != nil {
+		return sig, errors.Wrapf(ErrInvalidSignature, "error decoding signature file: %s", err)
+	}
+	if sig.Name == "" || !slices.Contains(ChecksumAlgos, sig.ChecksumAlgo) || len(sig.Signature) != ed25519.SignatureSize {
+		return sig, errors.Wrapf(ErrInvalidSignature, "malformed signature file")
+	}
+	return sig, nil
+}
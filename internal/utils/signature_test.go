@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/mawngo/go-errors"
+	"sin/internal/core"
+	"testing"
+)
+
+func TestBackupSignatureVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "260101_0000_db.sinbak"
+	checksum := sha256.Sum256([]byte("backup content"))
+	otherChecksum := sha256.Sum256([]byte("other content"))
+
+	tests := []struct {
+		name string
+		// sig the signature to verify, signed for name with the checksum by default.
+		sig      func() BackupSignature
+		key      ed25519.PublicKey
+		backup   string
+		checksum []byte
+		wantErr  error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "valid with directory and encryption extension",
+			sig: func() BackupSignature {
+				return SignChecksum(key, "dir/260101_0000_db.enc.sinbak", core.ChecksumSHA256, checksum[:])
+			},
+			backup: "260101_0000_db.age.sinbak",
+		},
+		{
+			name:     "checksum mismatch",
+			checksum: otherChecksum[:],
+			wantErr:  ErrChecksumMismatch,
+		},
+		{
+			name: "tampered checksum",
+			sig: func() BackupSignature {
+				sig := SignChecksum(key, name, core.ChecksumSHA256, checksum[:])
+				sig.Checksum = "00" + sig.Checksum[2:]
+				return sig
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "tampered name",
+			sig: func() BackupSignature {
+				sig := SignChecksum(key, name, core.ChecksumSHA256, checksum[:])
+				sig.Name = "260201_0000_db.sinbak"
+				return sig
+			},
+			backup:  "260201_0000_db.sinbak",
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "signed for another backup",
+			backup:  "260201_0000_db.sinbak",
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "wrong key",
+			key:     otherPub,
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := SignChecksum(key, name, core.ChecksumSHA256, checksum[:])
+			if tt.sig != nil {
+				sig = tt.sig()
+			}
+			if tt.key == nil {
+				tt.key = pub
+			}
+			if tt.backup == "" {
+				tt.backup = name
+			}
+			if tt.checksum == nil {
+				tt.checksum = checksum[:]
+			}
+			err := sig.Verify(tt.key, tt.backup, tt.checksum)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Verify() error = %s, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackupSignatureRename(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := sha256.Sum256([]byte("backup content"))
+	sig := SignChecksum(key, "260101_0000_db.sinbak", core.ChecksumSHA256, checksum[:])
+
+	renamed, err := sig.Rename(key, "260101_0000_[keep] db.sinbak")
+	if err != nil {
+		t.Fatalf("Rename() error = %s", err)
+	}
+	if err := renamed.Verify(pub, "260101_0000_[keep] db.sinbak", checksum[:]); err != nil {
+		t.Errorf("Verify() renamed error = %s", err)
+	}
+	if err := renamed.Verify(pub, "260101_0000_db.sinbak", checksum[:]); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() old name error = %v, want %v", err, ErrInvalidSignature)
+	}
+	if _, err := sig.Rename(otherKey, "260101_0000_[keep] db.sinbak"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Rename() with another key error = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestParseBackupSignature(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := sha256.Sum256([]byte("backup content"))
+	valid, err := json.Marshal(SignChecksum(key, "260101_0000_db.sinbak", core.ChecksumSHA256, checksum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unnamed := SignChecksum(key, "260101_0000_db.sinbak", core.ChecksumSHA256, checksum[:])
+	unnamed.Name = ""
+	v1, err := json.Marshal(unnamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{name: "valid", content: valid},
+		{name: "empty", content: nil, wantErr: ErrInvalidSignature},
+		{name: "not json", content: []byte("signature"), wantErr: ErrInvalidSignature},
+		{name: "missing signature", content: []byte(`{"name":"260101_0000_db.sinbak","checksumAlgo":"sha256","checksum":"00"}`), wantErr: ErrInvalidSignature},
+		{name: "unknown checksum algo", content: []byte(`{"name":"260101_0000_db.sinbak","checksumAlgo":"md5","checksum":"00"}`), wantErr: ErrInvalidSignature},
+		{name: "missing name", content: v1, wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBackupSignature(tt.content)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("ParseBackupSignature() error = %s, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseBackupSignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
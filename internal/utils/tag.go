@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/mawngo/go-errors"
+	"github.com/samber/lo"
+	"log/slog"
+	"regexp"
+	"sin/internal/core"
+	"slices"
+	"strings"
+)
+
+// NormalizeTags sorts and removes duplicated tags,
+// so the same set of tags always produces the same backup file name.
+func NormalizeTags(tags []string) []string {
+	tags = lo.Uniq(tags)
+	slices.Sort(tags)
+	return tags
+}
+
+// ValidateTags check whether tags can be used in backup file name.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.New("tag must not be empty")
+		}
+		if strings.ContainsAny(tag, "[],/\\") {
+			return errors.Newf("invalid tag '%s': must not contains any of '[],/\\'", tag)
+		}
+	}
+	return nil
+}
+
+// FormatTags return the tag segment of backup file name, or empty if there are no tags.
+func FormatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", strings.Join(NormalizeTags(tags), ","))
+}
+
+// FilterBackupFileNamesByTags filters out non-managed backup files, or backup files that do not have all the tags,
+// and sorts the remaining result based on alphabetical order.
+// Unlike FilterBackupFileNames, the filename must not contain the tag segment.
+func FilterBackupFileNamesByTags(names []string, filename string, tags []string) []string {
+	if len(tags) == 0 {
+		return FilterBackupFileNames(names, filename)
+	}
+	if len(names) == 0 {
+		return names
+	}
+	reg, err := regexp.Compile(fmt.Sprintf(`\d{6}_\d{4}_\[([^\]]*)\] %s%s%s$`, strings.ReplaceAll(filename, ".", "\\."), "\\", core.BackupFileExt))
+	if err != nil {
+		err = errors.Wrapf(err, "error compiling regexp for filename")
+		slog.Error("error compiling regexp", slog.String("filename", filename), slog.Any("err", err))
+		panic(err)
+	}
+	names = lo.Filter(names, func(name string, _ int) bool {
+		if IsTransientFileName(name) {
+			return false
+		}
+		match := reg.FindStringSubmatch(name)
+		if match == nil {
+			return false
+		}
+		fileTags := strings.Split(match[1], ",")
+		return lo.Every(fileTags, tags)
+	})
+	SortBackupFileNames(names)
+	return names
+}
+
+var tagSegmentRegex = regexp.MustCompile(`^\d{6}_\d{4}_\[([^\]]*)\] `)
+
+// ParseTags return the tags of backup file name.
+func ParseTags(name string) []string {
+	match := tagSegmentRegex.FindStringSubmatch(name)
+	if match == nil {
+		return nil
+	}
+	return strings.Split(match[1], ",")
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{"weekly", "prod", "weekly"})
+	if want := []string{"prod", "weekly"}; !slices.Equal(got, want) {
+		t.Errorf("NormalizeTags() = %v, want %v", got, want)
+	}
+	if got := FormatTags([]string{"weekly", "prod"}); got != "[prod,weekly] " {
+		t.Errorf("FormatTags() = %q, want %q", got, "[prod,weekly] ")
+	}
+	if got := FormatTags(nil); got != "" {
+		t.Errorf("FormatTags(nil) = %q, want empty", got)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		tag     string
+		wantErr bool
+	}{
+		{tag: "daily"},
+		{tag: "env-prod_1"},
+		{tag: "", wantErr: true},
+		{tag: "a,b", wantErr: true},
+		{tag: "[a]", wantErr: true},
+		{tag: "a/b", wantErr: true},
+		{tag: `a\b`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if err := ValidateTags([]string{tt.tag}); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTags(%q) error = %v, want error %v", tt.tag, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "260101_0000_[daily] db.sinbak", want: []string{"daily"}},
+		{name: "260101_0000_[prod,weekly] db.sinbak", want: []string{"prod", "weekly"}},
+		{name: "260101_0000_db.sinbak", want: nil},
+		{name: "db [daily].sinbak", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseTags(tt.name); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBackupFileNamesByTags(t *testing.T) {
+	names := []string{
+		"260103_0000_db.sinbak",
+		"260102_0000_[daily] db.sinbak",
+		"260101_0000_[daily,prod] db.sinbak",
+		"260101_0000_[prod,weekly] db.sinbak",
+		"260101_0000_[daily] other.sinbak",
+		"260104_0000_[daily] db.sinbak" + PartialExt,
+	}
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{name: "no tags", want: []string{"260103_0000_db.sinbak"}},
+		{name: "single tag", tags: []string{"daily"}, want: []string{"260101_0000_[daily,prod] db.sinbak", "260102_0000_[daily] db.sinbak"}},
+		{name: "all tags", tags: []string{"prod", "daily"}, want: []string{"260101_0000_[daily,prod] db.sinbak"}},
+		{name: "missing tag", tags: []string{"monthly"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterBackupFileNamesByTags(slices.Clone(names), "db", tt.tags); !slices.Equal(got, tt.want) {
+				t.Errorf("FilterBackupFileNamesByTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBackupFileNamesTagSegment(t *testing.T) {
+	// Compaction filters by the full name including the tag segment, so each set of tags is counted separately.
+	names := []string{
+		"260101_0000_[daily] db.sinbak",
+		"260102_0000_[daily,weekly] db.sinbak",
+		"260103_0000_db.sinbak",
+	}
+	want := []string{"260101_0000_[daily] db.sinbak"}
+	if got := FilterBackupFileNames(names, FormatTags([]string{"daily"})+"db"); !slices.Equal(got, want) {
+		t.Errorf("FilterBackupFileNames() = %v, want %v", got, want)
+	}
+}
@@ -1,13 +1,25 @@
 package utils
 
 import (
-	"crypto/sha256"
+	"context"
+	"github.com/mawngo/go-errors"
 	"github.com/mitchellh/mapstructure"
 	"io"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// configRefPattern matches the ${ENV_VAR} and ${file:/path} references in config values,
+// and the same references escaped as $${ENV_VAR} and $${file:/path}.
+var configRefPattern = regexp.MustCompile(`\$(\$)?\{(?:file:([^}]+)|([A-Za-z_][A-Za-z0-9_]*))}`)
+
+// MapToStruct decodes the config map into s, expanding the ${ENV_VAR} and ${file:/path} references in string values.
 func MapToStruct(m map[string]any, s any) error {
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		TagName: "json",
@@ -17,6 +29,7 @@ func MapToStruct(m map[string]any, s any) error {
 		Result:           &s,
 		WeaklyTypedInput: true,
 		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			expandRefHook,
 			mapstructure.StringToTimeDurationHookFunc(),
 			mapstructure.StringToSliceHookFunc(","),
 		),
@@ -27,20 +40,150 @@ func MapToStruct(m map[string]any, s any) error {
 	return decoder.Decode(m)
 }
 
-func FileSHA256Checksum(path string) ([]byte, error) {
+// expandRefHook expands the references in string values:
+// ${ENV_VAR} to the value of the environment variable, and ${file:/path} to the content of the file
+// without the trailing newline, such as a Docker or Kubernetes secret.
+// Referencing an unset variable or an unreadable file is an error, so a missing secret is not silently used as empty.
+// Escaped references ($${ENV_VAR}) are kept literally, without the escaping $.
+func expandRefHook(f reflect.Kind, _ reflect.Kind, data any) (any, error) {
+	if f != reflect.String {
+		return data, nil
+	}
+	var err error
+	expanded := configRefPattern.ReplaceAllStringFunc(data.(string), func(ref string) string {
+		match := configRefPattern.FindStringSubmatch(ref)
+		if match[1] != "" {
+			return ref[1:]
+		}
+		if path := match[2]; path != "" {
+			b, ferr := os.ReadFile(path)
+			if ferr != nil && err == nil {
+				err = errors.Wrapf(ferr, "error reading file %s referenced in config", path)
+			}
+			return strings.TrimRight(string(b), "\r\n")
+		}
+		value, ok := os.LookupEnv(match[3])
+		if !ok && err == nil {
+			err = errors.Newf("environment variable %s referenced in config is not set", match[3])
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// FileChecksum compute the checksum of the file using the algorithm.
+func FileChecksum(path string, algo string) ([]byte, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	h := sha256.New()
+	h := NewChecksumHash(algo)
 	if _, err := io.Copy(h, f); err != nil {
 		return nil, err
 	}
 	return h.Sum(nil), nil
 }
 
+// ChecksumResult the result of hashing a file in a batch.
+type ChecksumResult struct {
+	Path     string
+	Checksum []byte
+	Err      error
+}
+
+// BatchFileChecksum compute the checksum of files using a pool of workers.
+// The results are sorted by path, regardless of the order of completion.
+func BatchFileChecksum(ctx context.Context, paths []string, workers int, hash func(path string) ([]byte, error)) []ChecksumResult {
+	workers = max(min(workers, len(paths)), 1)
+	results := make([]ChecksumResult, len(paths))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i].Path = paths[i]
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Checksum, results[i].Err = hash(paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	slices.SortFunc(results, func(a, b ChecksumResult) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return results
+}
+
+// FormatBytes formats the size in bytes into human-readable form, using binary units.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(size)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "iB"
+}
+
+// ParseAge parses the age, which is a go duration also supporting a leading number of days, e.g. 30d, 1d12h or 36h.
+func ParseAge(s string) (time.Duration, error) {
+	days, rest, found := strings.Cut(s, "d")
+	if !found {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.Newf("invalid age '%s'", s)
+		}
+		return d, nil
+	}
+	n, err := strconv.ParseUint(days, 10, 16)
+	if err != nil {
+		return 0, errors.Newf("invalid age '%s'", s)
+	}
+	age := time.Duration(n) * 24 * time.Hour
+	if rest == "" {
+		return age, nil
+	}
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, errors.Newf("invalid age '%s'", s)
+	}
+	return age + d, nil
+}
+
+// FormatAge formats the duration into a short human-readable age using the two largest units, e.g. 3d4h, 5h12m or 42s.
+func FormatAge(d time.Duration) string {
+	d = max(d, 0).Round(time.Second)
+	days := int64(d / (24 * time.Hour))
+	hours := int64(d/time.Hour) % 24
+	minutes := int64(d/time.Minute) % 60
+	seconds := int64(d/time.Second) % 60
+	switch {
+	case days > 0:
+		return strconv.FormatInt(days, 10) + "d" + strconv.FormatInt(hours, 10) + "h"
+	case hours > 0:
+		return strconv.FormatInt(hours, 10) + "h" + strconv.FormatInt(minutes, 10) + "m"
+	case minutes > 0:
+		return strconv.FormatInt(minutes, 10) + "m" + strconv.FormatInt(seconds, 10) + "s"
+	default:
+		return strconv.FormatInt(seconds, 10) + "s"
+	}
+}
+
 func IsNumeric(str string) bool {
 	if _, err := strconv.Atoi(str); err == nil {
 		return true
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapToStructExpandRefs(t *testing.T) {
+	t.Setenv("SIN_TEST_SECRET", "s3cret")
+	t.Setenv("SIN_TEST_EMPTY", "")
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("file-s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "env", value: "${SIN_TEST_SECRET}", want: "s3cret"},
+		{name: "env inside value", value: "prefix/${SIN_TEST_SECRET}/db", want: "prefix/s3cret/db"},
+		{name: "empty env", value: "${SIN_TEST_EMPTY}", want: ""},
+		{name: "missing env", value: "${SIN_TEST_MISSING}", wantErr: true},
+		{name: "file", value: "${file:" + secretFile + "}", want: "file-s3cret"},
+		{name: "file and env", value: "${SIN_TEST_SECRET}:${file:" + secretFile + "}", want: "s3cret:file-s3cret"},
+		{name: "missing file", value: "${file:" + filepath.Join(dir, "missing") + "}", wantErr: true},
+		{name: "unreadable file", value: "${file:" + dir + "}", wantErr: true},
+		{name: "escaped file", value: "$${file:/run/secrets/s3}", want: "${file:/run/secrets/s3}"},
+		{name: "literal", value: "pa$$word$", want: "pa$$word$"},
+		{name: "literal not a reference", value: "${1abc} $SIN_TEST_SECRET", want: "${1abc} $SIN_TEST_SECRET"},
+		{name: "escaped", value: "$${SIN_TEST_SECRET}", want: "${SIN_TEST_SECRET}"},
+		{name: "escaped missing env", value: "$${SIN_TEST_MISSING}", want: "${SIN_TEST_MISSING}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Value string `json:"value"`
+			}
+			err := MapToStruct(map[string]any{"value": tt.value}, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MapToStruct() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Value != tt.want {
+				t.Errorf("MapToStruct() value = %q, want %q", got.Value, tt.want)
+			}
+		})
+	}
+}